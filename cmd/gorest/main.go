@@ -1,27 +1,39 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/rnov/Go-REST/pkg/auth"
 	infra "github.com/rnov/Go-REST/pkg/config"
 	"github.com/rnov/Go-REST/pkg/db"
+	"github.com/rnov/Go-REST/pkg/db/redis"
 	"github.com/rnov/Go-REST/pkg/http/rest"
+	"github.com/rnov/Go-REST/pkg/http/server"
 	"github.com/rnov/Go-REST/pkg/logger"
+	"github.com/rnov/Go-REST/pkg/metrics"
+	"github.com/rnov/Go-REST/pkg/ratelimit"
+	"github.com/rnov/Go-REST/pkg/search"
 	"github.com/rnov/Go-REST/pkg/service"
+	"github.com/rnov/Go-REST/pkg/tracing"
 )
 
 const (
 	EnvVarPath = "ENV_PATH"
+	// tracingFlushTimeout - time given to export the pending spans once the servers have stopped.
+	tracingFlushTimeout = 5 * time.Second
 )
 
 func main() {
 	fmt.Println("Hello, 世界")
 
-	l := logger.NewLogger()
+	// logs to stdout until the configured logger is set up
+	l := logger.NewJSONLogger("goREST", os.Stdout, logger.InfoLevel)
 
 	// load app config
 	envConfigPath, present := os.LookupEnv(EnvVarPath)
@@ -35,25 +47,98 @@ func main() {
 	if err != nil {
 		l.Fatal("error reading configuration " + envConfigPath + ": " + err.Error())
 	}
+	configured, err := logger.New(cfg.Logger, cfg.LogsPath)
+	if err != nil {
+		l.Fatal("error configuring logger: " + err.Error())
+	}
+	l = configured
+	defer l.Close()
+	if cfg.RedisLog.Active {
+		rl, err := logger.New(cfg.RedisLog, cfg.LogsPath)
+		if err != nil {
+			l.Fatal("error configuring redis logger: " + err.Error())
+		}
+		defer rl.Close()
+		redis.SetLogger(log.New(rl.Writer(logger.InfoLevel), "", 0))
+	}
+
+	m := metrics.New()
+	tp, err := tracing.NewProvider(cfg.Tracing)
+	if err != nil {
+		l.Fatal("error configuring tracing: " + err.Error())
+	}
 
-	// create DB client
-	dbClient, err := db.NewClient(cfg.DBCfg)
+	// create DB client, every call is recorded and traced
+	backend, err := db.NewClient(cfg.DBCfg)
 	if err != nil {
 		l.Fatal(err.Error())
 	}
+	dbClient := metrics.NewDBClient(db.NewTracedClient(backend), m)
 
 	// get auth accessor
-	authorization := auth.NewAuth(dbClient, l)
+	authorization, err := auth.NewAuth(dbClient, l, cfg.Auth)
+	if err != nil {
+		l.Fatal("error configuring authentication: " + err.Error())
+	}
 	// In this case recipe and rate share same DB and logger but could be different ones
-	RecipeSrv := service.NewRecipe(dbClient)
+	RecipeSrv := service.NewRecipe(dbClient, search.NewInvertedIndex())
+	if err := RecipeSrv.BuildIndex(); err != nil {
+		l.Fatal("error building search index: " + err.Error())
+	}
 	RateSrv := service.NewRate(dbClient)
+	KeySrv := service.NewAPIKey(dbClient)
 
 	// Create handlers
 	rcpHandler := rest.NewRecipeHandler(RecipeSrv, l)
 	rateHandler := rest.NewRateHandler(RateSrv, l)
+	keyHandler := rest.NewAPIKeyHandler(KeySrv, l)
+	var authHandler *rest.AuthHandler
+	if authorization.Accepts(auth.Bearer) {
+		authHandler = rest.NewAuthHandler(authorization, l)
+	}
 
-	r := rest.NewRouter(rcpHandler, rateHandler, authorization)
+	limiter, err := ratelimit.NewLimiter(cfg.RateLimit)
+	if err != nil {
+		l.Fatal("error configuring rate limits: " + err.Error())
+	}
+
+	r := rest.NewRouter(rcpHandler, rateHandler, authHandler, keyHandler, metrics.NewValidator(authorization, m),
+		limiter, l, m)
 
-	// Fire up the server
-	log.Fatal(http.ListenAndServe(cfg.Server.Address, r))
+	// Fire up the servers, until told to stop
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	srv, err := server.New(cfg.Server, r, l)
+	if err != nil {
+		l.Fatal("error configuring server: " + err.Error())
+	}
+	metricsSrv, err := metrics.NewServer(cfg.Metrics, m, l)
+	if err != nil {
+		l.Fatal("error configuring metrics server: " + err.Error())
+	}
+	// the metrics are served until the API has shut down, in-flight requests included
+	stopMetrics := make(chan os.Signal, 1)
+	metricsDone := make(chan struct{})
+	go func() {
+		defer close(metricsDone)
+		l.Infof("serving metrics on %s", metricsSrv.Addr())
+		if err := metricsSrv.Run(stopMetrics); err != nil {
+			l.Errorf("error serving metrics: %s", err.Error())
+		}
+	}()
+	l.Infof("listening on %s", cfg.Server.Address)
+	if err := srv.Run(stop); err != nil {
+		l.Errorf("error serving: %s", err.Error())
+	}
+	stopMetrics <- os.Interrupt
+	<-metricsDone
+	if err := dbClient.Close(); err != nil {
+		l.Errorf("error closing DB client: %s", err.Error())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tracingFlushTimeout)
+	defer cancel()
+	if err := tp.Shutdown(ctx); err != nil {
+		l.Errorf("error exporting spans: %s", err.Error())
+	}
+	l.Info("server stopped")
 }
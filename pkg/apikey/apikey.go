@@ -0,0 +1,76 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/identity"
+)
+
+// PrincipalPrefix - prefix of the username the requests authenticated by a key are made on behalf of, followed by the
+// key ID. Recipes created with a key are owned by it, rotating the key keeps its ID and therefore its ownership.
+const PrincipalPrefix = "apikey:"
+
+// secretLen - random bytes of the secret part of the keys.
+const secretLen = 32
+
+// Key - API key, the key itself is only known by the client: its hash is stored instead. Secret is only set when the key
+// is created or rotated, it is the single time it is shown.
+type Key struct {
+	ID        string                `json:"id"`
+	Name      string                `json:"name"`
+	Role      identity.Role         `json:"role"`
+	Scopes    []identity.Permission `json:"scopes,omitempty"`
+	CreatedBy string                `json:"createdBy"`
+	CreatedAt time.Time             `json:"createdAt"`
+	ExpiresAt *time.Time            `json:"expiresAt,omitempty"`
+	Hash      string                `json:"-"`
+	Secret    string                `json:"key,omitempty"`
+}
+
+// Expired - whether the key has expired at the given time, keys without expiration never do.
+func (k *Key) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// Principal - the principal the requests authenticated by the key are made on behalf of.
+func (k *Key) Principal() *identity.Principal {
+	return &identity.Principal{Username: PrincipalPrefix + k.ID, Role: k.Role, Scopes: k.Scopes}
+}
+
+// Generate - sets a new random secret, along with its hash, into the key. Secrets are prefixed by the key ID so that
+// the key can be looked up given the secret alone.
+func (k *Key) Generate() error {
+	b := make([]byte, secretLen)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	k.Secret = k.ID + "." + base64.RawURLEncoding.EncodeToString(b)
+	k.Hash = Hash(k.Secret)
+	return nil
+}
+
+// Matches - whether the secret is the one the key was generated with, compared in constant time.
+func (k *Key) Matches(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(Hash(secret)), []byte(k.Hash)) == 1
+}
+
+// ParseID - the ID of the key the secret belongs to.
+func ParseID(secret string) (string, bool) {
+	i := strings.Index(secret, ".")
+	if i <= 0 || i == len(secret)-1 {
+		return "", false
+	}
+	return secret[:i], true
+}
+
+// Hash - secrets are random and long enough for an unsalted SHA-256 not to be brute forced, unlike passwords.
+func Hash(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return fmt.Sprintf("%x", h[:])
+}
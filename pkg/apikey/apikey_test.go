@@ -0,0 +1,75 @@
+package apikey
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/identity"
+)
+
+func TestKey_Generate(t *testing.T) {
+	key := &Key{ID: "01EC9V3P6Y8B8XWJ2Q3KZ4M5N6", Role: identity.Editor}
+	if err := key.Generate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.HasPrefix(key.Secret, key.ID+".") || key.Hash != Hash(key.Secret) {
+		t.Errorf("unexpected secret '%s' and hash '%s'", key.Secret, key.Hash)
+	}
+	if ID, ok := ParseID(key.Secret); !ok || ID != key.ID {
+		t.Errorf("expected: '%s' instead got: '%s'", key.ID, ID)
+	}
+	if !key.Matches(key.Secret) {
+		t.Errorf("expected the generated secret to match")
+	}
+
+	previous := key.Secret
+	if err := key.Generate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if key.Matches(previous) {
+		t.Errorf("expected the previous secret not to match once rotated")
+	}
+}
+
+func TestParseID(t *testing.T) {
+	tests := []struct {
+		name       string
+		secret     string
+		expectedID string
+		expectedOk bool
+	}{
+		{name: "valid secret", secret: "01EC9V3P6Y8B8XWJ2Q3KZ4M5N6.c2VjcmV0", expectedID: "01EC9V3P6Y8B8XWJ2Q3KZ4M5N6", expectedOk: true},
+		{name: "missing ID", secret: ".c2VjcmV0"},
+		{name: "missing secret", secret: "01EC9V3P6Y8B8XWJ2Q3KZ4M5N6."},
+		{name: "missing separator", secret: "c2VjcmV0"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ID, ok := ParseID(test.secret)
+			if ID != test.expectedID || ok != test.expectedOk {
+				t.Errorf("expected: '%s', %t instead got: '%s', %t", test.expectedID, test.expectedOk, ID, ok)
+			}
+		})
+	}
+}
+
+func TestKey_Principal(t *testing.T) {
+	now := time.Now()
+	expiresAt := now.Add(time.Hour)
+	key := &Key{ID: "01EC9V3P6Y8B8XWJ2Q3KZ4M5N6", Role: identity.Editor, Scopes: []identity.Permission{identity.CreateRecipe},
+		ExpiresAt: &expiresAt}
+	expected := &identity.Principal{Username: "apikey:01EC9V3P6Y8B8XWJ2Q3KZ4M5N6", Role: identity.Editor,
+		Scopes: []identity.Permission{identity.CreateRecipe}}
+	if p := key.Principal(); !reflect.DeepEqual(p, expected) {
+		t.Errorf("expected: '%v' instead got: '%v'", expected, p)
+	}
+	if key.Expired(now) || !key.Expired(expiresAt) {
+		t.Errorf("unexpected expiration of key expiring at %s", expiresAt)
+	}
+	if (&Key{}).Expired(now) {
+		t.Errorf("expected a key without expiration not to expire")
+	}
+}
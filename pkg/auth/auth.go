@@ -1,43 +1,264 @@
 package auth
 
 import (
+	"context"
 	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/rnov/Go-REST/pkg/apikey"
+	"github.com/rnov/Go-REST/pkg/config"
 	"github.com/rnov/Go-REST/pkg/db"
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
 	"github.com/rnov/Go-REST/pkg/logger"
 )
 
+// authentication schemes, named as in the Authorization header (case insensitive). API keys are sent in their own
+// header instead and client certificates are verified along with the TLS handshake.
+const (
+	Basic      = "basic"
+	Bearer     = "bearer"
+	APIKey     = "apikey"
+	ClientCert = "clientcert"
+)
+
 // Auth is business logic struct for the authorization custom middleware/
 type Auth struct {
-	DB  db.Auth
-	Log logger.Loggers
+	DB      db.Auth
+	Log     logger.Loggers
+	schemes map[string]bool
+	// jwt - issues and verifies the bearer tokens, nil unless the bearer scheme is enabled.
+	jwt *JWT
+	// clientCerts - users by the subject of their client certificate.
+	clientCerts map[string]*identity.Principal
 }
 
-func NewAuth(db db.Auth, l logger.Loggers) *Auth {
-	return &Auth{
-		DB:  db,
-		Log: l,
+// NewAuth - enables the configured schemes, basic auth and API keys when none is given. The JWT signing key is loaded
+// whenever bearer tokens are enabled.
+func NewAuth(db db.Auth, l logger.Loggers, cfg config.AuthConfig) (*Auth, error) {
+	a := &Auth{
+		DB:          db,
+		Log:         l,
+		schemes:     make(map[string]bool),
+		clientCerts: make(map[string]*identity.Principal, len(cfg.ClientCerts)),
+	}
+	schemes := cfg.Schemes
+	if len(schemes) == 0 {
+		schemes = []string{Basic, APIKey}
+	}
+	for _, scheme := range schemes {
+		scheme = strings.ToLower(scheme)
+		if scheme != Basic && scheme != Bearer && scheme != APIKey && scheme != ClientCert {
+			return nil, fmt.Errorf("unsupported authentication scheme '%s'", scheme)
+		}
+		a.schemes[scheme] = true
 	}
+	if a.schemes[Bearer] {
+		jwt, err := NewJWT(cfg.JWT)
+		if err != nil {
+			return nil, err
+		}
+		a.jwt = jwt
+	}
+	for _, cc := range cfg.ClientCerts {
+		role, ok := identity.ParseRole(cc.Role)
+		if len(cc.Subject) == 0 || len(cc.Username) == 0 || !ok {
+			return nil, fmt.Errorf("invalid client certificate user '%s' of subject '%s'", cc.Username, cc.Subject)
+		}
+		a.clientCerts[cc.Subject] = &identity.Principal{Username: cc.Username, Role: role}
+	}
+
+	return a, nil
 }
 
-// Validator - defines all the business logic operations for authorization.
+// Validator - defines all the business logic operations for authorization, on behalf of the request of ctx.
 type Validator interface {
-	Validate(ba string) error
+	Validate(ctx context.Context, scheme, credentials string) (*identity.Principal, error)
+}
+
+// Issuer - exchanges credentials for bearer tokens, on behalf of the request of ctx.
+type Issuer interface {
+	IssueToken(ctx context.Context, ba string) (*Token, error)
+	RefreshToken(ctx context.Context, refresh string) (*Token, error)
+}
+
+// Token - access token along with the refresh token that renews it, as described by RFC 6749 section 5.1. ExpiresIn is
+// the lifetime of the access token in seconds.
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Accepts - whether the authentication scheme is enabled.
+func (a *Auth) Accepts(scheme string) bool {
+	return a.schemes[strings.ToLower(scheme)]
+}
+
+// Validate - validates that a given user is authorized to perform the request, the credentials are checked as told by
+// the scheme. Bearer tokens are verified on their own whereas basic auths and API keys are checked against the DB (see
+// validateBasic and validateAPIKey). The credentials of client certificates are the subject of a certificate already
+// verified by the server, which is only mapped to its user. Returns the user the request is made on behalf of.
+func (a *Auth) Validate(ctx context.Context, scheme, credentials string) (*identity.Principal, error) {
+	scheme = strings.ToLower(scheme)
+	if !a.schemes[scheme] {
+		return nil, errors.NewFailedAuthErr()
+	}
+	switch scheme {
+	case Basic:
+		return a.validateBasic(ctx, credentials)
+	case APIKey:
+		return a.validateAPIKey(ctx, credentials)
+	case ClientCert:
+		principal, ok := a.clientCerts[credentials]
+		if !ok {
+			return nil, errors.NewFailedAuthErr()
+		}
+		p := *principal
+		return &p, nil
+	}
+	claims, err := a.jwt.verify(credentials, accessToken)
+	if err != nil {
+		return nil, errors.NewFailedAuthErr()
+	}
+
+	return &identity.Principal{Username: claims.Subject, Role: claims.Role}, nil
+}
+
+// IssueToken - issues a bearer token on behalf of the user the basic auth belongs to.
+func (a *Auth) IssueToken(ctx context.Context, ba string) (*Token, error) {
+	if a.jwt == nil {
+		return nil, errors.NewFailedAuthErr()
+	}
+	principal, err := a.validateBasic(ctx, ba)
+	if err != nil {
+		return nil, err
+	}
+	return a.issue(principal, 0)
+}
+
+// RefreshToken - issues a new bearer token, along with a new refresh token, on behalf of the user the refresh token
+// belongs to. The user is reloaded from the DB so that its current role is granted, users that no longer exist are
+// rejected. The new refresh token expires along with the given one, refreshing does not extend the session.
+func (a *Auth) RefreshToken(ctx context.Context, refresh string) (*Token, error) {
+	if a.jwt == nil {
+		return nil, errors.NewFailedAuthErr()
+	}
+	claims, err := a.jwt.verify(refresh, refreshToken)
+	if err != nil {
+		return nil, errors.NewFailedAuthErr()
+	}
+	creds, err := a.DB.GetCredentials(ctx, claims.Subject)
+	if _, ok := err.(*errors.ExistErr); ok {
+		return nil, errors.NewFailedAuthErr()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a.issue(&creds.Principal, claims.ExpiresAt)
 }
 
-// Validate - validates that a given user is authorized to perform the request, hashes and compares the result with the ones
-// stored.
-func (a *Auth) Validate(ba string) error {
-	encodedAuth := hash(ba)
-	if err := a.DB.CheckAuth(encodedAuth); err != nil {
-		return err
+// issue - issues the access and refresh tokens on behalf of the user, the refresh token does not outlive expiresAt
+// (unix time) unless it is 0.
+func (a *Auth) issue(p *identity.Principal, expiresAt int64) (*Token, error) {
+	access, ttl, err := a.jwt.issue(p, accessToken)
+	if err != nil {
+		return nil, errors.NewDBErr(fmt.Sprintf("error issuing token: %s", err.Error()))
+	}
+	refresh, _, err := a.jwt.issueBefore(p, refreshToken, expiresAt)
+	if err != nil {
+		return nil, errors.NewDBErr(fmt.Sprintf("error issuing token: %s", err.Error()))
+	}
+
+	return &Token{AccessToken: access, TokenType: "Bearer", ExpiresIn: int64(ttl / time.Second), RefreshToken: refresh}, nil
+}
+
+// validateBasic - the password is compared with the salted hash stored for the user, users without one are checked
+// against their legacy token instead (see legacy).
+func (a *Auth) validateBasic(ctx context.Context, ba string) (*identity.Principal, error) {
+	username, password, ok := decodeBasicAuth(ba)
+	if !ok {
+		return nil, errors.NewFailedAuthErr()
+	}
+	creds, err := a.DB.GetCredentials(ctx, username)
+	if _, ok := err.(*errors.ExistErr); ok {
+		return a.legacy(ctx, ba, username, password)
+	}
+	if err != nil {
+		return nil, err
+	}
+	match, err := ComparePassword(creds.PasswordHash, password)
+	if err != nil {
+		return nil, errors.NewDBErr(fmt.Sprintf("invalid password hash of user '%s': %s", username, err.Error()))
+	}
+	if !match {
+		return nil, errors.NewFailedAuthErr()
+	}
+
+	return &creds.Principal, nil
+}
+
+// validateAPIKey - the key is looked up by the ID it is prefixed with, its hash must match and it must not have expired.
+func (a *Auth) validateAPIKey(ctx context.Context, secret string) (*identity.Principal, error) {
+	ID, ok := apikey.ParseID(secret)
+	if !ok {
+		return nil, errors.NewFailedAuthErr()
+	}
+	key, err := a.DB.GetAPIKey(ctx, ID)
+	if _, ok := err.(*errors.ExistErr); ok {
+		return nil, errors.NewFailedAuthErr()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !key.Matches(secret) || key.Expired(time.Now()) {
+		return nil, errors.NewFailedAuthErr()
+	}
+
+	return key.Principal(), nil
+}
+
+// legacy - checks the unsalted hash of the basic auth against the tokens registered before passwords were stored per
+// user. Once a legacy user authenticates its password is hashed and stored, from then on its token is no longer checked.
+func (a *Auth) legacy(ctx context.Context, ba, username, password string) (*identity.Principal, error) {
+	principal, err := a.DB.CheckAuth(ctx, hash(ba))
+	if err != nil {
+		return nil, err
+	}
+	// tokens belonging to a user other than the one given can not be migrated, they keep being checked
+	if principal.Username != username {
+		return principal, nil
+	}
+	passwordHash, err := HashPassword(password, Argon2id)
+	if err == nil {
+		err = a.DB.SetPassword(ctx, username, passwordHash)
+	}
+	if err != nil {
+		a.Log.Errorf("error migrating legacy token of user '%s': %s", username, err.Error())
+	}
+
+	return principal, nil
+}
+
+// decodeBasicAuth - splits the B64 encoded basic auth into the username and the password.
+func decodeBasicAuth(ba string) (string, string, bool) {
+	decoded, err := base64.StdEncoding.DecodeString(ba)
+	if err != nil {
+		return "", "", false
+	}
+	creds := strings.SplitN(string(decoded), ":", 2)
+	if len(creds) != 2 || len(creds[0]) == 0 {
+		return "", "", false
 	}
 
-	return nil
+	return creds[0], creds[1], true
 }
 
-// hash - hashes incoming basic auths encoded in B64 the result will be used check the DB to authorize a user.
+// hash - hashes incoming basic auths encoded in B64, the result is checked against the legacy tokens.
 func hash(ba string) string {
 	h := sha256.New()
 	h.Write([]byte(ba))
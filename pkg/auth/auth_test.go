@@ -1,57 +1,494 @@
 package auth
 
 import (
+	"context"
 	e "errors"
+	"reflect"
 	"testing"
+	"time"
 
+	"github.com/rnov/Go-REST/pkg/apikey"
+	"github.com/rnov/Go-REST/pkg/config"
 	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
 	"github.com/rnov/Go-REST/pkg/logger"
 )
 
 type authDBMock struct {
-	checkAuth func(auth string) error
+	checkAuth      func(auth string) (*identity.Principal, error)
+	getCredentials func(username string) (*identity.Credentials, error)
+	setPassword    func(username, passwordHash string) error
+	getAPIKey      func(ID string) (*apikey.Key, error)
 }
 
-func (am *authDBMock) CheckAuth(auth string) error {
+func (am *authDBMock) CheckAuth(ctx context.Context, auth string) (*identity.Principal, error) {
 	if am.checkAuth != nil {
 		return am.checkAuth(auth)
 	}
 	panic("Not implemented")
 }
 
+func (am *authDBMock) GetCredentials(ctx context.Context, username string) (*identity.Credentials, error) {
+	if am.getCredentials != nil {
+		return am.getCredentials(username)
+	}
+	panic("Not implemented")
+}
+
+func (am *authDBMock) SetPassword(ctx context.Context, username, passwordHash string) error {
+	if am.setPassword != nil {
+		return am.setPassword(username, passwordHash)
+	}
+	panic("Not implemented")
+}
+
+func (am *authDBMock) GetAPIKey(ctx context.Context, ID string) (*apikey.Key, error) {
+	if am.getAPIKey != nil {
+		return am.getAPIKey(ID)
+	}
+	panic("Not implemented")
+}
+
 func TestAuth_Validate(t *testing.T) {
+	// username:password
+	const ba = "dXNlcm5hbWU6cGFzc3dvcmQ="
+	stored := func(password, algorithm string) func(username string) (*identity.Credentials, error) {
+		passwordHash, err := HashPassword(password, algorithm)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return func(username string) (*identity.Credentials, error) {
+			if username != "username" {
+				return nil, errors.NewExistErr(false)
+			}
+			return &identity.Credentials{Principal: identity.Principal{Username: username, Role: identity.Editor},
+				PasswordHash: passwordHash}, nil
+		}
+	}
+	noCredentials := func(username string) (*identity.Credentials, error) {
+		return nil, errors.NewExistErr(false)
+	}
+	legacyToken := func(auth string) (*identity.Principal, error) {
+		if auth != hash(ba) {
+			return nil, errors.NewFailedAuthErr()
+		}
+		return &identity.Principal{Username: "username", Role: identity.Editor}, nil
+	}
 	tests := []struct {
-		name        string
-		authDB      authDBMock
-		expectedErr error
+		name              string
+		ba                string
+		authDB            authDBMock
+		expectedPrincipal *identity.Principal
+		expectedMigration bool
+		expectedErr       error
 	}{
 		{
-			name: "successful validation",
+			name:              "successful validation - argon2id password",
+			ba:                ba,
+			authDB:            authDBMock{getCredentials: stored("password", Argon2id)},
+			expectedPrincipal: &identity.Principal{Username: "username", Role: identity.Editor},
+		},
+		{
+			name:              "successful validation - bcrypt password",
+			ba:                ba,
+			authDB:            authDBMock{getCredentials: stored("password", Bcrypt)},
+			expectedPrincipal: &identity.Principal{Username: "username", Role: identity.Editor},
+		},
+		{
+			name:              "successful validation - legacy token is migrated",
+			ba:                ba,
+			authDB:            authDBMock{getCredentials: noCredentials, checkAuth: legacyToken},
+			expectedPrincipal: &identity.Principal{Username: "username", Role: identity.Editor},
+			expectedMigration: true,
+		},
+		{
+			name: "successful validation - legacy token of another user is not migrated",
+			ba:   ba,
 			authDB: authDBMock{
-				checkAuth: func(auth string) error {
-					return nil
+				getCredentials: noCredentials,
+				checkAuth: func(auth string) (*identity.Principal, error) {
+					return &identity.Principal{Username: "LongTimeUser", Role: identity.Admin}, nil
 				},
 			},
-			expectedErr: nil,
+			expectedPrincipal: &identity.Principal{Username: "LongTimeUser", Role: identity.Admin},
 		},
 		{
-			name: "error - failed validation",
+			name: "error - wrong password, legacy token is not checked",
+			ba:   ba,
 			authDB: authDBMock{
-				checkAuth: func(auth string) error {
-					return errors.NewFailedAuthErr()
-				},
+				getCredentials: stored("drowssap", Argon2id),
+				checkAuth:      legacyToken,
 			},
 			expectedErr: errors.NewFailedAuthErr(),
 		},
+		{
+			name:        "error - unknown user",
+			ba:          "b3RoZXI6cGFzc3dvcmQ=",
+			authDB:      authDBMock{getCredentials: stored("password", Argon2id), checkAuth: legacyToken},
+			expectedErr: errors.NewFailedAuthErr(),
+		},
+		{
+			name:        "error - malformed basic auth",
+			ba:          "username:password",
+			expectedErr: errors.NewFailedAuthErr(),
+		},
+		{
+			name: "error - malformed password hash",
+			ba:   ba,
+			authDB: authDBMock{
+				getCredentials: func(username string) (*identity.Credentials, error) {
+					return &identity.Credentials{PasswordHash: "$argon2id$v=19$m=x"}, nil
+				},
+			},
+			expectedErr: errors.NewDBErr("invalid password hash of user 'username': malformed argon2id hash"),
+		},
+		{
+			name: "error - DB retrieving credentials",
+			ba:   ba,
+			authDB: authDBMock{
+				getCredentials: func(username string) (*identity.Credentials, error) {
+					return nil, errors.NewDBErr("DB issue")
+				},
+			},
+			expectedErr: errors.NewDBErr("DB issue"),
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
+			var migrated string
+			test.authDB.setPassword = func(username, passwordHash string) error {
+				if match, err := ComparePassword(passwordHash, "password"); err != nil || !match {
+					return e.New("unexpected password hash")
+				}
+				migrated = username
+				return nil
+			}
 			l := logger.NewLogger()
-			auth := NewAuth(&test.authDB, l)
-			err := auth.Validate("dXNlcm5hbWU6cGFzc3dvcmQ=")
-			if err != nil && !e.Is(err, test.expectedErr) {
-				t.Errorf("error validation, unexpected error type")
+			auth, err := NewAuth(&test.authDB, l, config.AuthConfig{})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			principal, err := auth.Validate(context.Background(), "Basic", test.ba)
+			if err != nil && (test.expectedErr == nil || err.Error() != test.expectedErr.Error()) {
+				t.Errorf("expected: '%v' instead got: '%s'", test.expectedErr, err)
+			}
+			if err == nil && test.expectedErr != nil {
+				t.Errorf("expected: '%s' instead got nil", test.expectedErr)
+			}
+			if !reflect.DeepEqual(principal, test.expectedPrincipal) {
+				t.Errorf("expected: '%v' instead got: '%v'", test.expectedPrincipal, principal)
+			}
+			if (migrated == "username") != test.expectedMigration {
+				t.Errorf("expected migration: %t instead got: '%s'", test.expectedMigration, migrated)
+			}
+		})
+	}
+}
+
+func TestNewAuth(t *testing.T) {
+	secret := "0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		name            string
+		cfg             config.AuthConfig
+		expectedSchemes []string
+		expectedErr     bool
+	}{
+		{name: "basic and API keys by default", expectedSchemes: []string{Basic, APIKey}},
+		{
+			name:            "basic and bearer",
+			cfg:             config.AuthConfig{Schemes: []string{"Basic", "bearer"}, JWT: config.JWTConfig{Algorithm: HS256, Secret: secret}},
+			expectedSchemes: []string{Basic, Bearer},
+		},
+		{
+			name:            "API keys only",
+			cfg:             config.AuthConfig{Schemes: []string{"apikey"}},
+			expectedSchemes: []string{APIKey},
+		},
+		{
+			name:            "bearer only",
+			cfg:             config.AuthConfig{Schemes: []string{"bearer"}, JWT: config.JWTConfig{Algorithm: HS256, Secret: secret}},
+			expectedSchemes: []string{Bearer},
+		},
+		{
+			name: "basic and client certificates",
+			cfg: config.AuthConfig{Schemes: []string{"basic", "clientcert"},
+				ClientCerts: []config.ClientCertConfig{{Subject: "CN=ci,O=Acme", Username: "ci", Role: "editor"}}},
+			expectedSchemes: []string{Basic, ClientCert},
+		},
+		{name: "error - unknown scheme", cfg: config.AuthConfig{Schemes: []string{"digest"}}, expectedErr: true},
+		{
+			name:        "error - client certificate user with unknown role",
+			cfg:         config.AuthConfig{ClientCerts: []config.ClientCertConfig{{Subject: "CN=ci", Username: "ci", Role: "root"}}},
+			expectedErr: true,
+		},
+		{
+			name:        "error - client certificate without user",
+			cfg:         config.AuthConfig{ClientCerts: []config.ClientCertConfig{{Subject: "CN=ci"}}},
+			expectedErr: true,
+		},
+		{name: "error - bearer without JWT", cfg: config.AuthConfig{Schemes: []string{"bearer"}}, expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			auth, err := NewAuth(&authDBMock{}, logger.NewLogger(), test.cfg)
+			if (err != nil) != test.expectedErr {
+				t.Fatalf("unexpected error: '%v'", err)
+			}
+			if err != nil {
+				return
+			}
+			for _, scheme := range []string{Basic, Bearer, APIKey, ClientCert} {
+				expected := false
+				for _, s := range test.expectedSchemes {
+					expected = expected || s == scheme
+				}
+				if auth.Accepts(scheme) != expected {
+					t.Errorf("expected scheme '%s' accepted: %t", scheme, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestAuth_Tokens(t *testing.T) {
+	role, exists := identity.Editor, true
+	authDB := &authDBMock{
+		getCredentials: func(username string) (*identity.Credentials, error) {
+			if !exists {
+				return nil, errors.NewExistErr(false)
+			}
+			passwordHash, _ := HashPassword("password", Bcrypt)
+			return &identity.Credentials{Principal: identity.Principal{Username: username, Role: role},
+				PasswordHash: passwordHash}, nil
+		},
+	}
+	cfg := config.AuthConfig{Schemes: []string{Basic, Bearer}, JWT: config.JWTConfig{Algorithm: HS256,
+		Secret: "0123456789abcdef0123456789abcdef", Issuer: "gorest"}}
+	auth, err := NewAuth(authDB, logger.NewLogger(), cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	now := time.Now()
+	auth.jwt.now = func() time.Time { return now }
+	expected := &identity.Principal{Username: "username", Role: identity.Editor}
+
+	if _, err := auth.IssueToken(context.Background(), "dXNlcm5hbWU6ZHJvd3NzYXA="); err == nil {
+		t.Errorf("expected a wrong password not to be exchanged for a token")
+	}
+	token, err := auth.IssueToken(context.Background(), "dXNlcm5hbWU6cGFzc3dvcmQ=")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if token.TokenType != "Bearer" || token.ExpiresIn != int64(defaultAccessTTL.Seconds()) {
+		t.Errorf("unexpected token: '%v'", token)
+	}
+	principal, err := auth.Validate(context.Background(), "Bearer", token.AccessToken)
+	if err != nil || !reflect.DeepEqual(principal, expected) {
+		t.Errorf("expected: '%v' instead got: '%v', '%v'", expected, principal, err)
+	}
+	if _, err := auth.Validate(context.Background(), "Bearer", token.RefreshToken); err == nil {
+		t.Errorf("expected a refresh token not to be accepted as an access token")
+	}
+
+	refreshed, err := auth.RefreshToken(context.Background(), token.RefreshToken)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	principal, err = auth.Validate(context.Background(), "Bearer", refreshed.AccessToken)
+	if err != nil || !reflect.DeepEqual(principal, expected) {
+		t.Errorf("expected: '%v' instead got: '%v', '%v'", expected, principal, err)
+	}
+	if _, err := auth.RefreshToken(context.Background(), token.AccessToken); err == nil {
+		t.Errorf("expected an access token not to be accepted as a refresh token")
+	}
+
+	// refreshing grants the current role of the user and does not extend the session
+	now = now.Add(time.Hour)
+	role = identity.Reader
+	refreshed, err = auth.RefreshToken(context.Background(), refreshed.RefreshToken)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	principal, err = auth.Validate(context.Background(), "Bearer", refreshed.AccessToken)
+	if err != nil || principal.Role != identity.Reader {
+		t.Errorf("expected the role to be reloaded instead got: '%v', '%v'", principal, err)
+	}
+	original, _ := auth.jwt.verify(token.RefreshToken, refreshToken)
+	renewed, err := auth.jwt.verify(refreshed.RefreshToken, refreshToken)
+	if err != nil || renewed.ExpiresAt != original.ExpiresAt {
+		t.Errorf("expected the refresh token to expire at %d instead got: '%v', '%v'", original.ExpiresAt, renewed, err)
+	}
+	now = time.Unix(original.ExpiresAt, 0)
+	if _, err := auth.RefreshToken(context.Background(), refreshed.RefreshToken); err == nil {
+		t.Errorf("expected the session not to be refreshed past its expiration")
+	}
+	now = now.Add(-time.Hour)
+	exists = false
+	if _, err := auth.RefreshToken(context.Background(), refreshed.RefreshToken); err == nil {
+		t.Errorf("expected users that no longer exist not to be refreshed")
+	}
+
+	// basic auth only, no tokens are issued nor accepted
+	basic, err := NewAuth(authDB, logger.NewLogger(), config.AuthConfig{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := basic.Validate(context.Background(), "Bearer", token.AccessToken); err == nil {
+		t.Errorf("expected bearer tokens not to be accepted")
+	}
+	if _, err := basic.IssueToken(context.Background(), "dXNlcm5hbWU6cGFzc3dvcmQ="); err == nil {
+		t.Errorf("expected tokens not to be issued")
+	}
+}
+
+func TestAuth_ValidateAPIKey(t *testing.T) {
+	key := &apikey.Key{ID: "01EC9V3P6Y8B8XWJ2Q3KZ4M5N6", Role: identity.Editor, Scopes: []identity.Permission{identity.CreateRecipe}}
+	if err := key.Generate(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	secret := key.Secret
+	expired := time.Now().Add(-time.Minute)
+	stored := func(expiresAt *time.Time) func(ID string) (*apikey.Key, error) {
+		return func(ID string) (*apikey.Key, error) {
+			if ID != key.ID {
+				return nil, errors.NewExistErr(false)
+			}
+			k := *key
+			k.Secret, k.ExpiresAt = "", expiresAt
+			return &k, nil
+		}
+	}
+	tests := []struct {
+		name              string
+		secret            string
+		authDB            authDBMock
+		schemes           []string
+		expectedPrincipal *identity.Principal
+		expectedErr       error
+	}{
+		{
+			name:   "successful validation",
+			secret: secret,
+			authDB: authDBMock{getAPIKey: stored(nil)},
+			expectedPrincipal: &identity.Principal{Username: "apikey:01EC9V3P6Y8B8XWJ2Q3KZ4M5N6", Role: identity.Editor,
+				Scopes: []identity.Permission{identity.CreateRecipe}},
+		},
+		{
+			name:        "error - wrong secret",
+			secret:      key.ID + ".c2VjcmV0",
+			authDB:      authDBMock{getAPIKey: stored(nil)},
+			expectedErr: errors.NewFailedAuthErr(),
+		},
+		{
+			name:        "error - expired key",
+			secret:      secret,
+			authDB:      authDBMock{getAPIKey: stored(&expired)},
+			expectedErr: errors.NewFailedAuthErr(),
+		},
+		{
+			name:        "error - unknown key",
+			secret:      "01EC9V3P6Y8B8XWJ2Q3KZ4M5N7" + secret[len(key.ID):],
+			authDB:      authDBMock{getAPIKey: stored(nil)},
+			expectedErr: errors.NewFailedAuthErr(),
+		},
+		{
+			name:        "error - malformed key",
+			secret:      "c2VjcmV0",
+			expectedErr: errors.NewFailedAuthErr(),
+		},
+		{
+			name:        "error - API keys disabled",
+			secret:      secret,
+			authDB:      authDBMock{getAPIKey: stored(nil)},
+			schemes:     []string{Basic},
+			expectedErr: errors.NewFailedAuthErr(),
+		},
+		{
+			name:   "error - DB",
+			secret: secret,
+			authDB: authDBMock{getAPIKey: func(ID string) (*apikey.Key, error) {
+				return nil, errors.NewDBErr("DB issue")
+			}},
+			expectedErr: errors.NewDBErr("DB issue"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			auth, err := NewAuth(&test.authDB, logger.NewLogger(), config.AuthConfig{Schemes: test.schemes})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			principal, err := auth.Validate(context.Background(), APIKey, test.secret)
+			if err != nil && (test.expectedErr == nil || err.Error() != test.expectedErr.Error()) {
+				t.Errorf("expected: '%v' instead got: '%s'", test.expectedErr, err)
+			}
+			if err == nil && test.expectedErr != nil {
+				t.Errorf("expected: '%s' instead got nil", test.expectedErr)
+			}
+			if !reflect.DeepEqual(principal, test.expectedPrincipal) {
+				t.Errorf("expected: '%v' instead got: '%v'", test.expectedPrincipal, principal)
+			}
+		})
+	}
+}
+
+func TestAuth_ValidateClientCert(t *testing.T) {
+	cfg := config.AuthConfig{
+		Schemes: []string{"clientcert"},
+		ClientCerts: []config.ClientCertConfig{
+			{Subject: "CN=ci,O=Acme", Username: "ci", Role: "editor"},
+			{Subject: "CN=monitor,O=Acme", Username: "monitor"},
+		},
+	}
+	tests := []struct {
+		name              string
+		subject           string
+		schemes           []string
+		expectedPrincipal *identity.Principal
+		expectedErr       error
+	}{
+		{
+			name:              "successful validation",
+			subject:           "CN=ci,O=Acme",
+			expectedPrincipal: &identity.Principal{Username: "ci", Role: identity.Editor},
+		},
+		{
+			name:              "successful validation - default role",
+			subject:           "CN=monitor,O=Acme",
+			expectedPrincipal: &identity.Principal{Username: "monitor", Role: identity.DefaultRole},
+		},
+		{
+			name:        "error - unknown subject",
+			subject:     "CN=ci,O=Other",
+			expectedErr: errors.NewFailedAuthErr(),
+		},
+		{
+			name:        "error - client certificates disabled",
+			subject:     "CN=ci,O=Acme",
+			schemes:     []string{Basic},
+			expectedErr: errors.NewFailedAuthErr(),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := cfg
+			if test.schemes != nil {
+				c.Schemes = test.schemes
+			}
+			auth, err := NewAuth(&authDBMock{}, logger.NewLogger(), c)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			principal, err := auth.Validate(context.Background(), ClientCert, test.subject)
+			if (err == nil) != (test.expectedErr == nil) || (err != nil && err.Error() != test.expectedErr.Error()) {
+				t.Errorf("expected: '%v' instead got: '%v'", test.expectedErr, err)
+			}
+			if !reflect.DeepEqual(principal, test.expectedPrincipal) {
+				t.Errorf("expected: '%v' instead got: '%v'", test.expectedPrincipal, principal)
 			}
 		})
 	}
@@ -0,0 +1,253 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/config"
+	"github.com/rnov/Go-REST/pkg/id"
+	"github.com/rnov/Go-REST/pkg/identity"
+)
+
+// JWT signing algorithms.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+)
+
+// token uses, an access token is not accepted in place of a refresh token nor the other way round.
+const (
+	accessToken  = "access"
+	refreshToken = "refresh"
+)
+
+// default lifetime of the tokens.
+const (
+	defaultAccessTTL  = 15 * time.Minute
+	defaultRefreshTTL = 24 * time.Hour
+)
+
+// minSecretLen - HS256 secrets shorter than the hash output (32 bytes) weaken the signature.
+const minSecretLen = 32
+
+// Claims - registered claims of the issued tokens (RFC 7519) along with the role of the user and the use of the token.
+type Claims struct {
+	ID        string        `json:"jti"`
+	Issuer    string        `json:"iss,omitempty"`
+	Subject   string        `json:"sub"`
+	IssuedAt  int64         `json:"iat"`
+	ExpiresAt int64         `json:"exp"`
+	Role      identity.Role `json:"role"`
+	Use       string        `json:"token_use"`
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+// JWT - signs and verifies JSON Web Tokens with a single algorithm, tokens signed with any other one (none among them)
+// are rejected.
+type JWT struct {
+	alg        string
+	secret     []byte
+	privateKey *rsa.PrivateKey
+	issuer     string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	now        func() time.Time
+}
+
+// NewJWT - loads the signing key of the configured algorithm, the secret for HS256 and the PEM encoded private key file
+// (PKCS #1 or PKCS #8) for RS256.
+func NewJWT(cfg config.JWTConfig) (*JWT, error) {
+	j := &JWT{
+		alg:        cfg.Algorithm,
+		issuer:     cfg.Issuer,
+		accessTTL:  cfg.AccessTTL,
+		refreshTTL: cfg.RefreshTTL,
+		now:        time.Now,
+	}
+	if j.accessTTL <= 0 {
+		j.accessTTL = defaultAccessTTL
+	}
+	if j.refreshTTL <= 0 {
+		j.refreshTTL = defaultRefreshTTL
+	}
+	switch cfg.Algorithm {
+	case HS256:
+		if len(cfg.Secret) < minSecretLen {
+			return nil, fmt.Errorf("%s secret must be at least %d bytes long", HS256, minSecretLen)
+		}
+		j.secret = []byte(cfg.Secret)
+	case RS256:
+		key, err := loadRSAKey(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		j.privateKey = key
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm '%s'", cfg.Algorithm)
+	}
+
+	return j, nil
+}
+
+func loadRSAKey(file string) (*rsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s private key: %s", RS256, err.Error())
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s private key '%s' is not PEM encoded", RS256, file)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s private key: %s", RS256, err.Error())
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s private key '%s' is not an RSA key", RS256, file)
+	}
+	return key, nil
+}
+
+// issue - signs a token of the given use on behalf of the user, returns it along with its lifetime.
+func (j *JWT) issue(p *identity.Principal, use string) (string, time.Duration, error) {
+	return j.issueBefore(p, use, 0)
+}
+
+// issueBefore - same as issue, but the token expires at expiresAt (unix time) at the latest unless it is 0.
+func (j *JWT) issueBefore(p *identity.Principal, use string, expiresAt int64) (string, time.Duration, error) {
+	ttl := j.accessTTL
+	if use == refreshToken {
+		ttl = j.refreshTTL
+	}
+	jti, err := id.New()
+	if err != nil {
+		return "", 0, err
+	}
+	now := j.now()
+	if expiresAt > 0 && now.Add(ttl).Unix() > expiresAt {
+		ttl = time.Unix(expiresAt, 0).Sub(now)
+	}
+	claims := &Claims{
+		ID:        jti,
+		Issuer:    j.issuer,
+		Subject:   p.Username,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+		Role:      p.Role,
+		Use:       use,
+	}
+	token, err := j.sign(claims)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return token, ttl, nil
+}
+
+func (j *JWT) sign(claims *Claims) (string, error) {
+	h, err := json.Marshal(header{Alg: j.alg, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	signature, err := j.signature(signingInput)
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func (j *JWT) signature(signingInput string) ([]byte, error) {
+	if j.alg == HS256 {
+		mac := hmac.New(sha256.New, j.secret)
+		mac.Write([]byte(signingInput))
+		return mac.Sum(nil), nil
+	}
+	digest := sha256.Sum256([]byte(signingInput))
+	return rsa.SignPKCS1v15(rand.Reader, j.privateKey, crypto.SHA256, digest[:])
+}
+
+// verify - checks the signature, the expiration, the issuer and the use of the token, returns its claims. Nothing but
+// the token itself is needed, there is no DB round-trip.
+func (j *JWT) verify(token, use string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+	h := header{}
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, err
+	}
+	if h.Alg != j.alg {
+		return nil, fmt.Errorf("unexpected signing algorithm '%s'", h.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature")
+	}
+	if err := j.checkSignature(parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+	claims := &Claims{}
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return nil, err
+	}
+	if j.now().Unix() >= claims.ExpiresAt {
+		return nil, fmt.Errorf("token expired")
+	}
+	if claims.Issuer != j.issuer || claims.Use != use || len(claims.Subject) == 0 || !identity.ValidRole(claims.Role) {
+		return nil, fmt.Errorf("unexpected token claims")
+	}
+
+	return claims, nil
+}
+
+func (j *JWT) checkSignature(signingInput string, signature []byte) error {
+	if j.alg == HS256 {
+		expected, _ := j.signature(signingInput)
+		if !hmac.Equal(signature, expected) {
+			return fmt.Errorf("invalid token signature")
+		}
+		return nil
+	}
+	digest := sha256.Sum256([]byte(signingInput))
+	if err := rsa.VerifyPKCS1v15(&j.privateKey.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		return fmt.Errorf("invalid token signature")
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("malformed token segment")
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("malformed token segment: %s", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/config"
+	"github.com/rnov/Go-REST/pkg/identity"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func rsaKeyFile(t *testing.T) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f, err := ioutil.TempFile("", "jwt-*.pem")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer f.Close()
+	if err := pem.Encode(f, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return f.Name()
+}
+
+func TestNewJWT(t *testing.T) {
+	keyFile := rsaKeyFile(t)
+	defer os.Remove(keyFile)
+	tests := []struct {
+		name        string
+		cfg         config.JWTConfig
+		expectedErr bool
+	}{
+		{name: "HS256", cfg: config.JWTConfig{Algorithm: HS256, Secret: testSecret}},
+		{name: "RS256", cfg: config.JWTConfig{Algorithm: RS256, PrivateKeyFile: keyFile}},
+		{name: "error - short secret", cfg: config.JWTConfig{Algorithm: HS256, Secret: "secret"}, expectedErr: true},
+		{name: "error - missing private key", cfg: config.JWTConfig{Algorithm: RS256, PrivateKeyFile: "missing.pem"}, expectedErr: true},
+		{name: "error - unsupported algorithm", cfg: config.JWTConfig{Algorithm: "none"}, expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewJWT(test.cfg); (err != nil) != test.expectedErr {
+				t.Errorf("unexpected error: '%v'", err)
+			}
+		})
+	}
+}
+
+func TestJWT_Verify(t *testing.T) {
+	keyFile := rsaKeyFile(t)
+	defer os.Remove(keyFile)
+	p := &identity.Principal{Username: "username", Role: identity.Editor}
+	now := time.Now()
+	// forge - replaces the header of the token, keeping the claims and the signature.
+	forge := func(token, h string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(h)) + token[strings.Index(token, "."):]
+	}
+	tests := []struct {
+		name        string
+		cfg         config.JWTConfig
+		token       func(j *JWT) string
+		use         string
+		at          time.Time
+		expectedErr bool
+	}{
+		{
+			name:  "valid HS256 access token",
+			cfg:   config.JWTConfig{Algorithm: HS256, Secret: testSecret, Issuer: "gorest"},
+			token: func(j *JWT) string { token, _, _ := j.issue(p, accessToken); return token },
+			use:   accessToken,
+			at:    now,
+		},
+		{
+			name:  "valid RS256 refresh token",
+			cfg:   config.JWTConfig{Algorithm: RS256, PrivateKeyFile: keyFile},
+			token: func(j *JWT) string { token, _, _ := j.issue(p, refreshToken); return token },
+			use:   refreshToken,
+			at:    now.Add(23 * time.Hour),
+		},
+		{
+			name:        "error - expired token",
+			cfg:         config.JWTConfig{Algorithm: HS256, Secret: testSecret, AccessTTL: time.Minute},
+			token:       func(j *JWT) string { token, _, _ := j.issue(p, accessToken); return token },
+			use:         accessToken,
+			at:          now.Add(time.Minute),
+			expectedErr: true,
+		},
+		{
+			name:        "error - refresh token used as access token",
+			cfg:         config.JWTConfig{Algorithm: HS256, Secret: testSecret},
+			token:       func(j *JWT) string { token, _, _ := j.issue(p, refreshToken); return token },
+			use:         accessToken,
+			at:          now,
+			expectedErr: true,
+		},
+		{
+			name: "error - tampered claims",
+			cfg:  config.JWTConfig{Algorithm: HS256, Secret: testSecret},
+			token: func(j *JWT) string {
+				token, _, _ := j.issue(p, accessToken)
+				parts := strings.Split(token, ".")
+				claims := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"username","role":"admin","token_use":"access","exp":9999999999}`))
+				return parts[0] + "." + claims + "." + parts[2]
+			},
+			use:         accessToken,
+			at:          now,
+			expectedErr: true,
+		},
+		{
+			name: "error - unsigned token",
+			cfg:  config.JWTConfig{Algorithm: HS256, Secret: testSecret},
+			token: func(j *JWT) string {
+				token, _, _ := j.issue(p, accessToken)
+				token = forge(token, `{"alg":"none","typ":"JWT"}`)
+				return token[:strings.LastIndex(token, ".")+1]
+			},
+			use:         accessToken,
+			at:          now,
+			expectedErr: true,
+		},
+		{
+			name: "error - algorithm mismatch",
+			cfg:  config.JWTConfig{Algorithm: RS256, PrivateKeyFile: keyFile},
+			token: func(j *JWT) string {
+				token, _, _ := j.issue(p, accessToken)
+				return forge(token, `{"alg":"HS256","typ":"JWT"}`)
+			},
+			use:         accessToken,
+			at:          now,
+			expectedErr: true,
+		},
+		{
+			name: "error - other issuer",
+			cfg:  config.JWTConfig{Algorithm: HS256, Secret: testSecret, Issuer: "gorest"},
+			token: func(j *JWT) string {
+				j.issuer = "other"
+				defer func() { j.issuer = "gorest" }()
+				token, _, _ := j.issue(p, accessToken)
+				return token
+			},
+			use:         accessToken,
+			at:          now,
+			expectedErr: true,
+		},
+		{
+			name:        "error - malformed token",
+			cfg:         config.JWTConfig{Algorithm: HS256, Secret: testSecret},
+			token:       func(j *JWT) string { return "dXNlcm5hbWU6cGFzc3dvcmQ=" },
+			use:         accessToken,
+			at:          now,
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			j, err := NewJWT(test.cfg)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			j.now = func() time.Time { return now }
+			token := test.token(j)
+			j.now = func() time.Time { return test.at }
+
+			claims, err := j.verify(token, test.use)
+			if (err != nil) != test.expectedErr {
+				t.Fatalf("unexpected error: '%v'", err)
+			}
+			if err == nil && (claims.Subject != p.Username || claims.Role != p.Role || claims.Use != test.use) {
+				t.Errorf("unexpected claims: '%v'", claims)
+			}
+		})
+	}
+}
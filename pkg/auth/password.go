@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// password hashing algorithms, passwords hashed with any of them can be compared.
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+// argon2id parameters of the new hashes, the ones of stored hashes are read from their encoding. The OWASP minimum,
+// basic auth is checked on every request.
+const (
+	argon2Time    = 2
+	argon2Memory  = 19 * 1024
+	argon2Threads = 1
+	argon2KeyLen  = 32
+	saltLen       = 16
+)
+
+// HashPassword - salted hash of the password, encoded along with the algorithm and its parameters so that it can be
+// compared later on regardless of the current ones. argon2id hashes use the PHC string format, e.g.
+// $argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>, bcrypt hashes its modular crypt format.
+func HashPassword(password, algorithm string) (string, error) {
+	switch algorithm {
+	case Argon2id:
+		salt := make([]byte, saltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+		return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", Argon2id, argon2.Version, argon2Memory, argon2Time,
+			argon2Threads, base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	case Bcrypt:
+		h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return "", err
+		}
+		return string(h), nil
+	}
+	return "", fmt.Errorf("unknown password hashing algorithm '%s'", algorithm)
+}
+
+// ComparePassword - whether the password matches the encoded hash, in constant time. Returns an error only when the
+// hash is malformed.
+func ComparePassword(encoded, password string) (bool, error) {
+	if strings.HasPrefix(encoded, "$"+Argon2id+"$") {
+		return compareArgon2id(encoded, password)
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func compareArgon2id(encoded, password string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return false, fmt.Errorf("malformed %s hash", Argon2id)
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, fmt.Errorf("unsupported %s version '%s'", Argon2id, parts[2])
+	}
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil || time == 0 || threads == 0 {
+		return false, fmt.Errorf("malformed %s parameters '%s'", Argon2id, parts[3])
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, fmt.Errorf("malformed %s salt: %s", Argon2id, err.Error())
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return false, fmt.Errorf("malformed %s key", Argon2id)
+	}
+	computed := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(key, computed) == 1, nil
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHashPassword(t *testing.T) {
+	tests := []struct {
+		name           string
+		algorithm      string
+		expectedPrefix string
+		expectedErr    bool
+	}{
+		{name: "argon2id", algorithm: Argon2id, expectedPrefix: "$argon2id$v=19$m=19456,t=2,p=1$"},
+		{name: "bcrypt", algorithm: Bcrypt, expectedPrefix: "$2a$10$"},
+		{name: "error - unknown algorithm", algorithm: "md5", expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			first, err := HashPassword("password", test.algorithm)
+			if (err != nil) != test.expectedErr {
+				t.Fatalf("unexpected error: '%v'", err)
+			}
+			if err != nil {
+				return
+			}
+			if !strings.HasPrefix(first, test.expectedPrefix) {
+				t.Errorf("expected prefix: '%s' instead got: '%s'", test.expectedPrefix, first)
+			}
+			// salted, hashing the same password twice does not give the same hash
+			second, _ := HashPassword("password", test.algorithm)
+			if first == second {
+				t.Errorf("expected different hashes instead got: '%s' twice", first)
+			}
+		})
+	}
+}
+
+func TestComparePassword(t *testing.T) {
+	argon2idHash, _ := HashPassword("password", Argon2id)
+	bcryptHash, _ := HashPassword("password", Bcrypt)
+	tests := []struct {
+		name        string
+		encoded     string
+		password    string
+		expected    bool
+		expectedErr bool
+	}{
+		{name: "argon2id match", encoded: argon2idHash, password: "password", expected: true},
+		{name: "argon2id mismatch", encoded: argon2idHash, password: "Password"},
+		{name: "bcrypt match", encoded: bcryptHash, password: "password", expected: true},
+		{name: "bcrypt mismatch", encoded: bcryptHash, password: "Password"},
+		{
+			name: "argon2id custom parameters",
+			// password hashed with m=65536,t=3,p=4
+			encoded:  "$argon2id$v=19$m=65536,t=3,p=4$c29tZXNhbHRzb21lc2FsdA$gduXp+Z6iReEolmbyHn5V8s1EtJzmEvZfYoY/Fn/AeI",
+			password: "password",
+			expected: true,
+		},
+		{name: "error - unsupported argon2id version", encoded: "$argon2id$v=16$m=65536,t=3,p=4$c2FsdA$a2V5", expectedErr: true},
+		{name: "error - malformed argon2id parameters", encoded: "$argon2id$v=19$m=x,t=3,p=4$c2FsdA$a2V5", expectedErr: true},
+		{name: "error - argon2id without parallelism", encoded: "$argon2id$v=19$m=65536,t=3,p=0$c2FsdA$a2V5", expectedErr: true},
+		{name: "error - malformed argon2id salt", encoded: "$argon2id$v=19$m=65536,t=3,p=4$!$a2V5", expectedErr: true},
+		{name: "error - malformed hash", encoded: "e4da07ad200089ce", expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			match, err := ComparePassword(test.encoded, test.password)
+			if (err != nil) != test.expectedErr {
+				t.Fatalf("unexpected error: '%v'", err)
+			}
+			if match != test.expected {
+				t.Errorf("expected: %t instead got: %t", test.expected, match)
+			}
+		})
+	}
+}
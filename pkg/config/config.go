@@ -2,6 +2,7 @@ package config
 
 import (
 	"io/ioutil"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
@@ -25,22 +26,151 @@ type DBConfig struct {
 	Host string `yaml:"host"`
 	Port int    `yaml:"port"`
 	DB   int    `yaml:"dbInterface"`
+	// User, Password, Database and SSLMode are only used by postgres.
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Database string `yaml:"database"`
+	SSLMode  string `yaml:"sslMode"`
+	// Tokens - hashed basic auths to seed the DB with, only used by the in-memory DB. They are identified by their own
+	// hash and granted the default role, use Users instead.
+	Tokens []string `yaml:"tokens"`
+	// Users - users to seed the DB with, only used by the in-memory DB.
+	Users []UserConfig `yaml:"users"`
+	// Timeout - time each call made to the DB on behalf of a request is given, e.g. "2s", calls are not limited unless
+	// given. Requests whose calls are not completed in time are responded with 504 Gateway Timeout.
+	Timeout time.Duration `yaml:"timeout"`
 }
 
+// UserConfig - a user along with its role and credentials, the default role is granted when it is empty. PasswordHash is
+// a salted hash as generated by tools/authgenerator, Token the legacy unsalted hash of the basic auth which is only
+// checked while the user has no password hash.
+type UserConfig struct {
+	Username     string `yaml:"username"`
+	Role         string `yaml:"role"`
+	PasswordHash string `yaml:"passwordHash"`
+	Token        string `yaml:"token"`
+}
+
+// LoggerConfig - JSON logger writing the entries at least as severe as Level ("debug", "info" by default, "notice",
+// "warning", "error" or "critical") to Output: "stdout" (by default), "stderr" or "file". Log files are appended to File,
+// relative to the logs path unless absolute, and rotated once they reach MaxSizeMB (100 by default) keeping MaxBackups
+// (3 by default) previous files. Name is written along with every entry, Active only applies to the redis logger which
+// is disabled unless active.
 type LoggerConfig struct {
-	Name   string `yaml:"name"`
-	File   string `yaml:"file"`
-	Active bool   `yaml:"active"`
+	Name       string `yaml:"name"`
+	File       string `yaml:"file"`
+	Active     bool   `yaml:"active"`
+	Level      string `yaml:"level"`
+	Output     string `yaml:"output"`
+	MaxSizeMB  int    `yaml:"maxSizeMB"`
+	MaxBackups int    `yaml:"maxBackups"`
 }
 
 type APIConfig struct {
-	Server   Server       `yaml:"server"`
-	DBCfg    DBConfig     `yaml:"dbConfig"`
+	Server Server   `yaml:"server"`
+	DBCfg  DBConfig `yaml:"dbConfig"`
+	// LogsPath - directory of the relative log files.
 	LogsPath string       `yaml:"loggers_paths"`
-	RedisLog LoggerConfig `yaml:"redis_logger"`
+	Logger   LoggerConfig `yaml:"logger"`
+	// RedisLog - logger of the redis client internals, e.g. connection pool errors.
+	RedisLog  LoggerConfig    `yaml:"redis_logger"`
+	Auth      AuthConfig      `yaml:"auth"`
+	RateLimit RateLimitConfig `yaml:"rateLimit"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	Tracing   TracingConfig   `yaml:"tracing"`
 	//	... api, postgres, logger ...
 }
 
-type Server struct {
+// AuthConfig - authentication schemes accepted by the protected endpoints, "basic", "bearer", "apikey" and/or
+// "clientcert", basic auth and API keys are accepted when none is given. Bearer tokens are issued and verified as
+// configured by JWT, client certificates are verified by the server (see TLSConfig) and mapped to users by ClientCerts.
+type AuthConfig struct {
+	Schemes     []string           `yaml:"schemes"`
+	JWT         JWTConfig          `yaml:"jwt"`
+	ClientCerts []ClientCertConfig `yaml:"clientCerts"`
+}
+
+// ClientCertConfig - user the requests made with a client certificate are made on behalf of, the certificate is
+// identified by its subject as given by RFC 2253, e.g. "CN=ci,O=Acme". The default role is granted when it is empty.
+type ClientCertConfig struct {
+	Subject  string `yaml:"subject"`
+	Username string `yaml:"username"`
+	Role     string `yaml:"role"`
+}
+
+// JWTConfig - Algorithm is either HS256, signed with Secret, or RS256, signed with the PEM encoded PrivateKeyFile. The
+// lifetimes are given as durations, e.g. "15m", 15 minutes for access tokens and 24 hours for refresh tokens by default.
+type JWTConfig struct {
+	Algorithm      string        `yaml:"algorithm"`
+	Secret         string        `yaml:"secret"`
+	PrivateKeyFile string        `yaml:"privateKeyFile"`
+	Issuer         string        `yaml:"issuer"`
+	AccessTTL      time.Duration `yaml:"accessTTL"`
+	RefreshTTL     time.Duration `yaml:"refreshTTL"`
+}
+
+// MetricsConfig - Prometheus metrics are served on Address (":9090" by default), apart from the API, under Path
+// ("/metrics" by default).
+type MetricsConfig struct {
 	Address string `yaml:"address"`
+	Path    string `yaml:"path"`
+}
+
+// TracingConfig - spans are exported by Exporter: "none" (by default), "stdout" meant for local use, or "otlp" which
+// sends them over OTLP/HTTP to the collector at Endpoint ("localhost:4318" by default), without TLS when Insecure.
+// SampleRatio of the traces started by the API are sampled (all of them by default), traces propagated by the clients
+// keep their sampling decision. Spans are reported on behalf of ServiceName ("gorest" by default).
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter"`
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure"`
+	SampleRatio float64 `yaml:"sampleRatio"`
+	ServiceName string  `yaml:"serviceName"`
+}
+
+// RateLimitConfig - requests each client is allowed to make, Default applies to every route but those listed in Routes,
+// which are named by their method and path template, e.g. "POST /recipes/{ID}/rate". Authentication limits the requests
+// each address makes to the protected routes, whatever the route, before their credentials are checked. Requests are
+// not limited unless a limit is given. Store keeps the limits state, either "memory" (by default) or "redis" which is
+// shared by all the replicas using the same Redis instance, only its host, port and dbInterface are used.
+type RateLimitConfig struct {
+	Store          string                 `yaml:"store"`
+	Redis          DBConfig               `yaml:"redis"`
+	Default        LimitConfig            `yaml:"default"`
+	Authentication LimitConfig            `yaml:"authentication"`
+	Routes         map[string]LimitConfig `yaml:"routes"`
+}
+
+// LimitConfig - Requests per Per (a second by default) may be made on average, with bursts of up to Burst requests
+// (Requests by default). No limit is applied when Requests is 0.
+type LimitConfig struct {
+	Requests int           `yaml:"requests"`
+	Per      time.Duration `yaml:"per"`
+	Burst    int           `yaml:"burst"`
+}
+
+// Server - HTTP server settings, durations are given as e.g. "30s". Zero values are given a default: 5s to read the
+// request headers, 30s to read the whole request, 60s to write the response, 120s of idle keep-alive connections, 1MB of
+// headers and 30s to finish the in-flight requests on shutdown. HTTPS is served when TLS is given.
+type Server struct {
+	Address           string        `yaml:"address"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout"`
+	ReadTimeout       time.Duration `yaml:"readTimeout"`
+	WriteTimeout      time.Duration `yaml:"writeTimeout"`
+	IdleTimeout       time.Duration `yaml:"idleTimeout"`
+	MaxHeaderBytes    int           `yaml:"maxHeaderBytes"`
+	ShutdownTimeout   time.Duration `yaml:"shutdownTimeout"`
+	TLS               TLSConfig     `yaml:"tls"`
+}
+
+// TLSConfig - PEM encoded certificate (chain) and key of the server, TLS is enabled when CertFile is given. Client
+// certificates are verified against the PEM CA bundle of ClientCAFile, if any, and either "required" (by default) or
+// "optional" as told by ClientAuth. The files are checked for changes every ReloadInterval (10s by default) and
+// reloaded without restarting the server.
+type TLSConfig struct {
+	CertFile       string        `yaml:"certFile"`
+	KeyFile        string        `yaml:"keyFile"`
+	ClientCAFile   string        `yaml:"clientCAFile"`
+	ClientAuth     string        `yaml:"clientAuth"`
+	ReloadInterval time.Duration `yaml:"reloadInterval"`
 }
@@ -1,31 +1,77 @@
 package db
 
 import (
+	"context"
 	"errors"
+	"fmt"
 
+	"github.com/rnov/Go-REST/pkg/apikey"
 	"github.com/rnov/Go-REST/pkg/config"
+	"github.com/rnov/Go-REST/pkg/db/memory"
+	"github.com/rnov/Go-REST/pkg/db/postgres"
 	"github.com/rnov/Go-REST/pkg/db/redis"
+	"github.com/rnov/Go-REST/pkg/identity"
 	"github.com/rnov/Go-REST/pkg/rate"
 	rcp "github.com/rnov/Go-REST/pkg/recipe"
 )
 
-// Recipe - Provides all DB operations related to recipe's business logic.
+// Recipe - Provides all DB operations related to recipe's business logic, on behalf of the request of ctx.
 type Recipe interface {
-	GetRecipeByID(recipeID string) (*rcp.Recipe, error)
-	GetAllRecipes() ([]*rcp.Recipe, error)
-	CreateRecipe(recipe *rcp.Recipe) error
-	UpdateRecipe(recipe *rcp.Recipe) error
-	DeleteRecipe(recipeID string) error
+	GetRecipeByID(ctx context.Context, recipeID string) (*rcp.Recipe, error)
+	GetRecipes(ctx context.Context, query *rcp.Query) (*rcp.Page, error)
+	// CreateRecipe - stores a new recipe at its first version, which is set into the given recipe.
+	CreateRecipe(ctx context.Context, recipe *rcp.Recipe) error
+	// CreateRecipes - batch counterpart of CreateRecipe, the outcome of each recipe is returned in the same order: nil
+	// when it has been created or the error CreateRecipe would have returned otherwise. Recipes are created
+	// independently, a failing one does not prevent the rest from being created.
+	CreateRecipes(ctx context.Context, recipes []*rcp.Recipe) []error
+	// UpdateRecipe - replaces the stored recipe but its creation timestamp, which is set back into the given recipe along
+	// with the new version. Whenever version is greater than 0 the recipe is only replaced if it is still stored at that
+	// version, otherwise *errors.PreconditionErr is returned.
+	UpdateRecipe(ctx context.Context, recipe *rcp.Recipe, version int64) error
+	// PatchRecipe - partial update, only the given fields (rcp.Field*) of the recipe are written along with its update
+	// timestamp. The creation timestamp and the new version are set back into the given recipe, version conditions the
+	// update as in UpdateRecipe.
+	PatchRecipe(ctx context.Context, recipe *rcp.Recipe, fields []string, version int64) error
+	// DeleteRecipe - deletes the recipe along with its rates, version conditions the deletion as in UpdateRecipe.
+	DeleteRecipe(ctx context.Context, recipeID string, version int64) error
 }
 
-// Rate - Provides all DB operations related to rate's business logic.
+// Rate - Provides all DB operations related to rate's business logic, on behalf of the request of ctx.
 type Rate interface {
-	RateRecipe(recipeID string, rate *rate.Rate) error
+	// RateRecipe - stores the rate of the recipe, it replaces the previous rate of the same rater if any.
+	RateRecipe(ctx context.Context, recipeID string, rate *rate.Rate) error
+	// DeleteRate - retracts the rate of the rater, *errors.ExistErr when either the recipe or the rate does not exist.
+	DeleteRate(ctx context.Context, recipeID, rater string) error
+	GetRates(ctx context.Context, recipeID string) ([]*rate.Rate, error)
+	GetRateSummary(ctx context.Context, recipeID string) (*rate.Summary, error)
 }
 
-// Auth - Provides all DB operations related to authorization's business logic.
+// Auth - Provides all DB operations related to authorization's business logic, on behalf of the request of ctx.
 type Auth interface {
-	CheckAuth(auth string) error
+	// CheckAuth - returns the user the hashed basic auth belongs to, *errors.FailedAuthErr when it is not registered.
+	CheckAuth(ctx context.Context, auth string) (*identity.Principal, error)
+	// GetCredentials - returns the password hash of the user along with its role, *errors.ExistErr when the user has no
+	// password stored.
+	GetCredentials(ctx context.Context, username string) (*identity.Credentials, error)
+	// SetPassword - stores the password hash of the user, users that do not exist yet are granted the default role.
+	SetPassword(ctx context.Context, username, passwordHash string) error
+	// GetAPIKey - returns the key along with its hash, *errors.ExistErr when it does not exist.
+	GetAPIKey(ctx context.Context, ID string) (*apikey.Key, error)
+}
+
+// APIKey - Provides all DB operations related to API keys management, on behalf of the request of ctx. Keys are stored
+// along with their hash but never their secret.
+type APIKey interface {
+	CreateAPIKey(ctx context.Context, key *apikey.Key) error
+	GetAPIKey(ctx context.Context, ID string) (*apikey.Key, error)
+	// GetAPIKeys - returns all the keys sorted by ID, i.e. by creation time.
+	GetAPIKeys(ctx context.Context) ([]*apikey.Key, error)
+	// RotateAPIKey - replaces the hash of the key as long as it is still oldHash, *errors.PreconditionErr otherwise (e.g.
+	// it has been rotated in the meantime) and *errors.ExistErr when it does not exist.
+	RotateAPIKey(ctx context.Context, ID, oldHash, newHash string) error
+	// DeleteAPIKey - *errors.ExistErr when the key does not exist.
+	DeleteAPIKey(ctx context.Context, ID string) error
 }
 
 // Client - is a `superset` of DB interfaces that defines a DB client, that way is ensured that a given DB client needs to
@@ -34,19 +80,71 @@ type Client interface {
 	Recipe
 	Rate
 	Auth
+	APIKey
+	// Close - releases the connections to the DB once it is no longer used.
+	Close() error
 }
 
-// NewClient - DB client constructor based on the configuration that has been loaded.
+// NewClient - DB client constructor based on the configuration that has been loaded, each call is given up to the
+// configured timeout.
 func NewClient(cfg config.DBConfig) (Client, error) {
+	c, err := newBackend(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return withTimeout(c, cfg.Timeout), nil
+}
+
+// newBackend - client of the configured DB.
+func newBackend(cfg config.DBConfig) (Client, error) {
 	switch cfg.Name {
 	case "redis":
 		redisClient := redis.NewRedisClient(cfg.Host, cfg.Port, cfg.DB)
 		//check connection with redis
-		if _, err := redisClient.Ping().Result(); err != nil {
+		if _, err := redisClient.Ping(context.Background()).Result(); err != nil {
 			return nil, err
 		}
 		//fmt.Println(pong)
-		return redis.NewRedisProxy(redisClient), nil
+		redisProxy := redis.NewRedisProxy(redisClient)
+		// recipes stored before being indexed would not be listed otherwise
+		if err := redisProxy.EnsureIndexes(context.Background()); err != nil {
+			return nil, err
+		}
+		return redisProxy, nil
+	case "postgres":
+		pgClient, err := postgres.NewPostgresClient(cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Database, cfg.SSLMode)
+		if err != nil {
+			return nil, err
+		}
+		//check connection with postgres
+		if err := pgClient.Ping(); err != nil {
+			return nil, err
+		}
+		pgProxy := postgres.NewPostgresProxy(pgClient)
+		// bring the schema up to date before serving any request
+		if err := pgProxy.Migrate(context.Background()); err != nil {
+			return nil, err
+		}
+		return pgProxy, nil
+	case "memory":
+		store := memory.NewStore()
+		for _, token := range cfg.Tokens {
+			store.AddAuth(token, token)
+		}
+		for _, user := range cfg.Users {
+			role, ok := identity.ParseRole(user.Role)
+			if !ok {
+				return nil, fmt.Errorf("invalid role '%s' of user '%s'", user.Role, user.Username)
+			}
+			store.AddUser(user.Username, role)
+			if len(user.PasswordHash) > 0 {
+				store.SetPassword(context.Background(), user.Username, user.PasswordHash)
+			}
+			if len(user.Token) > 0 {
+				store.AddAuth(user.Token, user.Username)
+			}
+		}
+		return store, nil
 	}
 	return nil, errors.New("database does not exist")
 }
@@ -0,0 +1,88 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/rnov/Go-REST/pkg/apikey"
+	"github.com/rnov/Go-REST/pkg/errors"
+)
+
+// CreateAPIKey stores a copy of the key without its secret.
+func (s *Store) CreateAPIKey(ctx context.Context, key *apikey.Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apiKeys[key.ID]; ok {
+		return errors.NewExistErr(true)
+	}
+	s.apiKeys[key.ID] = copyKey(key)
+	return nil
+}
+
+// GetAPIKey returns a copy of the key along with its hash.
+func (s *Store) GetAPIKey(ctx context.Context, ID string) (*apikey.Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.apiKeys[ID]
+	if !ok {
+		return nil, errors.NewExistErr(false)
+	}
+	return copyKey(key), nil
+}
+
+// GetAPIKeys returns a copy of all the keys sorted by ID.
+func (s *Store) GetAPIKeys(ctx context.Context) ([]*apikey.Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]*apikey.Key, 0, len(s.apiKeys))
+	for _, key := range s.apiKeys {
+		keys = append(keys, copyKey(key))
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+// RotateAPIKey replaces the hash of the key unless it has been rotated since oldHash was read.
+func (s *Store) RotateAPIKey(ctx context.Context, ID, oldHash, newHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.apiKeys[ID]
+	if !ok {
+		return errors.NewExistErr(false)
+	}
+	if key.Hash != oldHash {
+		return errors.NewPreconditionErr()
+	}
+	key.Hash = newHash
+	return nil
+}
+
+// DeleteAPIKey removes the key, from then on it is no longer accepted.
+func (s *Store) DeleteAPIKey(ctx context.Context, ID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apiKeys[ID]; !ok {
+		return errors.NewExistErr(false)
+	}
+	delete(s.apiKeys, ID)
+	return nil
+}
+
+// copyKey - copy of the key detached from the given one, the secret is never kept.
+func copyKey(key *apikey.Key) *apikey.Key {
+	c := *key
+	c.Secret = ""
+	if key.Scopes != nil {
+		c.Scopes = append(c.Scopes[:0:0], key.Scopes...)
+	}
+	if key.ExpiresAt != nil {
+		expiresAt := *key.ExpiresAt
+		c.ExpiresAt = &expiresAt
+	}
+	return &c
+}
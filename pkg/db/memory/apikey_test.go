@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/apikey"
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
+)
+
+func TestStore_APIKeys(t *testing.T) {
+	store := NewStore()
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	first := &apikey.Key{ID: "01EC9V3P6Y8B8XWJ2Q3KZ4M5N6", Name: "ci", Role: identity.Editor,
+		Scopes: []identity.Permission{identity.CreateRecipe}, CreatedBy: "admin", ExpiresAt: &expiresAt,
+		Hash: "hash", Secret: "01EC9V3P6Y8B8XWJ2Q3KZ4M5N6.secret"}
+	second := &apikey.Key{ID: "01EC9V3P6Y8B8XWJ2Q3KZ4M5N7", Name: "backup", Role: identity.Reader, CreatedBy: "admin",
+		Hash: "other"}
+	for _, key := range []*apikey.Key{second, first} {
+		if err := store.CreateAPIKey(context.Background(), key); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := store.CreateAPIKey(context.Background(), first); err == nil || err.Error() != errors.NewExistErr(true).Error() {
+		t.Errorf("expected: '%s' instead got: '%v'", errors.NewExistErr(true), err)
+	}
+
+	stored, err := store.GetAPIKey(context.Background(), first.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := *first
+	expected.Secret = ""
+	if !reflect.DeepEqual(stored, &expected) {
+		t.Errorf("expected: '%v' instead got: '%v'", &expected, stored)
+	}
+
+	if err := store.RotateAPIKey(context.Background(), first.ID, "hash", "rotated"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// rotated in the meantime
+	if err := store.RotateAPIKey(context.Background(), first.ID, "hash", "again"); err == nil || err.Error() != errors.NewPreconditionErr().Error() {
+		t.Errorf("expected: '%s' instead got: '%v'", errors.NewPreconditionErr(), err)
+	}
+	keys, err := store.GetAPIKeys(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(keys) != 2 || keys[0].ID != first.ID || keys[0].Hash != "rotated" || keys[1].ID != second.ID {
+		t.Errorf("unexpected keys: '%v'", keys)
+	}
+
+	if err := store.DeleteAPIKey(context.Background(), first.ID); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	notExist := errors.NewExistErr(false).Error()
+	if _, err := store.GetAPIKey(context.Background(), first.ID); err == nil || err.Error() != notExist {
+		t.Errorf("expected: '%s' instead got: '%v'", notExist, err)
+	}
+	if err := store.RotateAPIKey(context.Background(), first.ID, "rotated", "again"); err == nil || err.Error() != notExist {
+		t.Errorf("expected: '%s' instead got: '%v'", notExist, err)
+	}
+	if err := store.DeleteAPIKey(context.Background(), first.ID); err == nil || err.Error() != notExist {
+		t.Errorf("expected: '%s' instead got: '%v'", notExist, err)
+	}
+}
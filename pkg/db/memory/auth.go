@@ -0,0 +1,75 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
+)
+
+// CheckAuth checks that a given hashed basic auth has been registered in the store, returns the user it belongs to.
+func (s *Store) CheckAuth(ctx context.Context, auth string) (*identity.Principal, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	username, ok := s.tokens[auth]
+	if !ok {
+		return nil, errors.NewFailedAuthErr()
+	}
+	role := identity.DefaultRole
+	if user, ok := s.users[username]; ok {
+		role = user.Role
+	}
+
+	return &identity.Principal{Username: username, Role: role}, nil
+}
+
+// GetCredentials returns the stored password hash of the user along with its role.
+func (s *Store) GetCredentials(ctx context.Context, username string) (*identity.Credentials, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[username]
+	if !ok || len(user.PasswordHash) == 0 {
+		return nil, errors.NewExistErr(false)
+	}
+	creds := *user
+
+	return &creds, nil
+}
+
+// SetPassword stores the password hash of the user, it is added with identity.DefaultRole when it does not exist.
+func (s *Store) SetPassword(ctx context.Context, username, passwordHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.user(username).PasswordHash = passwordHash
+	return nil
+}
+
+// AddAuth registers a hashed basic auth of the given user, the in-memory counterpart of inserting a `TOKEN_` key into
+// redis.
+func (s *Store) AddAuth(auth, username string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[auth] = username
+}
+
+// AddUser grants the role to the user, users that have not been added are granted identity.DefaultRole.
+func (s *Store) AddUser(username string, role identity.Role) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.user(username).Role = role
+}
+
+// user - the stored user, added with identity.DefaultRole when it does not exist. The caller must hold the lock.
+func (s *Store) user(username string) *identity.Credentials {
+	user, ok := s.users[username]
+	if !ok {
+		user = &identity.Credentials{Principal: identity.Principal{Username: username, Role: identity.DefaultRole}}
+		s.users[username] = user
+	}
+	return user
+}
@@ -0,0 +1,85 @@
+package memory
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
+)
+
+func TestStore_CheckAuth(t *testing.T) {
+	tests := []struct {
+		name              string
+		stored            map[string]string
+		users             map[string]identity.Role
+		Auth              string
+		expectedPrincipal *identity.Principal
+		expectedErr       error
+	}{
+		{
+			name:              "successful auth",
+			stored:            map[string]string{"qwertyzxcv12345": "chef"},
+			users:             map[string]identity.Role{"chef": identity.Editor},
+			Auth:              "qwertyzxcv12345",
+			expectedPrincipal: &identity.Principal{Username: "chef", Role: identity.Editor},
+		},
+		{
+			name:              "successful auth - default role",
+			stored:            map[string]string{"qwertyzxcv12345": "chef"},
+			Auth:              "qwertyzxcv12345",
+			expectedPrincipal: &identity.Principal{Username: "chef", Role: identity.DefaultRole},
+		},
+		{
+			name:        "error - auth does not exist",
+			Auth:        "qwertyzxcv12345",
+			expectedErr: errors.NewFailedAuthErr(),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewStore()
+			for auth, username := range test.stored {
+				store.AddAuth(auth, username)
+			}
+			for username, role := range test.users {
+				store.AddUser(username, role)
+			}
+			principal, err := store.CheckAuth(context.Background(), test.Auth)
+			assertErr(t, test.expectedErr, err)
+			if !reflect.DeepEqual(principal, test.expectedPrincipal) {
+				t.Errorf("expected: '%v' instead got: '%v'", test.expectedPrincipal, principal)
+			}
+		})
+	}
+}
+
+func TestStore_Credentials(t *testing.T) {
+	store := NewStore()
+	store.AddUser("chef", identity.Editor)
+	if _, err := store.GetCredentials(context.Background(), "chef"); err == nil || err.Error() != errors.NewExistErr(false).Error() {
+		t.Errorf("expected: '%s' for a user without password instead got: '%v'", errors.NewExistErr(false), err)
+	}
+
+	if err := store.SetPassword(context.Background(), "chef", "$argon2id$hash"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := store.SetPassword(context.Background(), "cook", "$2a$10$hash"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := map[string]*identity.Credentials{
+		"chef": {Principal: identity.Principal{Username: "chef", Role: identity.Editor}, PasswordHash: "$argon2id$hash"},
+		"cook": {Principal: identity.Principal{Username: "cook", Role: identity.DefaultRole}, PasswordHash: "$2a$10$hash"},
+	}
+	for username, creds := range expected {
+		stored, err := store.GetCredentials(context.Background(), username)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(stored, creds) {
+			t.Errorf("expected: '%v' instead got: '%v'", creds, stored)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package memory
+
+import (
+	"sync"
+
+	"github.com/rnov/Go-REST/pkg/apikey"
+	"github.com/rnov/Go-REST/pkg/identity"
+	"github.com/rnov/Go-REST/pkg/rate"
+	"github.com/rnov/Go-REST/pkg/recipe"
+)
+
+// Store - in-memory DB client, meant for local development and tests where running an external DB is not desired.
+// All the operations are safe for concurrent use and mimic the behaviour (and errors) of the redis proxy.
+type Store struct {
+	mu      sync.RWMutex
+	recipes map[string]*recipe.Recipe
+	rates   map[string][]*rate.Rate
+	// tokens - hashed basic auths along with the username they belong to.
+	tokens map[string]string
+	// users - role and password hash of each user, the password hash is empty until one has been stored.
+	users map[string]*identity.Credentials
+	// apiKeys - API keys by ID, along with their hash.
+	apiKeys map[string]*apikey.Key
+}
+
+func NewStore() *Store {
+	return &Store{
+		recipes: make(map[string]*recipe.Recipe),
+		rates:   make(map[string][]*rate.Rate),
+		tokens:  make(map[string]string),
+		users:   make(map[string]*identity.Credentials),
+		apiKeys: make(map[string]*apikey.Key),
+	}
+}
+
+// Close - nothing to release, the data is lost along with the store.
+func (s *Store) Close() error {
+	return nil
+}
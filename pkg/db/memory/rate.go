@@ -0,0 +1,86 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/rate"
+)
+
+// RateRecipe replaces the previous rate of the rater, the new rate is kept last as if it had just been added.
+func (s *Store) RateRecipe(ctx context.Context, recipeID string, r *rate.Rate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.recipes[recipeID]; !ok {
+		return errors.NewExistErr(false)
+	}
+	s.removeRate(recipeID, r.Rater)
+	c := *r
+	s.rates[recipeID] = append(s.rates[recipeID], &c)
+
+	return nil
+}
+
+func (s *Store) DeleteRate(ctx context.Context, recipeID, rater string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.recipes[recipeID]; !ok {
+		return errors.NewExistErr(false)
+	}
+	if !s.removeRate(recipeID, rater) {
+		return errors.NewExistErr(false)
+	}
+
+	return nil
+}
+
+// removeRate - removes the rate of the rater, if any, keeping the order of the rest. Callers must hold the lock.
+func (s *Store) removeRate(recipeID, rater string) bool {
+	rates := s.rates[recipeID]
+	for i, r := range rates {
+		if r.Rater == rater {
+			s.rates[recipeID] = append(rates[:i:i], rates[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) GetRates(ctx context.Context, recipeID string) ([]*rate.Rate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.recipes[recipeID]; !ok {
+		return nil, errors.NewExistErr(false)
+	}
+	rates := make([]*rate.Rate, 0, len(s.rates[recipeID]))
+	for _, r := range s.rates[recipeID] {
+		c := *r
+		rates = append(rates, &c)
+	}
+
+	return rates, nil
+}
+
+func (s *Store) GetRateSummary(ctx context.Context, recipeID string) (*rate.Summary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.recipes[recipeID]; !ok {
+		return nil, errors.NewExistErr(false)
+	}
+
+	return s.summary(recipeID), nil
+}
+
+// summary - aggregates the rates of a recipe, callers must hold the lock.
+func (s *Store) summary(recipeID string) *rate.Summary {
+	sum := 0
+	for _, r := range s.rates[recipeID] {
+		sum += r.Note
+	}
+
+	return rate.NewSummary(sum, len(s.rates[recipeID]))
+}
@@ -0,0 +1,130 @@
+package memory
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/rate"
+	"github.com/rnov/Go-REST/pkg/recipe"
+)
+
+func TestStore_RateRecipe(t *testing.T) {
+	tests := []struct {
+		name        string
+		stored      []*recipe.Recipe
+		ID          string
+		inputRate   *rate.Rate
+		expectedErr error
+	}{
+		{
+			name:      "successful rate",
+			stored:    []*recipe.Recipe{newTestRecipe("654321")},
+			ID:        "654321",
+			inputRate: &rate.Rate{Note: 4},
+		},
+		{
+			name:        "error - recipe does not exist",
+			ID:          "654321",
+			inputRate:   &rate.Rate{Note: 4},
+			expectedErr: errors.NewExistErr(false),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewStore()
+			for _, rcp := range test.stored {
+				_ = store.CreateRecipe(context.Background(), rcp)
+			}
+			err := store.RateRecipe(context.Background(), test.ID, test.inputRate)
+			assertErr(t, test.expectedErr, err)
+		})
+	}
+}
+
+func TestStore_GetRates(t *testing.T) {
+	tests := []struct {
+		name            string
+		stored          []*recipe.Recipe
+		rates           []*rate.Rate
+		ID              string
+		expectedSummary *rate.Summary
+		expectedErr     error
+	}{
+		{
+			name:            "successful retrieve",
+			stored:          []*recipe.Recipe{newTestRecipe("654321")},
+			rates:           []*rate.Rate{{Note: 5, Rater: "chef"}, {Note: 4, Rater: "cook"}},
+			ID:              "654321",
+			expectedSummary: &rate.Summary{Average: 4.5, Count: 2},
+		},
+		{
+			name:            "successful retrieve - not rated",
+			stored:          []*recipe.Recipe{newTestRecipe("654321")},
+			ID:              "654321",
+			expectedSummary: &rate.Summary{},
+		},
+		{
+			name:        "error - recipe does not exist",
+			ID:          "654321",
+			expectedErr: errors.NewExistErr(false),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewStore()
+			for _, rcp := range test.stored {
+				_ = store.CreateRecipe(context.Background(), rcp)
+			}
+			for _, r := range test.rates {
+				_ = store.RateRecipe(context.Background(), test.ID, r)
+			}
+			rates, err := store.GetRates(context.Background(), test.ID)
+			assertErr(t, test.expectedErr, err)
+			if err == nil && len(rates) != len(test.rates) {
+				t.Errorf("expected: '%d' rates instead got: '%d'", len(test.rates), len(rates))
+			}
+			summary, err := store.GetRateSummary(context.Background(), test.ID)
+			assertErr(t, test.expectedErr, err)
+			if summary != nil && !reflect.DeepEqual(summary, test.expectedSummary) {
+				t.Errorf("expected: '%v' instead got: '%v'", test.expectedSummary, summary)
+			}
+			if rcp, err := store.GetRecipeByID(context.Background(), test.ID); err == nil && rcp.RatingCount != test.expectedSummary.Count {
+				t.Errorf("expected recipe rating count: '%d' instead got: '%d'", test.expectedSummary.Count, rcp.RatingCount)
+			}
+		})
+	}
+}
+
+func TestStore_RateRecipe_OneVotePerRater(t *testing.T) {
+	store := NewStore()
+	_ = store.CreateRecipe(context.Background(), newTestRecipe("654321"))
+	for _, r := range []*rate.Rate{{Note: 5, Rater: "chef"}, {Note: 4, Rater: "cook"}, {Note: 1, Rater: "chef"}} {
+		if err := store.RateRecipe(context.Background(), "654321", r); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	rates, _ := store.GetRates(context.Background(), "654321")
+	expected := []*rate.Rate{{Note: 4, Rater: "cook"}, {Note: 1, Rater: "chef"}}
+	if !reflect.DeepEqual(rates, expected) {
+		t.Errorf("expected: '%v' instead got: '%v'", expected, rates)
+	}
+
+	if err := store.DeleteRate(context.Background(), "654321", "cook"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	summary, _ := store.GetRateSummary(context.Background(), "654321")
+	if expected := rate.NewSummary(1, 1); !reflect.DeepEqual(summary, expected) {
+		t.Errorf("expected: '%v' instead got: '%v'", expected, summary)
+	}
+	notExist := errors.NewExistErr(false).Error()
+	if err := store.DeleteRate(context.Background(), "654321", "cook"); err == nil || err.Error() != notExist {
+		t.Errorf("expected: '%s' instead got: '%v'", notExist, err)
+	}
+	if err := store.DeleteRate(context.Background(), "123456", "chef"); err == nil || err.Error() != notExist {
+		t.Errorf("expected: '%s' instead got: '%v'", notExist, err)
+	}
+}
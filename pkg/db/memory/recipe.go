@@ -0,0 +1,142 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/recipe"
+)
+
+func (s *Store) GetRecipeByID(ctx context.Context, ID string) (*recipe.Recipe, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rcp, ok := s.recipes[ID]
+	if !ok {
+		return nil, errors.NewExistErr(false)
+	}
+
+	return s.ratedCopy(rcp), nil
+}
+
+func (s *Store) GetRecipes(ctx context.Context, query *recipe.Query) (*recipe.Page, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	recipes := make([]*recipe.Recipe, 0, len(s.recipes))
+	for _, rcp := range s.recipes {
+		recipes = append(recipes, s.ratedCopy(rcp))
+	}
+
+	return query.Apply(recipes), nil
+}
+
+func (s *Store) CreateRecipe(ctx context.Context, rcp *recipe.Recipe) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.recipes[rcp.ID]; ok {
+		return errors.NewExistErr(true)
+	}
+	rcp.Version = 1
+	s.recipes[rcp.ID] = copyRecipe(rcp)
+
+	return nil
+}
+
+func (s *Store) CreateRecipes(ctx context.Context, rcps []*recipe.Recipe) []error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	errs := make([]error, len(rcps))
+	for i, rcp := range rcps {
+		if _, ok := s.recipes[rcp.ID]; ok {
+			errs[i] = errors.NewExistErr(true)
+			continue
+		}
+		rcp.Version = 1
+		s.recipes[rcp.ID] = copyRecipe(rcp)
+	}
+
+	return errs
+}
+
+func (s *Store) UpdateRecipe(ctx context.Context, rcp *recipe.Recipe, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.recipes[rcp.ID]
+	if !ok {
+		return errors.NewExistErr(false)
+	}
+	if version > 0 && old.Version != version {
+		return errors.NewPreconditionErr()
+	}
+	rcp.CreatedAt, rcp.Owner = old.CreatedAt, old.Owner
+	rcp.Version = old.Version + 1
+	s.recipes[rcp.ID] = copyRecipe(rcp)
+
+	return nil
+}
+
+func (s *Store) PatchRecipe(ctx context.Context, rcp *recipe.Recipe, fields []string, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.recipes[rcp.ID]
+	if !ok {
+		return errors.NewExistErr(false)
+	}
+	if version > 0 && old.Version != version {
+		return errors.NewPreconditionErr()
+	}
+	patched := copyRecipe(old)
+	recipe.CopyFields(patched, rcp, fields)
+	patched.UpdatedAt = rcp.UpdatedAt
+	patched.Version = old.Version + 1
+	s.recipes[rcp.ID] = patched
+	rcp.CreatedAt, rcp.Owner = patched.CreatedAt, patched.Owner
+	rcp.Version = patched.Version
+
+	return nil
+}
+
+func (s *Store) DeleteRecipe(ctx context.Context, ID string, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.recipes[ID]
+	if !ok {
+		return errors.NewExistErr(false)
+	}
+	if version > 0 && old.Version != version {
+		return errors.NewPreconditionErr()
+	}
+	// ratings belong to the recipe, hence they are deleted along with it
+	delete(s.recipes, ID)
+	delete(s.rates, ID)
+
+	return nil
+}
+
+// ratedCopy - copies the recipe filling its rating aggregates, callers must hold the lock.
+func (s *Store) ratedCopy(rcp *recipe.Recipe) *recipe.Recipe {
+	c := copyRecipe(rcp)
+	summary := s.summary(rcp.ID)
+	c.AverageRating = summary.Average
+	c.RatingCount = summary.Count
+
+	return c
+}
+
+// copyRecipe - the store never shares its recipes with the callers, that way data can only be modified through the store.
+func copyRecipe(rcp *recipe.Recipe) *recipe.Recipe {
+	c := *rcp
+	c.AverageRating = 0
+	c.RatingCount = 0
+	// slices would still be shared otherwise
+	c.Tags = append([]string(nil), rcp.Tags...)
+	c.Ingredients = append([]recipe.Ingredient(nil), rcp.Ingredients...)
+	c.Steps = append([]string(nil), rcp.Steps...)
+	return &c
+}
@@ -0,0 +1,411 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/rate"
+	"github.com/rnov/Go-REST/pkg/recipe"
+)
+
+func newTestRecipe(ID string) *recipe.Recipe {
+	return &recipe.Recipe{
+		ID:         ID,
+		Name:       "qwerty",
+		PrepTime:   20,
+		Difficulty: 3,
+		Vegetarian: false,
+		Servings:   4,
+		Cuisine:    "spanish",
+		Tags:       []string{"quick"},
+		Ingredients: []recipe.Ingredient{
+			{Name: "rice", Quantity: 400, Unit: "g"},
+			{Name: "egg", Quantity: 2},
+		},
+		Steps:     []string{"boil the rice", "fry the eggs"},
+		CreatedAt: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		UpdatedAt: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Version:   1,
+	}
+}
+
+func TestStore_GetRecipeByID(t *testing.T) {
+	tests := []struct {
+		name        string
+		stored      []*recipe.Recipe
+		ID          string
+		expectedRcp *recipe.Recipe
+		expectedErr error
+	}{
+		{
+			name:        "successful retrieve",
+			stored:      []*recipe.Recipe{newTestRecipe("654321")},
+			ID:          "654321",
+			expectedRcp: newTestRecipe("654321"),
+		},
+		{
+			name:        "error - recipe does not exists",
+			ID:          "654321",
+			expectedErr: errors.NewExistErr(false),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewStore()
+			for _, rcp := range test.stored {
+				_ = store.CreateRecipe(context.Background(), rcp)
+			}
+			rcp, err := store.GetRecipeByID(context.Background(), test.ID)
+			assertErr(t, test.expectedErr, err)
+			if rcp != nil {
+				if !reflect.DeepEqual(rcp, test.expectedRcp) {
+					t.Errorf("expected: '%v' instead got: '%v'", test.expectedRcp, rcp)
+				}
+			}
+		})
+	}
+}
+
+func TestStore_GetRecipes(t *testing.T) {
+	tests := []struct {
+		name          string
+		stored        []*recipe.Recipe
+		expectedCount int
+	}{
+		{
+			name:          "successful retrieve - empty",
+			expectedCount: 0,
+		},
+		{
+			name:          "successful retrieve - multiple results",
+			stored:        []*recipe.Recipe{newTestRecipe("654321"), newTestRecipe("98765")},
+			expectedCount: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewStore()
+			for _, rcp := range test.stored {
+				_ = store.CreateRecipe(context.Background(), rcp)
+			}
+			page, err := store.GetRecipes(context.Background(), &recipe.Query{})
+			if err != nil {
+				t.Errorf("unexpected error: '%s'", err)
+			}
+			if len(page.Recipes) != test.expectedCount {
+				t.Errorf("expected: '%d' recipes instead got: '%d'", test.expectedCount, len(page.Recipes))
+			}
+		})
+	}
+}
+
+func TestStore_CreateRecipe(t *testing.T) {
+	tests := []struct {
+		name        string
+		stored      []*recipe.Recipe
+		inputRcp    *recipe.Recipe
+		expectedErr error
+	}{
+		{
+			name:     "successful create",
+			inputRcp: newTestRecipe("654321"),
+		},
+		{
+			name:        "error - recipe already exists",
+			stored:      []*recipe.Recipe{newTestRecipe("654321")},
+			inputRcp:    newTestRecipe("654321"),
+			expectedErr: errors.NewExistErr(true),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewStore()
+			for _, rcp := range test.stored {
+				_ = store.CreateRecipe(context.Background(), rcp)
+			}
+			err := store.CreateRecipe(context.Background(), test.inputRcp)
+			assertErr(t, test.expectedErr, err)
+		})
+	}
+}
+
+func TestStore_CreateRecipes(t *testing.T) {
+	store := NewStore()
+	_ = store.CreateRecipe(context.Background(), newTestRecipe("111111"))
+
+	rcps := []*recipe.Recipe{newTestRecipe("222222"), newTestRecipe("111111"), newTestRecipe("222222"), newTestRecipe("333333")}
+	expected := []error{nil, errors.NewExistErr(true), errors.NewExistErr(true), nil}
+	errs := store.CreateRecipes(context.Background(), rcps)
+	if len(errs) != len(expected) {
+		t.Fatalf("expected: %d results instead got: %d", len(expected), len(errs))
+	}
+	for i, err := range errs {
+		if fmt.Sprint(err) != fmt.Sprint(expected[i]) {
+			t.Errorf("recipe %d expected: '%v' instead got: '%v'", i, expected[i], err)
+		}
+	}
+	for _, ID := range []string{"222222", "333333"} {
+		rcp, err := store.GetRecipeByID(context.Background(), ID)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if rcp.Version != 1 {
+			t.Errorf("recipe %s expected version 1 instead got: %d", ID, rcp.Version)
+		}
+	}
+}
+
+func TestStore_UpdateRecipe(t *testing.T) {
+	tests := []struct {
+		name        string
+		stored      []*recipe.Recipe
+		inputRcp    *recipe.Recipe
+		version     int64
+		expectedErr error
+	}{
+		{
+			name:   "successful update",
+			stored: []*recipe.Recipe{newTestRecipe("654321")},
+			inputRcp: &recipe.Recipe{
+				ID:         "654321",
+				Name:       "zxcvb",
+				PrepTime:   60,
+				Difficulty: 1,
+				Vegetarian: true,
+				Steps:      []string{"mix everything"},
+				UpdatedAt:  time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+			},
+		},
+		{
+			name:     "successful update - matching version",
+			stored:   []*recipe.Recipe{newTestRecipe("654321")},
+			inputRcp: newTestRecipe("654321"),
+			version:  1,
+		},
+		{
+			name:        "error - version mismatch",
+			stored:      []*recipe.Recipe{newTestRecipe("654321")},
+			inputRcp:    newTestRecipe("654321"),
+			version:     2,
+			expectedErr: errors.NewPreconditionErr(),
+		},
+		{
+			name:        "error - recipe does not exist",
+			inputRcp:    newTestRecipe("654321"),
+			expectedErr: errors.NewExistErr(false),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewStore()
+			for _, rcp := range test.stored {
+				_ = store.CreateRecipe(context.Background(), rcp)
+			}
+			err := store.UpdateRecipe(context.Background(), test.inputRcp, test.version)
+			assertErr(t, test.expectedErr, err)
+			if err != nil {
+				return
+			}
+			if !test.inputRcp.CreatedAt.Equal(test.stored[0].CreatedAt) {
+				t.Errorf("expected creation timestamp to be kept instead got: '%v'", test.inputRcp.CreatedAt)
+			}
+			if test.inputRcp.Version != 2 {
+				t.Errorf("expected: '2' version instead got: '%d'", test.inputRcp.Version)
+			}
+			rcp, _ := store.GetRecipeByID(context.Background(), test.inputRcp.ID)
+			if !reflect.DeepEqual(rcp, test.inputRcp) {
+				t.Errorf("expected: '%v' instead got: '%v'", test.inputRcp, rcp)
+			}
+		})
+	}
+}
+
+func TestStore_PatchRecipe(t *testing.T) {
+	tests := []struct {
+		name        string
+		stored      []*recipe.Recipe
+		version     int64
+		expectedErr error
+	}{
+		{
+			name:   "successful patch",
+			stored: []*recipe.Recipe{newTestRecipe("654321")},
+		},
+		{
+			name:    "successful patch - matching version",
+			stored:  []*recipe.Recipe{newTestRecipe("654321")},
+			version: 1,
+		},
+		{
+			name:        "error - version mismatch",
+			stored:      []*recipe.Recipe{newTestRecipe("654321")},
+			version:     2,
+			expectedErr: errors.NewPreconditionErr(),
+		},
+		{
+			name:        "error - recipe does not exist",
+			expectedErr: errors.NewExistErr(false),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewStore()
+			for _, rcp := range test.stored {
+				_ = store.CreateRecipe(context.Background(), rcp)
+			}
+			// only the listed fields are written
+			input := &recipe.Recipe{ID: "654321", Name: "zxcvb", PrepTime: 60, Tags: []string{"slow"},
+				UpdatedAt: time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)}
+			err := store.PatchRecipe(context.Background(), input, []string{recipe.FieldName, recipe.FieldTags}, test.version)
+			assertErr(t, test.expectedErr, err)
+			if err != nil {
+				return
+			}
+			expected := newTestRecipe("654321")
+			expected.Name, expected.Tags, expected.UpdatedAt, expected.Version = input.Name, input.Tags, input.UpdatedAt, 2
+			rcp, _ := store.GetRecipeByID(context.Background(), "654321")
+			if !reflect.DeepEqual(rcp, expected) {
+				t.Errorf("expected: '%v' instead got: '%v'", expected, rcp)
+			}
+			if !input.CreatedAt.Equal(expected.CreatedAt) || input.Version != 2 {
+				t.Errorf("expected creation timestamp and version to be set instead got: '%v', '%d'", input.CreatedAt, input.Version)
+			}
+		})
+	}
+}
+
+func TestStore_RecipeIsolation(t *testing.T) {
+	store := NewStore()
+	input := newTestRecipe("654321")
+	if err := store.CreateRecipe(context.Background(), input); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	input.Tags[0] = "modified"
+	input.Ingredients[0].Name = "modified"
+
+	rcp, _ := store.GetRecipeByID(context.Background(), "654321")
+	rcp.Steps[0] = "modified"
+
+	stored, _ := store.GetRecipeByID(context.Background(), "654321")
+	if !reflect.DeepEqual(stored, newTestRecipe("654321")) {
+		t.Errorf("expected stored recipe not to be modified instead got: '%v'", stored)
+	}
+}
+
+func TestStore_DeleteRecipe(t *testing.T) {
+	tests := []struct {
+		name        string
+		stored      []*recipe.Recipe
+		rated       bool
+		ID          string
+		version     int64
+		expectedErr error
+	}{
+		{
+			name:   "successful delete",
+			stored: []*recipe.Recipe{newTestRecipe("654321")},
+			ID:     "654321",
+		},
+		{
+			name:   "successful delete - rated recipe",
+			stored: []*recipe.Recipe{newTestRecipe("654321")},
+			rated:  true,
+			ID:     "654321",
+		},
+		{
+			name:    "successful delete - matching version",
+			stored:  []*recipe.Recipe{newTestRecipe("654321")},
+			ID:      "654321",
+			version: 1,
+		},
+		{
+			name:        "error - version mismatch",
+			stored:      []*recipe.Recipe{newTestRecipe("654321")},
+			rated:       true,
+			ID:          "654321",
+			version:     3,
+			expectedErr: errors.NewPreconditionErr(),
+		},
+		{
+			name:        "error - recipe does not exist",
+			ID:          "654321",
+			expectedErr: errors.NewExistErr(false),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewStore()
+			for _, rcp := range test.stored {
+				_ = store.CreateRecipe(context.Background(), rcp)
+				if test.rated {
+					_ = store.RateRecipe(context.Background(), rcp.ID, &rate.Rate{Note: 4})
+				}
+			}
+			err := store.DeleteRecipe(context.Background(), test.ID, test.version)
+			assertErr(t, test.expectedErr, err)
+			if _, ok := store.recipes[test.ID]; ok != (test.expectedErr != nil && len(test.stored) > 0) {
+				t.Errorf("expected recipe '%s' to be deleted only on success", test.ID)
+			}
+			if test.expectedErr != nil {
+				return
+			}
+			if _, ok := store.rates[test.ID]; ok {
+				t.Errorf("expected rates of recipe '%s' to be deleted", test.ID)
+			}
+		})
+	}
+}
+
+func TestStore_Concurrency(t *testing.T) {
+	store := NewStore()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// every goroutine races to create the same recipe, only one of them must succeed
+			if err := store.CreateRecipe(context.Background(), newTestRecipe("654321")); err == nil {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			}
+			_ = store.CreateRecipe(context.Background(), newTestRecipe(fmt.Sprintf("rcp%d", i)))
+			_ = store.RateRecipe(context.Background(), "654321", &rate.Rate{Note: 3})
+			_, _ = store.GetRecipes(context.Background(), &recipe.Query{})
+		}(i)
+	}
+	wg.Wait()
+
+	if created != 1 {
+		t.Errorf("expected: '1' successful create instead got: '%d'", created)
+	}
+	page, _ := store.GetRecipes(context.Background(), &recipe.Query{})
+	if len(page.Recipes) != 51 {
+		t.Errorf("expected: '51' recipes instead got: '%d'", len(page.Recipes))
+	}
+}
+
+// assertErr - fails when err is not the expected one, of the same type and message, or when only one of them is nil.
+func assertErr(t *testing.T, expected, err error) {
+	t.Helper()
+	if (err != nil) != (expected != nil) {
+		t.Errorf("expected: '%v' instead got: '%v'", expected, err)
+		return
+	}
+	if err != nil && (reflect.TypeOf(err) != reflect.TypeOf(expected) || err.Error() != expected.Error()) {
+		t.Errorf("expected: '%T(%s)' instead got: '%T(%s)'", expected, expected, err, err)
+	}
+}
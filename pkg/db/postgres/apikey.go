@@ -0,0 +1,127 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/rnov/Go-REST/pkg/apikey"
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
+)
+
+const (
+	// scopes are stored comma separated, permissions never contain commas
+	apiKeyColumns = `SELECT id, name, role, scopes, created_by, created_at, expires_at, hash FROM api_keys`
+	selectAPIKey  = apiKeyColumns + ` WHERE id = $1`
+	listAPIKeys   = apiKeyColumns + ` ORDER BY id`
+	insertAPIKey  = `INSERT INTO api_keys (id, name, role, scopes, created_by, created_at, expires_at, hash)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT (id) DO NOTHING`
+	rotateAPIKey = `UPDATE api_keys SET hash = $3 WHERE id = $1 AND hash = $2`
+	deleteAPIKey = `DELETE FROM api_keys WHERE id = $1`
+)
+
+func (p *Proxy) CreateAPIKey(ctx context.Context, key *apikey.Key) error {
+	scopes := make([]string, 0, len(key.Scopes))
+	for _, scope := range key.Scopes {
+		scopes = append(scopes, string(scope))
+	}
+	inserted, err := p.exec(ctx, insertAPIKey, key.ID, key.Name, string(key.Role), strings.Join(scopes, ","), key.CreatedBy,
+		key.CreatedAt, key.ExpiresAt, key.Hash)
+	if err != nil {
+		return errors.WrapDBErr(err)
+	}
+	if inserted == 0 {
+		return errors.NewExistErr(true)
+	}
+	return nil
+}
+
+// GetAPIKey queries postgres for the key along with its hash.
+func (p *Proxy) GetAPIKey(ctx context.Context, ID string) (*apikey.Key, error) {
+	key, err := scanAPIKey(p.queryRow(ctx, selectAPIKey, ID))
+	if err == sql.ErrNoRows {
+		return nil, errors.NewExistErr(false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (p *Proxy) GetAPIKeys(ctx context.Context) ([]*apikey.Key, error) {
+	rows, err := p.query(ctx, listAPIKeys)
+	if err != nil {
+		return nil, errors.WrapDBErr(err)
+	}
+	defer rows.Close()
+
+	keys := make([]*apikey.Key, 0)
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.WrapDBErr(err)
+	}
+	return keys, nil
+}
+
+// RotateAPIKey - the hash is only replaced while it is still oldHash, keys not updated either do not exist or have been
+// rotated in the meantime.
+func (p *Proxy) RotateAPIKey(ctx context.Context, ID, oldHash, newHash string) error {
+	updated, err := p.exec(ctx, rotateAPIKey, ID, oldHash, newHash)
+	if err != nil {
+		return errors.WrapDBErr(err)
+	}
+	if updated > 0 {
+		return nil
+	}
+	if _, err := p.GetAPIKey(ctx, ID); err != nil {
+		return err
+	}
+	return errors.NewPreconditionErr()
+}
+
+func (p *Proxy) DeleteAPIKey(ctx context.Context, ID string) error {
+	deleted, err := p.exec(ctx, deleteAPIKey, ID)
+	if err != nil {
+		return errors.WrapDBErr(err)
+	}
+	if deleted == 0 {
+		return errors.NewExistErr(false)
+	}
+	return nil
+}
+
+// scanAPIKey - sql.ErrNoRows is returned as it is, any other error as *errors.DBErr.
+func scanAPIKey(row scanner) (*apikey.Key, error) {
+	key := &apikey.Key{}
+	var role, scopes string
+	var expiresAt sql.NullTime
+	err := row.Scan(&key.ID, &key.Name, &role, &scopes, &key.CreatedBy, &key.CreatedAt, &expiresAt, &key.Hash)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.WrapDBErr(err)
+	}
+	r, ok := identity.ParseRole(role)
+	if !ok {
+		return nil, errors.NewDBErr(fmt.Sprintf("invalid role '%s' of API key '%s'", role, key.ID))
+	}
+	key.Role = r
+	if len(scopes) > 0 {
+		for _, scope := range strings.Split(scopes, ",") {
+			key.Scopes = append(key.Scopes, identity.Permission(scope))
+		}
+	}
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	return key, nil
+}
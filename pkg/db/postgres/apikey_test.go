@@ -0,0 +1,226 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	e "errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/apikey"
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
+)
+
+var (
+	testKeyCreatedAt = time.Date(2020, 7, 1, 10, 0, 0, 0, time.UTC)
+	testKeyExpiresAt = testKeyCreatedAt.Add(30 * 24 * time.Hour)
+)
+
+func TestProxy_GetAPIKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		accessor    *sqlAccessorMock
+		expectedKey *apikey.Key
+		expectedErr error
+	}{
+		{
+			name: "successful retrieve",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					if query != selectAPIKey || !reflect.DeepEqual(args, []interface{}{"01EC9V3P6Y8B8XWJ2Q3KZ4M5N6"}) {
+						return &rowMock{err: e.New("unexpected query")}
+					}
+					return &rowMock{values: []interface{}{"01EC9V3P6Y8B8XWJ2Q3KZ4M5N6", "ci", "editor",
+						"recipe:create,recipe:edit", "admin", testKeyCreatedAt, sql.NullTime{Time: testKeyExpiresAt, Valid: true},
+						"hash"}}
+				},
+			},
+			expectedKey: &apikey.Key{ID: "01EC9V3P6Y8B8XWJ2Q3KZ4M5N6", Name: "ci", Role: identity.Editor,
+				Scopes: []identity.Permission{identity.CreateRecipe, identity.EditRecipe}, CreatedBy: "admin",
+				CreatedAt: testKeyCreatedAt, ExpiresAt: &testKeyExpiresAt, Hash: "hash"},
+		},
+		{
+			name: "successful retrieve - without scopes nor expiration",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{values: []interface{}{"01EC9V3P6Y8B8XWJ2Q3KZ4M5N6", "ci", "reader", "", "admin",
+						testKeyCreatedAt, sql.NullTime{}, "hash"}}
+				},
+			},
+			expectedKey: &apikey.Key{ID: "01EC9V3P6Y8B8XWJ2Q3KZ4M5N6", Name: "ci", Role: identity.Reader,
+				CreatedBy: "admin", CreatedAt: testKeyCreatedAt, Hash: "hash"},
+		},
+		{
+			name: "error - key does not exist",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{err: sql.ErrNoRows}
+				},
+			},
+			expectedErr: errors.NewExistErr(false),
+		},
+		{
+			name: "error - invalid role",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{values: []interface{}{"01EC9V3P6Y8B8XWJ2Q3KZ4M5N6", "ci", "root", "", "admin",
+						testKeyCreatedAt, sql.NullTime{}, "hash"}}
+				},
+			},
+			expectedErr: errors.NewDBErr("invalid role 'root' of API key '01EC9V3P6Y8B8XWJ2Q3KZ4M5N6'"),
+		},
+		{
+			name: "error - DB query",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{err: e.New("DB error")}
+				},
+			},
+			expectedErr: errors.NewDBErr("DB error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxy := newPostgresMock(test.accessor)
+			key, err := proxy.GetAPIKey(context.Background(), "01EC9V3P6Y8B8XWJ2Q3KZ4M5N6")
+			assertErr(t, test.expectedErr, err)
+			if !reflect.DeepEqual(key, test.expectedKey) {
+				t.Errorf("expected: '%v' instead got: '%v'", test.expectedKey, key)
+			}
+		})
+	}
+}
+
+func TestProxy_GetAPIKeys(t *testing.T) {
+	accessor := &sqlAccessorMock{
+		queryAccessor: func(query string, args ...interface{}) (rowsScanner, error) {
+			if query != listAPIKeys {
+				return nil, e.New("unexpected query")
+			}
+			return &rowsMock{rows: [][]interface{}{
+				{"01EC9V3P6Y8B8XWJ2Q3KZ4M5N6", "ci", "editor", "", "admin", testKeyCreatedAt, sql.NullTime{}, "hash"},
+				{"01EC9V3P6Y8B8XWJ2Q3KZ4M5N7", "backup", "reader", "", "admin", testKeyCreatedAt, sql.NullTime{}, "other"},
+			}}, nil
+		},
+	}
+	keys, err := newPostgresMock(accessor).GetAPIKeys(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []*apikey.Key{
+		{ID: "01EC9V3P6Y8B8XWJ2Q3KZ4M5N6", Name: "ci", Role: identity.Editor, CreatedBy: "admin", CreatedAt: testKeyCreatedAt, Hash: "hash"},
+		{ID: "01EC9V3P6Y8B8XWJ2Q3KZ4M5N7", Name: "backup", Role: identity.Reader, CreatedBy: "admin", CreatedAt: testKeyCreatedAt, Hash: "other"},
+	}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected: '%v' instead got: '%v'", expected, keys)
+	}
+
+	accessor.queryAccessor = func(query string, args ...interface{}) (rowsScanner, error) {
+		return nil, e.New("DB error")
+	}
+	_, err = newPostgresMock(accessor).GetAPIKeys(context.Background())
+	assertErr(t, errors.NewDBErr("DB error"), err)
+}
+
+func TestProxy_WriteAPIKey(t *testing.T) {
+	key := &apikey.Key{ID: "01EC9V3P6Y8B8XWJ2Q3KZ4M5N6", Name: "ci", Role: identity.Editor,
+		Scopes: []identity.Permission{identity.CreateRecipe, identity.EditRecipe}, CreatedBy: "admin",
+		CreatedAt: testKeyCreatedAt, ExpiresAt: &testKeyExpiresAt, Hash: "hash", Secret: "secret"}
+	tests := []struct {
+		name         string
+		write        func(p *Proxy) error
+		expectedStmt string
+		expectedArgs []interface{}
+		affected     int64
+		execErr      error
+		// stored - row of the key looked up once nothing has been affected, sql.ErrNoRows when nil
+		stored      []interface{}
+		expectedErr error
+	}{
+		{
+			name:         "successful create",
+			write:        func(p *Proxy) error { return p.CreateAPIKey(context.Background(), key) },
+			expectedStmt: insertAPIKey,
+			expectedArgs: []interface{}{key.ID, "ci", "editor", "recipe:create,recipe:edit", "admin", testKeyCreatedAt,
+				&testKeyExpiresAt, "hash"},
+			affected: 1,
+		},
+		{
+			name:         "error - create existing key",
+			write:        func(p *Proxy) error { return p.CreateAPIKey(context.Background(), key) },
+			expectedStmt: insertAPIKey,
+			expectedArgs: []interface{}{key.ID, "ci", "editor", "recipe:create,recipe:edit", "admin", testKeyCreatedAt,
+				&testKeyExpiresAt, "hash"},
+			expectedErr: errors.NewExistErr(true),
+		},
+		{
+			name:         "successful rotate",
+			write:        func(p *Proxy) error { return p.RotateAPIKey(context.Background(), key.ID, "hash", "rotated") },
+			expectedStmt: rotateAPIKey,
+			expectedArgs: []interface{}{key.ID, "hash", "rotated"},
+			affected:     1,
+		},
+		{
+			name:         "error - rotate missing key",
+			write:        func(p *Proxy) error { return p.RotateAPIKey(context.Background(), key.ID, "hash", "rotated") },
+			expectedStmt: rotateAPIKey,
+			expectedArgs: []interface{}{key.ID, "hash", "rotated"},
+			expectedErr:  errors.NewExistErr(false),
+		},
+		{
+			name:         "error - rotate key rotated in the meantime",
+			write:        func(p *Proxy) error { return p.RotateAPIKey(context.Background(), key.ID, "hash", "rotated") },
+			expectedStmt: rotateAPIKey,
+			expectedArgs: []interface{}{key.ID, "hash", "rotated"},
+			stored: []interface{}{key.ID, "ci", "editor", "", "admin", testKeyCreatedAt, sql.NullTime{},
+				"other"},
+			expectedErr: errors.NewPreconditionErr(),
+		},
+		{
+			name:         "successful delete",
+			write:        func(p *Proxy) error { return p.DeleteAPIKey(context.Background(), key.ID) },
+			expectedStmt: deleteAPIKey,
+			expectedArgs: []interface{}{key.ID},
+			affected:     1,
+		},
+		{
+			name:         "error - delete missing key",
+			write:        func(p *Proxy) error { return p.DeleteAPIKey(context.Background(), key.ID) },
+			expectedStmt: deleteAPIKey,
+			expectedArgs: []interface{}{key.ID},
+			expectedErr:  errors.NewExistErr(false),
+		},
+		{
+			name:         "error - DB exec",
+			write:        func(p *Proxy) error { return p.DeleteAPIKey(context.Background(), key.ID) },
+			expectedStmt: deleteAPIKey,
+			expectedArgs: []interface{}{key.ID},
+			execErr:      e.New("DB error"),
+			expectedErr:  errors.NewDBErr("DB error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxy := newPostgresMock(&sqlAccessorMock{
+				execAccessor: func(query string, args ...interface{}) (int64, error) {
+					if query != test.expectedStmt || !reflect.DeepEqual(args, test.expectedArgs) {
+						return 0, e.New("unexpected statement")
+					}
+					return test.affected, test.execErr
+				},
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					if test.stored == nil {
+						return &rowMock{err: sql.ErrNoRows}
+					}
+					return &rowMock{values: test.stored}
+				},
+			})
+			err := test.write(proxy)
+			assertErr(t, test.expectedErr, err)
+		})
+	}
+}
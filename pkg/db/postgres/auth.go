@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
+)
+
+const (
+	// selectToken - the user a token belongs to along with its role, empty for users that have not been granted any.
+	selectToken = `SELECT t.name, COALESCE(u.role, '') FROM tokens t LEFT JOIN users u ON u.username = t.name
+WHERE t.hash = $1 AND (t.expires_at IS NULL OR t.expires_at > now())`
+	selectCredentials = `SELECT role, password_hash FROM users WHERE username = $1 AND password_hash <> ''`
+	upsertPassword    = `INSERT INTO users (username, password_hash) VALUES ($1, $2)
+ON CONFLICT (username) DO UPDATE SET password_hash = EXCLUDED.password_hash`
+)
+
+// CheckAuth queries postgres that a given hashed basic auth exists and has not expired, returns the user it belongs to.
+func (p *Proxy) CheckAuth(ctx context.Context, auth string) (*identity.Principal, error) {
+	var username, role string
+	err := p.queryRow(ctx, selectToken, auth).Scan(&username, &role)
+	if err == sql.ErrNoRows {
+		return nil, errors.NewFailedAuthErr()
+	}
+	if err != nil {
+		return nil, errors.WrapDBErr(err)
+	}
+	r, ok := identity.ParseRole(role)
+	if !ok {
+		return nil, errors.NewDBErr(fmt.Sprintf("invalid role '%s' of user '%s'", role, username))
+	}
+
+	return &identity.Principal{Username: username, Role: r}, nil
+}
+
+// GetCredentials queries postgres for the password hash of the user along with its role.
+func (p *Proxy) GetCredentials(ctx context.Context, username string) (*identity.Credentials, error) {
+	var role, passwordHash string
+	err := p.queryRow(ctx, selectCredentials, username).Scan(&role, &passwordHash)
+	if err == sql.ErrNoRows {
+		return nil, errors.NewExistErr(false)
+	}
+	if err != nil {
+		return nil, errors.WrapDBErr(err)
+	}
+	r, ok := identity.ParseRole(role)
+	if !ok {
+		return nil, errors.NewDBErr(fmt.Sprintf("invalid role '%s' of user '%s'", role, username))
+	}
+
+	return &identity.Credentials{Principal: identity.Principal{Username: username, Role: r}, PasswordHash: passwordHash}, nil
+}
+
+// SetPassword stores the password hash of the user, the user is inserted with the default role when it does not exist.
+func (p *Proxy) SetPassword(ctx context.Context, username, passwordHash string) error {
+	if _, err := p.exec(ctx, upsertPassword, username, passwordHash); err != nil {
+		return errors.WrapDBErr(err)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	e "errors"
+	"reflect"
+	"testing"
+
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
+)
+
+func TestProxy_CheckAuth(t *testing.T) {
+	tests := []struct {
+		name              string
+		accessor          *sqlAccessorMock
+		expectedPrincipal *identity.Principal
+		expectedErr       error
+	}{
+		{
+			name: "successful auth",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					if !reflect.DeepEqual(args, []interface{}{"qwertyzxcv12345"}) {
+						return &rowMock{err: e.New("unexpected arguments")}
+					}
+					return &rowMock{values: []interface{}{"chef", "admin"}}
+				},
+			},
+			expectedPrincipal: &identity.Principal{Username: "chef", Role: identity.Admin},
+		},
+		{
+			name: "successful auth - user without role",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{values: []interface{}{"chef", ""}}
+				},
+			},
+			expectedPrincipal: &identity.Principal{Username: "chef", Role: identity.DefaultRole},
+		},
+		{
+			name: "error - DB query",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{err: e.New("DB error")}
+				},
+			},
+			expectedErr: errors.NewDBErr("DB error"),
+		},
+		{
+			name: "error - auth does not exist",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{err: sql.ErrNoRows}
+				},
+			},
+			expectedErr: errors.NewFailedAuthErr(),
+		},
+		{
+			name: "error - invalid role",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{values: []interface{}{"chef", "root"}}
+				},
+			},
+			expectedErr: errors.NewDBErr("invalid role 'root' of user 'chef'"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxy := newPostgresMock(test.accessor)
+			principal, err := proxy.CheckAuth(context.Background(), "qwertyzxcv12345")
+			assertErr(t, test.expectedErr, err)
+			if !reflect.DeepEqual(principal, test.expectedPrincipal) {
+				t.Errorf("expected: '%v' instead got: '%v'", test.expectedPrincipal, principal)
+			}
+		})
+	}
+}
+
+func TestProxy_GetCredentials(t *testing.T) {
+	tests := []struct {
+		name          string
+		accessor      *sqlAccessorMock
+		expectedCreds *identity.Credentials
+		expectedErr   error
+	}{
+		{
+			name: "successful retrieve",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					if !reflect.DeepEqual(args, []interface{}{"chef"}) {
+						return &rowMock{err: e.New("unexpected arguments")}
+					}
+					return &rowMock{values: []interface{}{"editor", "$argon2id$hash"}}
+				},
+			},
+			expectedCreds: &identity.Credentials{Principal: identity.Principal{Username: "chef", Role: identity.Editor},
+				PasswordHash: "$argon2id$hash"},
+		},
+		{
+			name: "error - user without password",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{err: sql.ErrNoRows}
+				},
+			},
+			expectedErr: errors.NewExistErr(false),
+		},
+		{
+			name: "error - invalid role",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{values: []interface{}{"root", "$argon2id$hash"}}
+				},
+			},
+			expectedErr: errors.NewDBErr("invalid role 'root' of user 'chef'"),
+		},
+		{
+			name: "error - DB query",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{err: e.New("DB error")}
+				},
+			},
+			expectedErr: errors.NewDBErr("DB error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxy := newPostgresMock(test.accessor)
+			creds, err := proxy.GetCredentials(context.Background(), "chef")
+			assertErr(t, test.expectedErr, err)
+			if !reflect.DeepEqual(creds, test.expectedCreds) {
+				t.Errorf("expected: '%v' instead got: '%v'", test.expectedCreds, creds)
+			}
+		})
+	}
+}
+
+func TestProxy_SetPassword(t *testing.T) {
+	tests := []struct {
+		name        string
+		accessor    *sqlAccessorMock
+		expectedErr error
+	}{
+		{
+			name: "successful store",
+			accessor: &sqlAccessorMock{
+				execAccessor: func(query string, args ...interface{}) (int64, error) {
+					if query != upsertPassword || !reflect.DeepEqual(args, []interface{}{"chef", "$argon2id$hash"}) {
+						return 0, e.New("unexpected statement")
+					}
+					return 1, nil
+				},
+			},
+		},
+		{
+			name: "error - DB exec",
+			accessor: &sqlAccessorMock{
+				execAccessor: func(query string, args ...interface{}) (int64, error) {
+					return 0, e.New("DB error")
+				},
+			},
+			expectedErr: errors.NewDBErr("DB error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxy := newPostgresMock(test.accessor)
+			err := proxy.SetPassword(context.Background(), "chef", "$argon2id$hash")
+			assertErr(t, test.expectedErr, err)
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rnov/Go-REST/pkg/errors"
+)
+
+// migration - a versioned schema change, versions must be unique and increasing, applied migrations must never be edited,
+// add a new one instead.
+type migration struct {
+	version int
+	name    string
+	up      string
+}
+
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create recipes",
+		up: `CREATE TABLE IF NOT EXISTS recipes (
+	id         TEXT PRIMARY KEY,
+	name       TEXT NOT NULL,
+	prep_time  INTEGER NOT NULL,
+	difficulty INTEGER NOT NULL,
+	vegetarian BOOLEAN NOT NULL DEFAULT FALSE
+);`,
+	},
+	{
+		version: 2,
+		name:    "create ratings",
+		up: `CREATE TABLE IF NOT EXISTS ratings (
+	id         BIGSERIAL PRIMARY KEY,
+	recipe_id  TEXT NOT NULL REFERENCES recipes (id) ON DELETE CASCADE,
+	note       SMALLINT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS ratings_recipe_id_idx ON ratings (recipe_id);`,
+	},
+	{
+		version: 3,
+		name:    "create tokens",
+		up: `CREATE TABLE IF NOT EXISTS tokens (
+	hash       TEXT PRIMARY KEY,
+	name       TEXT NOT NULL DEFAULT '',
+	expires_at TIMESTAMPTZ
+);`,
+	},
+	{
+		version: 4,
+		name:    "add ratings rater",
+		up:      `ALTER TABLE ratings ADD COLUMN IF NOT EXISTS rater TEXT NOT NULL DEFAULT '';`,
+	},
+	{
+		version: 5,
+		name:    "add recipes details",
+		up: `ALTER TABLE recipes
+	ADD COLUMN IF NOT EXISTS servings    INTEGER NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS cuisine     TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS tags        JSONB NOT NULL DEFAULT '[]',
+	ADD COLUMN IF NOT EXISTS ingredients JSONB NOT NULL DEFAULT '[]',
+	ADD COLUMN IF NOT EXISTS steps       JSONB NOT NULL DEFAULT '[]',
+	ADD COLUMN IF NOT EXISTS created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+	ADD COLUMN IF NOT EXISTS updated_at  TIMESTAMPTZ NOT NULL DEFAULT now();`,
+	},
+	{
+		version: 6,
+		name:    "add recipes version",
+		up:      `ALTER TABLE recipes ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;`,
+	},
+	{
+		version: 7,
+		name:    "create users and add recipes owner",
+		up: `CREATE TABLE IF NOT EXISTS users (
+	username TEXT PRIMARY KEY,
+	role     TEXT NOT NULL DEFAULT 'reader'
+);
+ALTER TABLE recipes ADD COLUMN IF NOT EXISTS owner TEXT NOT NULL DEFAULT '';`,
+	},
+	{
+		version: 8,
+		name:    "add users password hash",
+		up:      `ALTER TABLE users ADD COLUMN IF NOT EXISTS password_hash TEXT NOT NULL DEFAULT '';`,
+	},
+	{
+		version: 9,
+		name:    "create api keys",
+		up: `CREATE TABLE IF NOT EXISTS api_keys (
+	id         TEXT PRIMARY KEY,
+	name       TEXT NOT NULL,
+	role       TEXT NOT NULL,
+	scopes     TEXT NOT NULL DEFAULT '',
+	created_by TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	expires_at TIMESTAMPTZ,
+	hash       TEXT NOT NULL
+);`,
+	},
+	{
+		version: 10,
+		name:    "add ratings username",
+		// rates of anonymous raters, identified by their address, are left without username
+		up: `ALTER TABLE ratings ADD COLUMN IF NOT EXISTS username TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS ratings_recipe_id_username_idx ON ratings (recipe_id, username);`,
+	},
+}
+
+// migrationsLock - key of the advisory lock held while migrating, replicas starting at once migrate one after another.
+const migrationsLock = 7391046382
+
+const (
+	lockMigrations        = `SELECT pg_advisory_xact_lock($1)`
+	createMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    INTEGER PRIMARY KEY,
+	name       TEXT NOT NULL,
+	applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+	currentVersion  = `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`
+	insertMigration = `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`
+)
+
+// Migrate - brings the DB schema up to date by applying, in order, all the migrations newer than the current version.
+// Migrations are applied in a single transaction holding the migrations lock, either all of them are applied or none,
+// and replicas waiting for the lock find the schema up to date once they get it.
+func (p *Proxy) Migrate(ctx context.Context) error {
+	err := p.transaction(ctx, func(tx sqlAccessor) error {
+		if _, err := tx.exec(lockMigrations, migrationsLock); err != nil {
+			return errors.NewDBErr(fmt.Sprintf("error locking migrations: %s", err.Error()))
+		}
+		if _, err := tx.exec(createMigrationsTable); err != nil {
+			return errors.NewDBErr(fmt.Sprintf("error creating migrations table: %s", err.Error()))
+		}
+		var version int
+		if err := tx.queryRow(currentVersion).Scan(&version); err != nil {
+			return errors.NewDBErr(fmt.Sprintf("error reading schema version: %s", err.Error()))
+		}
+
+		for _, m := range migrations {
+			if m.version <= version {
+				continue
+			}
+			if _, err := tx.exec(m.up); err != nil {
+				return errors.NewDBErr(fmt.Sprintf("error applying migration %d (%s): %s", m.version, m.name, err.Error()))
+			}
+			if _, err := tx.exec(insertMigration, m.version, m.name); err != nil {
+				return errors.NewDBErr(fmt.Sprintf("error recording migration %d (%s): %s", m.version, m.name, err.Error()))
+			}
+		}
+		return nil
+	})
+	switch err.(type) {
+	case nil, *errors.DBErr:
+		return err
+	}
+	return errors.WrapDBErr(err)
+}
@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"sync"
+	"testing"
+)
+
+// postgresDSNEnv - DSN of the postgres instance the integration tests are run against, they are skipped when unset,
+// e.g. "host=localhost port=5432 user=postgres password=postgres dbname=gorest_test sslmode=disable".
+const postgresDSNEnv = "POSTGRES_DSN"
+
+func openIntegrationDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv(postgresDSNEnv)
+	if len(dsn) == 0 {
+		t.Skipf("%s not set, skipping integration test", postgresDSNEnv)
+	}
+	client, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("error opening postgres: %s", err)
+	}
+	if err := client.Ping(); err != nil {
+		t.Fatalf("error connecting to postgres: %s", err)
+	}
+	return client
+}
+
+// TestProxy_Migrate_Integration - replicas migrating at once wait for each other, every migration is applied once.
+func TestProxy_Migrate_Integration(t *testing.T) {
+	client := openIntegrationDB(t)
+	defer client.Close()
+
+	const replicas = 3
+	errs := make([]error, replicas)
+	var wg sync.WaitGroup
+	for i := 0; i < replicas; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = NewPostgresProxy(client).Migrate(context.Background())
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("replica %d: unexpected error: %s", i, err)
+		}
+	}
+
+	var version, applied int
+	if err := client.QueryRow(`SELECT MAX(version), COUNT(*) FROM schema_migrations`).Scan(&version, &applied); err != nil {
+		t.Fatalf("error reading schema version: %s", err)
+	}
+	if last := migrations[len(migrations)-1].version; version != last || applied != len(migrations) {
+		t.Errorf("expected version %d with %d migrations instead got: %d with %d", last, len(migrations), version, applied)
+	}
+	var exists bool
+	if err := client.QueryRow(`SELECT to_regclass('api_keys') IS NOT NULL`).Scan(&exists); err != nil || !exists {
+		t.Errorf("expected the api_keys table to be created ('%v')", err)
+	}
+}
@@ -0,0 +1,109 @@
+package postgres
+
+import (
+	"context"
+	e "errors"
+	"strings"
+	"testing"
+
+	"github.com/rnov/Go-REST/pkg/errors"
+)
+
+func TestProxy_Migrate(t *testing.T) {
+	tests := []struct {
+		name            string
+		version         int
+		versionErr      error
+		execErr         error
+		failing         string
+		expectedApplied int
+		expectedErr     error
+	}{
+		{
+			name:            "successful migration - empty DB",
+			version:         0,
+			expectedApplied: len(migrations),
+		},
+		{
+			name:            "successful migration - partially migrated DB",
+			version:         1,
+			expectedApplied: len(migrations) - 1,
+		},
+		{
+			name:            "successful migration - up to date DB",
+			version:         migrations[len(migrations)-1].version,
+			expectedApplied: 0,
+		},
+		{
+			name:        "error - reading schema version",
+			versionErr:  e.New("DB issue"),
+			expectedErr: errors.NewDBErr("error reading schema version: DB issue"),
+		},
+		{
+			name:        "error - locking migrations",
+			execErr:     e.New("DB issue"),
+			failing:     "pg_advisory_xact_lock",
+			expectedErr: errors.NewDBErr("error locking migrations: DB issue"),
+		},
+		{
+			name:        "error - creating migrations table",
+			execErr:     e.New("DB issue"),
+			failing:     "CREATE TABLE IF NOT EXISTS schema_migrations",
+			expectedErr: errors.NewDBErr("error creating migrations table: DB issue"),
+		},
+		{
+			name:        "error - applying migration",
+			version:     1,
+			execErr:     e.New("DB issue"),
+			failing:     "CREATE TABLE IF NOT EXISTS ratings",
+			expectedErr: errors.NewDBErr("error applying migration 2 (create ratings): DB issue"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			applied, locked, transactions := 0, false, 0
+			accessor := &sqlAccessorMock{
+				execAccessor: func(query string, args ...interface{}) (int64, error) {
+					if test.execErr != nil && strings.Contains(query, test.failing) {
+						return 0, test.execErr
+					}
+					if strings.Contains(query, "pg_advisory_xact_lock") {
+						locked = true
+					}
+					if !locked {
+						t.Errorf("expected '%s' to be run holding the migrations lock", query)
+					}
+					if strings.Contains(query, "INSERT INTO schema_migrations") {
+						applied++
+					}
+					return 0, nil
+				},
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{values: []interface{}{test.version}, err: test.versionErr}
+				},
+			}
+			accessor.transactionAccessor = func(fn func(tx sqlAccessor) error) error {
+				transactions++
+				return fn(accessor)
+			}
+			proxy := newPostgresMock(accessor)
+			err := proxy.Migrate(context.Background())
+			if transactions != 1 {
+				t.Errorf("expected the migrations to be applied in one transaction instead got: %d", transactions)
+			}
+			assertErr(t, test.expectedErr, err)
+			if err == nil && applied != test.expectedApplied {
+				t.Errorf("expected: '%d' applied migrations instead got: '%d'", test.expectedApplied, applied)
+			}
+		})
+	}
+}
+
+func TestMigrations_Versions(t *testing.T) {
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].version <= migrations[i-1].version {
+			t.Errorf("migration '%s' version must be greater than '%s' version", migrations[i].name, migrations[i-1].name)
+		}
+	}
+}
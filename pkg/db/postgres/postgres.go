@@ -0,0 +1,217 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	// registers the "postgres" driver for database/sql
+	_ "github.com/lib/pq"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/rnov/Go-REST/pkg/tracing"
+)
+
+// scanner - satisfied by *sql.Row, allows to mock single row results.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// rowsScanner - satisfied by *sql.Rows, allows to mock multiple row results.
+type rowsScanner interface {
+	scanner
+	Next() bool
+	Err() error
+	Close() error
+}
+
+// sqlAccessor - to be able to mock postgres DB access without 3th parties or running any instance.
+type sqlAccessor interface {
+	exec(query string, args ...interface{}) (int64, error)
+	queryRow(query string, args ...interface{}) scanner
+	query(query string, args ...interface{}) (rowsScanner, error)
+	// transaction - runs fn within a transaction, committed whenever fn succeeds and rolled back otherwise.
+	transaction(fn func(tx sqlAccessor) error) error
+}
+
+// Proxy - postgres client - mock field is the same compromise taken in the redis proxy, *sql.DB is a struct.
+type Proxy struct {
+	main *sql.DB
+	mock sqlAccessor
+}
+
+func NewPostgresProxy(client *sql.DB) *Proxy {
+	return &Proxy{
+		main: client,
+	}
+}
+
+// Close - closes the connections to postgres, waiting for the queries in progress to finish.
+func (p *Proxy) Close() error {
+	if p.mock != nil {
+		return nil
+	}
+	return p.main.Close()
+}
+
+func newPostgresMock(sa sqlAccessor) *Proxy {
+	return &Proxy{
+		mock: sa,
+	}
+}
+
+func NewPostgresClient(host string, port int, user, password, dbName, sslMode string) (*sql.DB, error) {
+	if len(sslMode) == 0 {
+		sslMode = "disable"
+	}
+	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s", host, port, user, password, dbName, sslMode)
+	return sql.Open("postgres", dsn)
+}
+
+// exec - runs a statement on behalf of ctx and returns the number of affected rows. Statements are neither sent nor
+// waited for once ctx is done.
+func (p *Proxy) exec(ctx context.Context, query string, args ...interface{}) (affected int64, err error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if p.mock != nil {
+		return p.mock.exec(query, args...)
+	}
+	ctx, span := startRoundTrip(ctx, query)
+	defer func() { tracing.End(span, err) }()
+	res, err := p.main.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, interrupted(ctx, err)
+	}
+	return res.RowsAffected()
+}
+
+// queryRow - the round trip is traced up to the query being sent, the row is read once scanned.
+func (p *Proxy) queryRow(ctx context.Context, query string, args ...interface{}) scanner {
+	if err := ctx.Err(); err != nil {
+		return errRow{err: err}
+	}
+	if p.mock != nil {
+		return p.mock.queryRow(query, args...)
+	}
+	ctx, span := startRoundTrip(ctx, query)
+	defer span.End()
+	return &row{ctx: ctx, row: p.main.QueryRowContext(ctx, query, args...)}
+}
+
+func (p *Proxy) query(ctx context.Context, query string, args ...interface{}) (rows rowsScanner, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if p.mock != nil {
+		return p.mock.query(query, args...)
+	}
+	ctx, span := startRoundTrip(ctx, query)
+	defer func() { tracing.End(span, err) }()
+	res, err := p.main.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, interrupted(ctx, err)
+	}
+	return res, nil
+}
+
+// transaction - runs fn within a transaction bound to ctx, see sqlAccessor. Errors returned by fn are returned as they
+// are.
+func (p *Proxy) transaction(ctx context.Context, fn func(tx sqlAccessor) error) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if p.mock != nil {
+		return p.mock.transaction(fn)
+	}
+	ctx, span := tracing.Start(ctx, "postgres transaction", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgres))
+	defer func() { tracing.End(span, err) }()
+	tx, err := p.main.BeginTx(ctx, nil)
+	if err != nil {
+		return interrupted(ctx, err)
+	}
+	if err := fn(&sqlTx{ctx: ctx, tx: tx}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return interrupted(ctx, tx.Commit())
+}
+
+// sqlTx - sqlAccessor on top of a *sql.Tx, its statements are bound to ctx.
+type sqlTx struct {
+	ctx context.Context
+	tx  *sql.Tx
+}
+
+func (st *sqlTx) exec(query string, args ...interface{}) (affected int64, err error) {
+	ctx, span := startRoundTrip(st.ctx, query)
+	defer func() { tracing.End(span, err) }()
+	res, err := st.tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, interrupted(ctx, err)
+	}
+	return res.RowsAffected()
+}
+
+func (st *sqlTx) queryRow(query string, args ...interface{}) scanner {
+	ctx, span := startRoundTrip(st.ctx, query)
+	defer span.End()
+	return &row{ctx: ctx, row: st.tx.QueryRowContext(ctx, query, args...)}
+}
+
+func (st *sqlTx) query(query string, args ...interface{}) (rows rowsScanner, err error) {
+	ctx, span := startRoundTrip(st.ctx, query)
+	defer func() { tracing.End(span, err) }()
+	res, err := st.tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, interrupted(ctx, err)
+	}
+	return res, nil
+}
+
+// transaction - nested transactions are part of the enclosing one.
+func (st *sqlTx) transaction(fn func(tx sqlAccessor) error) error {
+	return fn(st)
+}
+
+// interrupted - statements interrupted since ctx is done are reported by postgres as canceled, the error tells the
+// reason instead (see errors.WrapDBErr).
+func interrupted(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil || err == ctx.Err() {
+		return err
+	}
+	return fmt.Errorf("%w: %s", ctx.Err(), err.Error())
+}
+
+// row - row read on behalf of ctx, see interrupted.
+type row struct {
+	ctx context.Context
+	row *sql.Row
+}
+
+func (r *row) Scan(dest ...interface{}) error {
+	return interrupted(r.ctx, r.row.Scan(dest...))
+}
+
+// errRow - row of a query that has not been sent, scanning it fails with err.
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(dest ...interface{}) error {
+	return r.err
+}
+
+// startRoundTrip - span of a statement sent to postgres, named after its operation, e.g. "postgres SELECT".
+func startRoundTrip(ctx context.Context, query string) (context.Context, trace.Span) {
+	var operation string
+	if words := strings.Fields(query); len(words) > 0 {
+		operation = strings.ToUpper(words[0])
+	}
+	return tracing.Start(ctx, "postgres "+operation, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgres, semconv.DBOperationKey.String(operation),
+			semconv.DBStatementKey.String(query)))
+}
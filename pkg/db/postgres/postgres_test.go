@@ -0,0 +1,144 @@
+package postgres
+
+import (
+	"context"
+	e "errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/recipe"
+)
+
+type sqlAccessorMock struct {
+	execAccessor     func(query string, args ...interface{}) (int64, error)
+	queryRowAccessor func(query string, args ...interface{}) scanner
+	queryAccessor    func(query string, args ...interface{}) (rowsScanner, error)
+	// transactionAccessor - fn is run against the mock itself when not given.
+	transactionAccessor func(fn func(tx sqlAccessor) error) error
+}
+
+func (sm *sqlAccessorMock) exec(query string, args ...interface{}) (int64, error) {
+	if sm.execAccessor != nil {
+		return sm.execAccessor(query, args...)
+	}
+	panic("Not implemented")
+}
+
+func (sm *sqlAccessorMock) queryRow(query string, args ...interface{}) scanner {
+	if sm.queryRowAccessor != nil {
+		return sm.queryRowAccessor(query, args...)
+	}
+	panic("Not implemented")
+}
+
+func (sm *sqlAccessorMock) query(query string, args ...interface{}) (rowsScanner, error) {
+	if sm.queryAccessor != nil {
+		return sm.queryAccessor(query, args...)
+	}
+	panic("Not implemented")
+}
+
+func (sm *sqlAccessorMock) transaction(fn func(tx sqlAccessor) error) error {
+	if sm.transactionAccessor != nil {
+		return sm.transactionAccessor(fn)
+	}
+	return fn(sm)
+}
+
+// rowMock - stand-in for *sql.Row, either returns err or copies values into the destinations.
+type rowMock struct {
+	values []interface{}
+	err    error
+}
+
+func (rm *rowMock) Scan(dest ...interface{}) error {
+	if rm.err != nil {
+		return rm.err
+	}
+	return assign(rm.values, dest)
+}
+
+// rowsMock - stand-in for *sql.Rows, iterates over the given rows.
+type rowsMock struct {
+	rows [][]interface{}
+	pos  int
+	err  error
+}
+
+func (rm *rowsMock) Next() bool {
+	if rm.pos >= len(rm.rows) {
+		return false
+	}
+	rm.pos++
+	return true
+}
+
+func (rm *rowsMock) Scan(dest ...interface{}) error {
+	return assign(rm.rows[rm.pos-1], dest)
+}
+
+func (rm *rowsMock) Err() error {
+	return rm.err
+}
+
+func (rm *rowsMock) Close() error {
+	return nil
+}
+
+// assign - copies each value into its destination pointer, mimicking database/sql conversions for the mocked types.
+func assign(values []interface{}, dest []interface{}) error {
+	if len(values) != len(dest) {
+		return fmt.Errorf("expected %d destination arguments in Scan, not %d", len(values), len(dest))
+	}
+	for i, v := range values {
+		d := reflect.ValueOf(dest[i])
+		if d.Kind() != reflect.Ptr || d.IsNil() {
+			return fmt.Errorf("destination %d is not a pointer", i)
+		}
+		val := reflect.ValueOf(v)
+		if !val.Type().ConvertibleTo(d.Elem().Type()) {
+			return fmt.Errorf("converting %T to %s is unsupported", v, d.Elem().Type())
+		}
+		d.Elem().Set(val.Convert(d.Elem().Type()))
+	}
+
+	return nil
+}
+
+func TestProxy_Interrupted(t *testing.T) {
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	// no statement is sent once the request is done, the accessor panics otherwise
+	_, err := newPostgresMock(&sqlAccessorMock{}).GetRecipeByID(expired, "654321")
+	if dbErr, ok := err.(*errors.DBErr); !ok || !dbErr.Timeout() {
+		t.Errorf("expected DB error due to timeout instead got: '%v'", err)
+	}
+	_, err = newPostgresMock(&sqlAccessorMock{}).GetRecipes(expired, &recipe.Query{Limit: 10})
+	if dbErr, ok := err.(*errors.DBErr); !ok || !dbErr.Timeout() {
+		t.Errorf("expected DB error due to timeout instead got: '%v'", err)
+	}
+
+	// postgres reports interrupted statements as canceled ones
+	canceled := e.New("pq: canceling statement due to user request")
+	if err := interrupted(expired, canceled); !e.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded instead got: '%v'", err)
+	}
+	if err := interrupted(context.Background(), canceled); err != canceled {
+		t.Errorf("expected the error as is instead got: '%v'", err)
+	}
+}
+
+// assertErr - fails when err is not the expected one, of the same type and message, or when only one of them is nil.
+func assertErr(t *testing.T, expected, err error) {
+	t.Helper()
+	if (err != nil) != (expected != nil) {
+		t.Errorf("expected: '%v' instead got: '%v'", expected, err)
+		return
+	}
+	if err != nil && (reflect.TypeOf(err) != reflect.TypeOf(expected) || err.Error() != expected.Error()) {
+		t.Errorf("expected: '%T(%s)' instead got: '%T(%s)'", expected, expected, err, err)
+	}
+}
@@ -0,0 +1,89 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/rate"
+)
+
+const (
+	// insertRate - only inserts whenever the recipe exists, that way existence check and insertion are a single statement.
+	// The previous rate of the user is replaced.
+	insertRate = `INSERT INTO ratings (recipe_id, note, rater, username, created_at) SELECT $1, $2, $3, $3, $4
+WHERE EXISTS (SELECT 1 FROM recipes WHERE id = $1)
+ON CONFLICT (recipe_id, username) DO UPDATE SET note = EXCLUDED.note, created_at = EXCLUDED.created_at`
+	deleteRate        = `DELETE FROM ratings WHERE recipe_id = $1 AND username = $2`
+	existsRecipe      = `SELECT EXISTS (SELECT 1 FROM recipes WHERE id = $1)`
+	selectRates       = `SELECT note, rater, created_at FROM ratings WHERE recipe_id = $1 ORDER BY created_at, id`
+	selectRateSummary = `SELECT COALESCE(SUM(ra.note), 0), COUNT(ra.note)
+FROM recipes r LEFT JOIN ratings ra ON ra.recipe_id = r.id WHERE r.id = $1 GROUP BY r.id`
+)
+
+func (p *Proxy) RateRecipe(ctx context.Context, recipeID string, rate *rate.Rate) error {
+	inserted, err := p.exec(ctx, insertRate, recipeID, rate.Note, rate.Rater, rate.CreatedAt)
+	if err != nil {
+		return errors.WrapDBErr(err)
+	}
+	if inserted == 0 {
+		return errors.NewExistErr(false)
+	}
+
+	return nil
+}
+
+// DeleteRate - a missing recipe can not be told apart from a missing rate, both are reported as not existing.
+func (p *Proxy) DeleteRate(ctx context.Context, recipeID, rater string) error {
+	deleted, err := p.exec(ctx, deleteRate, recipeID, rater)
+	if err != nil {
+		return errors.WrapDBErr(err)
+	}
+	if deleted == 0 {
+		return errors.NewExistErr(false)
+	}
+
+	return nil
+}
+
+func (p *Proxy) GetRates(ctx context.Context, recipeID string) ([]*rate.Rate, error) {
+	var exist bool
+	if err := p.queryRow(ctx, existsRecipe, recipeID).Scan(&exist); err != nil {
+		return nil, errors.WrapDBErr(err)
+	}
+	if !exist {
+		return nil, errors.NewExistErr(false)
+	}
+	rows, err := p.query(ctx, selectRates, recipeID)
+	if err != nil {
+		return nil, errors.WrapDBErr(err)
+	}
+	defer rows.Close()
+
+	rates := make([]*rate.Rate, 0)
+	for rows.Next() {
+		r := &rate.Rate{}
+		if err := rows.Scan(&r.Note, &r.Rater, &r.CreatedAt); err != nil {
+			return nil, errors.WrapDBErr(err)
+		}
+		rates = append(rates, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.WrapDBErr(err)
+	}
+
+	return rates, nil
+}
+
+func (p *Proxy) GetRateSummary(ctx context.Context, recipeID string) (*rate.Summary, error) {
+	var sum, count int
+	err := p.queryRow(ctx, selectRateSummary, recipeID).Scan(&sum, &count)
+	if err == sql.ErrNoRows {
+		return nil, errors.NewExistErr(false)
+	}
+	if err != nil {
+		return nil, errors.WrapDBErr(err)
+	}
+
+	return rate.NewSummary(sum, count), nil
+}
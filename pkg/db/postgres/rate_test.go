@@ -0,0 +1,200 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	e "errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/rate"
+)
+
+func TestProxy_RateRecipe(t *testing.T) {
+	tests := []struct {
+		name        string
+		accessor    *sqlAccessorMock
+		expectedErr error
+	}{
+		{
+			name: "successful rate",
+			accessor: &sqlAccessorMock{
+				execAccessor: func(query string, args ...interface{}) (int64, error) {
+					return 1, nil
+				},
+			},
+		},
+		{
+			name: "error - recipe does not exist",
+			accessor: &sqlAccessorMock{
+				execAccessor: func(query string, args ...interface{}) (int64, error) {
+					return 0, nil
+				},
+			},
+			expectedErr: errors.NewExistErr(false),
+		},
+		{
+			name: "error - writing rate in DB",
+			accessor: &sqlAccessorMock{
+				execAccessor: func(query string, args ...interface{}) (int64, error) {
+					return 0, e.New("DB error")
+				},
+			},
+			expectedErr: errors.NewDBErr("DB error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxy := newPostgresMock(test.accessor)
+			err := proxy.RateRecipe(context.Background(), "654321", &rate.Rate{Note: 4})
+			assertErr(t, test.expectedErr, err)
+		})
+	}
+}
+
+func TestProxy_DeleteRate(t *testing.T) {
+	tests := []struct {
+		name        string
+		accessor    *sqlAccessorMock
+		expectedErr error
+	}{
+		{
+			name: "successful delete",
+			accessor: &sqlAccessorMock{
+				execAccessor: func(query string, args ...interface{}) (int64, error) {
+					if query != deleteRate || !reflect.DeepEqual(args, []interface{}{"654321", "chef"}) {
+						return 0, e.New("unexpected statement")
+					}
+					return 1, nil
+				},
+			},
+		},
+		{
+			name: "error - rate does not exist",
+			accessor: &sqlAccessorMock{
+				execAccessor: func(query string, args ...interface{}) (int64, error) {
+					return 0, nil
+				},
+			},
+			expectedErr: errors.NewExistErr(false),
+		},
+		{
+			name: "error - deleting rate in DB",
+			accessor: &sqlAccessorMock{
+				execAccessor: func(query string, args ...interface{}) (int64, error) {
+					return 0, e.New("DB error")
+				},
+			},
+			expectedErr: errors.NewDBErr("DB error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxy := newPostgresMock(test.accessor)
+			err := proxy.DeleteRate(context.Background(), "654321", "chef")
+			assertErr(t, test.expectedErr, err)
+		})
+	}
+}
+
+func TestProxy_GetRates(t *testing.T) {
+	createdAt := time.Date(2020, 10, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		accessor      *sqlAccessorMock
+		expectedRates []*rate.Rate
+		expectedErr   error
+	}{
+		{
+			name: "successful retrieve",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{values: []interface{}{true}}
+				},
+				queryAccessor: func(query string, args ...interface{}) (rowsScanner, error) {
+					return &rowsMock{rows: [][]interface{}{{5, "10.0.0.1", createdAt}}}, nil
+				},
+			},
+			expectedRates: []*rate.Rate{{Note: 5, Rater: "10.0.0.1", CreatedAt: createdAt}},
+		},
+		{
+			name: "error - recipe does not exist",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{values: []interface{}{false}}
+				},
+			},
+			expectedErr: errors.NewExistErr(false),
+		},
+		{
+			name: "error - DB query",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{values: []interface{}{true}}
+				},
+				queryAccessor: func(query string, args ...interface{}) (rowsScanner, error) {
+					return nil, e.New("DB error")
+				},
+			},
+			expectedErr: errors.NewDBErr("DB error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxy := newPostgresMock(test.accessor)
+			rates, err := proxy.GetRates(context.Background(), "654321")
+			assertErr(t, test.expectedErr, err)
+			if rates != nil {
+				if !reflect.DeepEqual(rates, test.expectedRates) {
+					t.Errorf("expected: '%v' instead got: '%v'", test.expectedRates, rates)
+				}
+			}
+		})
+	}
+}
+
+func TestProxy_GetRateSummary(t *testing.T) {
+	tests := []struct {
+		name            string
+		accessor        *sqlAccessorMock
+		expectedSummary *rate.Summary
+		expectedErr     error
+	}{
+		{
+			name: "successful retrieve",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{values: []interface{}{10, 3}}
+				},
+			},
+			expectedSummary: &rate.Summary{Average: 3.33, Count: 3},
+		},
+		{
+			name: "error - recipe does not exist",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{err: sql.ErrNoRows}
+				},
+			},
+			expectedErr: errors.NewExistErr(false),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxy := newPostgresMock(test.accessor)
+			summary, err := proxy.GetRateSummary(context.Background(), "654321")
+			assertErr(t, test.expectedErr, err)
+			if summary != nil {
+				if !reflect.DeepEqual(summary, test.expectedSummary) {
+					t.Errorf("expected: '%v' instead got: '%v'", test.expectedSummary, summary)
+				}
+			}
+		})
+	}
+}
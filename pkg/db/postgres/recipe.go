@@ -0,0 +1,434 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/rate"
+	"github.com/rnov/Go-REST/pkg/recipe"
+)
+
+const (
+	// recipeColumns - recipe fields along with the sum and count of its ratings.
+	recipeColumns = `SELECT r.id, r.name, r.prep_time, r.difficulty, r.vegetarian, r.servings, r.cuisine, r.tags, r.ingredients,
+r.steps, r.created_at, r.updated_at, r.version, r.owner, COALESCE(SUM(ra.note), 0), COUNT(ra.note)
+FROM recipes r LEFT JOIN ratings ra ON ra.recipe_id = r.id`
+	selectRecipe = recipeColumns + ` WHERE r.id = $1 GROUP BY r.id`
+	// listRecipes - aggregated recipes are wrapped so that filters and ordering can be applied on the rating too.
+	listRecipes = `SELECT id, name, prep_time, difficulty, vegetarian, servings, cuisine, tags, ingredients, steps, created_at,
+updated_at, version, owner, rating_sum, rating_count FROM (
+SELECT r.*, COALESCE(SUM(ra.note), 0) AS rating_sum, COUNT(ra.note) AS rating_count
+FROM recipes r LEFT JOIN ratings ra ON ra.recipe_id = r.id GROUP BY r.id) rs`
+	insertRecipe = `INSERT INTO recipes (id, name, prep_time, difficulty, vegetarian, servings, cuisine, tags, ingredients, steps,
+created_at, updated_at, owner) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+ON CONFLICT (id) DO NOTHING`
+	// insertRecipes - multi-row counterpart of insertRecipe, the IDs of the inserted recipes are returned.
+	insertRecipes = `INSERT INTO recipes (id, name, prep_time, difficulty, vegetarian, servings, cuisine, tags, ingredients, steps,
+created_at, updated_at, owner) VALUES %s ON CONFLICT (id) DO NOTHING RETURNING id`
+	// updateRecipe - neither the creation timestamp nor the owner are updated, they are returned instead along with the new
+	// version. A version equal to 0 matches any stored version.
+	updateRecipe = `UPDATE recipes SET name = $2, prep_time = $3, difficulty = $4, vegetarian = $5, servings = $6, cuisine = $7,
+tags = $8, ingredients = $9, steps = $10, updated_at = $11, version = version + 1
+WHERE id = $1 AND ($12::BIGINT = 0 OR version = $12) RETURNING created_at, owner, version`
+	// ratings are removed by the foreign key cascade
+	deleteRecipe = `DELETE FROM recipes WHERE id = $1 AND ($2::BIGINT = 0 OR version = $2)`
+	// recipeExists - tells apart a missing recipe from a version mismatch once a conditional write has not matched any row.
+	recipeExists = `SELECT EXISTS (SELECT 1 FROM recipes WHERE id = $1)`
+)
+
+func (p *Proxy) GetRecipeByID(ctx context.Context, ID string) (*recipe.Recipe, error) {
+	rcp, err := scanRecipe(p.queryRow(ctx, selectRecipe, ID))
+	if err == sql.ErrNoRows {
+		return nil, errors.NewExistErr(false)
+	}
+	if err != nil {
+		return nil, errors.WrapDBErr(err)
+	}
+
+	return rcp, nil
+}
+
+func (p *Proxy) GetRecipes(ctx context.Context, query *recipe.Query) (*recipe.Page, error) {
+	stmt, args, err := buildListQuery(query)
+	if err != nil {
+		return nil, errors.WrapDBErr(err)
+	}
+	rows, err := p.query(ctx, stmt, args...)
+	if err != nil {
+		return nil, errors.WrapDBErr(err)
+	}
+	defer rows.Close()
+
+	recipes := make([]*recipe.Recipe, 0)
+	for rows.Next() {
+		rcp, err := scanRecipe(rows)
+		if err != nil {
+			return nil, errors.WrapDBErr(err)
+		}
+		recipes = append(recipes, rcp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.WrapDBErr(err)
+	}
+
+	return query.NewPage(recipes), nil
+}
+
+func (p *Proxy) CreateRecipe(ctx context.Context, rcp *recipe.Recipe) error {
+	details, err := marshalDetails(rcp)
+	if err != nil {
+		return errors.WrapDBErr(err)
+	}
+	inserted, err := p.exec(ctx, insertRecipe, rcp.ID, rcp.Name, rcp.PrepTime, rcp.Difficulty, rcp.Vegetarian, rcp.Servings,
+		rcp.Cuisine, details[0], details[1], details[2], rcp.CreatedAt, rcp.UpdatedAt, rcp.Owner)
+	if err != nil {
+		return errors.WrapDBErr(err)
+	}
+	if inserted == 0 {
+		return errors.NewExistErr(true)
+	}
+	// stored with the default version
+	rcp.Version = 1
+
+	return nil
+}
+
+// maxInsertRows - recipes inserted per statement, keeps the number of parameters well below the postgres limit.
+const maxInsertRows = 500
+
+// CreateRecipes - recipes are inserted in batches of multi-row statements, duplicates are skipped by the conflict clause
+// and told apart by the returned IDs.
+func (p *Proxy) CreateRecipes(ctx context.Context, rcps []*recipe.Recipe) []error {
+	errs := make([]error, len(rcps))
+	for start := 0; start < len(rcps); start += maxInsertRows {
+		end := start + maxInsertRows
+		if end > len(rcps) {
+			end = len(rcps)
+		}
+		p.insertBatch(ctx, rcps[start:end], errs[start:end])
+	}
+
+	return errs
+}
+
+// insertBatch - inserts the recipes in a single statement setting the outcome of each of them into errs.
+func (p *Proxy) insertBatch(ctx context.Context, rcps []*recipe.Recipe, errs []error) {
+	values := make([]string, 0, len(rcps))
+	args := make([]interface{}, 0, len(rcps)*13)
+	for i, rcp := range rcps {
+		details, err := marshalDetails(rcp)
+		if err != nil {
+			errs[i] = errors.WrapDBErr(err)
+			continue
+		}
+		placeholders := make([]string, 13)
+		for j := range placeholders {
+			placeholders[j] = "$" + strconv.Itoa(len(args)+j+1)
+		}
+		values = append(values, "("+strings.Join(placeholders, ", ")+")")
+		args = append(args, rcp.ID, rcp.Name, rcp.PrepTime, rcp.Difficulty, rcp.Vegetarian, rcp.Servings, rcp.Cuisine,
+			details[0], details[1], details[2], rcp.CreatedAt, rcp.UpdatedAt, rcp.Owner)
+	}
+	if len(values) == 0 {
+		return
+	}
+	inserted, err := p.insertedIDs(ctx, fmt.Sprintf(insertRecipes, strings.Join(values, ", ")), args)
+	for i, rcp := range rcps {
+		switch {
+		case errs[i] != nil:
+		case err != nil:
+			errs[i] = err
+		case inserted[rcp.ID]:
+			// a repeated ID is only inserted once, by its first occurrence
+			delete(inserted, rcp.ID)
+			rcp.Version = 1
+		default:
+			errs[i] = errors.NewExistErr(true)
+		}
+	}
+}
+
+func (p *Proxy) insertedIDs(ctx context.Context, query string, args []interface{}) (map[string]bool, error) {
+	rows, err := p.query(ctx, query, args...)
+	if err != nil {
+		return nil, errors.WrapDBErr(err)
+	}
+	defer rows.Close()
+
+	inserted := make(map[string]bool)
+	for rows.Next() {
+		var ID string
+		if err := rows.Scan(&ID); err != nil {
+			return nil, errors.WrapDBErr(err)
+		}
+		inserted[ID] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.WrapDBErr(err)
+	}
+
+	return inserted, nil
+}
+
+func (p *Proxy) UpdateRecipe(ctx context.Context, rcp *recipe.Recipe, version int64) error {
+	details, err := marshalDetails(rcp)
+	if err != nil {
+		return errors.WrapDBErr(err)
+	}
+	err = p.queryRow(ctx, updateRecipe, rcp.ID, rcp.Name, rcp.PrepTime, rcp.Difficulty, rcp.Vegetarian, rcp.Servings,
+		rcp.Cuisine, details[0], details[1], details[2], rcp.UpdatedAt, version).Scan(&rcp.CreatedAt, &rcp.Owner, &rcp.Version)
+	if err == sql.ErrNoRows {
+		return p.notMatchedErr(ctx, rcp.ID, version)
+	}
+	if err != nil {
+		return errors.WrapDBErr(err)
+	}
+
+	return nil
+}
+
+func (p *Proxy) PatchRecipe(ctx context.Context, rcp *recipe.Recipe, fields []string, version int64) error {
+	query, args, err := buildPatchQuery(rcp, fields, version)
+	if err != nil {
+		return errors.WrapDBErr(err)
+	}
+	err = p.queryRow(ctx, query, args...).Scan(&rcp.CreatedAt, &rcp.Owner, &rcp.Version)
+	if err == sql.ErrNoRows {
+		return p.notMatchedErr(ctx, rcp.ID, version)
+	}
+	if err != nil {
+		return errors.WrapDBErr(err)
+	}
+
+	return nil
+}
+
+func (p *Proxy) DeleteRecipe(ctx context.Context, ID string, version int64) error {
+	deleted, err := p.exec(ctx, deleteRecipe, ID, version)
+	if err != nil {
+		return errors.WrapDBErr(err)
+	}
+	if deleted == 0 {
+		return p.notMatchedErr(ctx, ID, version)
+	}
+
+	return nil
+}
+
+// notMatchedErr - error of a conditional write that has not matched any row, either the recipe does not exist or it is
+// not stored at the given version.
+func (p *Proxy) notMatchedErr(ctx context.Context, ID string, version int64) error {
+	if version == 0 {
+		return errors.NewExistErr(false)
+	}
+	var exists bool
+	if err := p.queryRow(ctx, recipeExists, ID).Scan(&exists); err != nil {
+		return errors.WrapDBErr(err)
+	}
+	if !exists {
+		return errors.NewExistErr(false)
+	}
+
+	return errors.NewPreconditionErr()
+}
+
+func scanRecipe(s scanner) (*recipe.Recipe, error) {
+	rcp := &recipe.Recipe{}
+	var tags, ingredients, steps []byte
+	var sum, count int
+	if err := s.Scan(&rcp.ID, &rcp.Name, &rcp.PrepTime, &rcp.Difficulty, &rcp.Vegetarian, &rcp.Servings, &rcp.Cuisine,
+		&tags, &ingredients, &steps, &rcp.CreatedAt, &rcp.UpdatedAt, &rcp.Version, &rcp.Owner, &sum, &count); err != nil {
+		return nil, err
+	}
+	if err := unmarshalDetails(rcp, tags, ingredients, steps); err != nil {
+		return nil, err
+	}
+	summary := rate.NewSummary(sum, count)
+	rcp.AverageRating = summary.Average
+	rcp.RatingCount = summary.Count
+
+	return rcp, nil
+}
+
+// marshalDetails - tags, ingredients and steps are stored as JSON arrays, in that order. They are sent as strings since
+// the driver would encode bytes as bytea.
+func marshalDetails(rcp *recipe.Recipe) ([3]string, error) {
+	details := [3]string{"[]", "[]", "[]"}
+	for i, v := range []struct {
+		value interface{}
+		empty bool
+	}{
+		{value: rcp.Tags, empty: len(rcp.Tags) == 0},
+		{value: rcp.Ingredients, empty: len(rcp.Ingredients) == 0},
+		{value: rcp.Steps, empty: len(rcp.Steps) == 0},
+	} {
+		if v.empty {
+			continue
+		}
+		b, err := json.Marshal(v.value)
+		if err != nil {
+			return details, err
+		}
+		details[i] = string(b)
+	}
+	return details, nil
+}
+
+func unmarshalDetails(rcp *recipe.Recipe, tags, ingredients, steps []byte) error {
+	if err := json.Unmarshal(tags, &rcp.Tags); err != nil {
+		return fmt.Errorf("error parsing recipe tags: %s", err.Error())
+	}
+	if err := json.Unmarshal(ingredients, &rcp.Ingredients); err != nil {
+		return fmt.Errorf("error parsing recipe ingredients: %s", err.Error())
+	}
+	if err := json.Unmarshal(steps, &rcp.Steps); err != nil {
+		return fmt.Errorf("error parsing recipe steps: %s", err.Error())
+	}
+	// empty arrays are read as nil, the same way they are provided by the other DB clients
+	if len(rcp.Tags) == 0 {
+		rcp.Tags = nil
+	}
+	if len(rcp.Ingredients) == 0 {
+		rcp.Ingredients = nil
+	}
+	if len(rcp.Steps) == 0 {
+		rcp.Steps = nil
+	}
+	return nil
+}
+
+// patchColumns - columns of the recipe's writable fields.
+var patchColumns = map[string]string{
+	recipe.FieldName:        "name",
+	recipe.FieldPrepTime:    "prep_time",
+	recipe.FieldDifficulty:  "difficulty",
+	recipe.FieldVegetarian:  "vegetarian",
+	recipe.FieldServings:    "servings",
+	recipe.FieldCuisine:     "cuisine",
+	recipe.FieldTags:        "tags",
+	recipe.FieldIngredients: "ingredients",
+	recipe.FieldSteps:       "steps",
+}
+
+// buildPatchQuery - translates a partial update into SQL, only the given fields are set. As in updateRecipe the creation
+// timestamp, the owner and the new version are returned.
+func buildPatchQuery(rcp *recipe.Recipe, fields []string, version int64) (string, []interface{}, error) {
+	details, err := marshalDetails(rcp)
+	if err != nil {
+		return "", nil, err
+	}
+	values := map[string]interface{}{
+		recipe.FieldName:        rcp.Name,
+		recipe.FieldPrepTime:    rcp.PrepTime,
+		recipe.FieldDifficulty:  rcp.Difficulty,
+		recipe.FieldVegetarian:  rcp.Vegetarian,
+		recipe.FieldServings:    rcp.Servings,
+		recipe.FieldCuisine:     rcp.Cuisine,
+		recipe.FieldTags:        details[0],
+		recipe.FieldIngredients: details[1],
+		recipe.FieldSteps:       details[2],
+	}
+	args := []interface{}{rcp.ID, version, rcp.UpdatedAt}
+	set := []string{"updated_at = $3", "version = version + 1"}
+	for _, field := range fields {
+		column, ok := patchColumns[field]
+		if !ok {
+			return "", nil, fmt.Errorf("unsupported patch field: %s", field)
+		}
+		args = append(args, values[field])
+		set = append(set, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	return fmt.Sprintf("UPDATE recipes SET %s WHERE id = $1 AND ($2::BIGINT = 0 OR version = $2) RETURNING created_at, owner, version",
+		strings.Join(set, ", ")), args, nil
+}
+
+// sortExpressions - SQL counterpart of the recipe's sort fields, must order the same way recipe.Query does. Recipes
+// are ordered by ID when no sort field is given.
+var sortExpressions = map[string]string{
+	recipe.SortName:       `lower(name) COLLATE "C"`,
+	recipe.SortPrepTime:   "prep_time",
+	recipe.SortDifficulty: "difficulty",
+	recipe.SortRating:     "ROUND(CASE WHEN rating_count = 0 THEN 0 ELSE rating_sum::numeric / rating_count END, 2)",
+}
+
+// idExpression - IDs are compared byte wise, regardless of the DB collation.
+const idExpression = `id COLLATE "C"`
+
+// buildListQuery - translates the query into SQL, pagination relays on the cursor (keyset) instead of offsets and
+// fetches one extra row to know whether there is a next page.
+func buildListQuery(q *recipe.Query) (string, []interface{}, error) {
+	var conditions []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if q.Filter.Vegetarian != nil {
+		conditions = append(conditions, "vegetarian = "+arg(*q.Filter.Vegetarian))
+	}
+	if q.Filter.MaxPrepTime > 0 {
+		conditions = append(conditions, "prep_time <= "+arg(q.Filter.MaxPrepTime))
+	}
+	if q.Filter.Difficulty > 0 {
+		conditions = append(conditions, "difficulty = "+arg(q.Filter.Difficulty))
+	}
+
+	// the sort key is compared along with the ID as a row, that way ties are broken the same way they are ordered
+	orderBy := []string{idExpression}
+	var cursorKey interface{}
+	if len(q.Sort) > 0 {
+		sortExpr, ok := sortExpressions[q.Sort]
+		if !ok {
+			return "", nil, fmt.Errorf("unsupported sort field: %s", q.Sort)
+		}
+		orderBy = []string{sortExpr, idExpression}
+		if q.Cursor != nil {
+			key, err := cursorKeyValue(q.Sort, q.Cursor.Key)
+			if err != nil {
+				return "", nil, err
+			}
+			cursorKey = key
+		}
+	}
+	direction, comparator := "ASC", ">"
+	if q.Desc {
+		direction, comparator = "DESC", "<"
+	}
+	if q.Cursor != nil {
+		if len(orderBy) == 1 {
+			conditions = append(conditions, fmt.Sprintf("%s %s %s", idExpression, comparator, arg(q.Cursor.ID)))
+		} else {
+			conditions = append(conditions, fmt.Sprintf("(%s, %s) %s (%s, %s)", orderBy[0], orderBy[1], comparator, arg(cursorKey), arg(q.Cursor.ID)))
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(listRecipes)
+	if len(conditions) > 0 {
+		sb.WriteString(" WHERE " + strings.Join(conditions, " AND "))
+	}
+	sb.WriteString(" ORDER BY " + strings.Join(orderBy, " "+direction+", ") + " " + direction)
+	if q.Limit > 0 {
+		sb.WriteString(" LIMIT " + arg(q.Limit+1))
+	}
+
+	return sb.String(), args, nil
+}
+
+// cursorKeyValue - cursor keys are strings, they need to be typed to be compared against the sort expression.
+func cursorKeyValue(sort, key string) (interface{}, error) {
+	switch sort {
+	case recipe.SortPrepTime, recipe.SortDifficulty:
+		return strconv.Atoi(key)
+	case recipe.SortRating:
+		return strconv.ParseFloat(key, 64)
+	}
+	return key, nil
+}
@@ -0,0 +1,575 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	e "errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/recipe"
+)
+
+var testCreatedAt = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func TestProxy_GetRecipeByID(t *testing.T) {
+	tests := []struct {
+		name        string
+		ID          string
+		accessor    *sqlAccessorMock
+		expectedRcp *recipe.Recipe
+		expectedErr error
+	}{
+		{
+			name: "successful retrieve",
+			ID:   "654321",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{values: []interface{}{"654321", "qwerty", 20, 3, false, 4, "spanish", `["quick"]`,
+						`[{"name":"rice","quantity":400,"unit":"g"}]`, `["boil the rice"]`, testCreatedAt, testCreatedAt, 2, "chef", 0, 0}}
+				},
+			},
+			expectedRcp: &recipe.Recipe{
+				ID:          "654321",
+				Name:        "qwerty",
+				PrepTime:    20,
+				Difficulty:  3,
+				Vegetarian:  false,
+				Servings:    4,
+				Cuisine:     "spanish",
+				Tags:        []string{"quick"},
+				Ingredients: []recipe.Ingredient{{Name: "rice", Quantity: 400, Unit: "g"}},
+				Steps:       []string{"boil the rice"},
+				CreatedAt:   testCreatedAt,
+				UpdatedAt:   testCreatedAt,
+				Version:     2,
+				Owner:       "chef",
+			},
+		},
+		{
+			name: "error - malformed ingredients",
+			ID:   "654321",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{values: []interface{}{"654321", "qwerty", 20, 3, false, 4, "spanish", `[]`, `{`, `[]`,
+						testCreatedAt, testCreatedAt, 1, "", 0, 0}}
+				},
+			},
+			expectedErr: errors.NewDBErr("error parsing recipe ingredients: unexpected end of JSON input"),
+		},
+		{
+			name: "error - recipe does not exists",
+			ID:   "654321",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{err: sql.ErrNoRows}
+				},
+			},
+			expectedErr: errors.NewExistErr(false),
+		},
+		{
+			name: "error - DB call",
+			ID:   "654321",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{err: e.New("DB issue")}
+				},
+			},
+			expectedErr: errors.NewDBErr("DB issue"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxy := newPostgresMock(test.accessor)
+			rcp, err := proxy.GetRecipeByID(context.Background(), test.ID)
+			assertErr(t, test.expectedErr, err)
+			if rcp != nil {
+				if !reflect.DeepEqual(rcp, test.expectedRcp) {
+					t.Errorf("expected: '%v' instead got: '%v'", test.expectedRcp, rcp)
+				}
+			}
+		})
+	}
+}
+
+func TestProxy_GetRecipes(t *testing.T) {
+	tests := []struct {
+		name         string
+		accessor     *sqlAccessorMock
+		expectedRcps []*recipe.Recipe
+		expectedErr  error
+	}{
+		{
+			name: "successful retrieve - empty",
+			accessor: &sqlAccessorMock{
+				queryAccessor: func(query string, args ...interface{}) (rowsScanner, error) {
+					return &rowsMock{}, nil
+				},
+			},
+			expectedRcps: []*recipe.Recipe{},
+		},
+		{
+			name: "successful retrieve - multiple results",
+			accessor: &sqlAccessorMock{
+				queryAccessor: func(query string, args ...interface{}) (rowsScanner, error) {
+					return &rowsMock{rows: [][]interface{}{
+						{"654321", "qwerty", 20, 3, false, 0, "", `[]`, `[]`, `[]`, testCreatedAt, testCreatedAt, 1, "", 0, 0},
+						{"98765", "zxcvb", 60, 2, true, 0, "", `[]`, `[]`, `[]`, testCreatedAt, testCreatedAt, 3, "chef", 9, 2},
+					}}, nil
+				},
+			},
+			expectedRcps: []*recipe.Recipe{
+				{
+					ID:         "654321",
+					Name:       "qwerty",
+					PrepTime:   20,
+					Difficulty: 3,
+					Vegetarian: false,
+					CreatedAt:  testCreatedAt,
+					UpdatedAt:  testCreatedAt,
+					Version:    1,
+				},
+				{
+					ID:            "98765",
+					Name:          "zxcvb",
+					PrepTime:      60,
+					Difficulty:    2,
+					Vegetarian:    true,
+					AverageRating: 4.5,
+					RatingCount:   2,
+					CreatedAt:     testCreatedAt,
+					UpdatedAt:     testCreatedAt,
+					Version:       3,
+					Owner:         "chef",
+				},
+			},
+		},
+		{
+			name: "error - DB query",
+			accessor: &sqlAccessorMock{
+				queryAccessor: func(query string, args ...interface{}) (rowsScanner, error) {
+					return nil, e.New("DB issue")
+				},
+			},
+			expectedErr: errors.NewDBErr("DB issue"),
+		},
+		{
+			name: "error - DB iterating rows",
+			accessor: &sqlAccessorMock{
+				queryAccessor: func(query string, args ...interface{}) (rowsScanner, error) {
+					return &rowsMock{err: e.New("DB issue")}, nil
+				},
+			},
+			expectedErr: errors.NewDBErr("DB issue"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxy := newPostgresMock(test.accessor)
+			page, err := proxy.GetRecipes(context.Background(), &recipe.Query{})
+			assertErr(t, test.expectedErr, err)
+			if page != nil {
+				if !reflect.DeepEqual(page.Recipes, test.expectedRcps) {
+					t.Errorf("expected: '%v' instead got: '%v'", test.expectedRcps, page.Recipes)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildListQuery(t *testing.T) {
+	vegetarian := true
+	tests := []struct {
+		name         string
+		query        *recipe.Query
+		expectedStmt string
+		expectedArgs []interface{}
+		expectedErr  bool
+	}{
+		{
+			name:         "default order",
+			query:        &recipe.Query{Limit: 20},
+			expectedStmt: listRecipes + ` ORDER BY id COLLATE "C" ASC LIMIT $1`,
+			expectedArgs: []interface{}{21},
+		},
+		{
+			name: "filtered and sorted by prep time after cursor",
+			query: &recipe.Query{
+				Limit:  10,
+				Sort:   recipe.SortPrepTime,
+				Desc:   true,
+				Cursor: &recipe.Cursor{Key: "30", ID: "654321"},
+				Filter: recipe.Filter{Vegetarian: &vegetarian, MaxPrepTime: 60, Difficulty: 2},
+			},
+			expectedStmt: listRecipes + ` WHERE vegetarian = $1 AND prep_time <= $2 AND difficulty = $3` +
+				` AND (prep_time, id COLLATE "C") < ($4, $5) ORDER BY prep_time DESC, id COLLATE "C" DESC LIMIT $6`,
+			expectedArgs: []interface{}{true, 60, 2, 30, "654321", 11},
+		},
+		{
+			name:        "error - invalid cursor key",
+			query:       &recipe.Query{Sort: recipe.SortRating, Cursor: &recipe.Cursor{Key: "notAFloat", ID: "654321"}},
+			expectedErr: true,
+		},
+		{
+			name:        "error - unsupported sort",
+			query:       &recipe.Query{Sort: "unsupported"},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stmt, args, err := buildListQuery(test.query)
+			if (err != nil) != test.expectedErr {
+				t.Errorf("unexpected error: '%v'", err)
+			}
+			if err != nil {
+				return
+			}
+			if stmt != test.expectedStmt {
+				t.Errorf("expected: '%s' instead got: '%s'", test.expectedStmt, stmt)
+			}
+			if !reflect.DeepEqual(args, test.expectedArgs) {
+				t.Errorf("expected: '%v' instead got: '%v'", test.expectedArgs, args)
+			}
+		})
+	}
+}
+
+func TestProxy_CreateRecipe(t *testing.T) {
+	tests := []struct {
+		name        string
+		accessor    *sqlAccessorMock
+		expectedErr error
+	}{
+		{
+			name: "successful create",
+			accessor: &sqlAccessorMock{
+				execAccessor: func(query string, args ...interface{}) (int64, error) {
+					expected := []interface{}{"654321", "qwerty", 20, 3, false, 4, "", `["quick"]`, `[]`,
+						`["boil the rice"]`, testCreatedAt, testCreatedAt, "chef"}
+					if !reflect.DeepEqual(args, expected) {
+						return 0, e.New("unexpected arguments")
+					}
+					return 1, nil
+				},
+			},
+		},
+		{
+			name: "error - recipe already exists",
+			accessor: &sqlAccessorMock{
+				execAccessor: func(query string, args ...interface{}) (int64, error) {
+					return 0, nil
+				},
+			},
+			expectedErr: errors.NewExistErr(true),
+		},
+		{
+			name: "error - DB inserting recipe",
+			accessor: &sqlAccessorMock{
+				execAccessor: func(query string, args ...interface{}) (int64, error) {
+					return 0, e.New("DB issue")
+				},
+			},
+			expectedErr: errors.NewDBErr("DB issue"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxy := newPostgresMock(test.accessor)
+			err := proxy.CreateRecipe(context.Background(), &recipe.Recipe{ID: "654321", Name: "qwerty", PrepTime: 20, Difficulty: 3, Servings: 4,
+				Tags: []string{"quick"}, Steps: []string{"boil the rice"}, CreatedAt: testCreatedAt, UpdatedAt: testCreatedAt,
+				Owner: "chef"})
+			assertErr(t, test.expectedErr, err)
+		})
+	}
+}
+
+func TestProxy_CreateRecipes(t *testing.T) {
+	newRcp := func(ID string) *recipe.Recipe {
+		return &recipe.Recipe{ID: ID, Name: "qwerty", PrepTime: 20, Difficulty: 3, CreatedAt: testCreatedAt,
+			UpdatedAt: testCreatedAt, Owner: "chef"}
+	}
+	tests := []struct {
+		name         string
+		accessor     *sqlAccessorMock
+		expectedErrs []error
+	}{
+		{
+			name: "successful create",
+			accessor: &sqlAccessorMock{
+				queryAccessor: func(query string, args ...interface{}) (rowsScanner, error) {
+					if len(args) != 39 || args[0] != "111111" || args[13] != "222222" || args[38] != "chef" {
+						return nil, e.New("unexpected arguments")
+					}
+					if !strings.Contains(query, "($27, $28, $29, $30, $31, $32, $33, $34, $35, $36, $37, $38, $39)") {
+						return nil, e.New("unexpected query")
+					}
+					return &rowsMock{rows: [][]interface{}{{"111111"}, {"333333"}}}, nil
+				},
+			},
+			expectedErrs: []error{nil, errors.NewExistErr(true), nil},
+		},
+		{
+			name: "error - DB inserting recipes",
+			accessor: &sqlAccessorMock{
+				queryAccessor: func(query string, args ...interface{}) (rowsScanner, error) {
+					return nil, e.New("DB issue")
+				},
+			},
+			expectedErrs: []error{errors.NewDBErr("DB issue"), errors.NewDBErr("DB issue"), errors.NewDBErr("DB issue")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxy := newPostgresMock(test.accessor)
+			rcps := []*recipe.Recipe{newRcp("111111"), newRcp("222222"), newRcp("333333")}
+			errs := proxy.CreateRecipes(context.Background(), rcps)
+			if len(errs) != len(test.expectedErrs) {
+				t.Fatalf("expected: %d results instead got: %d", len(test.expectedErrs), len(errs))
+			}
+			for i, err := range errs {
+				if fmt.Sprint(err) != fmt.Sprint(test.expectedErrs[i]) {
+					t.Errorf("recipe %d expected: '%v' instead got: '%v'", i, test.expectedErrs[i], err)
+				}
+				if err == nil && rcps[i].Version != 1 {
+					t.Errorf("recipe %d expected version 1 instead got: %d", i, rcps[i].Version)
+				}
+			}
+		})
+	}
+}
+
+func TestProxy_UpdateRecipe(t *testing.T) {
+	tests := []struct {
+		name        string
+		version     int64
+		accessor    *sqlAccessorMock
+		expectedErr error
+	}{
+		{
+			name: "successful update",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{values: []interface{}{testCreatedAt, "chef", 3}}
+				},
+			},
+		},
+		{
+			name:    "successful update - matching version",
+			version: 2,
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					if args[len(args)-1] != int64(2) {
+						return &rowMock{err: e.New("unexpected version")}
+					}
+					return &rowMock{values: []interface{}{testCreatedAt, "chef", 3}}
+				},
+			},
+		},
+		{
+			name:    "error - version mismatch",
+			version: 1,
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					if query == recipeExists {
+						return &rowMock{values: []interface{}{true}}
+					}
+					return &rowMock{err: sql.ErrNoRows}
+				},
+			},
+			expectedErr: errors.NewPreconditionErr(),
+		},
+		{
+			name:    "error - conditioned recipe does not exist",
+			version: 1,
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					if query == recipeExists {
+						return &rowMock{values: []interface{}{false}}
+					}
+					return &rowMock{err: sql.ErrNoRows}
+				},
+			},
+			expectedErr: errors.NewExistErr(false),
+		},
+		{
+			name: "error - recipe does not exist",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{err: sql.ErrNoRows}
+				},
+			},
+			expectedErr: errors.NewExistErr(false),
+		},
+		{
+			name: "error - DB updating recipe",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{err: e.New("DB issue")}
+				},
+			},
+			expectedErr: errors.NewDBErr("DB issue"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxy := newPostgresMock(test.accessor)
+			rcp := &recipe.Recipe{ID: "654321", Name: "qwerty", PrepTime: 20, Difficulty: 3}
+			err := proxy.UpdateRecipe(context.Background(), rcp, test.version)
+			assertErr(t, test.expectedErr, err)
+			if err == nil && (!rcp.CreatedAt.Equal(testCreatedAt) || rcp.Owner != "chef" || rcp.Version != 3) {
+				t.Errorf("expected stored creation timestamp and version instead got: '%v', '%d'", rcp.CreatedAt, rcp.Version)
+			}
+		})
+	}
+}
+
+func TestBuildPatchQuery(t *testing.T) {
+	rcp := &recipe.Recipe{ID: "654321", Name: "qwerty", PrepTime: 20, Tags: []string{"quick"}, UpdatedAt: testCreatedAt}
+	query, args, err := buildPatchQuery(rcp, []string{recipe.FieldName, recipe.FieldTags}, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expectedQuery := "UPDATE recipes SET updated_at = $3, version = version + 1, name = $4, tags = $5 WHERE id = $1 AND " +
+		"($2::BIGINT = 0 OR version = $2) RETURNING created_at, owner, version"
+	if query != expectedQuery {
+		t.Errorf("expected: '%s' instead got: '%s'", expectedQuery, query)
+	}
+	expectedArgs := []interface{}{"654321", int64(2), testCreatedAt, "qwerty", `["quick"]`}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("expected: '%v' instead got: '%v'", expectedArgs, args)
+	}
+
+	if _, _, err := buildPatchQuery(rcp, []string{"ID"}, 0); err == nil {
+		t.Errorf("expected error patching a read only field")
+	}
+}
+
+func TestProxy_PatchRecipe(t *testing.T) {
+	tests := []struct {
+		name        string
+		version     int64
+		accessor    *sqlAccessorMock
+		expectedErr error
+	}{
+		{
+			name:    "successful patch",
+			version: 2,
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{values: []interface{}{testCreatedAt, "chef", 3}}
+				},
+			},
+		},
+		{
+			name:    "error - version mismatch",
+			version: 1,
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					if query == recipeExists {
+						return &rowMock{values: []interface{}{true}}
+					}
+					return &rowMock{err: sql.ErrNoRows}
+				},
+			},
+			expectedErr: errors.NewPreconditionErr(),
+		},
+		{
+			name: "error - recipe does not exist",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{err: sql.ErrNoRows}
+				},
+			},
+			expectedErr: errors.NewExistErr(false),
+		},
+		{
+			name: "error - DB patching recipe",
+			accessor: &sqlAccessorMock{
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{err: e.New("DB issue")}
+				},
+			},
+			expectedErr: errors.NewDBErr("DB issue"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxy := newPostgresMock(test.accessor)
+			rcp := &recipe.Recipe{ID: "654321", Name: "qwerty", PrepTime: 20, Difficulty: 3}
+			err := proxy.PatchRecipe(context.Background(), rcp, []string{recipe.FieldName}, test.version)
+			assertErr(t, test.expectedErr, err)
+			if err == nil && (!rcp.CreatedAt.Equal(testCreatedAt) || rcp.Owner != "chef" || rcp.Version != 3) {
+				t.Errorf("expected stored creation timestamp and version instead got: '%v', '%d'", rcp.CreatedAt, rcp.Version)
+			}
+		})
+	}
+}
+
+func TestProxy_DeleteRecipe(t *testing.T) {
+	tests := []struct {
+		name        string
+		version     int64
+		accessor    *sqlAccessorMock
+		expectedErr error
+	}{
+		{
+			name: "successful delete",
+			accessor: &sqlAccessorMock{
+				execAccessor: func(query string, args ...interface{}) (int64, error) {
+					return 1, nil
+				},
+			},
+		},
+		{
+			name:    "error - version mismatch",
+			version: 4,
+			accessor: &sqlAccessorMock{
+				execAccessor: func(query string, args ...interface{}) (int64, error) {
+					return 0, nil
+				},
+				queryRowAccessor: func(query string, args ...interface{}) scanner {
+					return &rowMock{values: []interface{}{true}}
+				},
+			},
+			expectedErr: errors.NewPreconditionErr(),
+		},
+		{
+			name: "error - recipe does not exist",
+			accessor: &sqlAccessorMock{
+				execAccessor: func(query string, args ...interface{}) (int64, error) {
+					return 0, nil
+				},
+			},
+			expectedErr: errors.NewExistErr(false),
+		},
+		{
+			name: "error - DB deleting recipe",
+			accessor: &sqlAccessorMock{
+				execAccessor: func(query string, args ...interface{}) (int64, error) {
+					return 0, e.New("DB issue")
+				},
+			},
+			expectedErr: errors.NewDBErr("DB issue"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxy := newPostgresMock(test.accessor)
+			err := proxy.DeleteRecipe(context.Background(), "654321", test.version)
+			assertErr(t, test.expectedErr, err)
+		})
+	}
+}
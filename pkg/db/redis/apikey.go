@@ -0,0 +1,162 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/apikey"
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
+)
+
+const (
+	// apiKeyPattern - prefix of the API keys hashes, followed by the key ID.
+	apiKeyPattern   = "APIKEY_"
+	apiKeyName      = "name"
+	apiKeyRole      = "role"
+	apiKeyScopes    = "scopes"
+	apiKeyCreatedBy = "createdBy"
+	apiKeyCreatedAt = "createdAt"
+	apiKeyExpiresAt = "expiresAt"
+	apiKeyHash      = "hash"
+)
+
+// CreateAPIKey stores the key as a hash, without its secret.
+func (p *Proxy) CreateAPIKey(ctx context.Context, key *apikey.Key) error {
+	k := apiKeyPattern + key.ID
+	return p.transaction(ctx, func(tx redisTx) error {
+		exists, err := tx.exists(k)
+		if err != nil {
+			return errors.WrapDBErr(err)
+		}
+		if exists > 0 {
+			return errors.NewExistErr(true)
+		}
+		tx.set(k, mapAPIKeyToRedisFields(key))
+		return nil
+	}, k)
+}
+
+// GetAPIKey queries Redis for the key along with its hash.
+func (p *Proxy) GetAPIKey(ctx context.Context, ID string) (*apikey.Key, error) {
+	fields, err := p.getAll(ctx, apiKeyPattern+ID)
+	if err != nil {
+		return nil, errors.WrapDBErr(err)
+	}
+	if len(fields) == 0 {
+		return nil, errors.NewExistErr(false)
+	}
+	return mapToAPIKeyFromRedis(ID, fields)
+}
+
+// GetAPIKeys scans all the keys, there are few of them since they are only created by admins.
+func (p *Proxy) GetAPIKeys(ctx context.Context) ([]*apikey.Key, error) {
+	ks, err := p.scan(ctx, apiKeyPattern+"*")
+	if err != nil {
+		return nil, errors.WrapDBErr(err)
+	}
+	sort.Strings(ks)
+	fields, err := p.getAllMany(ctx, ks)
+	if err != nil {
+		return nil, errors.WrapDBErr(err)
+	}
+	keys := make([]*apikey.Key, 0, len(ks))
+	for i, f := range fields {
+		// deleted in between the scan and the read
+		if len(f) == 0 {
+			continue
+		}
+		key, err := mapToAPIKeyFromRedis(strings.TrimPrefix(ks[i], apiKeyPattern), f)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// RotateAPIKey replaces the hash of the key, checking within the transaction that it has been neither deleted nor
+// rotated since oldHash was read. Every key holds a hash, a missing one means the key does not exist.
+func (p *Proxy) RotateAPIKey(ctx context.Context, ID, oldHash, newHash string) error {
+	k := apiKeyPattern + ID
+	return p.transaction(ctx, func(tx redisTx) error {
+		current, found, err := tx.getField(k, apiKeyHash)
+		if err != nil {
+			return errors.WrapDBErr(err)
+		}
+		if !found {
+			return errors.NewExistErr(false)
+		}
+		if current != oldHash {
+			return errors.NewPreconditionErr()
+		}
+		tx.set(k, map[string]interface{}{apiKeyHash: newHash})
+		return nil
+	}, k)
+}
+
+// DeleteAPIKey removes the key hash.
+func (p *Proxy) DeleteAPIKey(ctx context.Context, ID string) error {
+	deleted, err := p.del(ctx, apiKeyPattern+ID)
+	if err != nil {
+		return errors.WrapDBErr(err)
+	}
+	if deleted == 0 {
+		return errors.NewExistErr(false)
+	}
+	return nil
+}
+
+func mapAPIKeyToRedisFields(key *apikey.Key) map[string]interface{} {
+	scopes := make([]string, 0, len(key.Scopes))
+	for _, scope := range key.Scopes {
+		scopes = append(scopes, string(scope))
+	}
+	expiresAt := ""
+	if key.ExpiresAt != nil {
+		expiresAt = key.ExpiresAt.Format(time.RFC3339Nano)
+	}
+	return map[string]interface{}{
+		apiKeyName:      key.Name,
+		apiKeyRole:      string(key.Role),
+		apiKeyScopes:    strings.Join(scopes, ","),
+		apiKeyCreatedBy: key.CreatedBy,
+		apiKeyCreatedAt: key.CreatedAt.Format(time.RFC3339Nano),
+		apiKeyExpiresAt: expiresAt,
+		apiKeyHash:      key.Hash,
+	}
+}
+
+func mapToAPIKeyFromRedis(ID string, fields map[string]string) (*apikey.Key, error) {
+	role, ok := identity.ParseRole(fields[apiKeyRole])
+	if !ok {
+		return nil, errors.NewDBErr(fmt.Sprintf("invalid role '%s' of API key '%s'", fields[apiKeyRole], ID))
+	}
+	key := &apikey.Key{
+		ID:        ID,
+		Name:      fields[apiKeyName],
+		Role:      role,
+		CreatedBy: fields[apiKeyCreatedBy],
+		Hash:      fields[apiKeyHash],
+	}
+	if len(fields[apiKeyScopes]) > 0 {
+		for _, scope := range strings.Split(fields[apiKeyScopes], ",") {
+			key.Scopes = append(key.Scopes, identity.Permission(scope))
+		}
+	}
+	var err error
+	if key.CreatedAt, err = time.Parse(time.RFC3339Nano, fields[apiKeyCreatedAt]); err != nil {
+		return nil, errors.NewDBErr(fmt.Sprintf("invalid creation time of API key '%s': %s", ID, err.Error()))
+	}
+	if len(fields[apiKeyExpiresAt]) > 0 {
+		expiresAt, err := time.Parse(time.RFC3339Nano, fields[apiKeyExpiresAt])
+		if err != nil {
+			return nil, errors.NewDBErr(fmt.Sprintf("invalid expiration time of API key '%s': %s", ID, err.Error()))
+		}
+		key.ExpiresAt = &expiresAt
+	}
+	return key, nil
+}
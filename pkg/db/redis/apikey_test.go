@@ -0,0 +1,113 @@
+package redis
+
+import (
+	"context"
+	e "errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/apikey"
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
+)
+
+func TestProxy_APIKeys(t *testing.T) {
+	fake := newRedisFake()
+	proxy := newRedisMock(fake)
+	createdAt := time.Date(2020, 7, 1, 10, 0, 0, 0, time.UTC)
+	expiresAt := createdAt.Add(30 * 24 * time.Hour)
+	first := &apikey.Key{ID: "01EC9V3P6Y8B8XWJ2Q3KZ4M5N6", Name: "ci", Role: identity.Editor,
+		Scopes: []identity.Permission{identity.CreateRecipe, identity.EditRecipe}, CreatedBy: "admin",
+		CreatedAt: createdAt, ExpiresAt: &expiresAt, Hash: "hash"}
+	second := &apikey.Key{ID: "01EC9V3P6Y8B8XWJ2Q3KZ4M5N7", Name: "backup", Role: identity.Reader, CreatedBy: "admin",
+		CreatedAt: createdAt, Hash: "other"}
+	for _, key := range []*apikey.Key{second, first} {
+		if err := proxy.CreateAPIKey(context.Background(), key); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := proxy.CreateAPIKey(context.Background(), first); err == nil || err.Error() != errors.NewExistErr(true).Error() {
+		t.Errorf("expected: '%s' instead got: '%v'", errors.NewExistErr(true), err)
+	}
+
+	stored, err := proxy.GetAPIKey(context.Background(), first.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(stored, first) {
+		t.Errorf("expected: '%v' instead got: '%v'", first, stored)
+	}
+
+	if err := proxy.RotateAPIKey(context.Background(), first.ID, "hash", "rotated"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// rotated in the meantime
+	if err := proxy.RotateAPIKey(context.Background(), first.ID, "hash", "again"); err == nil || err.Error() != errors.NewPreconditionErr().Error() {
+		t.Errorf("expected: '%s' instead got: '%v'", errors.NewPreconditionErr(), err)
+	}
+	keys, err := proxy.GetAPIKeys(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	rotated := *first
+	rotated.Hash = "rotated"
+	if !reflect.DeepEqual(keys, []*apikey.Key{&rotated, second}) {
+		t.Errorf("expected: '%v' instead got: '%v'", []*apikey.Key{&rotated, second}, keys)
+	}
+
+	if err := proxy.DeleteAPIKey(context.Background(), first.ID); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	notExist := errors.NewExistErr(false).Error()
+	if _, err := proxy.GetAPIKey(context.Background(), first.ID); err == nil || err.Error() != notExist {
+		t.Errorf("expected: '%s' instead got: '%v'", notExist, err)
+	}
+	if err := proxy.RotateAPIKey(context.Background(), first.ID, "rotated", "again"); err == nil || err.Error() != notExist {
+		t.Errorf("expected: '%s' instead got: '%v'", notExist, err)
+	}
+	if err := proxy.DeleteAPIKey(context.Background(), first.ID); err == nil || err.Error() != notExist {
+		t.Errorf("expected: '%s' instead got: '%v'", notExist, err)
+	}
+}
+
+func TestProxy_GetAPIKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		fields      map[string]string
+		failure     error
+		expectedErr error
+	}{
+		{
+			name:        "error - invalid role",
+			fields:      map[string]string{apiKeyRole: "root", apiKeyCreatedAt: "2020-07-01T10:00:00Z"},
+			expectedErr: errors.NewDBErr("invalid role 'root' of API key '01EC9V3P6Y8B8XWJ2Q3KZ4M5N6'"),
+		},
+		{
+			name:        "error - invalid expiration",
+			fields:      map[string]string{apiKeyCreatedAt: "2020-07-01T10:00:00Z", apiKeyExpiresAt: "tomorrow"},
+			expectedErr: errors.NewDBErr(`invalid expiration time of API key '01EC9V3P6Y8B8XWJ2Q3KZ4M5N6': parsing time "tomorrow" as "2006-01-02T15:04:05.999999999Z07:00": cannot parse "tomorrow" as "2006"`),
+		},
+		{
+			name:        "error - DB",
+			failure:     e.New("DB error"),
+			expectedErr: errors.NewDBErr("DB error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newRedisFake()
+			fake.fail["getAll"] = test.failure
+			fields := make(map[string]interface{})
+			for field, value := range test.fields {
+				fields[field] = value
+			}
+			fake.setHash(apiKeyPattern+"01EC9V3P6Y8B8XWJ2Q3KZ4M5N6", fields)
+			_, err := newRedisMock(fake).GetAPIKey(context.Background(), "01EC9V3P6Y8B8XWJ2Q3KZ4M5N6")
+			if err == nil || err.Error() != test.expectedErr.Error() {
+				t.Errorf("expected: '%s' instead got: '%v'", test.expectedErr, err)
+			}
+		})
+	}
+}
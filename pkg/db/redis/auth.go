@@ -1,18 +1,74 @@
 package redis
 
-import "github.com/rnov/Go-REST/pkg/errors"
+import (
+	"context"
+	"fmt"
 
-const tokenPattern = "TOKEN_"
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
+)
 
-// CheckAuth queries Redis that a given hashed basic auth exists
-func (p *Proxy) CheckAuth(auth string) error {
-	exist, err := p.exists(tokenPattern + auth)
+const (
+	// tokenPattern - prefix of the hashed basic auths, their value is the username they belong to.
+	tokenPattern = "TOKEN_"
+	// userPattern - prefix of the users hashes, users without hash are granted identity.DefaultRole.
+	userPattern  = "USER_"
+	userRole     = "role"
+	userPassword = "password"
+)
+
+// CheckAuth queries Redis that a given hashed basic auth exists, returns the user it belongs to.
+func (p *Proxy) CheckAuth(ctx context.Context, auth string) (*identity.Principal, error) {
+	username, found, err := p.get(ctx, tokenPattern+auth)
+	if err != nil {
+		return nil, errors.WrapDBErr(err)
+	}
+	if !found {
+		return nil, errors.NewFailedAuthErr()
+	}
+	user, err := p.getAll(ctx, userPattern+username)
+	if err != nil {
+		return nil, errors.WrapDBErr(err)
+	}
+	role, err := userRoleOf(username, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &identity.Principal{Username: username, Role: role}, nil
+}
+
+// GetCredentials queries Redis for the password hash of the user along with its role.
+func (p *Proxy) GetCredentials(ctx context.Context, username string) (*identity.Credentials, error) {
+	user, err := p.getAll(ctx, userPattern+username)
 	if err != nil {
-		return errors.NewDBErr(err.Error())
+		return nil, errors.WrapDBErr(err)
 	}
-	if exist == 0 {
-		return errors.NewFailedAuthErr()
+	if len(user[userPassword]) == 0 {
+		return nil, errors.NewExistErr(false)
+	}
+	role, err := userRoleOf(username, user)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return &identity.Credentials{Principal: identity.Principal{Username: username, Role: role}, PasswordHash: user[userPassword]}, nil
+}
+
+// SetPassword stores the password hash within the user hash, the rest of its fields are kept.
+func (p *Proxy) SetPassword(ctx context.Context, username, passwordHash string) error {
+	key := userPattern + username
+	return p.transaction(ctx, func(tx redisTx) error {
+		tx.set(key, map[string]interface{}{userPassword: passwordHash})
+		return nil
+	}, key)
+}
+
+// userRoleOf - the role stored within the user hash.
+func userRoleOf(username string, user map[string]string) (identity.Role, error) {
+	role, ok := identity.ParseRole(user[userRole])
+	if !ok {
+		return "", errors.NewDBErr(fmt.Sprintf("invalid role '%s' of user '%s'", user[userRole], username))
+	}
+	return role, nil
 }
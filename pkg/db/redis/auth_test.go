@@ -1,34 +1,60 @@
 package redis
 
 import (
+	"context"
 	e "errors"
+	"reflect"
 	"testing"
 
 	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
 )
 
 func TestProxy_CheckAuth(t *testing.T) {
+	token := func(key string) (string, bool, error) {
+		if key != tokenPattern+"qwertyzxcv12345" {
+			return "", false, e.New("unexpected key")
+		}
+		return "chef", true, nil
+	}
 	tests := []struct {
-		name        string
-		Auth        string
-		accessor    *redisAccessorMock
-		expectedErr error
+		name              string
+		Auth              string
+		accessor          *redisAccessorMock
+		expectedPrincipal *identity.Principal
+		expectedErr       error
 	}{
 		{
 			name: "successful auth",
 			Auth: "qwertyzxcv12345",
 			accessor: &redisAccessorMock{
-				existsAccessor: func(key string) (int64, error) {
-					return 1, nil
+				getAccessor: token,
+				getAllAccessor: func(key string) (map[string]string, error) {
+					if key != userPattern+"chef" {
+						return nil, e.New("unexpected key")
+					}
+					return map[string]string{userRole: "editor"}, nil
+				},
+			},
+			expectedPrincipal: &identity.Principal{Username: "chef", Role: identity.Editor},
+		},
+		{
+			name: "successful auth - user without role",
+			Auth: "qwertyzxcv12345",
+			accessor: &redisAccessorMock{
+				getAccessor: token,
+				getAllAccessor: func(key string) (map[string]string, error) {
+					return map[string]string{}, nil
 				},
 			},
+			expectedPrincipal: &identity.Principal{Username: "chef", Role: identity.DefaultRole},
 		},
 		{
-			name: "error - exist check from DB",
+			name: "error - token check from DB",
 			Auth: "qwertyzxcv12345",
 			accessor: &redisAccessorMock{
-				existsAccessor: func(key string) (int64, error) {
-					return 0, e.New("DB error")
+				getAccessor: func(key string) (string, bool, error) {
+					return "", false, e.New("DB error")
 				},
 			},
 			expectedErr: errors.NewDBErr("DB error"),
@@ -37,21 +63,72 @@ func TestProxy_CheckAuth(t *testing.T) {
 			name: "error - auth does not exist",
 			Auth: "qwertyzxcv12345",
 			accessor: &redisAccessorMock{
-				existsAccessor: func(key string) (int64, error) {
-					return 0, nil
+				getAccessor: func(key string) (string, bool, error) {
+					return "", false, nil
 				},
 			},
 			expectedErr: errors.NewFailedAuthErr(),
 		},
+		{
+			name: "error - invalid role",
+			Auth: "qwertyzxcv12345",
+			accessor: &redisAccessorMock{
+				getAccessor: token,
+				getAllAccessor: func(key string) (map[string]string, error) {
+					return map[string]string{userRole: "root"}, nil
+				},
+			},
+			expectedErr: errors.NewDBErr("invalid role 'root' of user 'chef'"),
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			proxy := newRedisMock(test.accessor)
-			err := proxy.CheckAuth(test.Auth)
+			principal, err := proxy.CheckAuth(context.Background(), test.Auth)
 			if err != nil && err.Error() != test.expectedErr.Error() {
 				t.Errorf("expected: '%s' instead got: '%s'", test.expectedErr, err)
 			}
+			if err == nil && test.expectedErr != nil {
+				t.Errorf("expected: '%s' instead got nil", test.expectedErr)
+			}
+			if !reflect.DeepEqual(principal, test.expectedPrincipal) {
+				t.Errorf("expected: '%v' instead got: '%v'", test.expectedPrincipal, principal)
+			}
 		})
 	}
 }
+
+func TestProxy_Credentials(t *testing.T) {
+	fake := newRedisFake()
+	fake.setHash(userPattern+"chef", map[string]interface{}{userRole: "editor"})
+	proxy := newRedisMock(fake)
+
+	if _, err := proxy.GetCredentials(context.Background(), "chef"); err == nil || err.Error() != errors.NewExistErr(false).Error() {
+		t.Errorf("expected: '%s' for a user without password instead got: '%v'", errors.NewExistErr(false), err)
+	}
+	if err := proxy.SetPassword(context.Background(), "chef", "$argon2id$hash"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := proxy.SetPassword(context.Background(), "cook", "$2a$10$hash"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := map[string]*identity.Credentials{
+		"chef": {Principal: identity.Principal{Username: "chef", Role: identity.Editor}, PasswordHash: "$argon2id$hash"},
+		"cook": {Principal: identity.Principal{Username: "cook", Role: identity.DefaultRole}, PasswordHash: "$2a$10$hash"},
+	}
+	for username, creds := range expected {
+		stored, err := proxy.GetCredentials(context.Background(), username)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(stored, creds) {
+			t.Errorf("expected: '%v' instead got: '%v'", creds, stored)
+		}
+	}
+
+	fake.fail["getAll"] = e.New("DB error")
+	if _, err := proxy.GetCredentials(context.Background(), "chef"); err == nil || err.Error() != errors.NewDBErr("DB error").Error() {
+		t.Errorf("expected: '%s' instead got: '%v'", errors.NewDBErr("DB error"), err)
+	}
+}
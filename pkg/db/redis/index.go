@@ -0,0 +1,355 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/recipe"
+)
+
+// Recipes are indexed in sorted sets whose members all share the same score, that way members are ordered
+// lexicographically and each member can hold the indexed value followed by the recipe ID. Numeric values are zero padded
+// so that their lexicographic order matches the numeric one, and ties are broken by the ID as recipe.Query does.
+const (
+	indexPattern    = "IDX_RECIPE_"
+	idIndex         = indexPattern + "ID"
+	nameIndex       = indexPattern + "NAME"
+	prepTimeIndex   = indexPattern + "PREPTIME"
+	difficultyIndex = indexPattern + "DIFFICULTY"
+	ratingIndex     = indexPattern + "RATING"
+	vegetarianIndex = indexPattern + "VEGETARIAN"
+	// separator - lower than any printable character, a shorter value is always listed first.
+	separator = "\x00"
+	// scanBatch - number of index members fetched per round trip when listing recipes, also the number of recipes
+	// indexed per round trip when rebuilding the indexes.
+	scanBatch = 100
+	// rebuildPattern - prefix of the keys the indexes are built into, see RebuildIndexes.
+	rebuildPattern = "REBUILD_"
+	// rebuildMarker - exists while the indexes are being rebuilt, writes update the indexes being built as well.
+	rebuildMarker = rebuildPattern + "RUNNING"
+	// indexVersionKey - hash holding the version of the indexes, they are rebuilt on startup while it is lower than
+	// indexVersion. Version 2 aggregates the ratings of the rates stored before the aggregation was kept on write.
+	indexVersionKey   = "INDEX_VERSION"
+	indexVersionField = "version"
+	indexVersion      = 2
+)
+
+// lexRange - bounds of a ZRANGEBYLEX, members are listed from Min to Max or the other way around when Rev.
+type lexRange struct {
+	Min   string
+	Max   string
+	Count int64
+	Rev   bool
+}
+
+func numericKey(n int) string {
+	return fmt.Sprintf("%010d", n)
+}
+
+func ratingKey(average float64) string {
+	return numericKey(int(math.Round(average * 100)))
+}
+
+func vegetarianKey(vegetarian bool) string {
+	if vegetarian {
+		return "1"
+	}
+	return "0"
+}
+
+// indexMembers - the member of each index for the given recipe.
+func indexMembers(rcp *recipe.Recipe) map[string]string {
+	return map[string]string{
+		idIndex:         rcp.ID,
+		nameIndex:       strings.ToLower(rcp.Name) + separator + rcp.ID,
+		prepTimeIndex:   numericKey(rcp.PrepTime) + separator + rcp.ID,
+		difficultyIndex: numericKey(rcp.Difficulty) + separator + rcp.ID,
+		ratingIndex:     ratingKey(rcp.AverageRating) + separator + rcp.ID,
+		vegetarianIndex: vegetarianKey(rcp.Vegetarian) + separator + rcp.ID,
+	}
+}
+
+// memberID - extracts the recipe ID out of an index member.
+func memberID(member string) string {
+	if i := strings.LastIndex(member, separator); i >= 0 {
+		return member[i+len(separator):]
+	}
+	return member
+}
+
+// listPlan - which index drives the listing and the prefix or bounds its members must be within.
+type listPlan struct {
+	index  string
+	prefix string
+	// upper - exclusive upper bound, only used when there is no prefix.
+	upper string
+}
+
+// planList - picks the index that provides the requested order while narrowing the members to scan the most. The
+// remaining filters are checked on the fetched recipes.
+func planList(q *recipe.Query) listPlan {
+	switch q.Sort {
+	case recipe.SortName:
+		return listPlan{index: nameIndex}
+	case recipe.SortPrepTime:
+		plan := listPlan{index: prepTimeIndex}
+		if q.Filter.MaxPrepTime > 0 {
+			plan.upper = numericKey(q.Filter.MaxPrepTime + 1)
+		}
+		return plan
+	case recipe.SortDifficulty:
+		plan := listPlan{index: difficultyIndex}
+		if q.Filter.Difficulty > 0 {
+			plan.prefix = numericKey(q.Filter.Difficulty) + separator
+		}
+		return plan
+	case recipe.SortRating:
+		return listPlan{index: ratingIndex}
+	}
+	// sorted by ID, members sharing a prefix are also sorted by ID
+	if q.Filter.Vegetarian != nil {
+		return listPlan{index: vegetarianIndex, prefix: vegetarianKey(*q.Filter.Vegetarian) + separator}
+	}
+	if q.Filter.Difficulty > 0 {
+		return listPlan{index: difficultyIndex, prefix: numericKey(q.Filter.Difficulty) + separator}
+	}
+	return listPlan{index: idIndex}
+}
+
+// cursorMember - translates a listing cursor into the member of the index the plan is driven by.
+func (lp listPlan) cursorMember(q *recipe.Query, c *recipe.Cursor) (string, error) {
+	if len(lp.prefix) > 0 && len(q.Sort) == 0 {
+		return lp.prefix + c.ID, nil
+	}
+	switch q.Sort {
+	case recipe.SortName:
+		return c.Key + separator + c.ID, nil
+	case recipe.SortPrepTime, recipe.SortDifficulty:
+		n, err := strconv.Atoi(c.Key)
+		if err != nil {
+			return "", err
+		}
+		return numericKey(n) + separator + c.ID, nil
+	case recipe.SortRating:
+		f, err := strconv.ParseFloat(c.Key, 64)
+		if err != nil {
+			return "", err
+		}
+		return ratingKey(f) + separator + c.ID, nil
+	}
+	return c.ID, nil
+}
+
+// bounds - initial range of the plan, the cursor (if any) is excluded.
+func (lp listPlan) bounds(q *recipe.Query) (lexRange, error) {
+	r := lexRange{Min: "-", Max: "+", Count: scanBatch, Rev: q.Desc}
+	if len(lp.prefix) > 0 {
+		r.Min = "[" + lp.prefix
+		r.Max = "(" + lp.prefix[:len(lp.prefix)-len(separator)] + "\x01"
+	} else if len(lp.upper) > 0 {
+		r.Max = "(" + lp.upper
+	}
+	if q.Cursor != nil {
+		member, err := lp.cursorMember(q, q.Cursor)
+		if err != nil {
+			return r, err
+		}
+		if q.Desc {
+			r.Max = "(" + member
+		} else {
+			r.Min = "(" + member
+		}
+	}
+
+	return r, nil
+}
+
+// recipeIndexUpdates - index members to replace the ones of the old recipe (if any) by the ones of the new recipe (if
+// any), members that do not change are left as they are.
+func recipeIndexUpdates(old, new *recipe.Recipe) (add, rem map[string][]string) {
+	add = make(map[string][]string)
+	rem = make(map[string][]string)
+	var newMembers map[string]string
+	if new != nil {
+		newMembers = indexMembers(new)
+	}
+	oldMembers := make(map[string]string)
+	if old != nil {
+		oldMembers = indexMembers(old)
+	}
+	for index, member := range oldMembers {
+		if newMembers[index] != member {
+			rem[index] = append(rem[index], member)
+		}
+	}
+	for index, member := range newMembers {
+		if oldMembers[index] != member {
+			add[index] = append(add[index], member)
+		}
+	}
+
+	return add, rem
+}
+
+// RebuildIndexes - rebuilds all the recipe indexes out of the stored recipes, keys are iterated with SCAN so that the
+// server is never blocked. The indexes are built aside (see rebuildKey), a batch of recipes per transaction, and renamed
+// over the live ones at once, which keep serving the listings in the meantime. Writes made while rebuilding update the
+// indexes being built as well (see indexedTransaction) and each batch is aborted (and retried) whenever its recipes
+// are written before it is indexed, hence no write is lost by the rename. Recipes stored before indexing was
+// introduced, or written straight into redis, are only listed once this has been run. The rating aggregation of every
+// recipe is recomputed out of its rates along the way, rates stored before the aggregation was kept on write are only
+// taken into account once this has been run.
+func (p *Proxy) RebuildIndexes(ctx context.Context) error {
+	indexes := []string{idIndex, nameIndex, prepTimeIndex, difficultyIndex, ratingIndex, vegetarianIndex}
+	// leftovers of a rebuild that did not finish
+	for _, index := range indexes {
+		if _, err := p.del(ctx, rebuildKey(index)); err != nil {
+			return errors.WrapDBErr(err)
+		}
+	}
+	// written before scanning, recipes created from now on are indexed by their own writes
+	err := p.transaction(ctx, func(tx redisTx) error {
+		tx.set(rebuildMarker, map[string]interface{}{"startedAt": time.Now().UTC().Format(time.RFC3339)})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	keys, err := p.scan(ctx, recipePattern+allPattern)
+	if err != nil {
+		return errors.WrapDBErr(err)
+	}
+	built := make(map[string]bool)
+	for start := 0; start < len(keys); start += scanBatch {
+		end := start + scanBatch
+		if end > len(keys) {
+			end = len(keys)
+		}
+		batch := keys[start:end]
+		// the rates are watched as well, they are aggregated into the recipes
+		rateKeys := make([]string, 0, len(batch))
+		watched := append(make([]string, 0, 2*len(batch)), batch...)
+		for _, key := range batch {
+			rateKeys = append(rateKeys, ratePattern+strings.TrimPrefix(key, recipePattern))
+		}
+		watched = append(watched, rateKeys...)
+		var batchBuilt map[string]bool
+		err := p.transaction(ctx, func(tx redisTx) error {
+			redisRcps, err := tx.getAllMany(batch)
+			if err != nil {
+				return errors.WrapDBErr(err)
+			}
+			redisRates, err := tx.getAllMany(rateKeys)
+			if err != nil {
+				return errors.WrapDBErr(err)
+			}
+			// set from scratch since the transaction may be retried
+			batchBuilt = make(map[string]bool)
+			add := make(map[string][]string)
+			for i, redisRcp := range redisRcps {
+				if len(redisRcp) == 0 {
+					continue
+				}
+				if err := aggregateRating(tx, batch[i], redisRcp, redisRates[i]); err != nil {
+					return err
+				}
+				rcp, err := mapToRecipeFromRedis(batch[i], redisRcp)
+				if err != nil {
+					return err
+				}
+				for index, member := range indexMembers(rcp) {
+					add[rebuildKey(index)] = append(add[rebuildKey(index)], member)
+					batchBuilt[index] = true
+				}
+			}
+			tx.updateIndexes(add, nil)
+			return nil
+		}, watched...)
+		if err != nil {
+			return err
+		}
+		for index := range batchBuilt {
+			built[index] = true
+		}
+	}
+
+	// sorted sets without members do not exist, indexes left empty are deleted instead
+	renames := make(map[string]string)
+	empty := []string{rebuildMarker}
+	for _, index := range indexes {
+		if built[index] {
+			renames[rebuildKey(index)] = index
+		} else {
+			empty = append(empty, index)
+		}
+	}
+	if err := p.rename(ctx, renames, empty...); err != nil {
+		return errors.WrapDBErr(err)
+	}
+
+	return p.transaction(ctx, func(tx redisTx) error {
+		tx.set(indexVersionKey, map[string]interface{}{indexVersionField: indexVersion})
+		return nil
+	})
+}
+
+// aggregateRating - sets the rating aggregation of the recipe out of its rates whenever it does not match them, both in
+// the recipe hash and in its fields as read.
+func aggregateRating(tx redisTx, key string, redisRcp, redisRates map[string]string) error {
+	stored, storedCount, err := mapRatingFromRedis(redisRcp)
+	if err != nil {
+		return err
+	}
+	sum, count, err := aggregateRates(redisRates)
+	if err != nil {
+		return err
+	}
+	if sum == stored && count == storedCount {
+		return nil
+	}
+	tx.set(key, map[string]interface{}{ratingSum: sum, ratingCount: count})
+	redisRcp[ratingSum], redisRcp[ratingCount] = strconv.Itoa(sum), strconv.Itoa(count)
+	return nil
+}
+
+// rebuildUpdates - the index updates applied to the live indexes, applied to the indexes being rebuilt instead.
+func rebuildUpdates(updates map[string][]string) map[string][]string {
+	rebuild := make(map[string][]string, len(updates))
+	for key, members := range updates {
+		if strings.HasPrefix(key, indexPattern) {
+			rebuild[rebuildKey(key)] = members
+		}
+	}
+	return rebuild
+}
+
+// rebuildKey - key an index is built into before replacing the live one.
+func rebuildKey(index string) string {
+	return rebuildPattern + index
+}
+
+// EnsureIndexes - builds the indexes whenever they do not exist yet or were built by a previous indexVersion, e.g. first
+// start after upgrading. Recipes written straight into redis once the indexes exist are not listed until IDX_RECIPE_ID is
+// deleted (see scripts/redis).
+func (p *Proxy) EnsureIndexes(ctx context.Context) error {
+	exists, err := p.exists(ctx, idIndex)
+	if err != nil {
+		return errors.WrapDBErr(err)
+	}
+	meta, err := p.getAll(ctx, indexVersionKey)
+	if err != nil {
+		return errors.WrapDBErr(err)
+	}
+	// indexes built before they were versioned hold no version
+	version, _ := strconv.Atoi(meta[indexVersionField])
+	if exists > 0 && version >= indexVersion {
+		return nil
+	}
+
+	return p.RebuildIndexes(ctx)
+}
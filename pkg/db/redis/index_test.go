@@ -0,0 +1,338 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rnov/Go-REST/pkg/rate"
+	"github.com/rnov/Go-REST/pkg/recipe"
+)
+
+// seedProxy - creates and rates enough recipes to span several index batches, returns them as they are stored.
+func seedProxy(t *testing.T, fake *redisFake) (*Proxy, []*recipe.Recipe) {
+	proxy := newRedisMock(fake)
+	names := []string{"Paella", "gazpacho", "Tortilla", "paella", "Croquetas", "salmorejo"}
+	for i := 0; i < 2*scanBatch+17; i++ {
+		rcp := &recipe.Recipe{
+			ID:         fmt.Sprintf("%06d", (i*7919)%1000000),
+			Name:       names[i%len(names)],
+			PrepTime:   (i * 13) % 90,
+			Difficulty: i%3 + 1,
+			Vegetarian: i%4 == 0,
+		}
+		if err := proxy.CreateRecipe(context.Background(), rcp); err != nil {
+			t.Fatalf("unexpected error creating recipe: %s", err)
+		}
+		for n := 0; n < i%4; n++ {
+			if err := proxy.RateRecipe(context.Background(), rcp.ID, &rate.Rate{Note: (i+n)%5 + 1, Rater: strconv.Itoa(n)}); err != nil {
+				t.Fatalf("unexpected error rating recipe: %s", err)
+			}
+		}
+	}
+	var rcps []*recipe.Recipe
+	for key := range fake.hashes {
+		if !strings.HasPrefix(key, recipePattern) {
+			continue
+		}
+		rcp, err := proxy.GetRecipeByID(context.Background(), strings.TrimPrefix(key, recipePattern))
+		if err != nil {
+			t.Fatalf("unexpected error retrieving recipe: %s", err)
+		}
+		rcps = append(rcps, rcp)
+	}
+	return proxy, rcps
+}
+
+func TestProxy_GetRecipesIndexed(t *testing.T) {
+	vegetarian, meat := true, false
+	queries := []recipe.Query{
+		{Limit: 25},
+		{Limit: 25, Desc: true},
+		{Limit: 30, Sort: recipe.SortName},
+		{Limit: 30, Sort: recipe.SortName, Desc: true},
+		{Limit: 40, Sort: recipe.SortPrepTime, Filter: recipe.Filter{MaxPrepTime: 45}},
+		{Limit: 40, Sort: recipe.SortPrepTime, Desc: true, Filter: recipe.Filter{MaxPrepTime: 45}},
+		{Limit: 20, Sort: recipe.SortDifficulty, Filter: recipe.Filter{Difficulty: 2}},
+		{Limit: 20, Sort: recipe.SortDifficulty, Desc: true},
+		{Limit: 15, Sort: recipe.SortRating},
+		{Limit: 15, Sort: recipe.SortRating, Desc: true, Filter: recipe.Filter{Vegetarian: &meat}},
+		{Limit: 10, Filter: recipe.Filter{Vegetarian: &vegetarian}},
+		{Limit: 10, Desc: true, Filter: recipe.Filter{Vegetarian: &meat, Difficulty: 3}},
+		{Limit: 10, Filter: recipe.Filter{Difficulty: 1, MaxPrepTime: 30}},
+	}
+
+	fake := newRedisFake()
+	proxy, rcps := seedProxy(t, fake)
+
+	for _, query := range queries {
+		q := query
+		t.Run(fmt.Sprintf("sort %q desc %t", q.Sort, q.Desc), func(t *testing.T) {
+			for page := 0; ; page++ {
+				expected := q.Apply(rcps)
+				got, err := proxy.GetRecipes(context.Background(), &q)
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if !reflect.DeepEqual(got, expected) {
+					t.Fatalf("page %d: expected: '%v' instead got: '%v'", page, expected, got)
+				}
+				if len(got.NextCursor) == 0 {
+					break
+				}
+				cursor, err := recipe.DecodeCursor(got.NextCursor)
+				if err != nil {
+					t.Fatalf("unexpected error decoding cursor: %s", err)
+				}
+				q.Cursor = cursor
+			}
+		})
+	}
+}
+
+func TestProxy_RebuildIndexes(t *testing.T) {
+	fake := newRedisFake()
+	proxy, _ := seedProxy(t, fake)
+	indexed := make(map[string]map[string]bool)
+	for key, members := range fake.zsets {
+		indexed[key] = members
+	}
+	// indexes missing, e.g. recipes stored before indexing existed
+	fake.zsets = make(map[string]map[string]bool)
+
+	if err := proxy.EnsureIndexes(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(fake.zsets, indexed) {
+		t.Errorf("rebuilt indexes do not match the ones maintained on write")
+	}
+
+	// once built, indexes are left as they are
+	delete(fake.zsets, nameIndex)
+	if err := proxy.EnsureIndexes(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := fake.zsets[nameIndex]; ok {
+		t.Errorf("expected indexes not to be rebuilt")
+	}
+}
+
+// rebuildFake - counts the transactions and checks the live indexes while the indexes are being rebuilt, during (if
+// any) is run once the reads of each transaction are done, before it is executed.
+type rebuildFake struct {
+	*redisFake
+	transactions int
+	check        func()
+	during       func(keys []string)
+}
+
+func (rf *rebuildFake) watch(fn func(tx redisTx) error, keys ...string) error {
+	rf.transactions++
+	rf.check()
+	return rf.redisFake.watch(func(tx redisTx) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		if rf.during != nil {
+			rf.during(keys)
+		}
+		return nil
+	}, keys...)
+}
+
+func TestProxy_RebuildIndexesAside(t *testing.T) {
+	fake := newRedisFake()
+	_, rcps := seedProxy(t, fake)
+	indexed := make(map[string]map[string]bool)
+	for key, members := range fake.zsets {
+		indexed[key] = make(map[string]bool)
+		for member := range members {
+			indexed[key][member] = true
+		}
+	}
+	// stale member of a recipe that is no longer stored
+	fake.zUpdate(map[string][]string{idIndex: {"999999"}}, nil)
+
+	rf := &rebuildFake{redisFake: fake}
+	rf.check = func() {
+		if _, rebuilding := fake.hashes[rebuildMarker]; rebuilding && !fake.zsets[idIndex]["999999"] {
+			t.Errorf("expected the live indexes to be left as they are while rebuilding")
+		}
+	}
+	if err := newRedisMock(rf).RebuildIndexes(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// the marker, a transaction per batch and the version
+	if expected := 2 + (len(rcps)+scanBatch-1)/scanBatch; rf.transactions != expected {
+		t.Errorf("expected %d transactions instead got: %d", expected, rf.transactions)
+	}
+	if !reflect.DeepEqual(fake.zsets, indexed) {
+		t.Errorf("rebuilt indexes do not match the ones maintained on write")
+	}
+
+	// recipes all gone, the indexes are emptied
+	for _, rcp := range rcps {
+		fake.delKeys(recipePattern + rcp.ID)
+	}
+	rf.check = func() {}
+	if err := newRedisMock(rf).RebuildIndexes(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(fake.zsets) != 0 {
+		t.Errorf("expected the indexes to be deleted instead got: '%v'", fake.zsets)
+	}
+}
+
+// TestProxy_RebuildIndexesKeepsWrites - writes made while rebuilding, including those made to a batch between its reads
+// and its execution, are not lost when the rebuilt indexes replace the live ones.
+func TestProxy_RebuildIndexesKeepsWrites(t *testing.T) {
+	fake := newRedisFake()
+	_, rcps := seedProxy(t, fake)
+	writer := newRedisMock(fake)
+	rf := &rebuildFake{redisFake: fake, check: func() {}}
+	written := false
+	rf.during = func(keys []string) {
+		if written || len(keys) == 0 || !strings.HasPrefix(keys[0], recipePattern) {
+			return
+		}
+		written = true
+		// recipe of the batch being indexed, its transaction is retried
+		batchID := strings.TrimPrefix(keys[0], recipePattern)
+		writes := []func() error{
+			func() error {
+				return writer.UpdateRecipe(context.Background(), &recipe.Recipe{ID: batchID, Name: "Migas", PrepTime: 5, Difficulty: 1}, 0)
+			},
+			func() error {
+				return writer.CreateRecipe(context.Background(), &recipe.Recipe{ID: "999999", Name: "Fabada", PrepTime: 180, Difficulty: 3})
+			},
+			func() error {
+				return writer.RateRecipe(context.Background(), rcps[1].ID, &rate.Rate{Note: 5, Rater: "late"})
+			},
+			func() error { return writer.DeleteRecipe(context.Background(), rcps[2].ID, 0) },
+		}
+		for _, write := range writes {
+			if err := write(); err != nil {
+				t.Fatalf("unexpected error writing while rebuilding: %s", err)
+			}
+		}
+	}
+	if err := newRedisMock(rf).RebuildIndexes(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !written {
+		t.Fatalf("expected writes while rebuilding")
+	}
+	if _, ok := fake.hashes[rebuildMarker]; ok {
+		t.Errorf("expected the rebuild marker to be deleted")
+	}
+
+	var stored []*recipe.Recipe
+	for key := range fake.hashes {
+		if !strings.HasPrefix(key, recipePattern) {
+			continue
+		}
+		rcp, err := writer.GetRecipeByID(context.Background(), strings.TrimPrefix(key, recipePattern))
+		if err != nil {
+			t.Fatalf("unexpected error retrieving recipe: %s", err)
+		}
+		stored = append(stored, rcp)
+	}
+	assertIndexed(t, fake, stored...)
+}
+
+func TestProxy_IndexesFollowWrites(t *testing.T) {
+	fake := newRedisFake()
+	proxy := newRedisMock(fake)
+	rcp := &recipe.Recipe{ID: "1", Name: "Paella", PrepTime: 60, Difficulty: 2, Vegetarian: false}
+	if err := proxy.CreateRecipe(context.Background(), rcp); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := proxy.RateRecipe(context.Background(), "1", &rate.Rate{Note: 3}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	updated := &recipe.Recipe{ID: "1", Name: "Gazpacho", PrepTime: 15, Difficulty: 1, Vegetarian: true}
+	if err := proxy.UpdateRecipe(context.Background(), updated, 0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := map[string]map[string]bool{
+		idIndex:         {"1": true},
+		nameIndex:       {"gazpacho" + separator + "1": true},
+		prepTimeIndex:   {numericKey(15) + separator + "1": true},
+		difficultyIndex: {numericKey(1) + separator + "1": true},
+		ratingIndex:     {ratingKey(3) + separator + "1": true},
+		vegetarianIndex: {"1" + separator + "1": true},
+	}
+	if !reflect.DeepEqual(fake.zsets, expected) {
+		t.Errorf("expected: '%v' instead got: '%v'", expected, fake.zsets)
+	}
+
+	if err := proxy.DeleteRecipe(context.Background(), "1", 0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for index, members := range fake.zsets {
+		if len(members) > 0 {
+			t.Errorf("expected index %s to be empty instead got: '%v'", index, members)
+		}
+	}
+}
+
+// TestProxy_EnsureIndexesAggregatesRates - rates stored before the aggregation was kept on write are aggregated once
+// the indexes are rebuilt, indexes built by a previous version included.
+func TestProxy_EnsureIndexesAggregatesRates(t *testing.T) {
+	fake := newRedisFake()
+	proxy := newRedisMock(fake)
+	// stored before the rates were aggregated, along with indexes holding them as unrated
+	old := &recipe.Recipe{ID: "1", Name: "Paella", PrepTime: 60, Difficulty: 2, Version: 1}
+	storeRecipe(t, fake, old, nil)
+	fake.setHash(ratePattern+"1", map[string]interface{}{"1594893600": "4", "1594897200": "2"})
+	// rated once the aggregation was kept on write, on top of a rate stored before
+	mixed := &recipe.Recipe{ID: "2", Name: "Gazpacho", PrepTime: 15, Difficulty: 1, Version: 1}
+	storeRecipe(t, fake, mixed, map[string]interface{}{ratingSum: 5, ratingCount: 1})
+	value, err := mapRateToRedisFields(&rate.Rate{Note: 5, Rater: "chef"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.setHash(ratePattern+"2", value)
+	fake.setHash(ratePattern+"2", map[string]interface{}{"1594893600": "2"})
+	unrated := &recipe.Recipe{ID: "3", Name: "Tortilla", PrepTime: 30, Difficulty: 1, Version: 1}
+	storeRecipe(t, fake, unrated, nil)
+
+	if err := proxy.EnsureIndexes(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := map[string]*rate.Summary{"1": rate.NewSummary(6, 2), "2": rate.NewSummary(7, 2), "3": rate.NewSummary(0, 0)}
+	var rcps []*recipe.Recipe
+	for ID, summary := range expected {
+		got, err := proxy.GetRateSummary(context.Background(), ID)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(got, summary) {
+			t.Errorf("recipe %s: expected: '%v' instead got: '%v'", ID, summary, got)
+		}
+		rcp, err := proxy.GetRecipeByID(context.Background(), ID)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		rcps = append(rcps, rcp)
+	}
+	assertIndexed(t, fake, rcps...)
+	if _, ok := fake.hashes[recipePattern+unrated.ID][ratingCount]; ok {
+		t.Errorf("expected the aggregation of unrated recipes not to be written")
+	}
+	if version := fake.hashes[indexVersionKey][indexVersionField]; version != strconv.Itoa(indexVersion) {
+		t.Errorf("expected index version %d instead got: '%s'", indexVersion, version)
+	}
+
+	// current indexes are left as they are
+	delete(fake.zsets, nameIndex)
+	if err := proxy.EnsureIndexes(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := fake.zsets[nameIndex]; ok {
+		t.Errorf("expected indexes not to be rebuilt")
+	}
+}
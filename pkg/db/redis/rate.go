@@ -1,43 +1,230 @@
 package redis
 
 import (
-	"github.com/rnov/Go-REST/pkg/errors"
-	"github.com/rnov/Go-REST/pkg/rate"
-
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/rate"
 )
 
 const (
 	allPattern  = "*"
 	ratePattern = "RATE_"
+	ratingSum   = "ratingsum"
+	ratingCount = "ratingcount"
+	raterPrefix = "user:"
 )
 
-func (p *Proxy) RateRecipe(recipeID string, rate *rate.Rate) error {
-	// check whether recipe exist
-	exists, err := p.exists(recipePattern + recipeID)
+// RateRecipe - every rate is stored as a distinct field of the recipe's rate hash, one per rater, the recipe hash keeps
+// the sum and count of its notes so that the aggregated score can be read along with the recipe. The previous rate of
+// the rater, if any, is replaced and taken out of the aggregation.
+func (p *Proxy) RateRecipe(ctx context.Context, recipeID string, r *rate.Rate) error {
+	// prepare to insert
+	redisFields, err := mapRateToRedisFields(r)
+	if err != nil {
+		return errors.WrapDBErr(err)
+	}
+
+	// the recipe is watched, that way the rate is never stored once the recipe has been deleted and concurrent rates do
+	// not move the recipe within the rating index based on a stale aggregation. The rates are watched as well so that
+	// the replaced rate is the one taken out.
+	key, rateKey, field := recipePattern+recipeID, ratePattern+recipeID, rateField(r.Rater)
+	return p.indexedTransaction(ctx, func(tx redisTx) error {
+		recipeFields, err := tx.getAll(key)
+		if err != nil {
+			return errors.WrapDBErr(err)
+		}
+		if len(recipeFields) == 0 {
+			return errors.NewExistErr(false)
+		}
+		noteDelta, countDelta := r.Note, 1
+		previous, found, err := tx.getField(rateKey, field)
+		if err != nil {
+			return errors.WrapDBErr(err)
+		}
+		if found {
+			old, err := mapToRateFromRedis(field, previous)
+			if err != nil {
+				return err
+			}
+			noteDelta, countDelta = r.Note-old.Note, 0
+		}
+		tx.set(rateKey, redisFields)
+		return updateRating(tx, recipeID, recipeFields, noteDelta, countDelta)
+	}, key, rateKey)
+}
+
+// DeleteRate - removes the rate of the rater and takes it out of the aggregation, as RateRecipe does.
+func (p *Proxy) DeleteRate(ctx context.Context, recipeID, rater string) error {
+	key, rateKey, field := recipePattern+recipeID, ratePattern+recipeID, rateField(rater)
+	return p.indexedTransaction(ctx, func(tx redisTx) error {
+		recipeFields, err := tx.getAll(key)
+		if err != nil {
+			return errors.WrapDBErr(err)
+		}
+		if len(recipeFields) == 0 {
+			return errors.NewExistErr(false)
+		}
+		previous, found, err := tx.getField(rateKey, field)
+		if err != nil {
+			return errors.WrapDBErr(err)
+		}
+		if !found {
+			return errors.NewExistErr(false)
+		}
+		old, err := mapToRateFromRedis(field, previous)
+		if err != nil {
+			return err
+		}
+		tx.delFields(rateKey, field)
+		return updateRating(tx, recipeID, recipeFields, -old.Note, -1)
+	}, key, rateKey)
+}
+
+// updateRating - applies the change of the notes to the aggregation kept in the recipe hash and moves the recipe within
+// the rating index accordingly.
+func updateRating(tx redisTx, recipeID string, recipeFields map[string]string, noteDelta, countDelta int) error {
+	sum, count, err := mapRatingFromRedis(recipeFields)
 	if err != nil {
-		return errors.NewDBErr(err.Error())
+		return err
+	}
+	old, summary := rate.NewSummary(sum, count), rate.NewSummary(sum+noteDelta, count+countDelta)
+	key := recipePattern + recipeID
+	tx.incrBy(key, ratingSum, int64(noteDelta))
+	tx.incrBy(key, ratingCount, int64(countDelta))
+	oldMember := ratingKey(old.Average) + separator + recipeID
+	newMember := ratingKey(summary.Average) + separator + recipeID
+	if oldMember != newMember {
+		tx.updateIndexes(map[string][]string{ratingIndex: {newMember}}, map[string][]string{ratingIndex: {oldMember}})
+	}
+	return nil
+}
+
+func (p *Proxy) GetRates(ctx context.Context, recipeID string) ([]*rate.Rate, error) {
+	exists, err := p.exists(ctx, recipePattern+recipeID)
+	if err != nil {
+		return nil, errors.WrapDBErr(err)
 	}
 	if exists == 0 {
-		return errors.NewExistErr(false)
+		return nil, errors.NewExistErr(false)
 	}
-	// prepare to insert
-	redisFields := mapRateToRedisFields(rate.Note)
-	err = p.setErr(ratePattern+recipeID, redisFields)
+	redisRates, err := p.getAll(ctx, ratePattern+recipeID)
 	if err != nil {
-		return errors.NewDBErr(err.Error())
+		return nil, errors.WrapDBErr(err)
 	}
 
-	return nil
+	rates := make([]*rate.Rate, 0, len(redisRates))
+	for field, value := range redisRates {
+		r, err := mapToRateFromRedis(field, value)
+		if err != nil {
+			return nil, err
+		}
+		rates = append(rates, r)
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		return rates[i].CreatedAt.Before(rates[j].CreatedAt)
+	})
+
+	return rates, nil
+}
+
+func (p *Proxy) GetRateSummary(ctx context.Context, recipeID string) (*rate.Summary, error) {
+	recipeFields, err := p.getAll(ctx, recipePattern+recipeID)
+	if err != nil {
+		return nil, errors.WrapDBErr(err)
+	}
+	if len(recipeFields) == 0 {
+		return nil, errors.NewExistErr(false)
+	}
+
+	return mapToSummaryFromRedis(recipeFields)
 }
 
-// mapRateToRedisFields - map rate struct to a map in order to be inserted to redis.
-func mapRateToRedisFields(rating int) map[string]interface{} {
+// rateField - field of the rate of the user within the recipe's rate hash, a new rate of the same user overwrites it.
+// Rates of anonymous raters were stored under their creation time instead, hence are never overwritten.
+func rateField(rater string) string {
+	return raterPrefix + rater
+}
+
+// mapRateToRedisFields - map rate struct to a map in order to be inserted to redis, the rater is kept in the field only.
+func mapRateToRedisFields(r *rate.Rate) (map[string]interface{}, error) {
+	value, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
 	mappedData := make(map[string]interface{})
-	// since AUTH it is not necessary we use the timestamp as key to insert the rating into redis
-	key := strconv.FormatInt(time.Now().Unix(), 10)
-	mappedData[key] = rating
+	mappedData[rateField(r.Rater)] = string(value)
+
+	return mappedData, nil
+}
+
+// mapToRateFromRedis - rates stored before they were kept individually only hold the note and use the unix time as field.
+// The rater is taken from the field of the rates of users, the address of anonymous raters is not read.
+func mapToRateFromRedis(field, value string) (*rate.Rate, error) {
+	r := &rate.Rate{}
+	if strings.HasPrefix(value, "{") {
+		if err := json.Unmarshal([]byte(value), r); err != nil {
+			return nil, errors.NewDBErr(fmt.Sprintf("error parsing rate from redis: %s", err.Error()))
+		}
+		if strings.HasPrefix(field, raterPrefix) {
+			r.Rater = strings.TrimPrefix(field, raterPrefix)
+		}
+		return r, nil
+	}
+	note, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, errors.NewDBErr(fmt.Sprintf("error parsing rate from redis: %s", err.Error()))
+	}
+	r.Note = note
+	if ts, err := strconv.ParseInt(field, 10, 64); err == nil {
+		r.CreatedAt = time.Unix(ts, 0).UTC()
+	}
+
+	return r, nil
+}
+
+// aggregateRates - sum and count of the notes of the rates held by a rate hash, the aggregation RateRecipe and DeleteRate
+// keep in the recipe hash.
+func aggregateRates(redisRates map[string]string) (sum, count int, err error) {
+	for field, value := range redisRates {
+		r, err := mapToRateFromRedis(field, value)
+		if err != nil {
+			return 0, 0, err
+		}
+		sum += r.Note
+		count++
+	}
+	return sum, count, nil
+}
+
+// mapToSummaryFromRedis - recipes that have never been rated do not hold the aggregation fields.
+func mapToSummaryFromRedis(redisData map[string]string) (*rate.Summary, error) {
+	sum, count, err := mapRatingFromRedis(redisData)
+	if err != nil {
+		return nil, err
+	}
+
+	return rate.NewSummary(sum, count), nil
+}
+
+// mapRatingFromRedis - sum and count of the notes kept in the recipe hash, both are 0 until the recipe is rated.
+func mapRatingFromRedis(redisData map[string]string) (sum, count int, err error) {
+	if v, ok := redisData[ratingSum]; ok {
+		if sum, err = strconv.Atoi(v); err != nil {
+			return 0, 0, errors.NewDBErr(fmt.Sprintf("error parsing rating from redis: %s", err.Error()))
+		}
+	}
+	if v, ok := redisData[ratingCount]; ok {
+		if count, err = strconv.Atoi(v); err != nil {
+			return 0, 0, errors.NewDBErr(fmt.Sprintf("error parsing rating from redis: %s", err.Error()))
+		}
+	}
 
-	return mappedData
+	return sum, count, nil
 }
@@ -1,49 +1,166 @@
 package redis
 
 import (
+	"context"
 	e "errors"
+	"reflect"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/rnov/Go-REST/pkg/errors"
 	"github.com/rnov/Go-REST/pkg/rate"
+	"github.com/rnov/Go-REST/pkg/recipe"
 )
 
 func TestProxy_RateRecipe(t *testing.T) {
+	stored := &recipe.Recipe{ID: "654321", Name: "qwerty", PrepTime: 20, Difficulty: 3, AverageRating: 3, RatingCount: 1}
 	tests := []struct {
 		name        string
-		ID          string
-		inputRate   *rate.Rate
-		accessor    *redisAccessorMock
+		stored      []*recipe.Recipe
+		fail        map[string]error
 		expectedErr error
 	}{
 		{
-			name:      "successful rate",
-			ID:        "654321",
-			inputRate: &rate.Rate{Note: 4},
+			name:   "successful rate",
+			stored: []*recipe.Recipe{stored},
+		},
+		{
+			name:        "error - recipe does not exist",
+			expectedErr: errors.NewExistErr(false),
+		},
+		{
+			name:        "error - reading recipe from DB",
+			stored:      []*recipe.Recipe{stored},
+			fail:        map[string]error{"getAll": e.New("DB error")},
+			expectedErr: errors.NewDBErr("DB error"),
+		},
+		{
+			name:        "error - executing transaction in DB",
+			stored:      []*recipe.Recipe{stored},
+			fail:        map[string]error{"exec": e.New("DB error")},
+			expectedErr: errors.NewDBErr("DB error"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newRedisFake()
+			for _, rcp := range test.stored {
+				storeRecipe(t, fake, rcp, map[string]interface{}{ratingSum: 3, ratingCount: 1})
+			}
+			fake.fail = test.fail
+			proxy := newRedisMock(fake)
+			err := proxy.RateRecipe(context.Background(), "654321", &rate.Rate{Note: 4, Rater: "127.0.0.1", CreatedAt: time.Now()})
+			if err != nil && err.Error() != test.expectedErr.Error() {
+				t.Errorf("expected: '%s' instead got: '%s'", test.expectedErr, err)
+			}
+			if err == nil && test.expectedErr != nil {
+				t.Errorf("expected: '%s' instead got nil", test.expectedErr)
+			}
+			if test.expectedErr != nil {
+				if _, ok := fake.hashes[ratePattern+"654321"]; ok {
+					t.Errorf("expected the rate not to be stored")
+				}
+				return
+			}
+			// the aggregation and the rating index include the new note
+			rated := *stored
+			rated.AverageRating, rated.RatingCount = 3.5, 2
+			rcp, err := getRecipe(&txFake{fake: fake}, "654321")
+			if err != nil || !reflect.DeepEqual(rcp, &rated) {
+				t.Errorf("expected: '%v' instead got: '%v' ('%v')", &rated, rcp, err)
+			}
+			if len(fake.hashes[ratePattern+"654321"]) != 1 {
+				t.Errorf("expected the rate to be stored instead got: '%v'", fake.hashes[ratePattern+"654321"])
+			}
+			assertIndexed(t, fake, &rated)
+		})
+	}
+}
+
+func TestProxy_ConcurrentRates(t *testing.T) {
+	fake := newRedisFake()
+	stored := &recipe.Recipe{ID: "654321", Name: "qwerty", PrepTime: 20, Difficulty: 3}
+	storeRecipe(t, fake, stored, nil)
+	proxy := newRedisMock(fake)
+
+	var wg sync.WaitGroup
+	sum := 0
+	for i := 0; i < 30; i++ {
+		note := i%5 + 1
+		sum += note
+		wg.Add(1)
+		go func(i, note int) {
+			defer wg.Done()
+			if err := proxy.RateRecipe(context.Background(), "654321", &rate.Rate{Note: note, Rater: strconv.Itoa(i)}); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		}(i, note)
+	}
+	wg.Wait()
+
+	summary, err := proxy.GetRateSummary(context.Background(), "654321")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := rate.NewSummary(sum, 30)
+	if !reflect.DeepEqual(summary, expected) {
+		t.Errorf("expected: '%v' instead got: '%v'", expected, summary)
+	}
+	rated := *stored
+	rated.AverageRating, rated.RatingCount = expected.Average, expected.Count
+	assertIndexed(t, fake, &rated)
+}
+
+func TestProxy_GetRates(t *testing.T) {
+	first := time.Date(2020, 10, 1, 10, 0, 0, 0, time.UTC)
+	second := first.Add(time.Second)
+	tests := []struct {
+		name          string
+		ID            string
+		accessor      *redisAccessorMock
+		expectedRates []*rate.Rate
+		expectedErr   error
+	}{
+		{
+			name: "successful retrieve - ordered by creation",
+			ID:   "654321",
 			accessor: &redisAccessorMock{
 				existsAccessor: func(key string) (int64, error) {
 					return 1, nil
 				},
-				setErrAccessor: func(key string, fields map[string]interface{}) error {
-					return nil
+				getAllAccessor: func(key string) (map[string]string, error) {
+					return map[string]string{
+						"user:chef":                    `{"note":3,"createdAt":"2020-10-01T10:00:01Z"}`,
+						"1601546400000000000:10.0.0.1": `{"note":5,"rater":"10.0.0.1","createdAt":"2020-10-01T10:00:00Z"}`,
+					}, nil
 				},
 			},
+			expectedRates: []*rate.Rate{
+				{Note: 5, CreatedAt: first},
+				{Note: 3, Rater: "chef", CreatedAt: second},
+			},
 		},
 		{
-			name:      "error - exist check from DB",
-			ID:        "654321",
-			inputRate: &rate.Rate{Note: 4},
+			name: "successful retrieve - legacy rate",
+			ID:   "654321",
 			accessor: &redisAccessorMock{
 				existsAccessor: func(key string) (int64, error) {
-					return 0, e.New("DB error")
+					return 1, nil
+				},
+				getAllAccessor: func(key string) (map[string]string, error) {
+					return map[string]string{"1601546400": "4"}, nil
 				},
 			},
-			expectedErr: errors.NewDBErr("DB error"),
+			expectedRates: []*rate.Rate{
+				{Note: 4, CreatedAt: first},
+			},
 		},
 		{
-			name:      "error - recipe does not exist",
-			ID:        "654321",
-			inputRate: &rate.Rate{Note: 4},
+			name: "error - recipe does not exist",
+			ID:   "654321",
 			accessor: &redisAccessorMock{
 				existsAccessor: func(key string) (int64, error) {
 					return 0, nil
@@ -52,15 +169,14 @@ func TestProxy_RateRecipe(t *testing.T) {
 			expectedErr: errors.NewExistErr(false),
 		},
 		{
-			name:      "error - writing rate in DB",
-			ID:        "654321",
-			inputRate: &rate.Rate{Note: 4},
+			name: "error - get all DB call",
+			ID:   "654321",
 			accessor: &redisAccessorMock{
 				existsAccessor: func(key string) (int64, error) {
 					return 1, nil
 				},
-				setErrAccessor: func(key string, fields map[string]interface{}) error {
-					return e.New("DB error")
+				getAllAccessor: func(key string) (map[string]string, error) {
+					return nil, e.New("DB error")
 				},
 			},
 			expectedErr: errors.NewDBErr("DB error"),
@@ -70,10 +186,116 @@ func TestProxy_RateRecipe(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			proxy := newRedisMock(test.accessor)
-			err := proxy.RateRecipe(test.ID, test.inputRate)
+			rates, err := proxy.GetRates(context.Background(), test.ID)
+			if err != nil && err.Error() != test.expectedErr.Error() {
+				t.Errorf("expected: '%s' instead got: '%s'", test.expectedErr, err)
+			}
+			if rates != nil {
+				if !reflect.DeepEqual(rates, test.expectedRates) {
+					t.Errorf("expected: '%v' instead got: '%v'", test.expectedRates, rates)
+				}
+			}
+		})
+	}
+}
+
+func TestProxy_GetRateSummary(t *testing.T) {
+	tests := []struct {
+		name            string
+		ID              string
+		accessor        *redisAccessorMock
+		expectedSummary *rate.Summary
+		expectedErr     error
+	}{
+		{
+			name: "successful retrieve",
+			ID:   "654321",
+			accessor: &redisAccessorMock{
+				getAllAccessor: func(key string) (map[string]string, error) {
+					return map[string]string{name: "qwerty", ratingSum: "10", ratingCount: "3"}, nil
+				},
+			},
+			expectedSummary: &rate.Summary{Average: 3.33, Count: 3},
+		},
+		{
+			name: "successful retrieve - not rated",
+			ID:   "654321",
+			accessor: &redisAccessorMock{
+				getAllAccessor: func(key string) (map[string]string, error) {
+					return map[string]string{name: "qwerty"}, nil
+				},
+			},
+			expectedSummary: &rate.Summary{},
+		},
+		{
+			name: "error - recipe does not exist",
+			ID:   "654321",
+			accessor: &redisAccessorMock{
+				getAllAccessor: func(key string) (map[string]string, error) {
+					return nil, nil
+				},
+			},
+			expectedErr: errors.NewExistErr(false),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxy := newRedisMock(test.accessor)
+			summary, err := proxy.GetRateSummary(context.Background(), test.ID)
 			if err != nil && err.Error() != test.expectedErr.Error() {
 				t.Errorf("expected: '%s' instead got: '%s'", test.expectedErr, err)
 			}
+			if summary != nil {
+				if !reflect.DeepEqual(summary, test.expectedSummary) {
+					t.Errorf("expected: '%v' instead got: '%v'", test.expectedSummary, summary)
+				}
+			}
 		})
 	}
 }
+
+func TestProxy_ReRateAndDeleteRate(t *testing.T) {
+	fake := newRedisFake()
+	stored := &recipe.Recipe{ID: "654321", Name: "qwerty", PrepTime: 20, Difficulty: 3}
+	storeRecipe(t, fake, stored, nil)
+	proxy := newRedisMock(fake)
+	assertRating := func(average float64, count int) {
+		t.Helper()
+		rated := *stored
+		rated.AverageRating, rated.RatingCount = average, count
+		rcp, err := getRecipe(&txFake{fake: fake}, "654321")
+		if err != nil || !reflect.DeepEqual(rcp, &rated) {
+			t.Errorf("expected: '%v' instead got: '%v' ('%v')", &rated, rcp, err)
+		}
+		assertIndexed(t, fake, &rated)
+	}
+
+	for _, r := range []*rate.Rate{{Note: 5, Rater: "chef"}, {Note: 3, Rater: "cook"}, {Note: 1, Rater: "chef"}} {
+		if err := proxy.RateRecipe(context.Background(), "654321", r); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	// the second rate of chef replaces the first one
+	assertRating(2, 2)
+	if len(fake.hashes[ratePattern+"654321"]) != 2 {
+		t.Errorf("expected a rate per rater instead got: '%v'", fake.hashes[ratePattern+"654321"])
+	}
+
+	if err := proxy.DeleteRate(context.Background(), "654321", "chef"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertRating(3, 1)
+
+	notExist := errors.NewExistErr(false).Error()
+	if err := proxy.DeleteRate(context.Background(), "654321", "chef"); err == nil || err.Error() != notExist {
+		t.Errorf("expected: '%s' instead got: '%v'", notExist, err)
+	}
+	if err := proxy.DeleteRate(context.Background(), "123456", "cook"); err == nil || err.Error() != notExist {
+		t.Errorf("expected: '%s' instead got: '%v'", notExist, err)
+	}
+	fake.fail["getField"] = e.New("DB error")
+	if err := proxy.DeleteRate(context.Background(), "654321", "cook"); err == nil || err.Error() != "DB error" {
+		t.Errorf("expected: 'DB error' instead got: '%v'", err)
+	}
+}
@@ -1,9 +1,12 @@
 package redis
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/rnov/Go-REST/pkg/errors"
 	"github.com/rnov/Go-REST/pkg/recipe"
@@ -16,12 +19,22 @@ const (
 	prepTime      = "preptime"
 	vegetarian    = "vegetarian"
 	difficulty    = "difficulty"
+	servings      = "servings"
+	cuisine       = "cuisine"
+	// tags, ingredients and steps are nested data, hence they are stored as JSON.
+	tags        = "tags"
+	ingredients = "ingredients"
+	steps       = "steps"
+	createdAt   = "createdat"
+	updatedAt   = "updatedat"
+	rcpVersion  = "version"
+	owner       = "owner"
 )
 
-func (p *Proxy) GetRecipeByID(ID string) (*recipe.Recipe, error) {
-	recipeFields, err := p.getAll(recipePattern + ID)
+func (p *Proxy) GetRecipeByID(ctx context.Context, ID string) (*recipe.Recipe, error) {
+	recipeFields, err := p.getAll(ctx, recipePattern+ID)
 	if err != nil {
-		return nil, errors.NewDBErr(err.Error())
+		return nil, errors.WrapDBErr(err)
 	}
 	if len(recipeFields) == 0 {
 		return nil, errors.NewExistErr(false)
@@ -34,85 +47,266 @@ func (p *Proxy) GetRecipeByID(ID string) (*recipe.Recipe, error) {
 	return rcp, nil
 }
 
-func (p *Proxy) GetAllRecipes() ([]*recipe.Recipe, error) {
-	recipesKeys, err := p.keys(recipePattern + allPattern)
+// GetRecipes - walks the index that provides the requested order in batches, recipes of each batch are fetched in a
+// single round trip and filtered until the page is filled.
+func (p *Proxy) GetRecipes(ctx context.Context, query *recipe.Query) (*recipe.Page, error) {
+	plan := planList(query)
+	bounds, err := plan.bounds(query)
 	if err != nil {
-		return nil, errors.NewDBErr(err.Error())
+		return nil, errors.WrapDBErr(err)
 	}
 
 	recipes := make([]*recipe.Recipe, 0)
-	for _, key := range recipesKeys {
-		redisRcp, err := p.getAll(key)
+	for query.Limit == 0 || len(recipes) <= query.Limit {
+		members, err := p.zRangeByLex(ctx, plan.index, bounds)
 		if err != nil {
-			return nil, errors.NewDBErr(err.Error())
+			return nil, errors.WrapDBErr(err)
 		}
-		rcp, err := mapToRecipeFromRedis(key, redisRcp)
+		if len(members) == 0 {
+			break
+		}
+		keys := make([]string, 0, len(members))
+		for _, member := range members {
+			keys = append(keys, recipePattern+memberID(member))
+		}
+		redisRcps, err := p.getAllMany(ctx, keys)
 		if err != nil {
-			return nil, err
+			return nil, errors.WrapDBErr(err)
+		}
+		for i, redisRcp := range redisRcps {
+			// the recipe might have been deleted since the index was read
+			if len(redisRcp) == 0 {
+				continue
+			}
+			rcp, err := mapToRecipeFromRedis(keys[i], redisRcp)
+			if err != nil {
+				return nil, err
+			}
+			if query.Matches(rcp) {
+				recipes = append(recipes, rcp)
+			}
+		}
+		if int64(len(members)) < bounds.Count {
+			break
+		}
+		last := "(" + members[len(members)-1]
+		if bounds.Rev {
+			bounds.Max = last
+		} else {
+			bounds.Min = last
 		}
-		recipes = append(recipes, rcp)
 	}
 
-	return recipes, nil
+	return query.NewPage(recipes), nil
 }
 
-func (p *Proxy) CreateRecipe(recipe *recipe.Recipe) error {
-	exists, err := p.exists(recipePattern + recipe.ID)
+// CreateRecipe - the recipe is stored along with its index members in a single transaction, which is aborted (and
+// retried) whenever the recipe is created by another client in the meantime.
+func (p *Proxy) CreateRecipe(ctx context.Context, recipe *recipe.Recipe) error {
+	// prepare to insert, new recipes are stored at their first version
+	recipe.Version = 1
+	redisFields, err := mapRecipeToRedisFields(recipe)
 	if err != nil {
-		return errors.NewDBErr(err.Error())
-	}
-	if exists > 0 {
-		return errors.NewExistErr(true)
+		return errors.WrapDBErr(err)
 	}
-	// prepare to insert
-	redisFields := mapRecipeToRedisFields(recipe)
-	_, err = p.set(recipePattern+recipe.ID, redisFields)
-	if err != nil {
-		return errors.NewDBErr(err.Error())
+	// a new recipe has never been rated
+	indexed := *recipe
+	indexed.AverageRating, indexed.RatingCount = 0, 0
+	add, rem := recipeIndexUpdates(nil, &indexed)
+
+	key, rateKey := recipePattern+recipe.ID, ratePattern+recipe.ID
+	return p.indexedTransaction(ctx, func(tx redisTx) error {
+		exists, err := tx.exists(key)
+		if err != nil {
+			return errors.WrapDBErr(err)
+		}
+		if exists > 0 {
+			return errors.NewExistErr(true)
+		}
+		// rates left behind by a recipe with the same ID, deleted before deletes were atomic, must not be inherited
+		tx.del(rateKey)
+		tx.set(key, redisFields)
+		tx.updateIndexes(add, rem)
+		return nil
+	}, key, rateKey)
+}
+
+// CreateRecipes - recipes are created in chunks, each of them within a single transaction: the existence of all its
+// recipes is checked at once and the new ones are written in the same MULTI/EXEC pipeline.
+func (p *Proxy) CreateRecipes(ctx context.Context, rcps []*recipe.Recipe) []error {
+	errs := make([]error, len(rcps))
+	for start := 0; start < len(rcps); start += createBatch {
+		end := start + createBatch
+		if end > len(rcps) {
+			end = len(rcps)
+		}
+		p.createChunk(ctx, rcps[start:end], errs[start:end])
 	}
 
-	return nil
+	return errs
 }
 
-func (p *Proxy) UpdateRecipe(recipe *recipe.Recipe) error {
-	exists, err := p.exists(recipePattern + recipe.ID)
-	if err != nil {
-		return errors.NewDBErr(err.Error())
+// createChunk - creates the recipes as CreateRecipe does, setting the outcome of each of them into errs.
+func (p *Proxy) createChunk(ctx context.Context, rcps []*recipe.Recipe, errs []error) {
+	keys := make([]string, 0, len(rcps))
+	rateKeys := make([]string, 0, len(rcps))
+	fields := make([]map[string]interface{}, len(rcps))
+	for i, rcp := range rcps {
+		rcp.Version = 1
+		redisFields, err := mapRecipeToRedisFields(rcp)
+		if err != nil {
+			errs[i] = errors.WrapDBErr(err)
+			continue
+		}
+		fields[i] = redisFields
+		keys = append(keys, recipePattern+rcp.ID)
+		rateKeys = append(rateKeys, ratePattern+rcp.ID)
 	}
-	if exists == 0 {
-		return errors.NewExistErr(false)
+	if len(keys) == 0 {
+		return
 	}
-	// prepare to update
-	redisFields := mapRecipeToRedisFields(recipe)
-	err = p.setErr(recipePattern+recipe.ID, redisFields)
+
+	err := p.indexedTransaction(ctx, func(tx redisTx) error {
+		exists, err := tx.existsMany(keys)
+		if err != nil {
+			return errors.WrapDBErr(err)
+		}
+		created := make(map[string]bool)
+		k := 0
+		for i, rcp := range rcps {
+			if fields[i] == nil {
+				continue
+			}
+			found := exists[k]
+			k++
+			// outcomes are set from scratch since the transaction may be retried
+			errs[i] = nil
+			if found || created[rcp.ID] {
+				errs[i] = errors.NewExistErr(true)
+				continue
+			}
+			created[rcp.ID] = true
+			indexed := *rcp
+			indexed.AverageRating, indexed.RatingCount = 0, 0
+			tx.del(ratePattern + rcp.ID)
+			tx.set(recipePattern+rcp.ID, fields[i])
+			tx.updateIndexes(recipeIndexUpdates(nil, &indexed))
+		}
+		return nil
+	}, append(keys, rateKeys...)...)
 	if err != nil {
-		return errors.NewDBErr(err.Error())
+		for i := range rcps {
+			if fields[i] != nil {
+				errs[i] = err
+			}
+		}
 	}
+}
 
-	return nil
+// UpdateRecipe - the stored recipe is read within the transaction since its index members have to be replaced.
+func (p *Proxy) UpdateRecipe(ctx context.Context, recipe *recipe.Recipe, version int64) error {
+	key := recipePattern + recipe.ID
+	return p.indexedTransaction(ctx, func(tx redisTx) error {
+		old, err := getRecipe(tx, recipe.ID)
+		if err != nil {
+			return err
+		}
+		if version > 0 && old.Version != version {
+			return errors.NewPreconditionErr()
+		}
+		// the creation timestamp and the owner are kept. All the fields are written so that none of the old ones remain
+		recipe.CreatedAt, recipe.Owner = old.CreatedAt, old.Owner
+		recipe.Version = old.Version + 1
+		redisFields, err := mapRecipeToRedisFields(recipe)
+		if err != nil {
+			return errors.WrapDBErr(err)
+		}
+		// rating is not updatable, it is kept from the stored recipe
+		indexed := *recipe
+		indexed.AverageRating, indexed.RatingCount = old.AverageRating, old.RatingCount
+		tx.set(key, redisFields)
+		tx.updateIndexes(recipeIndexUpdates(old, &indexed))
+		return nil
+	}, key)
 }
 
-func (p *Proxy) DeleteRecipe(ID string) error {
-	// check whether the recipe has been rated, in that case the rating is also deleted
-	exists, err := p.exists(ratePattern + ID)
-	if err != nil {
-		return errors.NewDBErr(err.Error())
-	}
-	result, err := p.del(recipePattern + ID)
-	if err != nil {
-		return errors.NewDBErr(err.Error())
-	}
-	if result == 0 {
-		return errors.NewExistErr(false)
-	}
-	if exists == 1 {
-		_, err = p.del(recipePattern + ID)
+// patchFields - redis fields of the recipe's writable fields.
+var patchFields = map[string]string{
+	recipe.FieldName:        name,
+	recipe.FieldPrepTime:    prepTime,
+	recipe.FieldDifficulty:  difficulty,
+	recipe.FieldVegetarian:  vegetarian,
+	recipe.FieldServings:    servings,
+	recipe.FieldCuisine:     cuisine,
+	recipe.FieldTags:        tags,
+	recipe.FieldIngredients: ingredients,
+	recipe.FieldSteps:       steps,
+}
+
+// PatchRecipe - as in UpdateRecipe the stored recipe is read within the transaction, only the given fields are written.
+func (p *Proxy) PatchRecipe(ctx context.Context, rcp *recipe.Recipe, fields []string, version int64) error {
+	key := recipePattern + rcp.ID
+	return p.indexedTransaction(ctx, func(tx redisTx) error {
+		old, err := getRecipe(tx, rcp.ID)
 		if err != nil {
-			return errors.NewDBErr(err.Error())
+			return err
+		}
+		if version > 0 && old.Version != version {
+			return errors.NewPreconditionErr()
 		}
+		patched := *old
+		recipe.CopyFields(&patched, rcp, fields)
+		patched.UpdatedAt = rcp.UpdatedAt
+		patched.Version = old.Version + 1
+		allFields, err := mapRecipeToRedisFields(&patched)
+		if err != nil {
+			return errors.WrapDBErr(err)
+		}
+		redisFields := map[string]interface{}{updatedAt: allFields[updatedAt], rcpVersion: allFields[rcpVersion]}
+		for _, field := range fields {
+			redisField, ok := patchFields[field]
+			if !ok {
+				return errors.NewDBErr(fmt.Sprintf("unsupported patch field: %s", field))
+			}
+			redisFields[redisField] = allFields[redisField]
+		}
+		tx.set(key, redisFields)
+		tx.updateIndexes(recipeIndexUpdates(old, &patched))
+		rcp.CreatedAt, rcp.Owner = old.CreatedAt, old.Owner
+		rcp.Version = patched.Version
+		return nil
+	}, key)
+}
+
+// DeleteRecipe - the recipe, its rates and its index members are deleted in a single transaction.
+func (p *Proxy) DeleteRecipe(ctx context.Context, ID string, version int64) error {
+	key := recipePattern + ID
+	return p.indexedTransaction(ctx, func(tx redisTx) error {
+		// the stored recipe is needed to remove its index members
+		old, err := getRecipe(tx, ID)
+		if err != nil {
+			return err
+		}
+		if version > 0 && old.Version != version {
+			return errors.NewPreconditionErr()
+		}
+		tx.del(key, ratePattern+ID)
+		tx.updateIndexes(recipeIndexUpdates(old, nil))
+		return nil
+	}, key)
+}
+
+// getRecipe - reads a recipe within a transaction.
+func getRecipe(tx redisTx, ID string) (*recipe.Recipe, error) {
+	recipeFields, err := tx.getAll(recipePattern + ID)
+	if err != nil {
+		return nil, errors.WrapDBErr(err)
+	}
+	if len(recipeFields) == 0 {
+		return nil, errors.NewExistErr(false)
 	}
 
-	return nil
+	return mapToRecipeFromRedis(ID, recipeFields)
 }
 
 func mapToRecipeFromRedis(key string, redisData map[string]string) (*recipe.Recipe, error) {
@@ -124,18 +318,71 @@ func mapToRecipeFromRedis(key string, redisData map[string]string) (*recipe.Reci
 	if err != nil {
 		return nil, errors.NewDBErr(fmt.Sprintf("error parsing recipe from redis: %s", err.Error()))
 	}
+	summary, err := mapToSummaryFromRedis(redisData)
+	if err != nil {
+		return nil, err
+	}
 	result := &recipe.Recipe{
-		ID:         strings.TrimPrefix(key, recipePattern),
-		Name:       redisData[name],
-		PrepTime:   prepTime,
-		Difficulty: difficulty,
-		Vegetarian: redisData[vegetarian] == "TRUE",
+		ID:            strings.TrimPrefix(key, recipePattern),
+		Name:          redisData[name],
+		PrepTime:      prepTime,
+		Difficulty:    difficulty,
+		Vegetarian:    strings.EqualFold(redisData[vegetarian], "true"),
+		Cuisine:       redisData[cuisine],
+		Owner:         redisData[owner],
+		AverageRating: summary.Average,
+		RatingCount:   summary.Count,
+	}
+	// recipes stored before the details were introduced lack the fields below
+	if err := mapDetailsFromRedis(redisData, result); err != nil {
+		return nil, errors.NewDBErr(fmt.Sprintf("error parsing recipe from redis: %s", err.Error()))
 	}
 
 	return result, nil
 }
 
-func mapRecipeToRedisFields(rcp *recipe.Recipe) map[string]interface{} {
+func mapDetailsFromRedis(redisData map[string]string, rcp *recipe.Recipe) error {
+	var err error
+	if v, ok := redisData[servings]; ok {
+		if rcp.Servings, err = strconv.Atoi(v); err != nil {
+			return err
+		}
+	}
+	for field, dest := range map[string]interface{}{tags: &rcp.Tags, ingredients: &rcp.Ingredients, steps: &rcp.Steps} {
+		if v, ok := redisData[field]; ok && len(v) > 0 {
+			if err := json.Unmarshal([]byte(v), dest); err != nil {
+				return err
+			}
+		}
+	}
+	// empty arrays are read as nil, the same way they are provided by the other DB clients
+	if len(rcp.Tags) == 0 {
+		rcp.Tags = nil
+	}
+	if len(rcp.Ingredients) == 0 {
+		rcp.Ingredients = nil
+	}
+	if len(rcp.Steps) == 0 {
+		rcp.Steps = nil
+	}
+	// recipes stored before versioning are at their first version
+	rcp.Version = 1
+	if v, ok := redisData[rcpVersion]; ok {
+		if rcp.Version, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return err
+		}
+	}
+	for field, dest := range map[string]*time.Time{createdAt: &rcp.CreatedAt, updatedAt: &rcp.UpdatedAt} {
+		if v, ok := redisData[field]; ok {
+			if *dest, err = time.Parse(time.RFC3339Nano, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func mapRecipeToRedisFields(rcp *recipe.Recipe) (map[string]interface{}, error) {
 	mappedData := make(map[string]interface{})
 	mappedData[rcpID] = rcp.ID
 	mappedData[prepTime] = strconv.Itoa(rcp.PrepTime)
@@ -146,6 +393,19 @@ func mapRecipeToRedisFields(rcp *recipe.Recipe) map[string]interface{} {
 	} else {
 		mappedData[vegetarian] = "False"
 	}
+	mappedData[servings] = strconv.Itoa(rcp.Servings)
+	mappedData[cuisine] = rcp.Cuisine
+	for field, v := range map[string]interface{}{tags: rcp.Tags, ingredients: rcp.Ingredients, steps: rcp.Steps} {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		mappedData[field] = string(b)
+	}
+	mappedData[createdAt] = rcp.CreatedAt.Format(time.RFC3339Nano)
+	mappedData[updatedAt] = rcp.UpdatedAt.Format(time.RFC3339Nano)
+	mappedData[rcpVersion] = strconv.FormatInt(rcp.Version, 10)
+	mappedData[owner] = rcp.Owner
 
-	return mappedData
+	return mappedData, nil
 }
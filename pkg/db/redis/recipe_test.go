@@ -1,22 +1,38 @@
 package redis
 
 import (
+	"context"
 	e "errors"
 	"fmt"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/rate"
 	"github.com/rnov/Go-REST/pkg/recipe"
 )
 
 type redisAccessorMock struct {
-	getAllAccessor func(key string) (map[string]string, error)
-	keysAccessor   func(pattern string) ([]string, error)
-	existsAccessor func(key string) (int64, error)
-	setAccessor    func(key string, fields map[string]interface{}) (string, error)
-	setErrAccessor func(key string, fields map[string]interface{}) error
-	delAccessor    func(key string) (int64, error)
+	getAccessor           func(key string) (string, bool, error)
+	getAllAccessor        func(key string) (map[string]string, error)
+	getAllManyAccessor    func(keys []string) ([]map[string]string, error)
+	scanAccessor          func(pattern string) ([]string, error)
+	zRangeByLexAccessor   func(key string, r lexRange) ([]string, error)
+	updateIndexesAccessor func(add, rem map[string][]string) error
+	existsAccessor        func(key string) (int64, error)
+	delAccessor           func(key string) (int64, error)
+	renameAccessor        func(renames map[string]string, del ...string) error
+	watchAccessor         func(fn func(tx redisTx) error, keys ...string) error
+}
+
+func (rm *redisAccessorMock) get(key string) (string, bool, error) {
+	if rm.getAccessor != nil {
+		return rm.getAccessor(key)
+	}
+	panic("Not implemented")
 }
 
 func (rm *redisAccessorMock) getAll(key string) (map[string]string, error) {
@@ -26,30 +42,37 @@ func (rm *redisAccessorMock) getAll(key string) (map[string]string, error) {
 	panic("Not implemented")
 }
 
-func (rm *redisAccessorMock) keys(pattern string) ([]string, error) {
-	if rm.keysAccessor != nil {
-		return rm.keysAccessor(pattern)
+func (rm *redisAccessorMock) getAllMany(keys []string) ([]map[string]string, error) {
+	if rm.getAllManyAccessor != nil {
+		return rm.getAllManyAccessor(keys)
 	}
 	panic("Not implemented")
 }
 
-func (rm *redisAccessorMock) exists(key string) (int64, error) {
-	if rm.existsAccessor != nil {
-		return rm.existsAccessor(key)
+func (rm *redisAccessorMock) scan(pattern string) ([]string, error) {
+	if rm.scanAccessor != nil {
+		return rm.scanAccessor(pattern)
 	}
 	panic("Not implemented")
 }
 
-func (rm *redisAccessorMock) set(key string, fields map[string]interface{}) (string, error) {
-	if rm.setAccessor != nil {
-		return rm.setAccessor(key, fields)
+func (rm *redisAccessorMock) zRangeByLex(key string, r lexRange) ([]string, error) {
+	if rm.zRangeByLexAccessor != nil {
+		return rm.zRangeByLexAccessor(key, r)
 	}
 	panic("Not implemented")
 }
 
-func (rm *redisAccessorMock) setErr(key string, fields map[string]interface{}) error {
-	if rm.setErrAccessor != nil {
-		return rm.setErrAccessor(key, fields)
+func (rm *redisAccessorMock) updateIndexes(add, rem map[string][]string) error {
+	if rm.updateIndexesAccessor != nil {
+		return rm.updateIndexesAccessor(add, rem)
+	}
+	panic("Not implemented")
+}
+
+func (rm *redisAccessorMock) exists(key string) (int64, error) {
+	if rm.existsAccessor != nil {
+		return rm.existsAccessor(key)
 	}
 	panic("Not implemented")
 }
@@ -61,6 +84,20 @@ func (rm *redisAccessorMock) del(key string) (int64, error) {
 	panic("Not implemented")
 }
 
+func (rm *redisAccessorMock) rename(renames map[string]string, del ...string) error {
+	if rm.renameAccessor != nil {
+		return rm.renameAccessor(renames, del...)
+	}
+	panic("Not implemented")
+}
+
+func (rm *redisAccessorMock) watch(fn func(tx redisTx) error, keys ...string) error {
+	if rm.watchAccessor != nil {
+		return rm.watchAccessor(fn, keys...)
+	}
+	panic("Not implemented")
+}
+
 func TestProxy_GetRecipeByID(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -84,6 +121,28 @@ func TestProxy_GetRecipeByID(t *testing.T) {
 				PrepTime:   20,
 				Difficulty: 3,
 				Vegetarian: false,
+				// stored before versioning
+				Version: 1,
+			},
+		},
+		{
+			name: "successful retrieve - rated recipe",
+			ID:   "654321",
+			accessor: &redisAccessorMock{
+				getAllAccessor: func(key string) (map[string]string, error) {
+					rcp := map[string]string{rcpID: "654321", name: "qwerty", prepTime: "20", difficulty: "3", vegetarian: "True", ratingSum: "9", ratingCount: "2", rcpVersion: "3"}
+					return rcp, nil
+				},
+			},
+			expectedRcp: &recipe.Recipe{
+				ID:            "654321",
+				Name:          "qwerty",
+				PrepTime:      20,
+				Difficulty:    3,
+				Vegetarian:    true,
+				AverageRating: 4.5,
+				RatingCount:   2,
+				Version:       3,
 			},
 		},
 		{
@@ -122,7 +181,7 @@ func TestProxy_GetRecipeByID(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			proxy := newRedisMock(test.accessor)
-			rcp, err := proxy.GetRecipeByID(test.ID)
+			rcp, err := proxy.GetRecipeByID(context.Background(), test.ID)
 			if err != nil && err.Error() != test.expectedErr.Error() {
 				t.Errorf("expected: '%s' instead got: '%s'", test.expectedErr, err)
 			}
@@ -135,38 +194,39 @@ func TestProxy_GetRecipeByID(t *testing.T) {
 	}
 }
 
-func TestProxy_GetAllRecipes(t *testing.T) {
-	// getAll could be called twice, this way we could mock both calls with different results.
-	var nCalls = 2
+func TestProxy_GetRecipes(t *testing.T) {
 	tests := []struct {
 		name         string
+		query        *recipe.Query
 		accessor     *redisAccessorMock
 		expectedRcps []*recipe.Recipe
 		expectedErr  error
 	}{
 		{
-			name: "successful retrieve - empty",
+			name:  "successful retrieve - empty",
+			query: &recipe.Query{Limit: 10},
 			accessor: &redisAccessorMock{
-				keysAccessor: func(pattern string) ([]string, error) {
-					return make([]string, 0), nil
+				zRangeByLexAccessor: func(key string, r lexRange) ([]string, error) {
+					return nil, nil
 				},
 			},
-			expectedRcps: nil,
-			expectedErr:  nil,
+			expectedRcps: []*recipe.Recipe{},
 		},
 		{
-			name: "successful retrieve - multiple results",
+			name:  "successful retrieve - multiple results",
+			query: &recipe.Query{Limit: 10},
 			accessor: &redisAccessorMock{
-				keysAccessor: func(pattern string) ([]string, error) {
-					rcpKeys := []string{"654321", "98765"}
-					return rcpKeys, nil
-				},
-				getAllAccessor: func(key string) (map[string]string, error) {
-					nCalls--
-					if nCalls == 1 {
-						return map[string]string{rcpID: "654321", name: "qwerty", prepTime: "20", difficulty: "3", vegetarian: "False"}, nil
+				zRangeByLexAccessor: func(key string, r lexRange) ([]string, error) {
+					if key != idIndex {
+						return nil, e.New("unexpected index")
 					}
-					return map[string]string{rcpID: "98765", name: "zxcvb", prepTime: "60", difficulty: "4", vegetarian: "False"}, nil
+					return []string{"654321", "98765"}, nil
+				},
+				getAllManyAccessor: func(keys []string) ([]map[string]string, error) {
+					return []map[string]string{
+						{rcpID: "654321", name: "qwerty", prepTime: "20", difficulty: "3", vegetarian: "False"},
+						{rcpID: "98765", name: "zxcvb", prepTime: "60", difficulty: "4", vegetarian: "False"},
+					}, nil
 				},
 			},
 			expectedRcps: []*recipe.Recipe{
@@ -176,47 +236,75 @@ func TestProxy_GetAllRecipes(t *testing.T) {
 					PrepTime:   20,
 					Difficulty: 3,
 					Vegetarian: false,
+					Version:    1,
+				},
+				{
+					ID:         "98765",
+					Name:       "zxcvb",
+					PrepTime:   60,
+					Difficulty: 4,
+					Vegetarian: false,
+					Version:    1,
 				},
+			},
+		},
+		{
+			name:  "successful retrieve - deleted recipe still indexed",
+			query: &recipe.Query{Limit: 10},
+			accessor: &redisAccessorMock{
+				zRangeByLexAccessor: func(key string, r lexRange) ([]string, error) {
+					return []string{"654321", "98765"}, nil
+				},
+				getAllManyAccessor: func(keys []string) ([]map[string]string, error) {
+					return []map[string]string{
+						{},
+						{rcpID: "98765", name: "zxcvb", prepTime: "60", difficulty: "4", vegetarian: "False"},
+					}, nil
+				},
+			},
+			expectedRcps: []*recipe.Recipe{
 				{
 					ID:         "98765",
 					Name:       "zxcvb",
 					PrepTime:   60,
 					Difficulty: 4,
 					Vegetarian: false,
+					Version:    1,
 				},
 			},
 		},
 		{
-			name: "error - DB retrieving keys",
+			name:  "error - DB retrieving index",
+			query: &recipe.Query{Limit: 10},
 			accessor: &redisAccessorMock{
-				keysAccessor: func(pattern string) ([]string, error) {
+				zRangeByLexAccessor: func(key string, r lexRange) ([]string, error) {
 					return nil, e.New("DB issue")
 				},
 			},
 			expectedErr: errors.NewDBErr("DB issue"),
 		},
 		{
-			name: "error - get all DB call",
+			name:  "error - get all DB call",
+			query: &recipe.Query{Limit: 10},
 			accessor: &redisAccessorMock{
-				keysAccessor: func(pattern string) ([]string, error) {
-					rcpKeys := []string{"654321", "98765"}
-					return rcpKeys, nil
+				zRangeByLexAccessor: func(key string, r lexRange) ([]string, error) {
+					return []string{"654321", "98765"}, nil
 				},
-				getAllAccessor: func(key string) (map[string]string, error) {
+				getAllManyAccessor: func(keys []string) ([]map[string]string, error) {
 					return nil, e.New("DB issue")
 				},
 			},
 			expectedErr: errors.NewDBErr("DB issue"),
 		},
 		{
-			name: "error - mapping from redis to recipe struct",
+			name:  "error - mapping from redis to recipe struct",
+			query: &recipe.Query{Limit: 10},
 			accessor: &redisAccessorMock{
-				keysAccessor: func(pattern string) ([]string, error) {
-					rcpKeys := []string{"654321", "98765"}
-					return rcpKeys, nil
+				zRangeByLexAccessor: func(key string, r lexRange) ([]string, error) {
+					return []string{"654321"}, nil
 				},
-				getAllAccessor: func(key string) (map[string]string, error) {
-					return map[string]string{rcpID: "654321", name: "qwerty", prepTime: "20", difficulty: "isNotAnInt", vegetarian: "False"}, nil
+				getAllManyAccessor: func(keys []string) ([]map[string]string, error) {
+					return []map[string]string{{rcpID: "654321", name: "qwerty", prepTime: "20", difficulty: "isNotAnInt", vegetarian: "False"}}, nil
 				},
 			},
 			expectedErr: errors.NewDBErr(fmt.Sprintf("error parsing recipe from redis: %s", "strconv.Atoi: parsing \"isNotAnInt\": invalid syntax")),
@@ -226,303 +314,654 @@ func TestProxy_GetAllRecipes(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			proxy := newRedisMock(test.accessor)
-			rcps, err := proxy.GetAllRecipes()
+			page, err := proxy.GetRecipes(context.Background(), test.query)
 			if err != nil && err.Error() != test.expectedErr.Error() {
 				t.Errorf("expected: '%s' instead got: '%s'", test.expectedErr, err)
 			}
-			if rcps != nil {
-				if len(rcps) != 0 && len(test.expectedRcps) != 0 && !reflect.DeepEqual(rcps, test.expectedRcps) {
-					t.Errorf("expected: '%v' instead got: '%v'", test.expectedRcps, rcps)
+			if page != nil {
+				if !reflect.DeepEqual(page.Recipes, test.expectedRcps) {
+					t.Errorf("expected: '%v' instead got: '%v'", test.expectedRcps, page.Recipes)
 				}
 			}
 		})
 	}
 }
 
+// storeRecipe - stores the recipe in the fake the same way the proxy does, along with its rating aggregation.
+func storeRecipe(t *testing.T, fake *redisFake, rcp *recipe.Recipe, ratingFields map[string]interface{}) {
+	fields, err := mapRecipeToRedisFields(rcp)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for field, value := range ratingFields {
+		fields[field] = value
+	}
+	fake.setHash(recipePattern+rcp.ID, fields)
+	fake.zUpdate(recipeIndexUpdates(nil, rcp))
+}
+
+// assertIndexed - every index holds exactly the members of the given recipes.
+func assertIndexed(t *testing.T, fake *redisFake, rcps ...*recipe.Recipe) {
+	expected := make(map[string]map[string]bool)
+	for _, rcp := range rcps {
+		for index, member := range indexMembers(rcp) {
+			if expected[index] == nil {
+				expected[index] = make(map[string]bool)
+			}
+			expected[index][member] = true
+		}
+	}
+	for index, members := range fake.zsets {
+		if len(members) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(members, expected[index]) {
+			t.Errorf("index %s: expected: '%v' instead got: '%v'", index, expected[index], members)
+		}
+		delete(expected, index)
+	}
+	if len(expected) > 0 {
+		t.Errorf("expected indexes missing: '%v'", expected)
+	}
+}
+
 func TestProxy_CreateRecipe(t *testing.T) {
+	inputRcp := &recipe.Recipe{
+		ID:         "654321",
+		Name:       "qwerty",
+		PrepTime:   20,
+		Difficulty: 3,
+		Vegetarian: false,
+	}
 	tests := []struct {
 		name        string
-		inputRcp    *recipe.Recipe
-		accessor    *redisAccessorMock
+		stored      []*recipe.Recipe
+		fail        map[string]error
 		expectedErr error
 	}{
 		{
 			name: "successful create",
-			inputRcp: &recipe.Recipe{
-				ID:         "654321",
-				Name:       "qwerty",
-				PrepTime:   20,
-				Difficulty: 3,
-				Vegetarian: false,
-			},
-			accessor: &redisAccessorMock{
-				existsAccessor: func(key string) (int64, error) {
-					return 0, nil
-				},
-				setAccessor: func(key string, fields map[string]interface{}) (string, error) {
-					return "", nil
-				},
-			},
-			expectedErr: nil,
 		},
 		{
-			name: "error - DB exist call",
-			inputRcp: &recipe.Recipe{
-				ID:         "654321",
-				Name:       "qwerty",
-				PrepTime:   20,
-				Difficulty: 3,
-				Vegetarian: false,
-			},
-			accessor: &redisAccessorMock{
-				existsAccessor: func(key string) (int64, error) {
-					return 0, e.New("DB issue")
-				},
-			},
-			expectedErr: errors.NewDBErr("DB issue"),
+			name:        "error - recipe already exists",
+			stored:      []*recipe.Recipe{inputRcp},
+			expectedErr: errors.NewExistErr(true),
 		},
 		{
-			name: "error - recipe already exists",
-			inputRcp: &recipe.Recipe{
-				ID:         "654321",
-				Name:       "qwerty",
-				PrepTime:   20,
-				Difficulty: 3,
-				Vegetarian: false,
-			},
-			accessor: &redisAccessorMock{
-				existsAccessor: func(key string) (int64, error) {
-					return 1, nil
-				},
-			},
-			expectedErr: errors.NewExistErr(true),
+			name:        "error - DB exist call",
+			fail:        map[string]error{"exists": e.New("DB issue")},
+			expectedErr: errors.NewDBErr("DB issue"),
 		},
 		{
-			name: "error - DB inserting recipe",
-			inputRcp: &recipe.Recipe{
-				ID:         "654321",
-				Name:       "qwerty",
-				PrepTime:   20,
-				Difficulty: 3,
-				Vegetarian: false,
-			},
-			accessor: &redisAccessorMock{
-				existsAccessor: func(key string) (int64, error) {
-					return 0, nil
-				},
-				setAccessor: func(key string, fields map[string]interface{}) (string, error) {
-					return "", e.New("DB issue")
-				},
-			},
+			name:        "error - DB executing transaction",
+			fail:        map[string]error{"exec": e.New("DB issue")},
 			expectedErr: errors.NewDBErr("DB issue"),
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			proxy := newRedisMock(test.accessor)
-			err := proxy.CreateRecipe(test.inputRcp)
+			fake := newRedisFake()
+			// orphaned rates must not be inherited by the new recipe
+			fake.setHash(ratePattern+inputRcp.ID, map[string]interface{}{"1:rater": `{"note":1}`})
+			for _, rcp := range test.stored {
+				storeRecipe(t, fake, rcp, nil)
+			}
+			fake.fail = test.fail
+			proxy := newRedisMock(fake)
+			err := proxy.CreateRecipe(context.Background(), inputRcp)
 			if err != nil && err.Error() != test.expectedErr.Error() {
 				t.Errorf("expected: '%s' instead got: '%s'", test.expectedErr, err)
 			}
+			if err == nil && test.expectedErr != nil {
+				t.Errorf("expected: '%s' instead got nil", test.expectedErr)
+			}
+			if test.expectedErr != nil {
+				return
+			}
+			rcp, err := getRecipe(&txFake{fake: fake}, inputRcp.ID)
+			if err != nil || !reflect.DeepEqual(rcp, inputRcp) {
+				t.Errorf("expected: '%v' instead got: '%v' ('%v')", inputRcp, rcp, err)
+			}
+			if _, ok := fake.hashes[ratePattern+inputRcp.ID]; ok {
+				t.Errorf("expected orphaned rates to be deleted")
+			}
+			assertIndexed(t, fake, inputRcp)
+		})
+	}
+}
+
+func TestProxy_CreateRecipes(t *testing.T) {
+	newRcp := func(ID string) *recipe.Recipe {
+		return &recipe.Recipe{ID: ID, Name: "qwerty " + ID, PrepTime: 20, Difficulty: 3}
+	}
+	tests := []struct {
+		name         string
+		fail         map[string]error
+		expectedErrs []error
+	}{
+		{
+			name:         "successful create",
+			expectedErrs: []error{nil, errors.NewExistErr(true), errors.NewExistErr(true), nil},
+		},
+		{
+			name: "error - DB executing transaction",
+			fail: map[string]error{"exec": e.New("DB issue")},
+			expectedErrs: []error{errors.NewDBErr("DB issue"), errors.NewDBErr("DB issue"), errors.NewDBErr("DB issue"),
+				errors.NewDBErr("DB issue")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newRedisFake()
+			stored := newRcp("111111")
+			stored.Version = 1
+			storeRecipe(t, fake, stored, nil)
+			fake.fail = test.fail
+			proxy := newRedisMock(fake)
+			rcps := []*recipe.Recipe{newRcp("222222"), newRcp("111111"), newRcp("222222"), newRcp("333333")}
+			errs := proxy.CreateRecipes(context.Background(), rcps)
+			if len(errs) != len(test.expectedErrs) {
+				t.Fatalf("expected: %d results instead got: %d", len(test.expectedErrs), len(errs))
+			}
+			for i, err := range errs {
+				if fmt.Sprint(err) != fmt.Sprint(test.expectedErrs[i]) {
+					t.Errorf("recipe %d expected: '%v' instead got: '%v'", i, test.expectedErrs[i], err)
+				}
+			}
+			if test.fail != nil {
+				return
+			}
+			for _, i := range []int{0, 3} {
+				rcp, err := getRecipe(&txFake{fake: fake}, rcps[i].ID)
+				if err != nil || !reflect.DeepEqual(rcp, rcps[i]) {
+					t.Errorf("expected: '%v' instead got: '%v' ('%v')", rcps[i], rcp, err)
+				}
+			}
+			assertIndexed(t, fake, stored, rcps[0], rcps[3])
 		})
 	}
 }
 
 func TestProxy_UpdateRecipe(t *testing.T) {
+	stored := &recipe.Recipe{
+		ID:            "654321",
+		Name:          "asdfg",
+		PrepTime:      40,
+		Difficulty:    1,
+		Vegetarian:    true,
+		AverageRating: 4,
+		RatingCount:   2,
+		CreatedAt:     time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Version:       2,
+	}
 	tests := []struct {
 		name        string
-		inputRcp    *recipe.Recipe
-		accessor    *redisAccessorMock
+		stored      []*recipe.Recipe
+		version     int64
+		fail        map[string]error
 		expectedErr error
 	}{
 		{
-			name: "successful update",
-			inputRcp: &recipe.Recipe{
-				ID:         "654321",
-				Name:       "qwerty",
-				PrepTime:   20,
-				Difficulty: 3,
-				Vegetarian: false,
-			},
-			accessor: &redisAccessorMock{
-				existsAccessor: func(key string) (int64, error) {
-					return 1, nil
-				},
-				setErrAccessor: func(key string, fields map[string]interface{}) error {
-					return nil
-				},
-			},
-			expectedErr: nil,
+			name:   "successful update",
+			stored: []*recipe.Recipe{stored},
 		},
 		{
-			name: "successful update",
-			inputRcp: &recipe.Recipe{
-				ID:         "654321",
-				Name:       "qwerty",
-				PrepTime:   20,
-				Difficulty: 3,
-				Vegetarian: false,
-			},
-			accessor: &redisAccessorMock{
-				existsAccessor: func(key string) (int64, error) {
-					return 1, nil
-				},
-				setErrAccessor: func(key string, fields map[string]interface{}) error {
-					return nil
-				},
-			},
-			expectedErr: nil,
+			name:    "successful update - matching version",
+			stored:  []*recipe.Recipe{stored},
+			version: 2,
 		},
 		{
-			name: "error - DB exist call",
-			inputRcp: &recipe.Recipe{
-				ID:         "654321",
-				Name:       "qwerty",
-				PrepTime:   20,
-				Difficulty: 3,
-				Vegetarian: false,
-			},
-			accessor: &redisAccessorMock{
-				existsAccessor: func(key string) (int64, error) {
-					return 0, e.New("DB issue")
-				},
-			},
+			name:        "error - version mismatch",
+			stored:      []*recipe.Recipe{stored},
+			version:     1,
+			expectedErr: errors.NewPreconditionErr(),
+		},
+		{
+			name:        "error - recipe does not exist",
+			expectedErr: errors.NewExistErr(false),
+		},
+		{
+			name:        "error - DB get all call",
+			stored:      []*recipe.Recipe{stored},
+			fail:        map[string]error{"getAll": e.New("DB issue")},
 			expectedErr: errors.NewDBErr("DB issue"),
 		},
 		{
-			name: "error - recipe does not exist",
-			inputRcp: &recipe.Recipe{
+			name:        "error - DB watching recipe",
+			stored:      []*recipe.Recipe{stored},
+			fail:        map[string]error{"watch": e.New("DB issue")},
+			expectedErr: errors.NewDBErr("DB issue"),
+		},
+		{
+			name:        "error - DB executing transaction",
+			stored:      []*recipe.Recipe{stored},
+			fail:        map[string]error{"exec": e.New("DB issue")},
+			expectedErr: errors.NewDBErr("DB issue"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newRedisFake()
+			for _, rcp := range test.stored {
+				storeRecipe(t, fake, rcp, map[string]interface{}{ratingSum: 8, ratingCount: 2})
+			}
+			fake.fail = test.fail
+			proxy := newRedisMock(fake)
+			inputRcp := &recipe.Recipe{
 				ID:         "654321",
 				Name:       "qwerty",
 				PrepTime:   20,
 				Difficulty: 3,
 				Vegetarian: false,
-			},
-			accessor: &redisAccessorMock{
-				existsAccessor: func(key string) (int64, error) {
-					return 0, nil
-				},
-			},
+			}
+			err := proxy.UpdateRecipe(context.Background(), inputRcp, test.version)
+			if err != nil && err.Error() != test.expectedErr.Error() {
+				t.Errorf("expected: '%s' instead got: '%s'", test.expectedErr, err)
+			}
+			if err == nil && test.expectedErr != nil {
+				t.Errorf("expected: '%s' instead got nil", test.expectedErr)
+			}
+			if test.expectedErr != nil {
+				return
+			}
+			// rating and creation timestamp are kept, the version is increased
+			expected := *inputRcp
+			expected.CreatedAt = stored.CreatedAt
+			if expected.Version != stored.Version+1 {
+				t.Errorf("expected: '%d' version instead got: '%d'", stored.Version+1, expected.Version)
+			}
+			expected.AverageRating, expected.RatingCount = stored.AverageRating, stored.RatingCount
+			rcp, err := getRecipe(&txFake{fake: fake}, inputRcp.ID)
+			if err != nil || !reflect.DeepEqual(rcp, &expected) {
+				t.Errorf("expected: '%v' instead got: '%v' ('%v')", &expected, rcp, err)
+			}
+			assertIndexed(t, fake, &expected)
+		})
+	}
+}
+
+func TestProxy_PatchRecipe(t *testing.T) {
+	stored := &recipe.Recipe{
+		ID:            "654321",
+		Name:          "asdfg",
+		PrepTime:      40,
+		Difficulty:    1,
+		Vegetarian:    true,
+		Tags:          []string{"quick"},
+		AverageRating: 4,
+		RatingCount:   2,
+		CreatedAt:     time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Version:       2,
+	}
+	tests := []struct {
+		name        string
+		stored      []*recipe.Recipe
+		fields      []string
+		version     int64
+		fail        map[string]error
+		expectedErr error
+	}{
+		{
+			name:   "successful patch",
+			stored: []*recipe.Recipe{stored},
+			fields: []string{recipe.FieldName, recipe.FieldPrepTime},
+		},
+		{
+			name:    "successful patch - matching version",
+			stored:  []*recipe.Recipe{stored},
+			fields:  []string{recipe.FieldTags},
+			version: 2,
+		},
+		{
+			name:        "error - version mismatch",
+			stored:      []*recipe.Recipe{stored},
+			fields:      []string{recipe.FieldName},
+			version:     1,
+			expectedErr: errors.NewPreconditionErr(),
+		},
+		{
+			name:        "error - read only field",
+			stored:      []*recipe.Recipe{stored},
+			fields:      []string{"ID"},
+			expectedErr: errors.NewDBErr("unsupported patch field: ID"),
+		},
+		{
+			name:        "error - recipe does not exist",
+			fields:      []string{recipe.FieldName},
 			expectedErr: errors.NewExistErr(false),
 		},
 		{
-			name: "error - DB setting new values",
-			inputRcp: &recipe.Recipe{
-				ID:         "654321",
-				Name:       "qwerty",
-				PrepTime:   20,
-				Difficulty: 3,
-				Vegetarian: false,
-			},
-			accessor: &redisAccessorMock{
-				existsAccessor: func(key string) (int64, error) {
-					return 1, nil
-				},
-				setErrAccessor: func(key string, fields map[string]interface{}) error {
-					return e.New("DB issue")
-				},
-			},
+			name:        "error - DB executing transaction",
+			stored:      []*recipe.Recipe{stored},
+			fields:      []string{recipe.FieldName},
+			fail:        map[string]error{"exec": e.New("DB issue")},
 			expectedErr: errors.NewDBErr("DB issue"),
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			proxy := newRedisMock(test.accessor)
-			err := proxy.UpdateRecipe(test.inputRcp)
+			fake := newRedisFake()
+			for _, rcp := range test.stored {
+				storeRecipe(t, fake, rcp, map[string]interface{}{ratingSum: 8, ratingCount: 2})
+			}
+			fake.fail = test.fail
+			proxy := newRedisMock(fake)
+			inputRcp := &recipe.Recipe{
+				ID:        "654321",
+				Name:      "qwerty",
+				PrepTime:  20,
+				UpdatedAt: time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+			}
+			err := proxy.PatchRecipe(context.Background(), inputRcp, test.fields, test.version)
 			if err != nil && err.Error() != test.expectedErr.Error() {
 				t.Errorf("expected: '%s' instead got: '%s'", test.expectedErr, err)
 			}
+			if err == nil && test.expectedErr != nil {
+				t.Errorf("expected: '%s' instead got nil", test.expectedErr)
+			}
+			if test.expectedErr != nil {
+				return
+			}
+			// only the given fields are written
+			expected := *stored
+			recipe.CopyFields(&expected, inputRcp, test.fields)
+			expected.UpdatedAt, expected.Version = inputRcp.UpdatedAt, stored.Version+1
+			rcp, err := getRecipe(&txFake{fake: fake}, inputRcp.ID)
+			if err != nil || !reflect.DeepEqual(rcp, &expected) {
+				t.Errorf("expected: '%v' instead got: '%v' ('%v')", &expected, rcp, err)
+			}
+			if inputRcp.Version != expected.Version || !inputRcp.CreatedAt.Equal(stored.CreatedAt) {
+				t.Errorf("expected creation timestamp and version to be set instead got: '%v', '%d'", inputRcp.CreatedAt, inputRcp.Version)
+			}
+			assertIndexed(t, fake, &expected)
 		})
 	}
 }
 
 func TestProxy_DeleteRecipe(t *testing.T) {
-	// del to redis could be called twice, this way we could mock both calls with different results.
-	var nCalls = 2
+	stored := &recipe.Recipe{ID: "654321", Name: "asdfg", PrepTime: 40, Difficulty: 1, Vegetarian: true, Version: 1}
+	other := &recipe.Recipe{ID: "98765", Name: "zxcvb", PrepTime: 60, Difficulty: 2, Version: 1}
 	tests := []struct {
 		name        string
-		ID          string
-		accessor    *redisAccessorMock
+		stored      []*recipe.Recipe
+		version     int64
+		fail        map[string]error
 		expectedErr error
-		delCalls    int
 	}{
 		{
-			name: "successful delete",
-			ID:   "654321",
-			accessor: &redisAccessorMock{
-				delAccessor: func(key string) (int64, error) {
-					return 1, nil
-				},
-				existsAccessor: func(key string) (int64, error) {
-					return 1, nil
-				},
-			},
-			expectedErr: nil,
+			name:   "successful delete",
+			stored: []*recipe.Recipe{stored, other},
 		},
 		{
-			name: "error - DB exist call",
-			ID:   "654321",
-			accessor: &redisAccessorMock{
-				existsAccessor: func(key string) (int64, error) {
-					return 0, e.New("DB issue")
-				},
-			},
+			name:    "successful delete - matching version",
+			stored:  []*recipe.Recipe{stored, other},
+			version: 1,
+		},
+		{
+			name:        "error - version mismatch",
+			stored:      []*recipe.Recipe{stored, other},
+			version:     2,
+			expectedErr: errors.NewPreconditionErr(),
+		},
+		{
+			name:        "error - recipe does not exist",
+			stored:      []*recipe.Recipe{other},
+			expectedErr: errors.NewExistErr(false),
+		},
+		{
+			name:        "error - DB get all call",
+			stored:      []*recipe.Recipe{stored, other},
+			fail:        map[string]error{"getAll": e.New("DB issue")},
 			expectedErr: errors.NewDBErr("DB issue"),
 		},
 		{
-			name: "error - DB del call",
-			ID:   "654321",
-			accessor: &redisAccessorMock{
-				existsAccessor: func(key string) (int64, error) {
-					return 1, nil
-				},
-				delAccessor: func(key string) (int64, error) {
-					return 0, e.New("DB issue")
-				},
-			},
+			name:        "error - DB executing transaction",
+			stored:      []*recipe.Recipe{stored, other},
+			fail:        map[string]error{"exec": e.New("DB issue")},
 			expectedErr: errors.NewDBErr("DB issue"),
 		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newRedisFake()
+			for _, rcp := range test.stored {
+				storeRecipe(t, fake, rcp, nil)
+				fake.setHash(ratePattern+rcp.ID, map[string]interface{}{"1:rater": `{"note":1}`})
+			}
+			fake.fail = test.fail
+			proxy := newRedisMock(fake)
+			err := proxy.DeleteRecipe(context.Background(), stored.ID, test.version)
+			if err != nil && err.Error() != test.expectedErr.Error() {
+				t.Errorf("expected: '%s' instead got: '%s'", test.expectedErr, err)
+			}
+			if err == nil && test.expectedErr != nil {
+				t.Errorf("expected: '%s' instead got nil", test.expectedErr)
+			}
+			if test.expectedErr != nil {
+				return
+			}
+			// the rates are deleted along with the recipe, other recipes are left untouched
+			for _, key := range []string{recipePattern + stored.ID, ratePattern + stored.ID} {
+				if _, ok := fake.hashes[key]; ok {
+					t.Errorf("expected %s to be deleted", key)
+				}
+			}
+			for _, key := range []string{recipePattern + other.ID, ratePattern + other.ID} {
+				if _, ok := fake.hashes[key]; !ok {
+					t.Errorf("expected %s not to be deleted", key)
+				}
+			}
+			assertIndexed(t, fake, other)
+		})
+	}
+}
+
+// TestProxy_CreateWatchesRates - the orphaned rates deleted on creation are watched along with the recipe.
+func TestProxy_CreateWatchesRates(t *testing.T) {
+	var watched []string
+	proxy := newRedisMock(&redisAccessorMock{
+		watchAccessor: func(fn func(tx redisTx) error, keys ...string) error {
+			watched = keys
+			return nil
+		},
+	})
+	if err := proxy.CreateRecipe(context.Background(), &recipe.Recipe{ID: "654321"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := []string{recipePattern + "654321", ratePattern + "654321", rebuildMarker}; !reflect.DeepEqual(watched, expected) {
+		t.Errorf("expected: '%v' instead got: '%v'", expected, watched)
+	}
+	proxy.CreateRecipes(context.Background(), []*recipe.Recipe{{ID: "654321"}, {ID: "98765"}})
+	expected := []string{recipePattern + "654321", recipePattern + "98765", ratePattern + "654321", ratePattern + "98765",
+		rebuildMarker}
+	if !reflect.DeepEqual(watched, expected) {
+		t.Errorf("expected: '%v' instead got: '%v'", expected, watched)
+	}
+}
+
+func TestProxy_TransactionRetries(t *testing.T) {
+	conflicts := 0
+	proxy := newRedisMock(&redisAccessorMock{
+		watchAccessor: func(fn func(tx redisTx) error, keys ...string) error {
+			conflicts++
+			return errTxConflict
+		},
+	})
+	err := proxy.DeleteRecipe(context.Background(), "654321", 0)
+	if _, ok := err.(*errors.DBErr); !ok {
+		t.Errorf("expected DB error instead got: '%v'", err)
+	}
+	if conflicts != maxTxAttempts {
+		t.Errorf("expected %d attempts instead got: %d", maxTxAttempts, conflicts)
+	}
+}
+
+// TestProxy_Interrupted - no round trip is made once the request is done, the DB error tells why.
+func TestProxy_Interrupted(t *testing.T) {
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+	canceled, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tests := []struct {
+		name             string
+		ctx              context.Context
+		accessor         *redisAccessorMock
+		expectedTimeout  bool
+		expectedCanceled bool
+	}{
 		{
-			name: "error - recipe does not exist",
-			ID:   "654321",
-			accessor: &redisAccessorMock{
-				existsAccessor: func(key string) (int64, error) {
-					return 1, nil
-				},
-				delAccessor: func(key string) (int64, error) {
-					return 0, nil
-				},
-			},
-			expectedErr: errors.NewExistErr(false),
+			name:            "deadline exceeded before the first round trip",
+			ctx:             expired,
+			accessor:        &redisAccessorMock{},
+			expectedTimeout: true,
 		},
 		{
-			name: "error - DB deleting recipe",
-			ID:   "654321",
+			name: "canceled in between round trips",
+			ctx:  canceled,
 			accessor: &redisAccessorMock{
-				existsAccessor: func(key string) (int64, error) {
-					return 1, nil
-				},
-				delAccessor: func(key string) (int64, error) {
-					nCalls--
-					if nCalls == 1 {
-						return 1, nil
-					}
-					return 0, e.New("DB issue")
+				zRangeByLexAccessor: func(key string, r lexRange) ([]string, error) {
+					cancel()
+					return []string{"654321", "98765"}, nil
 				},
 			},
-			expectedErr: errors.NewDBErr("DB issue"),
+			expectedCanceled: true,
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			proxy := newRedisMock(test.accessor)
-			err := proxy.DeleteRecipe(test.ID)
-			if err != nil && err.Error() != test.expectedErr.Error() {
-				t.Errorf("expected: '%s' instead got: '%s'", test.expectedErr, err)
+			_, err := newRedisMock(test.accessor).GetRecipes(test.ctx, &recipe.Query{Limit: 10})
+			dbErr, ok := err.(*errors.DBErr)
+			if !ok {
+				t.Fatalf("expected DB error instead got: '%v'", err)
+			}
+			if dbErr.Timeout() != test.expectedTimeout || dbErr.Canceled() != test.expectedCanceled {
+				t.Errorf("expected timeout: %v and canceled: %v instead got: '%v'", test.expectedTimeout,
+					test.expectedCanceled, err)
 			}
 		})
 	}
 }
+
+func TestProxy_ConcurrentCreate(t *testing.T) {
+	fake := newRedisFake()
+	proxy := newRedisMock(fake)
+	var created, existing int64
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rcp := &recipe.Recipe{ID: "654321", Name: fmt.Sprintf("recipe %d", i), PrepTime: 20, Difficulty: 1}
+			err := proxy.CreateRecipe(context.Background(), rcp)
+			switch err.(type) {
+			case nil:
+				atomic.AddInt64(&created, 1)
+			case *errors.ExistErr:
+				atomic.AddInt64(&existing, 1)
+			default:
+				t.Errorf("unexpected error: %s", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if created != 1 || existing != 19 {
+		t.Errorf("expected a single recipe to be created instead got %d created and %d existing", created, existing)
+	}
+	rcp, err := getRecipe(&txFake{fake: fake}, "654321")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertIndexed(t, fake, rcp)
+}
+
+func TestProxy_ConcurrentUpdateAndDelete(t *testing.T) {
+	for run := 0; run < 20; run++ {
+		fake := newRedisFake()
+		storeRecipe(t, fake, &recipe.Recipe{ID: "654321", Name: "qwerty", PrepTime: 20, Difficulty: 1}, nil)
+		proxy := newRedisMock(fake)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(2)
+			go func(i int) {
+				defer wg.Done()
+				rcp := &recipe.Recipe{ID: "654321", Name: fmt.Sprintf("recipe %d", i), PrepTime: 20 + i, Difficulty: i%3 + 1}
+				if err := proxy.UpdateRecipe(context.Background(), rcp, 0); err != nil {
+					if _, ok := err.(*errors.ExistErr); !ok {
+						t.Errorf("unexpected error: %s", err)
+					}
+				}
+			}(i)
+			go func() {
+				defer wg.Done()
+				if err := proxy.RateRecipe(context.Background(), "654321", &rate.Rate{Note: 5, Rater: "rater"}); err != nil {
+					if _, ok := err.(*errors.ExistErr); !ok {
+						t.Errorf("unexpected error: %s", err)
+					}
+				}
+			}()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := proxy.DeleteRecipe(context.Background(), "654321", 0); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		}()
+		wg.Wait()
+
+		// nothing is left behind once the recipe is deleted
+		if len(fake.hashes) != 0 {
+			t.Fatalf("expected no hashes left instead got: '%v'", fake.hashes)
+		}
+		assertIndexed(t, fake)
+	}
+}
+
+func TestMapRecipeRedisFields(t *testing.T) {
+	rcp := &recipe.Recipe{
+		ID:          "654321",
+		Name:        "qwerty",
+		PrepTime:    20,
+		Difficulty:  3,
+		Vegetarian:  true,
+		Servings:    4,
+		Cuisine:     "spanish",
+		Tags:        []string{"quick", "cheap"},
+		Ingredients: []recipe.Ingredient{{Name: "rice", Quantity: 400, Unit: "g"}, {Name: "egg", Quantity: 2}},
+		Steps:       []string{"boil the rice", "fry the eggs"},
+		CreatedAt:   time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC),
+		UpdatedAt:   time.Date(2021, 1, 2, 3, 4, 5, 6, time.UTC),
+		Owner:       "chef",
+	}
+	fields, err := mapRecipeToRedisFields(rcp)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// redis hashes only hold strings
+	redisData := make(map[string]string)
+	for field, value := range fields {
+		redisData[field] = fmt.Sprint(value)
+	}
+	got, err := mapToRecipeFromRedis(recipePattern+rcp.ID, redisData)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(got, rcp) {
+		t.Errorf("expected: '%v' instead got: '%v'", rcp, got)
+	}
+
+	// malformed nested data
+	redisData[ingredients] = "{"
+	if _, err := mapToRecipeFromRedis(recipePattern+rcp.ID, redisData); err == nil {
+		t.Errorf("expected error instead got nil")
+	}
+}
@@ -1,36 +1,94 @@
 package redis
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"time"
 
-	"github.com/go-redis/redis"
+	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/tracing"
+)
+
+const (
+	// scanCount - hint of how many keys SCAN should go through on each call.
+	scanCount = 1000
+	// maxTxAttempts - times a transaction is attempted while its watched keys keep being modified by other clients.
+	maxTxAttempts = 10
+	// txBackoff, maxTxBackoff - base and cap of the randomized wait between attempts, so that conflicting clients do not
+	// keep retrying in lockstep.
+	txBackoff    = time.Millisecond
+	maxTxBackoff = 32 * time.Millisecond
+	// createBatch - recipes created per transaction when creating them in batch, bounds the number of watched keys.
+	createBatch = 100
 )
 
+// errTxConflict - returned by watch whenever a watched key has been modified before the transaction was executed.
+var errTxConflict error = redis.TxFailedErr
+
 // redisAccessor - to be able to mock redis DB access without 3th parties or running any instance.
 type redisAccessor interface {
+	get(key string) (string, bool, error)
 	getAll(key string) (map[string]string, error)
-	keys(pattern string) ([]string, error)
+	getAllMany(keys []string) ([]map[string]string, error)
+	scan(pattern string) ([]string, error)
+	zRangeByLex(key string, r lexRange) ([]string, error)
+	updateIndexes(add, rem map[string][]string) error
 	exists(key string) (int64, error)
-	set(key string, fields map[string]interface{}) (string, error)
-	setErr(key string, fields map[string]interface{}) error
 	del(key string) (int64, error)
+	// rename - renames the keys given as source to destination and deletes the del keys at once (MULTI/EXEC).
+	rename(renames map[string]string, del ...string) error
+	watch(fn func(tx redisTx) error, keys ...string) error
+}
+
+// redisTx - optimistic transaction, reads are done right away while the watched keys are checked, writes are queued
+// and executed at once (MULTI/EXEC) only if none of the watched keys has been modified in the meantime.
+type redisTx interface {
+	getAll(key string) (map[string]string, error)
+	getAllMany(keys []string) ([]map[string]string, error)
+	// getField - value of a single hash field, found is false whenever either the key or the field does not exist.
+	getField(key, field string) (value string, found bool, err error)
+	exists(key string) (int64, error)
+	existsMany(keys []string) ([]bool, error)
+	set(key string, fields map[string]interface{})
+	del(keys ...string)
+	delFields(key string, fields ...string)
+	incrBy(key, field string, incr int64)
+	updateIndexes(add, rem map[string][]string)
 }
 
 // Proxy - redis client - mock field is a compromise to our test since the 3th party redis client is a struct.
 type Proxy struct {
-	main redis.Client
+	main *redis.Client
 	mock redisAccessor
 	// could add the workers too e.g: get some data from main and use it to CRUD the workers or register custom logger
 }
 
+// NewRedisProxy - proxy issuing its commands through client, every round trip is traced as a span of its own.
 func NewRedisProxy(client *redis.Client) *Proxy {
 	redisProxy := new(Proxy)
 	if client != nil {
-		redisProxy.main = *client
+		client.AddHook(roundTripHook{})
+		redisProxy.main = client
 	}
 	return redisProxy
 }
 
+// Close - closes the connections to redis, the proxy can not be used afterwards.
+func (p *Proxy) Close() error {
+	if p.mock != nil {
+		return nil
+	}
+	return p.main.Close()
+}
+
 func newRedisMock(ra redisAccessor) *Proxy {
 	return &Proxy{
 		mock: ra,
@@ -46,45 +104,416 @@ func NewRedisClient(host string, port int, db int) *redis.Client {
 	return client
 }
 
+// SetLogger - logger of the redis client internals, e.g. connection pool errors, shared by all the clients.
+func SetLogger(l *log.Logger) {
+	redis.SetLogger(clientLogger{l})
+}
+
+// clientLogger - the redis client logs along with the context of the command, which is not logged.
+type clientLogger struct {
+	l *log.Logger
+}
+
+func (cl clientLogger) Printf(ctx context.Context, format string, v ...interface{}) {
+	cl.l.Printf(format, v...)
+}
+
+// roundTripHook - traces each command or pipeline sent to redis as a span of its own. The commands are bound to the
+// context they are issued with: no connection is waited for once it is done and its deadline, if any, bounds the
+// reads and writes of the round trip. A context canceled without deadline does not interrupt a round trip in progress,
+// which is bounded by the client timeouts instead, the helpers below check it before every round trip.
+type roundTripHook struct{}
+
+func (roundTripHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	ctx, _ = startRoundTrip(ctx, strings.ToUpper(cmd.Name()))
+	return ctx, nil
+}
+
+func (roundTripHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	endRoundTrip(trace.SpanFromContext(ctx), cmd.Err())
+	return nil
+}
+
+func (roundTripHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	ctx, _ = startRoundTrip(ctx, "pipeline", attribute.Int("db.redis.commands", len(cmds)))
+	return ctx, nil
+}
+
+func (roundTripHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if err = cmd.Err(); err != nil && err != redis.Nil {
+			break
+		}
+	}
+	endRoundTrip(trace.SpanFromContext(ctx), err)
+	return nil
+}
+
+func startRoundTrip(ctx context.Context, operation string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, semconv.DBSystemRedis, semconv.DBOperationKey.String(operation))
+	return tracing.Start(ctx, "redis "+operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// endRoundTrip - keys that do not exist are not a failure.
+func endRoundTrip(span trace.Span, err error) {
+	if err == redis.Nil {
+		err = nil
+	}
+	tracing.End(span, err)
+}
+
 // Compromise since a 3th party redis-client is used and Go "cannot define methods on non-local type" e.g redis.Client being a 3th party package
-func (p *Proxy) getAll(key string) (map[string]string, error) {
+func (p *Proxy) getAll(ctx context.Context, key string) (map[string]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if p.mock != nil {
 		return p.mock.getAll(key)
 	}
-	return p.main.HGetAll(key).Result()
+	return p.main.HGetAll(ctx, key).Result()
 }
 
-func (p *Proxy) keys(pattern string) ([]string, error) {
+// get - value of a string key, found is false whenever the key does not exist.
+func (p *Proxy) get(ctx context.Context, key string) (value string, found bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return "", false, err
+	}
 	if p.mock != nil {
-		return p.mock.keys(pattern)
+		return p.mock.get(key)
 	}
-	return p.main.Keys(pattern).Result()
+	value, err = p.main.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
 }
 
-func (p *Proxy) exists(key string) (int64, error) {
+// getAllMany - pipelines a HGETALL per key, results keep the keys order.
+func (p *Proxy) getAllMany(ctx context.Context, keys []string) ([]map[string]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if p.mock != nil {
-		return p.mock.exists(key)
+		return p.mock.getAllMany(keys)
+	}
+	pipe := p.main.Pipeline()
+	cmds := make([]*redis.StringStringMapCmd, 0, len(keys))
+	for _, key := range keys {
+		cmds = append(cmds, pipe.HGetAll(ctx, key))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	results := make([]map[string]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		results = append(results, cmd.Val())
+	}
+	return results, nil
+}
+
+// scan - iterates the keyspace with SCAN, unlike KEYS it does not block the server.
+func (p *Proxy) scan(ctx context.Context, pattern string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if p.mock != nil {
+		return p.mock.scan(pattern)
+	}
+	var keys []string
+	var cursor uint64
+	for {
+		batch, next, err := p.main.Scan(ctx, cursor, pattern, scanCount).Result()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, batch...)
+		if next == 0 {
+			return keys, nil
+		}
+		cursor = next
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 	}
-	return p.main.Exists(key).Result()
 }
 
-func (p *Proxy) set(key string, fields map[string]interface{}) (string, error) {
+func (p *Proxy) zRangeByLex(ctx context.Context, key string, r lexRange) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if p.mock != nil {
-		return p.mock.set(key, fields)
+		return p.mock.zRangeByLex(key, r)
+	}
+	opt := &redis.ZRangeBy{Min: r.Min, Max: r.Max, Count: r.Count}
+	if r.Rev {
+		return p.main.ZRevRangeByLex(ctx, key, opt).Result()
 	}
-	return p.main.HMSet(key, fields).Result()
+	return p.main.ZRangeByLex(ctx, key, opt).Result()
 }
 
-func (p *Proxy) setErr(key string, fields map[string]interface{}) error {
+// updateIndexes - pipelines the addition and removal of index members, all members share the same score.
+func (p *Proxy) updateIndexes(ctx context.Context, add, rem map[string][]string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if p.mock != nil {
-		return p.mock.setErr(key, fields)
+		return p.mock.updateIndexes(add, rem)
 	}
-	return p.main.HMSet(key, fields).Err()
+	pipe := p.main.Pipeline()
+	queueIndexUpdates(ctx, pipe, add, rem)
+	_, err := pipe.Exec(ctx)
+	return err
 }
 
-func (p *Proxy) del(key string) (int64, error) {
+// queueIndexUpdates - queues the removal and addition of index members, all members share the same score.
+func queueIndexUpdates(ctx context.Context, pipe redis.Pipeliner, add, rem map[string][]string) {
+	for key, members := range rem {
+		if len(members) == 0 {
+			continue
+		}
+		ms := make([]interface{}, 0, len(members))
+		for _, m := range members {
+			ms = append(ms, m)
+		}
+		pipe.ZRem(ctx, key, ms...)
+	}
+	for key, members := range add {
+		if len(members) == 0 {
+			continue
+		}
+		zs := make([]*redis.Z, 0, len(members))
+		for _, m := range members {
+			zs = append(zs, &redis.Z{Member: m})
+		}
+		pipe.ZAdd(ctx, key, zs...)
+	}
+}
+
+func (p *Proxy) exists(ctx context.Context, key string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if p.mock != nil {
+		return p.mock.exists(key)
+	}
+	return p.main.Exists(ctx, key).Result()
+}
+
+func (p *Proxy) del(ctx context.Context, key string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
 	if p.mock != nil {
 		return p.mock.del(key)
 	}
-	return p.main.Del(key).Result()
+	return p.main.Del(ctx, key).Result()
+}
+
+func (p *Proxy) rename(ctx context.Context, renames map[string]string, del ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if p.mock != nil {
+		return p.mock.rename(renames, del...)
+	}
+	_, err := p.main.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for src, dst := range renames {
+			pipe.Rename(ctx, src, dst)
+		}
+		if len(del) > 0 {
+			pipe.Del(ctx, del...)
+		}
+		return nil
+	})
+	return err
+}
+
+func (p *Proxy) watch(ctx context.Context, fn func(tx redisTx) error, keys ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if p.mock != nil {
+		return p.mock.watch(fn, keys...)
+	}
+	return p.main.Watch(ctx, func(tx *redis.Tx) error {
+		wtx := &watchedTx{ctx: ctx, tx: tx}
+		if err := fn(wtx); err != nil {
+			return err
+		}
+		if len(wtx.writes) == 0 {
+			return nil
+		}
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, write := range wtx.writes {
+				write(pipe)
+			}
+			return nil
+		})
+		return err
+	}, keys...)
+}
+
+// txWait - exponential backoff with full jitter for the given failed attempt.
+func txWait(attempt int) time.Duration {
+	wait := txBackoff << uint(attempt)
+	if wait > maxTxBackoff {
+		wait = maxTxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(wait)))
+}
+
+// transaction - runs fn within a transaction watching the given keys, it is retried as long as other clients modify the
+// keys in between. Errors returned by fn are expected to be already typed.
+func (p *Proxy) transaction(ctx context.Context, fn func(tx redisTx) error, keys ...string) (err error) {
+	ctx, span := tracing.Start(ctx, "redis transaction", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemRedis))
+	defer func() { tracing.End(span, err) }()
+	for attempt := 0; attempt < maxTxAttempts; attempt++ {
+		err := p.watch(ctx, fn, keys...)
+		switch err.(type) {
+		case nil:
+			return nil
+		case *errors.DBErr, *errors.ExistErr, *errors.PreconditionErr:
+			return err
+		}
+		if err != errTxConflict {
+			return errors.WrapDBErr(err)
+		}
+		if attempt < maxTxAttempts-1 {
+			select {
+			case <-time.After(txWait(attempt)):
+			case <-ctx.Done():
+				return errors.WrapDBErr(ctx.Err())
+			}
+		}
+	}
+
+	return errors.NewDBErr(fmt.Sprintf("transaction aborted after %d attempts, keys %v kept being modified", maxTxAttempts, keys))
+}
+
+// indexedTransaction - transaction of a write that updates the indexes. While the indexes are being rebuilt (see
+// RebuildIndexes) its index updates are applied to the indexes being built as well, the rebuild marker is watched so
+// that the rebuild starting or finishing in between aborts (and retries) the transaction.
+func (p *Proxy) indexedTransaction(ctx context.Context, fn func(tx redisTx) error, keys ...string) error {
+	watched := make([]string, 0, len(keys)+1)
+	watched = append(append(watched, keys...), rebuildMarker)
+	return p.transaction(ctx, func(tx redisTx) error {
+		rebuilding, err := tx.exists(rebuildMarker)
+		if err != nil {
+			return errors.WrapDBErr(err)
+		}
+		if rebuilding > 0 {
+			tx = &rebuildingTx{redisTx: tx}
+		}
+		return fn(tx)
+	}, watched...)
+}
+
+// rebuildingTx - redisTx whose index updates are mirrored onto the indexes being rebuilt.
+type rebuildingTx struct {
+	redisTx
+}
+
+func (rt *rebuildingTx) updateIndexes(add, rem map[string][]string) {
+	rt.redisTx.updateIndexes(add, rem)
+	rt.redisTx.updateIndexes(rebuildUpdates(add), rebuildUpdates(rem))
+}
+
+// watchedTx - redisTx on top of a redis.Tx, its commands are bound to ctx. Writes are kept as functions applied on the
+// MULTI/EXEC pipeline.
+type watchedTx struct {
+	ctx    context.Context
+	tx     *redis.Tx
+	writes []func(pipe redis.Pipeliner)
+}
+
+func (wt *watchedTx) getAll(key string) (map[string]string, error) {
+	return wt.tx.HGetAll(wt.ctx, key).Result()
+}
+
+// getAllMany - pipelines a HGETALL per key, results keep the keys order.
+func (wt *watchedTx) getAllMany(keys []string) ([]map[string]string, error) {
+	cmds := make([]*redis.StringStringMapCmd, 0, len(keys))
+	_, err := wt.tx.Pipelined(wt.ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			cmds = append(cmds, pipe.HGetAll(wt.ctx, key))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	results := make([]map[string]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		results = append(results, cmd.Val())
+	}
+	return results, nil
+}
+
+func (wt *watchedTx) getField(key, field string) (string, bool, error) {
+	value, err := wt.tx.HGet(wt.ctx, key, field).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+func (wt *watchedTx) exists(key string) (int64, error) {
+	return wt.tx.Exists(wt.ctx, key).Result()
+}
+
+// existsMany - pipelines an EXISTS per key, results keep the keys order.
+func (wt *watchedTx) existsMany(keys []string) ([]bool, error) {
+	cmds := make([]*redis.IntCmd, 0, len(keys))
+	_, err := wt.tx.Pipelined(wt.ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			cmds = append(cmds, pipe.Exists(wt.ctx, key))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	results := make([]bool, 0, len(cmds))
+	for _, cmd := range cmds {
+		results = append(results, cmd.Val() > 0)
+	}
+	return results, nil
+}
+
+func (wt *watchedTx) set(key string, fields map[string]interface{}) {
+	wt.writes = append(wt.writes, func(pipe redis.Pipeliner) {
+		pipe.HMSet(wt.ctx, key, fields)
+	})
+}
+
+func (wt *watchedTx) del(keys ...string) {
+	wt.writes = append(wt.writes, func(pipe redis.Pipeliner) {
+		pipe.Del(wt.ctx, keys...)
+	})
+}
+
+func (wt *watchedTx) delFields(key string, fields ...string) {
+	wt.writes = append(wt.writes, func(pipe redis.Pipeliner) {
+		pipe.HDel(wt.ctx, key, fields...)
+	})
+}
+
+func (wt *watchedTx) incrBy(key, field string, incr int64) {
+	wt.writes = append(wt.writes, func(pipe redis.Pipeliner) {
+		pipe.HIncrBy(wt.ctx, key, field, incr)
+	})
+}
+
+func (wt *watchedTx) updateIndexes(add, rem map[string][]string) {
+	wt.writes = append(wt.writes, func(pipe redis.Pipeliner) {
+		queueIndexUpdates(wt.ctx, pipe, add, rem)
+	})
 }
@@ -1 +1,335 @@
 package redis
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// redisFake - keeps hashes and lexicographic sorted sets in memory. Every write bumps the version of the key, that way
+// transactions are aborted the same way redis does whenever a watched key is modified before they are executed. Errors
+// can be injected per operation through fail.
+type redisFake struct {
+	mu       sync.Mutex
+	hashes   map[string]map[string]string
+	zsets    map[string]map[string]bool
+	versions map[string]int
+	fail     map[string]error
+}
+
+func newRedisFake() *redisFake {
+	return &redisFake{
+		hashes:   make(map[string]map[string]string),
+		zsets:    make(map[string]map[string]bool),
+		versions: make(map[string]int),
+		fail:     make(map[string]error),
+	}
+}
+
+func (f *redisFake) get(key string) (string, bool, error) {
+	panic("Not implemented")
+}
+
+func (f *redisFake) getAll(key string) (map[string]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.fail["getAll"]; err != nil {
+		return nil, err
+	}
+	return f.hash(key), nil
+}
+
+// hash - copy of the hash, the caller must hold the lock.
+func (f *redisFake) hash(key string) map[string]string {
+	result := make(map[string]string)
+	for field, value := range f.hashes[key] {
+		result[field] = value
+	}
+	return result
+}
+
+func (f *redisFake) getAllMany(keys []string) ([]map[string]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.fail["getAllMany"]; err != nil {
+		return nil, err
+	}
+	results := make([]map[string]string, 0, len(keys))
+	for _, key := range keys {
+		results = append(results, f.hash(key))
+	}
+	return results, nil
+}
+
+func (f *redisFake) scan(pattern string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []string
+	for key := range f.hashes {
+		if ok, _ := path.Match(pattern, key); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// inLex - whether the member is within the given ZRANGEBYLEX bound.
+func inLex(member, bound string, lower bool) bool {
+	switch {
+	case bound == "-":
+		return true
+	case bound == "+":
+		return true
+	case strings.HasPrefix(bound, "["):
+		if lower {
+			return member >= bound[1:]
+		}
+		return member <= bound[1:]
+	case strings.HasPrefix(bound, "("):
+		if lower {
+			return member > bound[1:]
+		}
+		return member < bound[1:]
+	}
+	panic("invalid lex bound " + bound)
+}
+
+func (f *redisFake) zRangeByLex(key string, r lexRange) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var members []string
+	for member := range f.zsets[key] {
+		if inLex(member, r.Min, true) && inLex(member, r.Max, false) {
+			members = append(members, member)
+		}
+	}
+	sort.Strings(members)
+	if r.Rev {
+		for i, j := 0, len(members)-1; i < j; i, j = i+1, j-1 {
+			members[i], members[j] = members[j], members[i]
+		}
+	}
+	if r.Count > 0 && int64(len(members)) > r.Count {
+		members = members[:r.Count]
+	}
+	return members, nil
+}
+
+func (f *redisFake) updateIndexes(add, rem map[string][]string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.zUpdate(add, rem)
+	return nil
+}
+
+// zUpdate - the caller must hold the lock.
+func (f *redisFake) zUpdate(add, rem map[string][]string) {
+	for key, members := range rem {
+		for _, member := range members {
+			delete(f.zsets[key], member)
+		}
+		f.versions[key]++
+	}
+	for key, members := range add {
+		if f.zsets[key] == nil {
+			f.zsets[key] = make(map[string]bool)
+		}
+		for _, member := range members {
+			f.zsets[key][member] = true
+		}
+		f.versions[key]++
+	}
+}
+
+func (f *redisFake) exists(key string) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.fail["exists"]; err != nil {
+		return 0, err
+	}
+	return f.keyExists(key), nil
+}
+
+// keyExists - the caller must hold the lock.
+func (f *redisFake) keyExists(key string) int64 {
+	if len(f.hashes[key]) > 0 || len(f.zsets[key]) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func (f *redisFake) del(key string) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.delKeys(key), nil
+}
+
+func (f *redisFake) rename(renames map[string]string, del ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.fail["rename"]; err != nil {
+		return err
+	}
+	for src := range renames {
+		if f.keyExists(src) == 0 {
+			return fmt.Errorf("ERR no such key")
+		}
+	}
+	for src, dst := range renames {
+		hash, zset := f.hashes[src], f.zsets[src]
+		f.delKeys(src, dst)
+		if hash != nil {
+			f.hashes[dst] = hash
+		}
+		if zset != nil {
+			f.zsets[dst] = zset
+		}
+	}
+	f.delKeys(del...)
+	return nil
+}
+
+// delKeys - the caller must hold the lock.
+func (f *redisFake) delKeys(keys ...string) int64 {
+	var deleted int64
+	for _, key := range keys {
+		deleted += f.keyExists(key)
+		delete(f.hashes, key)
+		delete(f.zsets, key)
+		f.versions[key]++
+	}
+	return deleted
+}
+
+// delFields - the caller must hold the lock.
+func (f *redisFake) delFields(key string, fields ...string) {
+	for _, field := range fields {
+		delete(f.hashes[key], field)
+	}
+	if len(f.hashes[key]) == 0 {
+		delete(f.hashes, key)
+	}
+	f.versions[key]++
+}
+
+func (f *redisFake) setHash(key string, fields map[string]interface{}) {
+	if f.hashes[key] == nil {
+		f.hashes[key] = make(map[string]string)
+	}
+	for field, value := range fields {
+		f.hashes[key][field] = fmt.Sprint(value)
+	}
+	f.versions[key]++
+}
+
+func (f *redisFake) incrBy(key, field string, incr int64) {
+	if f.hashes[key] == nil {
+		f.hashes[key] = make(map[string]string)
+	}
+	value, _ := strconv.ParseInt(f.hashes[key][field], 10, 64)
+	f.hashes[key][field] = strconv.FormatInt(value+incr, 10)
+	f.versions[key]++
+}
+
+func (f *redisFake) watch(fn func(tx redisTx) error, keys ...string) error {
+	f.mu.Lock()
+	if err := f.fail["watch"]; err != nil {
+		f.mu.Unlock()
+		return err
+	}
+	watched := make(map[string]int)
+	for _, key := range keys {
+		watched[key] = f.versions[key]
+	}
+	f.mu.Unlock()
+
+	tx := &txFake{fake: f}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for key, version := range watched {
+		if f.versions[key] != version {
+			return errTxConflict
+		}
+	}
+	if err := f.fail["exec"]; err != nil {
+		return err
+	}
+	for _, write := range tx.writes {
+		write()
+	}
+	return nil
+}
+
+// txFake - reads go straight to the fake while writes are applied once the watched keys have been checked.
+type txFake struct {
+	fake   *redisFake
+	writes []func()
+}
+
+func (tf *txFake) getAll(key string) (map[string]string, error) {
+	// give other transactions the chance to modify the watched keys
+	defer runtime.Gosched()
+	return tf.fake.getAll(key)
+}
+
+func (tf *txFake) getAllMany(keys []string) ([]map[string]string, error) {
+	defer runtime.Gosched()
+	return tf.fake.getAllMany(keys)
+}
+
+func (tf *txFake) getField(key, field string) (string, bool, error) {
+	defer runtime.Gosched()
+	tf.fake.mu.Lock()
+	defer tf.fake.mu.Unlock()
+	if err := tf.fake.fail["getField"]; err != nil {
+		return "", false, err
+	}
+	value, ok := tf.fake.hashes[key][field]
+	return value, ok, nil
+}
+
+func (tf *txFake) exists(key string) (int64, error) {
+	defer runtime.Gosched()
+	return tf.fake.exists(key)
+}
+
+func (tf *txFake) existsMany(keys []string) ([]bool, error) {
+	defer runtime.Gosched()
+	results := make([]bool, 0, len(keys))
+	for _, key := range keys {
+		exists, err := tf.fake.exists(key)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, exists > 0)
+	}
+	return results, nil
+}
+
+func (tf *txFake) set(key string, fields map[string]interface{}) {
+	tf.writes = append(tf.writes, func() { tf.fake.setHash(key, fields) })
+}
+
+func (tf *txFake) del(keys ...string) {
+	tf.writes = append(tf.writes, func() { tf.fake.delKeys(keys...) })
+}
+
+func (tf *txFake) delFields(key string, fields ...string) {
+	tf.writes = append(tf.writes, func() { tf.fake.delFields(key, fields...) })
+}
+
+func (tf *txFake) incrBy(key, field string, incr int64) {
+	tf.writes = append(tf.writes, func() { tf.fake.incrBy(key, field, incr) })
+}
+
+func (tf *txFake) updateIndexes(add, rem map[string][]string) {
+	tf.writes = append(tf.writes, func() { tf.fake.zUpdate(add, rem) })
+}
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/apikey"
+	"github.com/rnov/Go-REST/pkg/identity"
+	"github.com/rnov/Go-REST/pkg/rate"
+	rcp "github.com/rnov/Go-REST/pkg/recipe"
+)
+
+// timeoutClient - decorates a DB client giving each call up to timeout, on top of the deadline of the request if any.
+// Calls not completed in time fail with a DB error telling so, see errors.DBErr.
+type timeoutClient struct {
+	next    Client
+	timeout time.Duration
+}
+
+// withTimeout - c whose calls are given up to timeout each, c itself when there is no timeout.
+func withTimeout(c Client, timeout time.Duration) Client {
+	if timeout <= 0 {
+		return c
+	}
+	return &timeoutClient{next: c, timeout: timeout}
+}
+
+func (c *timeoutClient) GetRecipeByID(ctx context.Context, recipeID string) (*rcp.Recipe, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.GetRecipeByID(ctx, recipeID)
+}
+
+func (c *timeoutClient) GetRecipes(ctx context.Context, query *rcp.Query) (*rcp.Page, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.GetRecipes(ctx, query)
+}
+
+func (c *timeoutClient) CreateRecipe(ctx context.Context, recipe *rcp.Recipe) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.CreateRecipe(ctx, recipe)
+}
+
+func (c *timeoutClient) CreateRecipes(ctx context.Context, recipes []*rcp.Recipe) []error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.CreateRecipes(ctx, recipes)
+}
+
+func (c *timeoutClient) UpdateRecipe(ctx context.Context, recipe *rcp.Recipe, version int64) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.UpdateRecipe(ctx, recipe, version)
+}
+
+func (c *timeoutClient) PatchRecipe(ctx context.Context, recipe *rcp.Recipe, fields []string, version int64) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.PatchRecipe(ctx, recipe, fields, version)
+}
+
+func (c *timeoutClient) DeleteRecipe(ctx context.Context, recipeID string, version int64) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.DeleteRecipe(ctx, recipeID, version)
+}
+
+func (c *timeoutClient) RateRecipe(ctx context.Context, recipeID string, rate *rate.Rate) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.RateRecipe(ctx, recipeID, rate)
+}
+
+func (c *timeoutClient) DeleteRate(ctx context.Context, recipeID, rater string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.DeleteRate(ctx, recipeID, rater)
+}
+
+func (c *timeoutClient) GetRates(ctx context.Context, recipeID string) ([]*rate.Rate, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.GetRates(ctx, recipeID)
+}
+
+func (c *timeoutClient) GetRateSummary(ctx context.Context, recipeID string) (*rate.Summary, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.GetRateSummary(ctx, recipeID)
+}
+
+func (c *timeoutClient) CheckAuth(ctx context.Context, auth string) (*identity.Principal, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.CheckAuth(ctx, auth)
+}
+
+func (c *timeoutClient) GetCredentials(ctx context.Context, username string) (*identity.Credentials, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.GetCredentials(ctx, username)
+}
+
+func (c *timeoutClient) SetPassword(ctx context.Context, username, passwordHash string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.SetPassword(ctx, username, passwordHash)
+}
+
+func (c *timeoutClient) CreateAPIKey(ctx context.Context, key *apikey.Key) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.CreateAPIKey(ctx, key)
+}
+
+func (c *timeoutClient) GetAPIKey(ctx context.Context, ID string) (*apikey.Key, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.GetAPIKey(ctx, ID)
+}
+
+func (c *timeoutClient) GetAPIKeys(ctx context.Context) ([]*apikey.Key, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.GetAPIKeys(ctx)
+}
+
+func (c *timeoutClient) RotateAPIKey(ctx context.Context, ID, oldHash, newHash string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.RotateAPIKey(ctx, ID, oldHash, newHash)
+}
+
+func (c *timeoutClient) DeleteAPIKey(ctx context.Context, ID string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.next.DeleteAPIKey(ctx, ID)
+}
+
+func (c *timeoutClient) Close() error {
+	return c.next.Close()
+}
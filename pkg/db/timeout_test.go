@@ -0,0 +1,47 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/db/memory"
+	"github.com/rnov/Go-REST/pkg/errors"
+	rcp "github.com/rnov/Go-REST/pkg/recipe"
+)
+
+// slowDB - the in-memory DB whose recipes are never read in time, calls wait until ctx is done.
+type slowDB struct {
+	*memory.Store
+}
+
+func (s *slowDB) GetRecipeByID(ctx context.Context, recipeID string) (*rcp.Recipe, error) {
+	<-ctx.Done()
+	return nil, errors.WrapDBErr(ctx.Err())
+}
+
+func TestWithTimeout(t *testing.T) {
+	backend := &slowDB{Store: memory.NewStore()}
+	if c := withTimeout(backend, 0); c != backend {
+		t.Errorf("expected calls not to be limited without timeout, instead got: '%T'", c)
+	}
+
+	c := withTimeout(backend, 10*time.Millisecond)
+	_, err := c.GetRecipeByID(context.Background(), "5f10223c")
+	if dbErr, ok := err.(*errors.DBErr); !ok || !dbErr.Timeout() {
+		t.Errorf("expected DB error due to timeout instead got: '%v'", err)
+	}
+	// the deadline of the request still applies when it is closer
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = withTimeout(backend, time.Minute).GetRecipeByID(ctx, "5f10223c")
+	if dbErr, ok := err.(*errors.DBErr); !ok || !dbErr.Canceled() {
+		t.Errorf("expected DB error due to cancellation instead got: '%v'", err)
+	}
+	// calls completed in time are left as they are
+	if _, err := c.GetRates(context.Background(), "5f10223c"); err != nil {
+		if _, ok := err.(*errors.ExistErr); !ok {
+			t.Errorf("expected the outcome of the call, instead got: '%v'", err)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+
+	"github.com/rnov/Go-REST/pkg/rate"
+	rcp "github.com/rnov/Go-REST/pkg/recipe"
+	"github.com/rnov/Go-REST/pkg/tracing"
+)
+
+// tracedClient - decorates a DB client tracing the calls made on behalf of a request as spans of their own, named after
+// the method, e.g. "db.GetRecipes". The round trips made by the call are traced by the client as its children.
+type tracedClient struct {
+	Client
+}
+
+// NewTracedClient - DB client tracing the calls made to c, whatever its backend.
+func NewTracedClient(c Client) Client {
+	return &tracedClient{Client: c}
+}
+
+func (c *tracedClient) GetRecipeByID(ctx context.Context, recipeID string) (*rcp.Recipe, error) {
+	ctx, span := tracing.Start(ctx, "db.GetRecipeByID")
+	recipe, err := c.Client.GetRecipeByID(ctx, recipeID)
+	tracing.End(span, err)
+	return recipe, err
+}
+
+func (c *tracedClient) GetRecipes(ctx context.Context, query *rcp.Query) (*rcp.Page, error) {
+	ctx, span := tracing.Start(ctx, "db.GetRecipes")
+	page, err := c.Client.GetRecipes(ctx, query)
+	tracing.End(span, err)
+	return page, err
+}
+
+func (c *tracedClient) CreateRecipe(ctx context.Context, recipe *rcp.Recipe) error {
+	ctx, span := tracing.Start(ctx, "db.CreateRecipe")
+	err := c.Client.CreateRecipe(ctx, recipe)
+	tracing.End(span, err)
+	return err
+}
+
+// CreateRecipes - the outcome of each recipe is not recorded, failed calls are told by the spans of the round trips.
+func (c *tracedClient) CreateRecipes(ctx context.Context, recipes []*rcp.Recipe) []error {
+	ctx, span := tracing.Start(ctx, "db.CreateRecipes")
+	errs := c.Client.CreateRecipes(ctx, recipes)
+	tracing.End(span, nil)
+	return errs
+}
+
+func (c *tracedClient) UpdateRecipe(ctx context.Context, recipe *rcp.Recipe, version int64) error {
+	ctx, span := tracing.Start(ctx, "db.UpdateRecipe")
+	err := c.Client.UpdateRecipe(ctx, recipe, version)
+	tracing.End(span, err)
+	return err
+}
+
+func (c *tracedClient) PatchRecipe(ctx context.Context, recipe *rcp.Recipe, fields []string, version int64) error {
+	ctx, span := tracing.Start(ctx, "db.PatchRecipe")
+	err := c.Client.PatchRecipe(ctx, recipe, fields, version)
+	tracing.End(span, err)
+	return err
+}
+
+func (c *tracedClient) DeleteRecipe(ctx context.Context, recipeID string, version int64) error {
+	ctx, span := tracing.Start(ctx, "db.DeleteRecipe")
+	err := c.Client.DeleteRecipe(ctx, recipeID, version)
+	tracing.End(span, err)
+	return err
+}
+
+func (c *tracedClient) RateRecipe(ctx context.Context, recipeID string, rate *rate.Rate) error {
+	ctx, span := tracing.Start(ctx, "db.RateRecipe")
+	err := c.Client.RateRecipe(ctx, recipeID, rate)
+	tracing.End(span, err)
+	return err
+}
+
+func (c *tracedClient) DeleteRate(ctx context.Context, recipeID, rater string) error {
+	ctx, span := tracing.Start(ctx, "db.DeleteRate")
+	err := c.Client.DeleteRate(ctx, recipeID, rater)
+	tracing.End(span, err)
+	return err
+}
+
+func (c *tracedClient) GetRates(ctx context.Context, recipeID string) ([]*rate.Rate, error) {
+	ctx, span := tracing.Start(ctx, "db.GetRates")
+	rates, err := c.Client.GetRates(ctx, recipeID)
+	tracing.End(span, err)
+	return rates, err
+}
+
+func (c *tracedClient) GetRateSummary(ctx context.Context, recipeID string) (*rate.Summary, error) {
+	ctx, span := tracing.Start(ctx, "db.GetRateSummary")
+	summary, err := c.Client.GetRateSummary(ctx, recipeID)
+	tracing.End(span, err)
+	return summary, err
+}
@@ -1,7 +1,9 @@
 package errors
 
 import (
+	"context"
 	"encoding/json"
+	stderrors "errors"
 	"net/http"
 )
 
@@ -10,12 +12,21 @@ const (
 	OutOfRange  = "out of range"
 	TooLong     = "too long"
 	MissingName = "missing name"
+	MissingText = "missing text"
+	Invalid     = "invalid value"
+	TooMany     = "too many items"
+	Empty       = "empty value"
 )
 
 const (
-	Name       = "name"
-	Preptime   = "preptime"
-	Difficulty = "difficulty"
+	Name        = "name"
+	Preptime    = "preptime"
+	Difficulty  = "difficulty"
+	Servings    = "servings"
+	Cuisine     = "cuisine"
+	Tags        = "tags"
+	Ingredients = "ingredients"
+	Steps       = "steps"
 )
 
 const (
@@ -23,10 +34,35 @@ const (
 	RateID = "ID"
 )
 
+const (
+	Patch     = "patch"
+	Batch     = "batch"
+	Recipe    = "recipe"
+	GrantType = "grant_type"
+)
+
+const (
+	Role      = "role"
+	Scopes    = "scopes"
+	ExpiresAt = "expiresAt"
+)
+
+const (
+	Limit       = "limit"
+	Cursor      = "cursor"
+	Sort        = "sort"
+	Vegetarian  = "vegetarian"
+	MaxPrepTime = "maxPrepTime"
+	SearchText  = "q"
+)
+
 // DBErr is a defined error type whose purpose is to be used whenever a DB related error has occurred and needs to be
 //logged.
 type DBErr struct {
 	msgToLog string
+	// cause - context.DeadlineExceeded or context.Canceled whenever the call has been interrupted on behalf of the
+	// request, nil otherwise.
+	cause error
 }
 
 func (myErr *DBErr) Error() string {
@@ -39,6 +75,28 @@ func NewDBErr(msg string) *DBErr {
 	}
 }
 
+// WrapDBErr - DB error out of the error returned by the DB client, whether it is due to the deadline of the request
+// being exceeded or to the request being canceled is kept (see Timeout and Canceled).
+func WrapDBErr(err error) *DBErr {
+	dbErr := NewDBErr(err.Error())
+	if stderrors.Is(err, context.DeadlineExceeded) {
+		dbErr.cause = context.DeadlineExceeded
+	} else if stderrors.Is(err, context.Canceled) {
+		dbErr.cause = context.Canceled
+	}
+	return dbErr
+}
+
+// Timeout - whether the DB call has not been completed before the deadline of the request.
+func (myErr *DBErr) Timeout() bool {
+	return myErr.cause == context.DeadlineExceeded
+}
+
+// Canceled - whether the DB call has been interrupted since the request has been canceled, e.g. the client is gone.
+func (myErr *DBErr) Canceled() bool {
+	return myErr.cause == context.Canceled
+}
+
 // FailedAuthErr is a defined error type whose purpose is to acknowledge a failed authorization attempt.
 type FailedAuthErr struct {
 }
@@ -51,6 +109,19 @@ func NewFailedAuthErr() *FailedAuthErr {
 	return &FailedAuthErr{}
 }
 
+// ForbiddenErr is a defined error type whose purpose is to acknowledge that the authenticated user has not been granted
+// the permission the request requires.
+type ForbiddenErr struct {
+}
+
+func (fe *ForbiddenErr) Error() string {
+	return "operation not permitted"
+}
+
+func NewForbiddenErr() *ForbiddenErr {
+	return &ForbiddenErr{}
+}
+
 // InputErr is a defined error type whose purpose is to acknowledge any error due user's input and carry relevant
 //information regarding the error.
 type InputErr struct {
@@ -91,42 +162,87 @@ func NewExistErr(exist bool) *ExistErr {
 	}
 }
 
+// PreconditionErr is a defined error type whose purpose is to acknowledge that the stored item is no longer at the
+// version the request was conditioned on, e.g. it has been modified by someone else in the meantime.
+type PreconditionErr struct {
+}
+
+func (pe *PreconditionErr) Error() string {
+	return "item has been modified"
+}
+
+func NewPreconditionErr() *PreconditionErr {
+	return &PreconditionErr{}
+}
+
 // BuildResponse - is a method that is being used by handler methods whenever an error occurs and a response based on the error type
 // needs to be built. It also acknowledge whether an error needs to be logged, due the logging policy design.
 // A compromise decision that tights the relation error-log but for the current size is a small one.
 func BuildResponse(w http.ResponseWriter, method string, err error) (toLog bool) {
+	status, toLog := StatusCode(method, err)
+	if ie, ok := err.(*InputErr); ok {
+		body, jsonErr := json.Marshal(ie)
+		if jsonErr != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return true
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(body)
+		return toLog
+	}
+	if status > 0 {
+		w.WriteHeader(status)
+	}
+
+	return toLog
+}
+
+// StatusClientClosedRequest - non standard status of the requests canceled by the client before being served, it is
+// never received by the client but tells the access log and the metrics apart from the failed requests.
+const StatusClientClosedRequest = 499
+
+// StatusCode - the status code BuildResponse responds with to the error of a request of the given method, 0 when no
+// status is written, along with whether the error needs to be logged. Requests whose deadline has been exceeded are
+// responded with 504 Gateway Timeout, those canceled by the client are not logged.
+func StatusCode(method string, err error) (status int, toLog bool) {
 	switch e := err.(type) {
 	case *FailedAuthErr:
-		w.WriteHeader(http.StatusUnauthorized)
+		return http.StatusUnauthorized, false
+	case *ForbiddenErr:
+		return http.StatusForbidden, false
 	case *DBErr:
-		toLog = true
-		w.WriteHeader(http.StatusInternalServerError)
+		if e.Timeout() {
+			return http.StatusGatewayTimeout, true
+		} else if e.Canceled() {
+			return StatusClientClosedRequest, false
+		}
+		return http.StatusInternalServerError, true
 	case *ExistErr:
 		if method == "GET" && !e.Exist {
-			w.WriteHeader(http.StatusNotFound)
+			return http.StatusNotFound, false
 		} else if method == "POST" && e.Exist {
-			w.WriteHeader(http.StatusForbidden)
+			return http.StatusForbidden, false
 		} else if method == "PUT" && !e.Exist {
-			w.WriteHeader(http.StatusNoContent)
+			return http.StatusNoContent, false
 		} else if method == "DELETE" && !e.Exist {
-			w.WriteHeader(http.StatusNotFound)
+			return http.StatusNotFound, false
+		} else if method == "PATCH" && !e.Exist {
+			return http.StatusNotFound, false
 		} else if method == "POST" && !e.Exist {
-			w.WriteHeader(http.StatusNotFound)
+			return http.StatusNotFound, false
 		}
+		return 0, false
+	case *PreconditionErr:
+		return http.StatusPreconditionFailed, false
 	case *InputErr:
-		body, jsonErr := json.Marshal(e)
-		if jsonErr != nil {
-			toLog = true
-			w.WriteHeader(http.StatusInternalServerError)
-			return toLog
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write(body)
-	default:
-		toLog = true
-		w.WriteHeader(http.StatusInternalServerError)
+		return http.StatusBadRequest, false
+	}
+	if stderrors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout, true
+	} else if stderrors.Is(err, context.Canceled) {
+		return StatusClientClosedRequest, false
 	}
 
-	return toLog
+	return http.StatusInternalServerError, true
 }
@@ -0,0 +1,60 @@
+package errors
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBuildResponse_Interrupted(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedToLog  bool
+	}{
+		{
+			name:           "DB error",
+			err:            NewDBErr("connection refused"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedToLog:  true,
+		},
+		{
+			name:           "DB call not completed in time",
+			err:            WrapDBErr(fmt.Errorf("%w: i/o timeout", context.DeadlineExceeded)),
+			expectedStatus: http.StatusGatewayTimeout,
+			expectedToLog:  true,
+		},
+		{
+			name:           "DB call interrupted by the client",
+			err:            WrapDBErr(context.Canceled),
+			expectedStatus: StatusClientClosedRequest,
+		},
+		{
+			name:           "deadline exceeded",
+			err:            context.DeadlineExceeded,
+			expectedStatus: http.StatusGatewayTimeout,
+			expectedToLog:  true,
+		},
+		{
+			name:           "canceled",
+			err:            context.Canceled,
+			expectedStatus: StatusClientClosedRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			toLog := BuildResponse(rr, "GET", test.err)
+			if rr.Code != test.expectedStatus {
+				t.Errorf("expected status: %d instead got: %d", test.expectedStatus, rr.Code)
+			}
+			if toLog != test.expectedToLog {
+				t.Errorf("expected to log: %v instead got: %v", test.expectedToLog, toLog)
+			}
+		})
+	}
+}
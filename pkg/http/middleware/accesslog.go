@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
+	"github.com/rnov/Go-REST/pkg/logger"
+	"github.com/rnov/Go-REST/pkg/tracing"
+)
+
+type accessKey struct{}
+
+// access - details of the request only known once it has gone through the inner middlewares, e.g. the authenticated
+// user, filled in through the request context.
+type access struct {
+	principal string
+}
+
+// AccessLog - custom HTTP middleware that writes an entry per request once it has been served: method, route, status,
+// bytes written, duration and the authenticated user, if any, along with the request ID and the trace ID when traced.
+// Handlers are given a logger carrying both IDs through the request context (see logger.FromContext). It has to be
+// wrapped by RequestID, and by Tracing for the trace ID to be known.
+func AccessLog(l logger.Loggers) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ids := logger.Fields{"requestID": RequestIDFromContext(r.Context())}
+			if traceID := tracing.TraceID(r.Context()); len(traceID) > 0 {
+				ids["traceID"] = traceID
+			}
+			rl := logger.With(l, ids)
+			acc := &access{}
+			ctx := context.WithValue(logger.NewContext(r.Context(), rl), accessKey{}, acc)
+			sw := &statusWriter{ResponseWriter: w}
+
+			next.ServeHTTP(sw, r.WithContext(ctx))
+
+			fields := logger.Fields{
+				"method":     r.Method,
+				"route":      pathTemplate(r),
+				"status":     sw.statusCode(),
+				"bytes":      sw.bytes,
+				"durationMs": float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if len(acc.principal) > 0 {
+				fields["principal"] = acc.principal
+			}
+			logger.With(rl, fields).Info("access")
+		})
+	}
+}
+
+// recordPrincipal - tells the access log the user the request is made on behalf of.
+func recordPrincipal(r *http.Request, p *identity.Principal) {
+	if acc, ok := r.Context().Value(accessKey{}).(*access); ok {
+		acc.principal = p.Username
+	}
+}
+
+// buildResponse - responds with the error, which is logged by the request logger whenever errors.BuildResponse tells so.
+func buildResponse(w http.ResponseWriter, r *http.Request, err error) {
+	if toLog := errors.BuildResponse(w, r.Method, err); toLog {
+		if l, ok := logger.FromContext(r.Context()); ok {
+			l.Errorf("system error: %s", err.Error())
+		}
+	}
+}
+
+// statusWriter - records the status and the size of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	n, err := sw.ResponseWriter.Write(b)
+	sw.bytes += int64(n)
+	return n, err
+}
+
+// Flush - streamed responses, e.g. exports, are flushed as they are written.
+func (sw *statusWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// statusCode - the status written, responses without any status nor body are sent as 200 OK.
+func (sw *statusWriter) statusCode() int {
+	if sw.status == 0 {
+		return http.StatusOK
+	}
+	return sw.status
+}
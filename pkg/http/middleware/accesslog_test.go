@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
+	"github.com/rnov/Go-REST/pkg/logger"
+)
+
+func TestAccessLog(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		auth     bool
+		handler  func(w http.ResponseWriter, r *http.Request)
+		expected []map[string]interface{}
+	}{
+		{
+			name:   "routed request",
+			method: "GET",
+			url:    "/recipes/5f10223c",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("recipe"))
+			},
+			expected: []map[string]interface{}{
+				{"msg": "access", "method": "GET", "route": "/recipes/{ID}", "status": float64(200), "bytes": float64(6),
+					"requestID": "4bf92f3577b34da6"},
+			},
+		},
+		{
+			name:   "authenticated request",
+			method: "DELETE",
+			url:    "/recipes/5f10223c",
+			auth:   true,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+			expected: []map[string]interface{}{
+				{"msg": "access", "method": "DELETE", "route": "/recipes/{ID}", "status": float64(204), "bytes": float64(0),
+					"principal": "chef", "requestID": "4bf92f3577b34da6"},
+			},
+		},
+		{
+			name:   "errors to log are logged by the request logger",
+			method: "DELETE",
+			url:    "/recipes/5f10223c",
+			auth:   true,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				buildResponse(w, r, errors.NewDBErr("connection refused"))
+			},
+			expected: []map[string]interface{}{
+				{"level": "error", "msg": "system error: connection refused", "requestID": "4bf92f3577b34da6"},
+				{"msg": "access", "method": "DELETE", "route": "/recipes/{ID}", "status": float64(500), "bytes": float64(0),
+					"principal": "chef", "requestID": "4bf92f3577b34da6"},
+			},
+		},
+		{
+			name:   "unrouted request",
+			method: "GET",
+			url:    "/unknown",
+			expected: []map[string]interface{}{
+				{"msg": "access", "method": "GET", "route": "/unknown", "status": float64(404), "requestID": "4bf92f3577b34da6"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			l := logger.NewJSONLogger("goREST", buf, logger.InfoLevel)
+			logged := func(h http.Handler) http.Handler {
+				return RequestID(AccessLog(l)(h))
+			}
+			router := mux.NewRouter()
+			router.Use(logged)
+			router.NotFoundHandler = logged(http.NotFoundHandler())
+			h := test.handler
+			if test.auth {
+				validator := &validatorMock{validate: func(scheme, credentials string) (*identity.Principal, error) {
+					return &identity.Principal{Username: "chef", Role: identity.Editor}, nil
+				}}
+				h = Authentication(validator, h)
+			}
+			if h != nil {
+				router.HandleFunc("/recipes/{ID}", h).Methods(test.method)
+			}
+
+			req, err := http.NewRequest(test.method, test.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set(requestIDHeader, "4bf92f3577b34da6")
+			if test.auth {
+				req.Header.Set(authHeader, "Basic dXNlcm5hbWU6cGFzc3dvcmQ=")
+			}
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			if len(lines) != len(test.expected) {
+				t.Fatalf("expected %d entries instead got: '%s'", len(test.expected), buf.String())
+			}
+			for i, line := range lines {
+				entry := make(map[string]interface{})
+				if err := json.Unmarshal([]byte(line), &entry); err != nil {
+					t.Fatalf("invalid entry '%s': %s", line, err)
+				}
+				for k, v := range test.expected[i] {
+					if entry[k] != v {
+						t.Errorf("expected %s: '%v' instead got: '%v'", k, v, entry[k])
+					}
+				}
+				if _, ok := test.expected[i]["principal"]; !ok && entry["principal"] != nil {
+					t.Errorf("unexpected principal: '%v'", entry["principal"])
+				}
+				if entry["msg"] == "access" && entry["durationMs"] == nil {
+					t.Errorf("expected the duration to be logged")
+				}
+			}
+		})
+	}
+}
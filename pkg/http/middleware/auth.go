@@ -6,36 +6,68 @@ import (
 
 	"github.com/rnov/Go-REST/pkg/auth"
 	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
 )
 
 const (
-	authHeader = "Authorization"
-	basic      = "Basic"
+	authHeader   = "Authorization"
+	apiKeyHeader = "X-API-Key"
 )
 
-// Authentication - custom HTTP middleware that validates user's basic auth.
+// Authentication - custom HTTP middleware that validates user's credentials, either basic auth, a bearer token or an API
+// key as enabled by the validator. The authenticated user is passed on to next through the request context (see
+// identity.FromContext).
 func Authentication(auth auth.Validator, next func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var basicAuth string
-		ah := r.Header.Get(authHeader)
-		basicAuth, valid := validateAuthStructure(ah)
+		scheme, credentials, valid := Credentials(r)
 		if !valid {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
-		if err := auth.Validate(basicAuth); err != nil {
-			errors.BuildResponse(w, r.Method, err)
+		principal, err := auth.Validate(r.Context(), scheme, credentials)
+		if err != nil {
+			buildResponse(w, r, err)
+			return
+		}
+		recordPrincipal(r, principal)
+		next(w, r.WithContext(identity.NewContext(r.Context(), principal)))
+	}
+}
+
+// Authorization - custom HTTP middleware that checks that the authenticated user has been granted the permission, it
+// has to be wrapped by Authentication.
+func Authorization(perm identity.Permission, next func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := identity.FromContext(r.Context())
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if !principal.Can(perm) {
+			buildResponse(w, r, errors.NewForbiddenErr())
 			return
 		}
 		next(w, r)
 	}
 }
 
-// validateAuthStructure - validates that the authorization header value provided by the user has a valid structure.
-func validateAuthStructure(ah string) (string, bool) {
-	if res := strings.Split(ah, " "); res[0] == basic && len(res) == 2 {
-		return res[1], true
+// Credentials - splits the authorization header value provided by the user into the scheme and the credentials, the
+// scheme is lower cased since it is case insensitive. Requests without authorization header are authenticated by their
+// API key header, if any, under the auth.APIKey scheme, or otherwise by the subject of their client certificate under
+// the auth.ClientCert scheme as long as the certificate has been verified by the server.
+func Credentials(r *http.Request) (string, string, bool) {
+	if len(r.Header.Get(authHeader)) == 0 {
+		if key := r.Header.Get(apiKeyHeader); len(key) > 0 {
+			return auth.APIKey, key, true
+		}
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			return auth.ClientCert, r.TLS.VerifiedChains[0][0].Subject.String(), true
+		}
+		return auth.APIKey, "", false
+	}
+	if res := strings.Split(r.Header.Get(authHeader), " "); len(res) == 2 && len(res[0]) > 0 && len(res[1]) > 0 {
+		return strings.ToLower(res[0]), res[1], true
 	}
 
-	return "", false
+	return "", "", false
 }
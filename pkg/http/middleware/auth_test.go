@@ -1,21 +1,26 @@
 package middleware
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/gorilla/mux"
 	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
 )
 
 type validatorMock struct {
-	validate func(ba string) error
+	validate func(scheme, credentials string) (*identity.Principal, error)
 }
 
-func (am *validatorMock) Validate(BA string) error {
+func (am *validatorMock) Validate(ctx context.Context, scheme, credentials string) (*identity.Principal, error) {
 	if am.validate != nil {
-		return am.validate(BA)
+		return am.validate(scheme, credentials)
 	}
 	panic("Not implemented")
 }
@@ -26,22 +31,105 @@ func TestAuthentication(t *testing.T) {
 		auth           validatorMock
 		AuthHeader     bool
 		Auth           string
+		APIKey         string
+		ClientCert     *pkix.Name
 		next           func(w http.ResponseWriter, r *http.Request)
 		expectedStatus int
 	}{
 		{
 			name: "successful validation",
 			auth: validatorMock{
-				validate: func(ba string) error {
-					return nil
+				validate: func(scheme, credentials string) (*identity.Principal, error) {
+					if scheme != "basic" || credentials != "dXNlcm5hbWU6cGFzc3dvcmQ=" {
+						return nil, errors.NewFailedAuthErr()
+					}
+					return &identity.Principal{Username: "username", Role: identity.Reader}, nil
 				},
 			},
 			AuthHeader: true,
 			Auth:       "Basic dXNlcm5hbWU6cGFzc3dvcmQ=",
 			next: func(w http.ResponseWriter, r *http.Request) {
+				// the principal is passed on to the handler
+				if p, ok := identity.FromContext(r.Context()); !ok || p.Username != "username" {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
 			},
 			expectedStatus: 200,
 		},
+		{
+			name: "successful validation - bearer token",
+			auth: validatorMock{
+				validate: func(scheme, credentials string) (*identity.Principal, error) {
+					if scheme != "bearer" || credentials != "eyJhbGciOiJIUzI1NiJ9.e30.c2ln" {
+						return nil, errors.NewFailedAuthErr()
+					}
+					return &identity.Principal{Username: "username", Role: identity.Reader}, nil
+				},
+			},
+			AuthHeader:     true,
+			Auth:           "Bearer eyJhbGciOiJIUzI1NiJ9.e30.c2ln",
+			next:           func(w http.ResponseWriter, r *http.Request) {},
+			expectedStatus: 200,
+		},
+		{
+			name: "successful validation - API key",
+			auth: validatorMock{
+				validate: func(scheme, credentials string) (*identity.Principal, error) {
+					if scheme != "apikey" || credentials != "01EC9V3P6Y8B8XWJ2Q3KZ4M5N6.c2VjcmV0" {
+						return nil, errors.NewFailedAuthErr()
+					}
+					return &identity.Principal{Username: "apikey:01EC9V3P6Y8B8XWJ2Q3KZ4M5N6", Role: identity.Reader}, nil
+				},
+			},
+			APIKey:         "01EC9V3P6Y8B8XWJ2Q3KZ4M5N6.c2VjcmV0",
+			next:           func(w http.ResponseWriter, r *http.Request) {},
+			expectedStatus: 200,
+		},
+		{
+			name: "successful validation - authorization header takes precedence over API key",
+			auth: validatorMock{
+				validate: func(scheme, credentials string) (*identity.Principal, error) {
+					if scheme != "basic" {
+						return nil, errors.NewFailedAuthErr()
+					}
+					return &identity.Principal{Username: "username", Role: identity.Reader}, nil
+				},
+			},
+			AuthHeader:     true,
+			Auth:           "Basic dXNlcm5hbWU6cGFzc3dvcmQ=",
+			APIKey:         "01EC9V3P6Y8B8XWJ2Q3KZ4M5N6.c2VjcmV0",
+			next:           func(w http.ResponseWriter, r *http.Request) {},
+			expectedStatus: 200,
+		},
+		{
+			name: "successful validation - client certificate",
+			auth: validatorMock{
+				validate: func(scheme, credentials string) (*identity.Principal, error) {
+					if scheme != "clientcert" || credentials != "CN=ci,O=Acme" {
+						return nil, errors.NewFailedAuthErr()
+					}
+					return &identity.Principal{Username: "ci", Role: identity.Editor}, nil
+				},
+			},
+			ClientCert:     &pkix.Name{CommonName: "ci", Organization: []string{"Acme"}},
+			next:           func(w http.ResponseWriter, r *http.Request) {},
+			expectedStatus: 200,
+		},
+		{
+			name: "successful validation - API key takes precedence over client certificate",
+			auth: validatorMock{
+				validate: func(scheme, credentials string) (*identity.Principal, error) {
+					if scheme != "apikey" {
+						return nil, errors.NewFailedAuthErr()
+					}
+					return &identity.Principal{Username: "apikey:01EC9V3P6Y8B8XWJ2Q3KZ4M5N6", Role: identity.Reader}, nil
+				},
+			},
+			APIKey:         "01EC9V3P6Y8B8XWJ2Q3KZ4M5N6.c2VjcmV0",
+			ClientCert:     &pkix.Name{CommonName: "ci", Organization: []string{"Acme"}},
+			next:           func(w http.ResponseWriter, r *http.Request) {},
+			expectedStatus: 200,
+		},
 		{
 			name:           "error - not valid auth structure",
 			AuthHeader:     true,
@@ -56,8 +144,8 @@ func TestAuthentication(t *testing.T) {
 			name: "error - non existent auth",
 			Auth: "basic dXNlcm5hbWU6cGFzc3dvcmQ=",
 			auth: validatorMock{
-				validate: func(ba string) error {
-					return errors.NewFailedAuthErr()
+				validate: func(scheme, credentials string) (*identity.Principal, error) {
+					return nil, errors.NewFailedAuthErr()
 				},
 			},
 			AuthHeader:     true,
@@ -72,6 +160,14 @@ func TestAuthentication(t *testing.T) {
 				t.Fatal(err)
 			}
 			req.Header.Add(authHeader, test.Auth)
+			if len(test.APIKey) > 0 {
+				req.Header.Add(apiKeyHeader, test.APIKey)
+			}
+			if test.ClientCert != nil {
+				cert := &x509.Certificate{Subject: *test.ClientCert}
+				req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert},
+					VerifiedChains: [][]*x509.Certificate{{cert}}}
+			}
 
 			// We create a ResponseRecorder (which satisfies http.ResponseWriter) to record the response.
 			rr := httptest.NewRecorder()
@@ -89,3 +185,49 @@ func TestAuthentication(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthorization(t *testing.T) {
+	tests := []struct {
+		name           string
+		principal      *identity.Principal
+		perm           identity.Permission
+		expectedStatus int
+	}{
+		{
+			name:           "successful authorization",
+			principal:      &identity.Principal{Username: "chef", Role: identity.Editor},
+			perm:           identity.CreateRecipe,
+			expectedStatus: 200,
+		},
+		{
+			name:           "error - permission not granted",
+			principal:      &identity.Principal{Username: "chef", Role: identity.Reader},
+			perm:           identity.CreateRecipe,
+			expectedStatus: 403,
+		},
+		{
+			name:           "error - not authenticated",
+			perm:           identity.CreateRecipe,
+			expectedStatus: 401,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/recipes", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.principal != nil {
+				req = req.WithContext(identity.NewContext(req.Context(), test.principal))
+			}
+
+			rr := httptest.NewRecorder()
+			Authorization(test.perm, func(w http.ResponseWriter, r *http.Request) {})(rr, req)
+
+			if rr.Code != test.expectedStatus {
+				t.Errorf("handler returned wrong status code: expected %v got %v", test.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/metrics"
+)
+
+// unmatchedRoute - route of the requests that have not matched any, their path is not recorded as it is up to the
+// clients.
+const unmatchedRoute = "unmatched"
+
+// Metrics - custom HTTP middleware that records every request served, along with its route template, status and
+// duration.
+func Metrics(m *metrics.Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w}
+
+			next.ServeHTTP(sw, r)
+
+			route, ok := routeTemplate(r)
+			if !ok {
+				route = unmatchedRoute
+			}
+			m.ObserveRequest(r.Method, route, sw.statusCode(), time.Since(start))
+		})
+	}
+}
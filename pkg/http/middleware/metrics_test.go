@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/rnov/Go-REST/pkg/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	m := metrics.New()
+	instrumented := Metrics(m)
+	router := mux.NewRouter()
+	router.Use(instrumented)
+	router.NotFoundHandler = instrumented(http.NotFoundHandler())
+	router.HandleFunc("/recipes/{ID}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("recipe"))
+	}).Methods("GET")
+	router.HandleFunc("/recipes/{ID}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods("DELETE")
+
+	requests := []struct {
+		method string
+		url    string
+	}{
+		{method: "GET", url: "/recipes/5f10223c"},
+		{method: "GET", url: "/recipes/5f10223d"},
+		{method: "DELETE", url: "/recipes/5f10223c"},
+		{method: "GET", url: "/unknown/5f10223c"},
+	}
+	for _, request := range requests {
+		req, err := http.NewRequest(request.method, request.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	rr := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := ioutil.ReadAll(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// requests are recorded by route template, the path of unmatched ones is left out
+	for _, sample := range []string{
+		`gorest_http_requests_total{method="GET",route="/recipes/{ID}",status="200"} 2`,
+		`gorest_http_requests_total{method="DELETE",route="/recipes/{ID}",status="204"} 1`,
+		`gorest_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`gorest_http_request_duration_seconds_count{method="GET",route="/recipes/{ID}",status="200"} 2`,
+	} {
+		if !strings.Contains(string(body), sample+"\n") {
+			t.Errorf("expected sample: '%s' instead got: '%s'", sample, body)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
+	"github.com/rnov/Go-REST/pkg/ratelimit"
+)
+
+const (
+	retryAfterHeader = "Retry-After"
+	limitHeader      = "RateLimit-Limit"
+	remainingHeader  = "RateLimit-Remaining"
+	resetHeader      = "RateLimit-Reset"
+)
+
+// RateLimit - custom HTTP middleware that limits the requests each client makes to the route, rejected requests get
+// 429 Too Many Requests along with the time to wait before retrying. Authenticated users are told apart by their
+// username, hence it has to be wrapped by Authentication on protected routes, anonymous ones by their address.
+func RateLimit(limiter ratelimit.Allower, next func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		res, err := limiter.Allow(Route(r), client(r))
+		if err != nil {
+			buildResponse(w, r, errors.NewDBErr("error checking rate limit: "+err.Error()))
+			return
+		}
+		if res == nil {
+			next(w, r)
+			return
+		}
+		w.Header().Set(limitHeader, strconv.Itoa(res.Limit))
+		w.Header().Set(remainingHeader, strconv.Itoa(res.Remaining))
+		w.Header().Set(resetHeader, seconds(res.Reset))
+		if !res.Allowed {
+			w.Header().Set(retryAfterHeader, seconds(res.RetryAfter))
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// AuthenticationLimit - custom HTTP middleware that limits the requests each address makes to the protected routes
+// before their credentials are checked, by the ratelimit.Authentication limit shared by all those routes. Rejected
+// requests get 429 Too Many Requests along with Retry-After, the RateLimit-* headers are left to the limit of the route.
+func AuthenticationLimit(limiter ratelimit.Allower, next func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		res, err := limiter.Allow(ratelimit.Authentication, "ip:"+address(r))
+		if err != nil {
+			buildResponse(w, r, errors.NewDBErr("error checking rate limit: "+err.Error()))
+			return
+		}
+		if res != nil && !res.Allowed {
+			w.Header().Set(retryAfterHeader, seconds(res.RetryAfter))
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Route - names the route matched by the request after its method and path template, e.g. "GET /recipes/{ID}", the
+// request path is taken when no route has been matched.
+func Route(r *http.Request) string {
+	return r.Method + " " + pathTemplate(r)
+}
+
+// pathTemplate - path template of the route matched by the request, the request path when none has been matched.
+func pathTemplate(r *http.Request) string {
+	if tpl, ok := routeTemplate(r); ok {
+		return tpl
+	}
+	return r.URL.Path
+}
+
+// routeTemplate - path template of the route matched by the request, false when none has been matched.
+func routeTemplate(r *http.Request) (string, bool) {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tpl, err := route.GetPathTemplate(); err == nil {
+			return tpl, true
+		}
+	}
+	return "", false
+}
+
+// client - identifies the client making the request, by its username when authenticated or its address otherwise.
+func client(r *http.Request) string {
+	if p, ok := identity.FromContext(r.Context()); ok {
+		return "user:" + p.Username
+	}
+	return "ip:" + address(r)
+}
+
+// address - host the request comes from.
+func address(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// seconds - whole seconds rounded up, as expected by the rate limit headers.
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
@@ -0,0 +1,193 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/rnov/Go-REST/pkg/identity"
+	"github.com/rnov/Go-REST/pkg/ratelimit"
+)
+
+type allowerMock struct {
+	allow func(route, client string) (*ratelimit.Result, error)
+}
+
+func (am *allowerMock) Allow(route, client string) (*ratelimit.Result, error) {
+	if am.allow != nil {
+		return am.allow(route, client)
+	}
+	panic("Not implemented")
+}
+
+func TestAuthenticationLimit(t *testing.T) {
+	tests := []struct {
+		name            string
+		limiter         allowerMock
+		expectedStatus  int
+		expectedHeaders map[string]string
+	}{
+		{
+			name: "allowed",
+			limiter: allowerMock{
+				allow: func(route, client string) (*ratelimit.Result, error) {
+					if route != ratelimit.Authentication || client != "ip:192.0.2.1" {
+						return nil, errors.New("unexpected route or client")
+					}
+					return &ratelimit.Result{Allowed: true, Limit: 10, Remaining: 9, Reset: time.Second}, nil
+				},
+			},
+			expectedStatus:  http.StatusOK,
+			expectedHeaders: map[string]string{limitHeader: "", remainingHeader: "", retryAfterHeader: ""},
+		},
+		{
+			name: "allowed - not limited",
+			limiter: allowerMock{
+				allow: func(route, client string) (*ratelimit.Result, error) {
+					return nil, nil
+				},
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "error - too many requests",
+			limiter: allowerMock{
+				allow: func(route, client string) (*ratelimit.Result, error) {
+					return &ratelimit.Result{Limit: 10, Reset: 10 * time.Second, RetryAfter: 200 * time.Millisecond}, nil
+				},
+			},
+			expectedStatus:  http.StatusTooManyRequests,
+			expectedHeaders: map[string]string{limitHeader: "", retryAfterHeader: "1"},
+		},
+		{
+			name: "error - store unavailable",
+			limiter: allowerMock{
+				allow: func(route, client string) (*ratelimit.Result, error) {
+					return nil, errors.New("connection refused")
+				},
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/recipes", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.RemoteAddr = "192.0.2.1:1234"
+
+			rr := httptest.NewRecorder()
+			next := func(w http.ResponseWriter, r *http.Request) {}
+			AuthenticationLimit(&test.limiter, next)(rr, req)
+
+			if rr.Code != test.expectedStatus {
+				t.Errorf("handler returned wrong status code: expected %v got %v", test.expectedStatus, rr.Code)
+			}
+			for header, expected := range test.expectedHeaders {
+				if got := rr.Header().Get(header); got != expected {
+					t.Errorf("expected %s: '%s' instead got: '%s'", header, expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	tests := []struct {
+		name            string
+		limiter         allowerMock
+		principal       *identity.Principal
+		expectedStatus  int
+		expectedHeaders map[string]string
+	}{
+		{
+			name: "allowed - anonymous client",
+			limiter: allowerMock{
+				allow: func(route, client string) (*ratelimit.Result, error) {
+					if route != "GET /recipes/{ID}" || client != "ip:192.0.2.1" {
+						return nil, errors.New("unexpected route or client")
+					}
+					return &ratelimit.Result{Allowed: true, Limit: 10, Remaining: 9, Reset: 1500 * time.Millisecond}, nil
+				},
+			},
+			expectedStatus:  http.StatusOK,
+			expectedHeaders: map[string]string{limitHeader: "10", remainingHeader: "9", resetHeader: "2", retryAfterHeader: ""},
+		},
+		{
+			name: "allowed - authenticated user",
+			limiter: allowerMock{
+				allow: func(route, client string) (*ratelimit.Result, error) {
+					if client != "user:chef" {
+						return nil, errors.New("unexpected client")
+					}
+					return &ratelimit.Result{Allowed: true, Limit: 10, Remaining: 9, Reset: time.Second}, nil
+				},
+			},
+			principal:      &identity.Principal{Username: "chef", Role: identity.Reader},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "allowed - route not limited",
+			limiter: allowerMock{
+				allow: func(route, client string) (*ratelimit.Result, error) {
+					return nil, nil
+				},
+			},
+			expectedStatus:  http.StatusOK,
+			expectedHeaders: map[string]string{limitHeader: "", remainingHeader: ""},
+		},
+		{
+			name: "error - too many requests",
+			limiter: allowerMock{
+				allow: func(route, client string) (*ratelimit.Result, error) {
+					return &ratelimit.Result{Limit: 10, Reset: 10 * time.Second, RetryAfter: 200 * time.Millisecond}, nil
+				},
+			},
+			expectedStatus:  http.StatusTooManyRequests,
+			expectedHeaders: map[string]string{limitHeader: "10", remainingHeader: "0", resetHeader: "10", retryAfterHeader: "1"},
+		},
+		{
+			name: "error - store unavailable",
+			limiter: allowerMock{
+				allow: func(route, client string) (*ratelimit.Result, error) {
+					return nil, errors.New("connection refused")
+				},
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/recipes/5f10223c", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.RemoteAddr = "192.0.2.1:1234"
+			if test.principal != nil {
+				req = req.WithContext(identity.NewContext(req.Context(), test.principal))
+			}
+
+			rr := httptest.NewRecorder()
+			servicesRouter := mux.NewRouter()
+			next := func(w http.ResponseWriter, r *http.Request) {}
+			servicesRouter.HandleFunc("/recipes/{ID}", RateLimit(&test.limiter, next)).Methods("GET")
+			servicesRouter.ServeHTTP(rr, req)
+
+			if rr.Code != test.expectedStatus {
+				t.Errorf("handler returned wrong status code: expected %v got %v", test.expectedStatus, rr.Code)
+			}
+			for header, expected := range test.expectedHeaders {
+				if got := rr.Header().Get(header); got != expected {
+					t.Errorf("expected %s: '%s' instead got: '%s'", header, expected, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/rnov/Go-REST/pkg/id"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	// maxRequestIDLen - IDs provided by the clients longer than this are replaced.
+	maxRequestIDLen = 128
+)
+
+type requestIDKey struct{}
+
+// RequestID - custom HTTP middleware that propagates the X-Request-ID header of the request, a new ID is assigned
+// whenever it is missing or malformed. The ID is sent back in the response header and passed on through the request
+// context (see RequestIDFromContext).
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqID := r.Header.Get(requestIDHeader)
+		if !validRequestID(reqID) {
+			// IDs are generated out of random bits, an error means there is no entropy left to rely on
+			var err error
+			if reqID, err = id.New(); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+		w.Header().Set(requestIDHeader, reqID)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, reqID)))
+	})
+}
+
+// RequestIDFromContext - the ID of the request ctx belongs to, empty unless set by RequestID.
+func RequestIDFromContext(ctx context.Context) string {
+	reqID, _ := ctx.Value(requestIDKey{}).(string)
+	return reqID
+}
+
+// validRequestID - IDs are made of printable ASCII characters but spaces, so that they can be logged as they are.
+func validRequestID(reqID string) bool {
+	if len(reqID) == 0 || len(reqID) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(reqID); i++ {
+		if reqID[i] <= ' ' || reqID[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
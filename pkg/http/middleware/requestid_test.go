@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID string
+		expected  string
+	}{
+		{name: "propagated", requestID: "4bf92f3577b34da6", expected: "4bf92f3577b34da6"},
+		{name: "assigned when missing"},
+		{name: "replaced when malformed", requestID: "id with spaces"},
+		{name: "replaced when too long", requestID: strings.Repeat("a", maxRequestIDLen+1)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/recipes", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(test.requestID) > 0 {
+				req.Header.Set(requestIDHeader, test.requestID)
+			}
+			var got string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = RequestIDFromContext(r.Context())
+			})
+			rr := httptest.NewRecorder()
+			RequestID(next).ServeHTTP(rr, req)
+
+			if len(test.expected) > 0 && got != test.expected {
+				t.Errorf("expected: '%s' instead got: '%s'", test.expected, got)
+			}
+			if len(test.expected) == 0 && (len(got) != 26 || got == test.requestID) {
+				t.Errorf("expected a new ID instead got: '%s'", got)
+			}
+			if header := rr.Header().Get(requestIDHeader); header != got {
+				t.Errorf("expected response header: '%s' instead got: '%s'", got, header)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/rnov/Go-REST/pkg/tracing"
+)
+
+// Tracing - custom HTTP middleware that serves every request within a span named after its route, e.g.
+// "GET /recipes/{ID}". The span continues the trace propagated by the client in the traceparent header, if any, and is
+// passed on to the handler through the request context.
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the route is left out of the attributes of the requests that have not matched any
+		route, _ := routeTemplate(r)
+		name := r.Method + " " + route
+		if len(route) == 0 {
+			name = r.Method + " " + unmatchedRoute
+		}
+		ctx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("", route, r)...))
+		defer span.End()
+		sw := &statusWriter{ResponseWriter: w}
+
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		status := sw.statusCode()
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(status)...)
+		// client errors are the outcome of the request rather than a failure to serve it
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
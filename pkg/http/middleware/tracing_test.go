@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		tp.Shutdown(context.Background())
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	}()
+
+	router := mux.NewRouter()
+	router.Use(Tracing)
+	router.NotFoundHandler = Tracing(http.NotFoundHandler())
+	var handlerTraceID trace.TraceID
+	router.HandleFunc("/recipes/{ID}", func(w http.ResponseWriter, r *http.Request) {
+		handlerTraceID = trace.SpanContextFromContext(r.Context()).TraceID()
+		w.Write([]byte("recipe"))
+	}).Methods("GET")
+	router.HandleFunc("/recipes/{ID}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}).Methods("DELETE")
+
+	tests := map[string]struct {
+		method         string
+		url            string
+		traceparent    string
+		expectedName   string
+		expectedStatus codes.Code
+		// handled - whether the request reaches the handler recording the trace it is given
+		handled bool
+	}{
+		"propagated trace": {
+			method:         "GET",
+			url:            "/recipes/5f10223c",
+			traceparent:    "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			expectedName:   "GET /recipes/{ID}",
+			expectedStatus: codes.Unset,
+			handled:        true,
+		},
+		"new trace": {
+			method:         "GET",
+			url:            "/recipes/5f10223c",
+			expectedName:   "GET /recipes/{ID}",
+			expectedStatus: codes.Unset,
+			handled:        true,
+		},
+		"server error": {
+			method:         "DELETE",
+			url:            "/recipes/5f10223c",
+			expectedName:   "DELETE /recipes/{ID}",
+			expectedStatus: codes.Error,
+		},
+		"unmatched route": {
+			method:         "GET",
+			url:            "/unknown/5f10223c",
+			expectedName:   "GET unmatched",
+			expectedStatus: codes.Unset,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			exporter.Reset()
+			handlerTraceID = trace.TraceID{}
+			req := httptest.NewRequest(test.method, test.url, nil)
+			if len(test.traceparent) > 0 {
+				req.Header.Set("traceparent", test.traceparent)
+			}
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			spans := exporter.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("expected a single span, instead got: '%d'", len(spans))
+			}
+			span := spans[0]
+			if span.Name != test.expectedName {
+				t.Errorf("expected span: '%s' instead got: '%s'", test.expectedName, span.Name)
+			}
+			if span.SpanKind != trace.SpanKindServer {
+				t.Errorf("expected a server span, instead got: '%v'", span.SpanKind)
+			}
+			if span.StatusCode != test.expectedStatus {
+				t.Errorf("expected status: '%v' instead got: '%v'", test.expectedStatus, span.StatusCode)
+			}
+			if len(test.traceparent) > 0 {
+				if traceID := span.SpanContext.TraceID().String(); traceID != test.traceparent[3:35] {
+					t.Errorf("expected the trace of the client: '%s' instead got: '%s'", test.traceparent[3:35], traceID)
+				}
+				if parent := span.Parent.SpanID().String(); parent != test.traceparent[36:52] {
+					t.Errorf("expected the span of the client: '%s' as parent, instead got: '%s'", test.traceparent[36:52], parent)
+				}
+			}
+			if test.handled && handlerTraceID != span.SpanContext.TraceID() {
+				t.Errorf("expected the handler to be given the span, instead got trace: '%s'", handlerTraceID)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+
+	"github.com/rnov/Go-REST/pkg/apikey"
+	"github.com/rnov/Go-REST/pkg/logger"
+	"github.com/rnov/Go-REST/pkg/service"
+)
+
+const (
+	apiKeyID = "ID"
+)
+
+// APIKeyHandler - manages the API keys, its routes are restricted to admins.
+type APIKeyHandler struct {
+	keySrv service.APIKeyMng
+	log    logger.Loggers
+}
+
+func NewAPIKeyHandler(keySrv service.APIKeyMng, l logger.Loggers) *APIKeyHandler {
+	keyHandler := &APIKeyHandler{
+		keySrv: keySrv,
+		log:    l,
+	}
+	return keyHandler
+}
+
+// CreateAPIKey - the response carries the key, it is the only time it is shown.
+func (kh *APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	key := &apikey.Key{}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(key); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := kh.keySrv.Create(r.Context(), key, principal(r)); err != nil {
+		buildResponse(w, r, kh.log, err)
+		return
+	}
+
+	w.Header().Set("Location", "/apikeys/"+url.PathEscape(key.ID))
+	kh.writeKey(w, r, http.StatusCreated, key)
+}
+
+// GetAPIKeys - lists the keys without their secret, which is never stored.
+func (kh *APIKeyHandler) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := kh.keySrv.List(r.Context())
+	if err != nil {
+		buildResponse(w, r, kh.log, err)
+		return
+	}
+
+	body, err := json.Marshal(keys)
+	if err != nil {
+		requestLog(r, kh.log).Errorf("system error: %s", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// RotateAPIKey - the response carries the new key, the previous one is no longer accepted. A rotation racing another one
+// of the same key is answered with 412 Precondition Failed.
+func (kh *APIKeyHandler) RotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	ID := mux.Vars(r)[apiKeyID]
+	if len(ID) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	key, err := kh.keySrv.Rotate(r.Context(), ID)
+	if err != nil {
+		buildResponse(w, r, kh.log, err)
+		return
+	}
+
+	kh.writeKey(w, r, http.StatusOK, key)
+}
+
+func (kh *APIKeyHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	ID := mux.Vars(r)[apiKeyID]
+	if len(ID) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := kh.keySrv.Revoke(r.Context(), ID); err != nil {
+		buildResponse(w, r, kh.log, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeKey - responses carrying a secret must not be cached.
+func (kh *APIKeyHandler) writeKey(w http.ResponseWriter, r *http.Request, status int, key *apikey.Key) {
+	body, err := json.Marshal(key)
+	if err != nil {
+		requestLog(r, kh.log).Errorf("system error: %s", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(body)
+}
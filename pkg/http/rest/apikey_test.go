@@ -0,0 +1,203 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/rnov/Go-REST/pkg/apikey"
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
+	"github.com/rnov/Go-REST/pkg/logger"
+)
+
+type apiKeyServiceMock struct {
+	create func(key *apikey.Key, user *identity.Principal) error
+	list   func() ([]*apikey.Key, error)
+	rotate func(ID string) (*apikey.Key, error)
+	revoke func(ID string) error
+}
+
+func (am *apiKeyServiceMock) Create(ctx context.Context, key *apikey.Key, user *identity.Principal) error {
+	if am.create != nil {
+		return am.create(key, user)
+	}
+	panic("Not implemented")
+}
+
+func (am *apiKeyServiceMock) List(ctx context.Context) ([]*apikey.Key, error) {
+	if am.list != nil {
+		return am.list()
+	}
+	panic("Not implemented")
+}
+
+func (am *apiKeyServiceMock) Rotate(ctx context.Context, ID string) (*apikey.Key, error) {
+	if am.rotate != nil {
+		return am.rotate(ID)
+	}
+	panic("Not implemented")
+}
+
+func (am *apiKeyServiceMock) Revoke(ctx context.Context, ID string) error {
+	if am.revoke != nil {
+		return am.revoke(ID)
+	}
+	panic("Not implemented")
+}
+
+func TestAPIKeyHandler(t *testing.T) {
+	const ID = "01EC9V3P6Y8B8XWJ2Q3KZ4M5N6"
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		body           string
+		service        apiKeyServiceMock
+		status         int
+		expectedSecret string
+		expectedBody   string
+	}{
+		{
+			name:   "successful create",
+			method: "POST",
+			url:    "/apikeys",
+			body:   `{"name":"ci","role":"editor","scopes":["recipe:create"]}`,
+			service: apiKeyServiceMock{
+				create: func(key *apikey.Key, user *identity.Principal) error {
+					if key.Name != "ci" || key.Role != identity.Editor || len(key.Scopes) != 1 {
+						return errors.NewInputError("unexpected key", nil)
+					}
+					key.ID, key.Secret, key.Hash = ID, ID+".c2VjcmV0", "hash"
+					return nil
+				},
+			},
+			status:         http.StatusCreated,
+			expectedSecret: ID + ".c2VjcmV0",
+		},
+		{
+			name:   "error - create unknown field",
+			method: "POST",
+			url:    "/apikeys",
+			body:   `{"name":"ci","hash":"hash"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "error - create invalid key",
+			method: "POST",
+			url:    "/apikeys",
+			body:   `{"name":"","role":"root"}`,
+			service: apiKeyServiceMock{
+				create: func(key *apikey.Key, user *identity.Principal) error {
+					return errors.NewInputError("Invalid input parameters", map[string]string{errors.Role: errors.Invalid})
+				},
+			},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "successful list",
+			method: "GET",
+			url:    "/apikeys",
+			service: apiKeyServiceMock{
+				list: func() ([]*apikey.Key, error) {
+					return []*apikey.Key{{ID: ID, Name: "ci", Role: identity.Reader, Hash: "hash"}}, nil
+				},
+			},
+			status:       http.StatusOK,
+			expectedBody: `[{"id":"01EC9V3P6Y8B8XWJ2Q3KZ4M5N6","name":"ci","role":"reader","createdBy":"","createdAt":"0001-01-01T00:00:00Z"}]`,
+		},
+		{
+			name:   "successful rotate",
+			method: "POST",
+			url:    "/apikeys/" + ID + ":rotate",
+			service: apiKeyServiceMock{
+				rotate: func(keyID string) (*apikey.Key, error) {
+					if keyID != ID {
+						return nil, errors.NewExistErr(false)
+					}
+					return &apikey.Key{ID: ID, Secret: ID + ".cm90YXRlZA", Hash: "hash"}, nil
+				},
+			},
+			status:         http.StatusOK,
+			expectedSecret: ID + ".cm90YXRlZA",
+		},
+		{
+			name:   "error - rotate missing key",
+			method: "POST",
+			url:    "/apikeys/" + ID + ":rotate",
+			service: apiKeyServiceMock{
+				rotate: func(keyID string) (*apikey.Key, error) {
+					return nil, errors.NewExistErr(false)
+				},
+			},
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "successful revoke",
+			method: "DELETE",
+			url:    "/apikeys/" + ID,
+			service: apiKeyServiceMock{
+				revoke: func(keyID string) error {
+					if keyID != ID {
+						return errors.NewExistErr(false)
+					}
+					return nil
+				},
+			},
+			status: http.StatusNoContent,
+		},
+		{
+			name:   "error - revoke missing key",
+			method: "DELETE",
+			url:    "/apikeys/" + ID,
+			service: apiKeyServiceMock{
+				revoke: func(keyID string) error {
+					return errors.NewExistErr(false)
+				},
+			},
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := logger.NewLogger()
+			req, err := http.NewRequest(test.method, test.url, strings.NewReader(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			kh := NewAPIKeyHandler(&test.service, l)
+
+			rr := httptest.NewRecorder()
+			servicesRouter := mux.NewRouter()
+			servicesRouter.HandleFunc("/apikeys", kh.GetAPIKeys).Methods("GET")
+			servicesRouter.HandleFunc("/apikeys", kh.CreateAPIKey).Methods("POST")
+			servicesRouter.HandleFunc("/apikeys/{ID}:rotate", kh.RotateAPIKey).Methods("POST")
+			servicesRouter.HandleFunc("/apikeys/{ID}", kh.RevokeAPIKey).Methods("DELETE")
+			servicesRouter.ServeHTTP(rr, req)
+
+			if rr.Code != test.status {
+				t.Errorf("handler returned wrong status code: expected %v got %v", test.status, rr.Code)
+			}
+			if len(test.expectedBody) > 0 && strings.TrimSpace(rr.Body.String()) != test.expectedBody {
+				t.Errorf("expected: '%s' instead got: '%s'", test.expectedBody, rr.Body.String())
+			}
+			if len(test.expectedSecret) == 0 {
+				return
+			}
+			key := make(map[string]interface{})
+			if err := json.Unmarshal(rr.Body.Bytes(), &key); err != nil {
+				t.Fatalf("error unmarshalling key: %s", err)
+			}
+			if key["key"] != test.expectedSecret || key["hash"] != nil || rr.Header().Get("Cache-Control") != "no-store" {
+				t.Errorf("unexpected key: '%v'", key)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rnov/Go-REST/pkg/auth"
+	"github.com/rnov/Go-REST/pkg/errors"
+	mid "github.com/rnov/Go-REST/pkg/http/middleware"
+	"github.com/rnov/Go-REST/pkg/logger"
+)
+
+// form parameters of the token requests, as named by RFC 6749.
+const (
+	grantTypeParam    = "grant_type"
+	refreshTokenParam = "refresh_token"
+	refreshGrant      = "refresh_token"
+)
+
+// AuthHandler - issues bearer tokens.
+type AuthHandler struct {
+	issuer auth.Issuer
+	log    logger.Loggers
+}
+
+// NewAuthHandler
+func NewAuthHandler(issuer auth.Issuer, l logger.Loggers) *AuthHandler {
+	authHandler := &AuthHandler{
+		issuer: issuer,
+		log:    l,
+	}
+	return authHandler
+}
+
+// CreateToken - exchanges the basic auth credentials for a bearer token, or renews it given the refresh_token grant
+// (RFC 6749 section 6) along with the refresh token. Parameters are form encoded.
+func (ah *AuthHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var token *auth.Token
+	var err error
+	switch r.PostForm.Get(grantTypeParam) {
+	case "":
+		scheme, credentials, ok := mid.Credentials(r)
+		if !ok || scheme != auth.Basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="gorest"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		token, err = ah.issuer.IssueToken(r.Context(), credentials)
+	case refreshGrant:
+		token, err = ah.issuer.RefreshToken(r.Context(), r.PostForm.Get(refreshTokenParam))
+	default:
+		err = errors.NewInputError("Invalid grant", map[string]string{errors.GrantType: errors.Invalid})
+	}
+	if err != nil {
+		buildResponse(w, r, ah.log, err)
+		return
+	}
+
+	body, err := json.Marshal(token)
+	if err != nil {
+		requestLog(r, ah.log).Errorf("system error: %s", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	// tokens must not be cached, RFC 6749 section 5.1
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
@@ -0,0 +1,416 @@
+package rest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/recipe"
+)
+
+// Media types of the batch documents, items are either one JSON recipe per line or one CSV row per recipe.
+const (
+	ndjsonType = "application/x-ndjson"
+	csvType    = "text/csv"
+)
+
+const (
+	// formatParam - query parameter choosing the export format, it takes precedence over the Accept header.
+	formatParam = "format"
+	// maxBatchBytes - size limit of a batch request body.
+	maxBatchBytes = 10 << 20
+	// exportFlush - recipes written between flushes of the export stream.
+	exportFlush = recipe.MaxLimit
+)
+
+// CSV columns of a recipe, named after their JSON counterpart. Tags, ingredients and steps are written as JSON arrays,
+// read only columns are exported but ignored on creation.
+var (
+	csvColumns = []string{"ID", recipe.FieldName, recipe.FieldPrepTime, recipe.FieldDifficulty, recipe.FieldVegetarian,
+		recipe.FieldServings, recipe.FieldCuisine, recipe.FieldTags, recipe.FieldIngredients, recipe.FieldSteps,
+		"averageRating", "ratingCount", "createdAt", "updatedAt", "version", "owner"}
+	csvReadOnly = map[string]bool{"averageRating": true, "ratingCount": true, "createdAt": true, "updatedAt": true,
+		"version": true, "owner": true}
+)
+
+// batchResult - outcome of a single item of a batch, Index is its zero based position in the request and Status the
+// code the item would have been responded with by POST /recipes.
+type batchResult struct {
+	Index      int               `json:"index"`
+	ID         string            `json:"ID,omitempty"`
+	Status     int               `json:"status"`
+	Error      string            `json:"error,omitempty"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// batchReport - per item report of a batch, results keep the order of the request items.
+type batchReport struct {
+	Created int           `json:"created"`
+	Failed  int           `json:"failed"`
+	Results []batchResult `json:"results"`
+}
+
+// BatchCreateRecipes - creates the recipes of a NDJSON or CSV body, as told by the Content-Type header. Items are
+// created independently, malformed or invalid ones do not prevent the rest from being created and the outcome of each
+// of them is reported.
+func (rh *RecipeHandler) BatchCreateRecipes(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != ndjsonType && mediaType != csvType) {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	body := http.MaxBytesReader(w, r.Body, maxBatchBytes)
+	var rcps []*recipe.Recipe
+	var errs []error
+	if mediaType == csvType {
+		rcps, errs, err = decodeCSV(body)
+	} else {
+		rcps, errs, err = decodeNDJSON(body)
+	}
+	if err != nil {
+		buildResponse(w, r, rh.log, err)
+		return
+	}
+
+	// only the well formed items are handed to the service
+	decoded := make([]*recipe.Recipe, 0, len(rcps))
+	positions := make([]int, 0, len(rcps))
+	for i, rcp := range rcps {
+		if errs[i] == nil {
+			decoded = append(decoded, rcp)
+			positions = append(positions, i)
+		}
+	}
+	if len(decoded) > 0 || len(rcps) == 0 {
+		created, err := rh.rcpSrv.CreateBatch(r.Context(), decoded, principal(r))
+		if err != nil {
+			buildResponse(w, r, rh.log, err)
+			return
+		}
+		for i, err := range created {
+			errs[positions[i]] = err
+		}
+	}
+
+	report := batchReport{Results: make([]batchResult, 0, len(rcps))}
+	for i, rcp := range rcps {
+		result := rh.itemResult(r, i, rcp, errs[i])
+		if errs[i] == nil {
+			report.Created++
+		} else {
+			report.Failed++
+		}
+		report.Results = append(report.Results, result)
+	}
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		requestLog(r, rh.log).Errorf("system error: %s", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(reportJSON)
+}
+
+// itemResult - builds the result of an item out of its error, DB errors are logged and reported without details.
+func (rh *RecipeHandler) itemResult(r *http.Request, index int, rcp *recipe.Recipe, err error) batchResult {
+	result := batchResult{Index: index, ID: rcp.ID}
+	if err == nil {
+		result.Status = http.StatusCreated
+		return result
+	}
+	status, toLog := errors.StatusCode(r.Method, err)
+	result.Status = status
+	switch e := err.(type) {
+	case *errors.InputErr:
+		result.Error, result.Parameters = e.Msg, e.Parameters
+	default:
+		if toLog {
+			requestLog(r, rh.log).Errorf("system error: %s", err.Error())
+			result.Error = http.StatusText(status)
+		} else {
+			result.Error = err.Error()
+		}
+	}
+	return result
+}
+
+// ExportRecipes - streams all the recipes matching the listing filters as NDJSON or CSV, the format is taken from the
+// format query parameter or the Accept header, NDJSON by default. Once the stream has started errors can no longer be
+// responded, they are logged and the stream is cut short.
+func (rh *RecipeHandler) ExportRecipes(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	mediaType, err := exportType(values.Get(formatParam), r.Header.Get("Accept"))
+	if err != nil {
+		buildResponse(w, r, rh.log, err)
+		return
+	}
+	query, err := parseListQuery(values)
+	if err != nil {
+		buildResponse(w, r, rh.log, err)
+		return
+	}
+
+	enc := newExportEncoder(w, mediaType)
+	written := 0
+	err = rh.rcpSrv.Export(r.Context(), query, func(rcp *recipe.Recipe) error {
+		if written == 0 {
+			if err := enc.start(); err != nil {
+				return err
+			}
+		}
+		if err := enc.encode(rcp); err != nil {
+			return err
+		}
+		written++
+		if written%exportFlush == 0 {
+			return enc.flush()
+		}
+		return nil
+	})
+	if err != nil && written == 0 {
+		buildResponse(w, r, rh.log, err)
+		return
+	}
+	if err != nil {
+		requestLog(r, rh.log).Errorf("export aborted after %d recipes: %s", written, err.Error())
+		return
+	}
+	if written == 0 {
+		if err := enc.start(); err != nil {
+			requestLog(r, rh.log).Errorf("system error: %s", err.Error())
+			return
+		}
+	}
+	if err := enc.flush(); err != nil {
+		requestLog(r, rh.log).Errorf("system error: %s", err.Error())
+	}
+}
+
+// exportType - media type of the export, the format parameter takes precedence over the Accept header.
+func exportType(format, accept string) (string, error) {
+	switch format {
+	case "ndjson":
+		return ndjsonType, nil
+	case "csv":
+		return csvType, nil
+	case "":
+	default:
+		return "", errors.NewInputError("Invalid query parameters", map[string]string{formatParam: errors.Invalid})
+	}
+	for _, mediaRange := range strings.Split(accept, ",") {
+		if mediaType, _, err := mime.ParseMediaType(mediaRange); err == nil && mediaType == csvType {
+			return csvType, nil
+		}
+	}
+	return ndjsonType, nil
+}
+
+// exportEncoder - writes the recipes of an export in the chosen format.
+type exportEncoder struct {
+	w           http.ResponseWriter
+	mediaType   string
+	csvWriter   *csv.Writer
+	jsonEncoder *json.Encoder
+}
+
+func newExportEncoder(w http.ResponseWriter, mediaType string) *exportEncoder {
+	enc := &exportEncoder{w: w, mediaType: mediaType}
+	if mediaType == csvType {
+		enc.csvWriter = csv.NewWriter(w)
+	} else {
+		enc.jsonEncoder = json.NewEncoder(w)
+	}
+	return enc
+}
+
+// start - writes the response headers, along with the CSV header row.
+func (enc *exportEncoder) start() error {
+	enc.w.Header().Set("Content-Type", enc.mediaType)
+	enc.w.WriteHeader(http.StatusOK)
+	if enc.csvWriter != nil {
+		return enc.csvWriter.Write(csvColumns)
+	}
+	return nil
+}
+
+func (enc *exportEncoder) encode(rcp *recipe.Recipe) error {
+	if enc.csvWriter != nil {
+		row, err := encodeCSVRow(rcp)
+		if err != nil {
+			return err
+		}
+		return enc.csvWriter.Write(row)
+	}
+	// the encoder terminates each recipe with a new line
+	return enc.jsonEncoder.Encode(rcp)
+}
+
+func (enc *exportEncoder) flush() error {
+	if enc.csvWriter != nil {
+		enc.csvWriter.Flush()
+		if err := enc.csvWriter.Error(); err != nil {
+			return err
+		}
+	}
+	if f, ok := enc.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// decodeNDJSON - decodes a recipe per non blank line, a malformed line is reported as the error of its item. Returns an
+// error only when the body itself can not be read.
+func decodeNDJSON(body io.Reader) ([]*recipe.Recipe, []error, error) {
+	var rcps []*recipe.Recipe
+	var errs []error
+	reader := bufio.NewReader(body)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, nil, errors.NewInputError("Invalid batch", map[string]string{errors.Batch: err.Error()})
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			rcp := &recipe.Recipe{}
+			dec := json.NewDecoder(bytes.NewReader(line))
+			dec.DisallowUnknownFields()
+			var decErr error
+			if decErr = dec.Decode(rcp); decErr == nil && dec.More() {
+				decErr = fmt.Errorf("unexpected data after the recipe")
+			}
+			if decErr != nil {
+				rcp = &recipe.Recipe{}
+				decErr = errors.NewInputError("Malformed recipe", map[string]string{errors.Recipe: decErr.Error()})
+			}
+			rcps = append(rcps, rcp)
+			errs = append(errs, decErr)
+		}
+		if err == io.EOF {
+			return rcps, errs, nil
+		}
+	}
+}
+
+// decodeCSV - decodes a recipe per row, the first row names the columns (see csvColumns) which can be given in any
+// order. A row that can not be decoded is reported as the error of its item whereas an unknown column or a malformed
+// CSV document fail the whole batch.
+func decodeCSV(body io.Reader) ([]*recipe.Recipe, []error, error) {
+	reader := csv.NewReader(body)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, errors.NewInputError("Invalid batch", map[string]string{errors.Batch: err.Error()})
+	}
+	known := make(map[string]bool, len(csvColumns))
+	for _, column := range csvColumns {
+		known[column] = true
+	}
+	for _, column := range header {
+		if !known[column] {
+			return nil, nil, errors.NewInputError("Invalid batch", map[string]string{column: "unknown column"})
+		}
+	}
+
+	var rcps []*recipe.Recipe
+	var errs []error
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return rcps, errs, nil
+		}
+		if pe, ok := err.(*csv.ParseError); ok && pe.Err == csv.ErrFieldCount {
+			rcps = append(rcps, &recipe.Recipe{})
+			errs = append(errs, errors.NewInputError("Malformed recipe", map[string]string{errors.Recipe: err.Error()}))
+			continue
+		}
+		if err != nil {
+			return nil, nil, errors.NewInputError("Invalid batch", map[string]string{errors.Batch: err.Error()})
+		}
+		rcp, err := decodeCSVRow(header, row)
+		rcps = append(rcps, rcp)
+		errs = append(errs, err)
+	}
+}
+
+// decodeCSVRow - empty cells leave their field unset, the service validates the values as for any other recipe.
+func decodeCSVRow(header, row []string) (*recipe.Recipe, error) {
+	rcp := &recipe.Recipe{}
+	invalid := make(map[string]string)
+	for i, column := range header {
+		cell := row[i]
+		if len(cell) == 0 || csvReadOnly[column] {
+			continue
+		}
+		var err error
+		switch column {
+		case "ID":
+			rcp.ID = cell
+		case recipe.FieldName:
+			rcp.Name = cell
+		case recipe.FieldPrepTime:
+			rcp.PrepTime, err = strconv.Atoi(cell)
+		case recipe.FieldDifficulty:
+			rcp.Difficulty, err = strconv.Atoi(cell)
+		case recipe.FieldVegetarian:
+			rcp.Vegetarian, err = strconv.ParseBool(cell)
+		case recipe.FieldServings:
+			rcp.Servings, err = strconv.Atoi(cell)
+		case recipe.FieldCuisine:
+			rcp.Cuisine = cell
+		case recipe.FieldTags:
+			err = json.Unmarshal([]byte(cell), &rcp.Tags)
+		case recipe.FieldIngredients:
+			err = json.Unmarshal([]byte(cell), &rcp.Ingredients)
+		case recipe.FieldSteps:
+			err = json.Unmarshal([]byte(cell), &rcp.Steps)
+		}
+		if err != nil {
+			invalid[column] = errors.Invalid
+		}
+	}
+	if len(invalid) > 0 {
+		return rcp, errors.NewInputError("Malformed recipe", invalid)
+	}
+	return rcp, nil
+}
+
+// encodeCSVRow - the recipe as a row of csvColumns, empty lists are written as empty cells.
+func encodeCSVRow(rcp *recipe.Recipe) ([]string, error) {
+	tags, err := jsonCell(len(rcp.Tags), rcp.Tags)
+	if err != nil {
+		return nil, err
+	}
+	ingredients, err := jsonCell(len(rcp.Ingredients), rcp.Ingredients)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := jsonCell(len(rcp.Steps), rcp.Steps)
+	if err != nil {
+		return nil, err
+	}
+	return []string{rcp.ID, rcp.Name, strconv.Itoa(rcp.PrepTime), strconv.Itoa(rcp.Difficulty),
+		strconv.FormatBool(rcp.Vegetarian), strconv.Itoa(rcp.Servings), rcp.Cuisine, tags, ingredients, steps,
+		strconv.FormatFloat(rcp.AverageRating, 'f', -1, 64), strconv.Itoa(rcp.RatingCount),
+		rcp.CreatedAt.Format(time.RFC3339Nano), rcp.UpdatedAt.Format(time.RFC3339Nano),
+		strconv.FormatInt(rcp.Version, 10), rcp.Owner}, nil
+}
+
+func jsonCell(length int, list interface{}) (string, error) {
+	if length == 0 {
+		return "", nil
+	}
+	cell, err := json.Marshal(list)
+	return string(cell), err
+}
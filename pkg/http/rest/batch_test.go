@@ -0,0 +1,306 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/logger"
+	r "github.com/rnov/Go-REST/pkg/recipe"
+)
+
+func TestRecipeHandler_BatchCreateRecipes(t *testing.T) {
+	// creates every recipe but the ones named "exists"
+	created := func(recipes []*r.Recipe) ([]error, error) {
+		errs := make([]error, len(recipes))
+		for i, rcp := range recipes {
+			if rcp.Name == "exists" {
+				errs[i] = errors.NewExistErr(true)
+				continue
+			}
+			if len(rcp.ID) == 0 {
+				rcp.ID = "01EDGQ5K2XW4YCPMJBD3T9V7ZN"
+			}
+		}
+		return errs, nil
+	}
+	tests := []struct {
+		name           string
+		contentType    string
+		body           string
+		service        RecipeServiceMock
+		status         int
+		expectedReport *batchReport
+	}{
+		{
+			name:        "Successful request - NDJSON",
+			contentType: "application/x-ndjson",
+			body: `{"ID":"111111","name":"qwerty","prepTime":20,"difficulty":3}
+
+{"name":"qwerty","prepTime":20,"difficulty":3}
+{"ID":"222222","name":"exists","prepTime":20,"difficulty":3}
+{"ID":"333333","age":100}
+`,
+			service: RecipeServiceMock{batch: created},
+			status:  200,
+			expectedReport: &batchReport{Created: 2, Failed: 2, Results: []batchResult{
+				{Index: 0, ID: "111111", Status: 201},
+				{Index: 1, ID: "01EDGQ5K2XW4YCPMJBD3T9V7ZN", Status: 201},
+				{Index: 2, ID: "222222", Status: 403, Error: "item already exists"},
+				{Index: 3, Status: 400, Error: "Malformed recipe",
+					Parameters: map[string]string{errors.Recipe: `json: unknown field "age"`}},
+			}},
+		},
+		{
+			name:        "Successful request - CSV",
+			contentType: "text/csv; charset=utf-8",
+			body: `name,ID,prepTime,difficulty,tags,version
+qwerty,111111,20,3,"[""quick""]",7
+qwerty,222222,twenty,3,,
+qwerty,333333
+`,
+			service: RecipeServiceMock{batch: func(recipes []*r.Recipe) ([]error, error) {
+				expected := []*r.Recipe{{ID: "111111", Name: "qwerty", PrepTime: 20, Difficulty: 3, Tags: []string{"quick"}}}
+				if !reflect.DeepEqual(recipes, expected) {
+					return nil, errors.NewDBErr("unexpected recipes")
+				}
+				return created(recipes)
+			}},
+			status: 200,
+			expectedReport: &batchReport{Created: 1, Failed: 2, Results: []batchResult{
+				{Index: 0, ID: "111111", Status: 201},
+				{Index: 1, ID: "222222", Status: 400, Error: "Malformed recipe",
+					Parameters: map[string]string{"prepTime": errors.Invalid}},
+				{Index: 2, Status: 400, Error: "Malformed recipe",
+					Parameters: map[string]string{errors.Recipe: "record on line 4: wrong number of fields"}},
+			}},
+		},
+		{
+			name:        "Successful request - invalid recipe",
+			contentType: "application/x-ndjson",
+			body:        `{"ID":"111111","name":"qwerty","prepTime":20,"difficulty":100}`,
+			service: RecipeServiceMock{batch: func(recipes []*r.Recipe) ([]error, error) {
+				return []error{errors.NewInputError("Invalid input parameters", map[string]string{errors.Difficulty: errors.OutOfRange})}, nil
+			}},
+			status: 200,
+			expectedReport: &batchReport{Failed: 1, Results: []batchResult{
+				{Index: 0, ID: "111111", Status: 400, Error: "Invalid input parameters",
+					Parameters: map[string]string{errors.Difficulty: errors.OutOfRange}},
+			}},
+		},
+		{
+			name:        "Successful request - DB errors are not disclosed",
+			contentType: "application/x-ndjson",
+			body:        `{"ID":"111111","name":"qwerty","prepTime":20,"difficulty":3}`,
+			service: RecipeServiceMock{batch: func(recipes []*r.Recipe) ([]error, error) {
+				return []error{errors.NewDBErr("connection refused")}, nil
+			}},
+			status: 200,
+			expectedReport: &batchReport{Failed: 1, Results: []batchResult{
+				{Index: 0, ID: "111111", Status: 500, Error: "Internal Server Error"},
+			}},
+		},
+		{
+			name:        "Error - empty batch",
+			contentType: "application/x-ndjson",
+			service: RecipeServiceMock{batch: func(recipes []*r.Recipe) ([]error, error) {
+				return nil, errors.NewInputError("Invalid batch", nil)
+			}},
+			status: 400,
+		},
+		{
+			name:        "Error - unknown CSV column",
+			contentType: "text/csv",
+			body:        "ID,age\n111111,100\n",
+			status:      400,
+		},
+		{
+			name:        "Error - unsupported media type",
+			contentType: "application/json",
+			body:        `[{"ID":"111111"}]`,
+			status:      415,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/recipes:batchCreate", strings.NewReader(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", test.contentType)
+
+			rh := NewRecipeHandler(&test.service, logger.NewLogger())
+			rr := httptest.NewRecorder()
+			servicesRouter := mux.NewRouter()
+			servicesRouter.HandleFunc("/recipes:batchCreate", rh.BatchCreateRecipes).Methods("POST")
+			servicesRouter.ServeHTTP(rr, req)
+
+			if rr.Code != test.status {
+				t.Errorf("handler returned wrong status code: expected %v got %v", test.status, rr.Code)
+			}
+			if test.expectedReport != nil {
+				report := &batchReport{}
+				if err := json.Unmarshal(rr.Body.Bytes(), report); err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if !reflect.DeepEqual(test.expectedReport, report) {
+					t.Errorf("expected: '%+v' instead got: '%+v'", test.expectedReport, report)
+				}
+			}
+		})
+	}
+}
+
+func TestRecipeHandler_ExportRecipes(t *testing.T) {
+	createdAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	stored := []*r.Recipe{
+		{ID: "111111", Name: "qwerty", PrepTime: 20, Difficulty: 3, Tags: []string{"quick"},
+			Ingredients: []r.Ingredient{{Name: "rice", Quantity: 400, Unit: "g"}}, AverageRating: 4.5, RatingCount: 2,
+			CreatedAt: createdAt, UpdatedAt: createdAt, Version: 2, Owner: "chef"},
+		{ID: "222222", Name: "asdfg, \"quoted\"", PrepTime: 30, Difficulty: 1, Vegetarian: true, CreatedAt: createdAt,
+			UpdatedAt: createdAt, Version: 1},
+	}
+	export := func(query *r.Query, fn func(recipe *r.Recipe) error) error {
+		for _, rcp := range stored {
+			if err := fn(rcp); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	tests := []struct {
+		name                string
+		url                 string
+		accept              string
+		service             RecipeServiceMock
+		status              int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			name:                "Successful request - NDJSON by default",
+			url:                 "/recipes:export",
+			service:             RecipeServiceMock{export: export},
+			status:              200,
+			expectedContentType: "application/x-ndjson",
+			expectedBody: `{"ID":"111111","name":"qwerty","prepTime":20,"difficulty":3,"vegetarian":false,"tags":["quick"],"ingredients":[{"name":"rice","quantity":400,"unit":"g"}],"averageRating":4.5,"ratingCount":2,"createdAt":"2020-01-02T03:04:05Z","updatedAt":"2020-01-02T03:04:05Z","version":2,"owner":"chef"}
+{"ID":"222222","name":"asdfg, \"quoted\"","prepTime":30,"difficulty":1,"vegetarian":true,"averageRating":0,"ratingCount":0,"createdAt":"2020-01-02T03:04:05Z","updatedAt":"2020-01-02T03:04:05Z","version":1}
+`,
+		},
+		{
+			name:                "Successful request - CSV through the Accept header",
+			url:                 "/recipes:export",
+			accept:              "text/csv, application/json;q=0.5",
+			service:             RecipeServiceMock{export: export},
+			status:              200,
+			expectedContentType: "text/csv",
+			expectedBody: `ID,name,prepTime,difficulty,vegetarian,servings,cuisine,tags,ingredients,steps,averageRating,ratingCount,createdAt,updatedAt,version,owner
+111111,qwerty,20,3,false,0,,"[""quick""]","[{""name"":""rice"",""quantity"":400,""unit"":""g""}]",,4.5,2,2020-01-02T03:04:05Z,2020-01-02T03:04:05Z,2,chef
+222222,"asdfg, ""quoted""",30,1,true,0,,,,,0,0,2020-01-02T03:04:05Z,2020-01-02T03:04:05Z,1,
+`,
+		},
+		{
+			name:   "Successful request - filters are passed on, empty CSV export",
+			url:    "/recipes:export?format=csv&vegetarian=true&sort=-name",
+			accept: "application/x-ndjson",
+			service: RecipeServiceMock{export: func(query *r.Query, fn func(recipe *r.Recipe) error) error {
+				vegetarian := true
+				expected := &r.Query{Sort: r.SortName, Desc: true, Filter: r.Filter{Vegetarian: &vegetarian}}
+				if !reflect.DeepEqual(query, expected) {
+					return errors.NewDBErr("unexpected query")
+				}
+				return nil
+			}},
+			status:              200,
+			expectedContentType: "text/csv",
+			expectedBody:        "ID,name,prepTime,difficulty,vegetarian,servings,cuisine,tags,ingredients,steps,averageRating,ratingCount,createdAt,updatedAt,version,owner\n",
+		},
+		{
+			name:   "Error - invalid format",
+			url:    "/recipes:export?format=xml",
+			status: 400,
+		},
+		{
+			name: "Error - invalid query",
+			url:  "/recipes:export?sort=unknown",
+			service: RecipeServiceMock{export: func(query *r.Query, fn func(recipe *r.Recipe) error) error {
+				return errors.NewInputError("Invalid query parameters", map[string]string{errors.Sort: errors.Invalid})
+			}},
+			status: 400,
+		},
+		{
+			name: "Error - DB error mid stream cuts the export short",
+			url:  "/recipes:export",
+			service: RecipeServiceMock{export: func(query *r.Query, fn func(recipe *r.Recipe) error) error {
+				if err := fn(stored[1]); err != nil {
+					return err
+				}
+				return errors.NewDBErr("connection lost")
+			}},
+			status:              200,
+			expectedContentType: "application/x-ndjson",
+			expectedBody: `{"ID":"222222","name":"asdfg, \"quoted\"","prepTime":30,"difficulty":1,"vegetarian":true,"averageRating":0,"ratingCount":0,"createdAt":"2020-01-02T03:04:05Z","updatedAt":"2020-01-02T03:04:05Z","version":1}
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", test.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Accept", test.accept)
+
+			rh := NewRecipeHandler(&test.service, logger.NewLogger())
+			rr := httptest.NewRecorder()
+			servicesRouter := mux.NewRouter()
+			servicesRouter.HandleFunc("/recipes:export", rh.ExportRecipes).Methods("GET")
+			servicesRouter.ServeHTTP(rr, req)
+
+			if rr.Code != test.status {
+				t.Errorf("handler returned wrong status code: expected %v got %v", test.status, rr.Code)
+			}
+			if contentType := rr.Header().Get("Content-Type"); test.status == 200 && contentType != test.expectedContentType {
+				t.Errorf("expected content type: '%s' instead got: '%s'", test.expectedContentType, contentType)
+			}
+			if test.status == 200 && rr.Body.String() != test.expectedBody {
+				t.Errorf("expected: '%s' instead got: '%s'", test.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestRecipeHandler_ExportRoundTrip(t *testing.T) {
+	// an exported CSV can be imported as it is
+	rcp := &r.Recipe{ID: "111111", Name: "qwerty, \"quoted\"", PrepTime: 20, Difficulty: 3, Servings: 2,
+		Cuisine: "spanish", Tags: []string{"quick"}, Ingredients: []r.Ingredient{{Name: "egg", Quantity: 2}},
+		Steps: []string{"fry the eggs"}, AverageRating: 4, RatingCount: 1, Version: 3}
+	rh := NewRecipeHandler(&RecipeServiceMock{
+		export: func(query *r.Query, fn func(recipe *r.Recipe) error) error {
+			return fn(rcp)
+		},
+	}, logger.NewLogger())
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/recipes:export?format=csv", nil)
+	rh.ExportRecipes(rr, req)
+
+	rcps, errs, err := decodeCSV(bytes.NewReader(rr.Body.Bytes()))
+	if err != nil || len(errs) != 1 || errs[0] != nil {
+		t.Fatalf("unexpected error: %v %v", err, errs)
+	}
+	expected := *rcp
+	expected.AverageRating, expected.RatingCount, expected.Version = 0, 0, 0
+	if !reflect.DeepEqual(rcps[0], &expected) {
+		t.Errorf("expected: '%v' instead got: '%v'", &expected, rcps[0])
+	}
+}
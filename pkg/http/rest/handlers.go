@@ -6,37 +6,124 @@ import (
 	"github.com/gorilla/mux"
 
 	"github.com/rnov/Go-REST/pkg/auth"
+	"github.com/rnov/Go-REST/pkg/errors"
 	mid "github.com/rnov/Go-REST/pkg/http/middleware"
+	"github.com/rnov/Go-REST/pkg/identity"
+	"github.com/rnov/Go-REST/pkg/logger"
+	"github.com/rnov/Go-REST/pkg/metrics"
+	"github.com/rnov/Go-REST/pkg/ratelimit"
 )
 
 type RecipeAPI interface {
 	GetRecipeByID(w http.ResponseWriter, r *http.Request)
 	GetAllRecipes(w http.ResponseWriter, r *http.Request)
+	SearchRecipes(w http.ResponseWriter, r *http.Request)
 	CreateRecipe(w http.ResponseWriter, r *http.Request)
+	BatchCreateRecipes(w http.ResponseWriter, r *http.Request)
+	ExportRecipes(w http.ResponseWriter, r *http.Request)
 	UpdateRecipe(w http.ResponseWriter, r *http.Request)
+	PatchRecipe(w http.ResponseWriter, r *http.Request)
 	DeleteRecipe(w http.ResponseWriter, r *http.Request)
 }
 
+type AuthAPI interface {
+	CreateToken(w http.ResponseWriter, r *http.Request)
+}
+
+type APIKeyAPI interface {
+	CreateAPIKey(w http.ResponseWriter, r *http.Request)
+	GetAPIKeys(w http.ResponseWriter, r *http.Request)
+	RotateAPIKey(w http.ResponseWriter, r *http.Request)
+	RevokeAPIKey(w http.ResponseWriter, r *http.Request)
+}
+
 type RateAPI interface {
 	RateRecipe(w http.ResponseWriter, r *http.Request)
+	GetRates(w http.ResponseWriter, r *http.Request)
+	DeleteRate(w http.ResponseWriter, r *http.Request)
 }
 
-func NewRouter(rcpHand *RecipeHandler, rateHand *RateHandler, auth *auth.Auth) *mux.Router {
+// NewRouter - the token endpoint is only served when authHand is given, i.e. bearer tokens are enabled. Every route is
+// rate limited by lim and every request, routed or not, is traced, written to the access log by l and recorded by m.
+func NewRouter(rcpHand *RecipeHandler, rateHand *RateHandler, authHand *AuthHandler, keyHand *APIKeyHandler,
+	auth auth.Validator, lim ratelimit.Allower, l logger.Loggers, m *metrics.Metrics) *mux.Router {
 	APIRESTRouter := mux.NewRouter()
-	configRecipeEndpoints(APIRESTRouter, rcpHand, auth)
-	configRateEndPoints(APIRESTRouter, rateHand)
+	accessLog := mid.AccessLog(l)
+	instrumented := mid.Metrics(m)
+	observed := func(h http.Handler) http.Handler {
+		return mid.RequestID(mid.Tracing(accessLog(instrumented(h))))
+	}
+	APIRESTRouter.Use(observed)
+	APIRESTRouter.NotFoundHandler = observed(http.NotFoundHandler())
+	APIRESTRouter.MethodNotAllowedHandler = observed(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	configRecipeEndpoints(APIRESTRouter, rcpHand, auth, lim)
+	configRateEndPoints(APIRESTRouter, rateHand, auth, lim)
+	configAPIKeyEndpoints(APIRESTRouter, keyHand, auth, lim)
+	if authHand != nil {
+		configAuthEndpoints(APIRESTRouter, authHand, lim)
+	}
 
 	return APIRESTRouter
 }
 
-func configRecipeEndpoints(r *mux.Router, rcpHand *RecipeHandler, auth *auth.Auth) {
-	r.HandleFunc("/recipes/{ID}", rcpHand.GetRecipeByID).Methods("GET")
-	r.HandleFunc("/recipes", rcpHand.GetAllRecipes).Methods("GET")
-	r.HandleFunc("/recipes/{ID}", mid.Authentication(auth, rcpHand.DeleteRecipe)).Methods("DELETE")
-	r.HandleFunc("/recipes", mid.Authentication(auth, rcpHand.CreateRecipe)).Methods("POST")
-	r.HandleFunc("/recipes/{ID}", mid.Authentication(auth, rcpHand.UpdateRecipe)).Methods("PUT")
+// configRecipeEndpoints - recipes are read by anyone, only the writes are restricted to the users granted permission.
+func configRecipeEndpoints(r *mux.Router, rcpHand *RecipeHandler, auth auth.Validator, lim ratelimit.Allower) {
+	// registered before /recipes/{ID}, otherwise "search" would be taken as a recipe ID
+	r.HandleFunc("/recipes/search", limited(lim, rcpHand.SearchRecipes)).Methods("GET")
+	r.HandleFunc("/recipes/{ID}", limited(lim, rcpHand.GetRecipeByID)).Methods("GET")
+	r.HandleFunc("/recipes", limited(lim, rcpHand.GetAllRecipes)).Methods("GET")
+	r.HandleFunc("/recipes:export", limited(lim, rcpHand.ExportRecipes)).Methods("GET")
+	// ownership of the recipes being modified is checked by the service
+	r.HandleFunc("/recipes:batchCreate", authorized(auth, lim, identity.CreateRecipe, rcpHand.BatchCreateRecipes)).Methods("POST")
+	r.HandleFunc("/recipes/{ID}", authorized(auth, lim, identity.EditRecipe, rcpHand.DeleteRecipe)).Methods("DELETE")
+	r.HandleFunc("/recipes", authorized(auth, lim, identity.CreateRecipe, rcpHand.CreateRecipe)).Methods("POST")
+	r.HandleFunc("/recipes/{ID}", authorized(auth, lim, identity.EditRecipe, rcpHand.UpdateRecipe)).Methods("PUT")
+	r.HandleFunc("/recipes/{ID}", authorized(auth, lim, identity.EditRecipe, rcpHand.PatchRecipe)).Methods("PATCH")
+}
+
+// authorized - restricts the handler to the authenticated users that have been granted the permission, each user is
+// rate limited on its own by the limit of the route. Requests are limited per client address by the authentication
+// limit before their credentials are checked, so that guessing passwords or API keys is limited too.
+func authorized(auth auth.Validator, lim ratelimit.Allower, perm identity.Permission, h http.HandlerFunc) http.HandlerFunc {
+	return mid.AuthenticationLimit(lim, mid.Authentication(auth, mid.RateLimit(lim, mid.Authorization(perm, h))))
+}
+
+// limited - rate limits the handler of a public route per client address.
+func limited(lim ratelimit.Allower, h http.HandlerFunc) http.HandlerFunc {
+	return mid.RateLimit(lim, h)
+}
+
+// configRateEndPoints - rates are read by anyone, rating requires the identity.RateRecipe permission (see identity.Reader).
+func configRateEndPoints(r *mux.Router, rateHand *RateHandler, auth auth.Validator, lim ratelimit.Allower) {
+	r.HandleFunc("/recipes/{ID}/rate", authorized(auth, lim, identity.RateRecipe, rateHand.RateRecipe)).Methods("POST")
+	r.HandleFunc("/recipes/{ID}/rate", authorized(auth, lim, identity.RateRecipe, rateHand.DeleteRate)).Methods("DELETE")
+	r.HandleFunc("/recipes/{ID}/rate", limited(lim, rateHand.GetRates)).Methods("GET")
+}
+
+func configAuthEndpoints(r *mux.Router, authHand *AuthHandler, lim ratelimit.Allower) {
+	r.HandleFunc("/auth/token", limited(lim, authHand.CreateToken)).Methods("POST")
+}
+
+func configAPIKeyEndpoints(r *mux.Router, keyHand *APIKeyHandler, auth auth.Validator, lim ratelimit.Allower) {
+	r.HandleFunc("/apikeys", authorized(auth, lim, identity.ManageAPIKeys, keyHand.GetAPIKeys)).Methods("GET")
+	r.HandleFunc("/apikeys", authorized(auth, lim, identity.ManageAPIKeys, keyHand.CreateAPIKey)).Methods("POST")
+	r.HandleFunc("/apikeys/{ID}:rotate", authorized(auth, lim, identity.ManageAPIKeys, keyHand.RotateAPIKey)).Methods("POST")
+	r.HandleFunc("/apikeys/{ID}", authorized(auth, lim, identity.ManageAPIKeys, keyHand.RevokeAPIKey)).Methods("DELETE")
+}
+
+// buildResponse - responds with the error, which is logged by the request logger whenever errors.BuildResponse tells so.
+func buildResponse(w http.ResponseWriter, r *http.Request, l logger.Loggers, err error) {
+	if toLog := errors.BuildResponse(w, r.Method, err); toLog {
+		requestLog(r, l).Errorf("system error: %s", err.Error())
+	}
 }
 
-func configRateEndPoints(r *mux.Router, rateHand *RateHandler) {
-	r.HandleFunc("/recipes/{ID}/rate", rateHand.RateRecipe).Methods("POST")
+// requestLog - the logger of the request, carrying the request ID (see middleware.AccessLog), l when there is none.
+func requestLog(r *http.Request, l logger.Loggers) logger.Loggers {
+	if rl, ok := logger.FromContext(r.Context()); ok {
+		return rl
+	}
+	return l
 }
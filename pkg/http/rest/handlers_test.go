@@ -0,0 +1,106 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/rnov/Go-REST/pkg/config"
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
+	"github.com/rnov/Go-REST/pkg/ratelimit"
+)
+
+type validatorMock struct {
+	validate func(scheme, credentials string) (*identity.Principal, error)
+}
+
+func (vm *validatorMock) Validate(ctx context.Context, scheme, credentials string) (*identity.Principal, error) {
+	if vm.validate != nil {
+		return vm.validate(scheme, credentials)
+	}
+	panic("Not implemented")
+}
+
+func TestAuthorized_FailedAuthentication(t *testing.T) {
+	const burst = 3
+	lim, err := ratelimit.NewLimiter(config.RateLimitConfig{
+		Default:        config.LimitConfig{Requests: 100, Per: time.Hour},
+		Authentication: config.LimitConfig{Requests: burst, Per: time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	validations := 0
+	validator := &validatorMock{validate: func(scheme, credentials string) (*identity.Principal, error) {
+		validations++
+		return nil, errors.NewFailedAuthErr()
+	}}
+	servicesRouter := mux.NewRouter()
+	servicesRouter.HandleFunc("/recipes", authorized(validator, lim, identity.CreateRecipe, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler must not be reached with bad credentials")
+	})).Methods("POST")
+
+	for i := 0; i <= burst; i++ {
+		req := httptest.NewRequest("POST", "/recipes", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.SetBasicAuth("user", "wrong")
+		rr := httptest.NewRecorder()
+		servicesRouter.ServeHTTP(rr, req)
+
+		expected := http.StatusUnauthorized
+		if i == burst {
+			expected = http.StatusTooManyRequests
+		}
+		if rr.Code != expected {
+			t.Errorf("attempt %d: expected status %d got %d", i+1, expected, rr.Code)
+		}
+	}
+	if validations != burst {
+		t.Errorf("expected %d validations got %d", burst, validations)
+	}
+}
+
+func TestAuthorized_LimitedPerUser(t *testing.T) {
+	lim, err := ratelimit.NewLimiter(config.RateLimitConfig{
+		Default:        config.LimitConfig{Requests: 1, Per: time.Hour},
+		Authentication: config.LimitConfig{Requests: 100, Per: time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	validator := &validatorMock{validate: func(scheme, credentials string) (*identity.Principal, error) {
+		return &identity.Principal{Username: credentials, Role: identity.Editor}, nil
+	}}
+	servicesRouter := mux.NewRouter()
+	servicesRouter.HandleFunc("/recipes", authorized(validator, lim, identity.CreateRecipe, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})).Methods("POST")
+
+	// users behind the same address have their own bucket, only the second request of chef is over the limit
+	for i, step := range []struct {
+		user     string
+		expected int
+	}{
+		{user: "chef", expected: http.StatusCreated},
+		{user: "cook", expected: http.StatusCreated},
+		{user: "chef", expected: http.StatusTooManyRequests},
+	} {
+		req := httptest.NewRequest("POST", "/recipes", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("Authorization", "Bearer "+step.user)
+		rr := httptest.NewRecorder()
+		servicesRouter.ServeHTTP(rr, req)
+
+		if rr.Code != step.expected {
+			t.Errorf("request %d: expected status %d got %d", i+1, step.expected, rr.Code)
+		}
+		if limit := rr.Header().Get("RateLimit-Limit"); limit != "1" {
+			t.Errorf("request %d: expected the route limit header '1' got '%s'", i+1, limit)
+		}
+	}
+}
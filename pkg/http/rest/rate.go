@@ -6,7 +6,6 @@ import (
 
 	"github.com/gorilla/mux"
 
-	"github.com/rnov/Go-REST/pkg/errors"
 	"github.com/rnov/Go-REST/pkg/logger"
 	"github.com/rnov/Go-REST/pkg/rate"
 	"github.com/rnov/Go-REST/pkg/service"
@@ -26,7 +25,7 @@ func NewRateHandler(srv service.Rater, l logger.Loggers) *RateHandler {
 	return rateHandler
 }
 
-// RateRecipe
+// RateRecipe - rates the recipe on behalf of the authenticated user, rating it again replaces the previous rate.
 func (rh *RateHandler) RateRecipe(w http.ResponseWriter, r *http.Request) {
 	ID := mux.Vars(r)["ID"]
 	if len(ID) == 0 {
@@ -41,10 +40,51 @@ func (rh *RateHandler) RateRecipe(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	if err := rh.rateSrv.Rate(ID, rating); err != nil {
-		errors.BuildResponse(w, r.Method, err)
+	if err := rh.rateSrv.Rate(r.Context(), ID, rating, principal(r)); err != nil {
+		buildResponse(w, r, rh.log, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
+
+// GetRates - aggregated score of the recipe along with its rates, raters are not disclosed since anyone can read them.
+func (rh *RateHandler) GetRates(w http.ResponseWriter, r *http.Request) {
+	ID := mux.Vars(r)["ID"]
+	if len(ID) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	summary, err := rh.rateSrv.GetRates(r.Context(), ID)
+	if err != nil {
+		buildResponse(w, r, rh.log, err)
+		return
+	}
+
+	body, err := json.Marshal(summary)
+	if err != nil {
+		requestLog(r, rh.log).Errorf("system error: %s", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// DeleteRate - retracts the rate the authenticated user gave to the recipe.
+func (rh *RateHandler) DeleteRate(w http.ResponseWriter, r *http.Request) {
+	ID := mux.Vars(r)["ID"]
+	if len(ID) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := rh.rateSrv.DeleteRate(r.Context(), ID, principal(r)); err != nil {
+		buildResponse(w, r, rh.log, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,25 +2,45 @@ package rest
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/gorilla/mux"
 
 	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
 	"github.com/rnov/Go-REST/pkg/logger"
 	"github.com/rnov/Go-REST/pkg/rate"
 )
 
 type rateServiceMock struct {
-	rate func(ID string, r *rate.Rate) error
+	rate       func(ID string, r *rate.Rate, user *identity.Principal) error
+	getRates   func(ID string) (*rate.Summary, error)
+	deleteRate func(ID string, user *identity.Principal) error
 }
 
-func (rsm *rateServiceMock) Rate(ID string, r *rate.Rate) error {
+func (rsm *rateServiceMock) Rate(ctx context.Context, ID string, r *rate.Rate, user *identity.Principal) error {
 	if rsm.rate != nil {
-		return rsm.rate(ID, r)
+		return rsm.rate(ID, r, user)
+	}
+	panic("Not implemented")
+}
+
+func (rsm *rateServiceMock) DeleteRate(ctx context.Context, ID string, user *identity.Principal) error {
+	if rsm.deleteRate != nil {
+		return rsm.deleteRate(ID, user)
+	}
+	panic("Not implemented")
+}
+
+func (rsm *rateServiceMock) GetRates(ctx context.Context, ID string) (*rate.Summary, error) {
+	if rsm.getRates != nil {
+		return rsm.getRates(ID)
 	}
 	panic("Not implemented")
 }
@@ -38,7 +58,10 @@ func TestRateHandler_RateRecipe(t *testing.T) {
 			url:            "/recipes/5f10223c/rate",
 			requestPayload: &rate.Rate{Note: 5},
 			service: rateServiceMock{
-				rate: func(ID string, r *rate.Rate) error {
+				rate: func(ID string, r *rate.Rate, user *identity.Principal) error {
+					if user == nil || user.Username != "chef" {
+						return errors.NewInputError("unexpected rater", nil)
+					}
 					return nil
 				},
 			},
@@ -49,7 +72,7 @@ func TestRateHandler_RateRecipe(t *testing.T) {
 			url:            "/recipes/5f10223c/rate",
 			requestPayload: &rate.Rate{Note: 10},
 			service: rateServiceMock{
-				rate: func(ID string, r *rate.Rate) error {
+				rate: func(ID string, r *rate.Rate, user *identity.Principal) error {
 					v := make(map[string]string)
 					v[errors.Rate] = errors.OutOfRange
 					return errors.NewInputError("invalid input parameters", v)
@@ -62,7 +85,7 @@ func TestRateHandler_RateRecipe(t *testing.T) {
 			url:            "/recipes/987654/rate",
 			requestPayload: &rate.Rate{Note: 10},
 			service: rateServiceMock{
-				rate: func(ID string, r *rate.Rate) error {
+				rate: func(ID string, r *rate.Rate, user *identity.Principal) error {
 					return errors.NewExistErr(false)
 				},
 			},
@@ -91,6 +114,7 @@ func TestRateHandler_RateRecipe(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
+			req = req.WithContext(identity.NewContext(req.Context(), &identity.Principal{Username: "chef", Role: identity.Reader}))
 
 			rh := NewRateHandler(&test.service, l)
 
@@ -110,3 +134,142 @@ func TestRateHandler_RateRecipe(t *testing.T) {
 		})
 	}
 }
+
+func TestRateHandler_GetRates(t *testing.T) {
+	tests := []struct {
+		name            string
+		url             string
+		service         rateServiceMock
+		status          int
+		expectedPayload *rate.Summary
+		unpublished     []string
+	}{
+		{
+			name: "successful request",
+			url:  "/recipes/5f10223c/rate",
+			service: rateServiceMock{
+				getRates: func(ID string) (*rate.Summary, error) {
+					return &rate.Summary{Average: 4.5, Count: 2, Rates: []*rate.Rate{{Note: 5}, {Note: 4}}}, nil
+				},
+			},
+			status:          http.StatusOK,
+			expectedPayload: &rate.Summary{Average: 4.5, Count: 2, Rates: []*rate.Rate{{Note: 5}, {Note: 4}}},
+		},
+		{
+			name: "successful request - raters are not published",
+			url:  "/recipes/5f10223c/rate",
+			service: rateServiceMock{
+				getRates: func(ID string) (*rate.Summary, error) {
+					return &rate.Summary{Average: 4.5, Count: 2, Rates: []*rate.Rate{{Note: 5, Rater: "chef"}, {Note: 4, Rater: "10.0.0.1"}}}, nil
+				},
+			},
+			status:          http.StatusOK,
+			expectedPayload: &rate.Summary{Average: 4.5, Count: 2, Rates: []*rate.Rate{{Note: 5}, {Note: 4}}},
+			unpublished:     []string{"rater", "chef", "10.0.0.1"},
+		},
+		{
+			name: "error - recipe does not exist",
+			url:  "/recipes/987654/rate",
+			service: rateServiceMock{
+				getRates: func(ID string) (*rate.Summary, error) {
+					return nil, errors.NewExistErr(false)
+				},
+			},
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := logger.NewLogger()
+			req, err := http.NewRequest("GET", test.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rh := NewRateHandler(&test.service, l)
+
+			// We create a ResponseRecorder (which satisfies http.ResponseWriter) to record the response.
+			rr := httptest.NewRecorder()
+			servicesRouter := mux.NewRouter()
+			servicesRouter.HandleFunc("/recipes/{ID}/rate", rh.GetRates).Methods("GET")
+
+			// Our handlers satisfy http.Handler, so we can call their ServeHTTP method
+			// directly and pass in our Request and ResponseRecorder.
+			servicesRouter.ServeHTTP(rr, req)
+
+			// Check the status code is what we expect.
+			if rr.Code != test.status {
+				t.Errorf("handler returned wrong status code: expected %v got %v", test.status, rr.Code)
+			}
+
+			if test.expectedPayload != nil {
+				summary := &rate.Summary{}
+				_ = json.Unmarshal(rr.Body.Bytes(), summary)
+				if !reflect.DeepEqual(test.expectedPayload, summary) {
+					t.Errorf("expected: '%v' instead got: '%v'", test.expectedPayload, summary)
+				}
+			}
+			for _, u := range test.unpublished {
+				if strings.Contains(rr.Body.String(), u) {
+					t.Errorf("'%s' published in: '%s'", u, rr.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRateHandler_DeleteRate(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		service rateServiceMock
+		status  int
+	}{
+		{
+			name: "successful delete",
+			url:  "/recipes/5f10223c/rate",
+			service: rateServiceMock{
+				deleteRate: func(ID string, user *identity.Principal) error {
+					if user == nil || user.Username != "chef" {
+						return errors.NewInputError("unexpected rater", nil)
+					}
+					return nil
+				},
+			},
+			status: http.StatusNoContent,
+		},
+		{
+			name: "error - rate does not exist",
+			url:  "/recipes/987654/rate",
+			service: rateServiceMock{
+				deleteRate: func(ID string, user *identity.Principal) error {
+					return errors.NewExistErr(false)
+				},
+			},
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := logger.NewLogger()
+			req, err := http.NewRequest("DELETE", test.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req = req.WithContext(identity.NewContext(req.Context(), &identity.Principal{Username: "chef", Role: identity.Reader}))
+
+			rh := NewRateHandler(&test.service, l)
+
+			rr := httptest.NewRecorder()
+			servicesRouter := mux.NewRouter()
+			servicesRouter.HandleFunc("/recipes/{ID}/rate", rh.DeleteRate).Methods("DELETE")
+			servicesRouter.ServeHTTP(rr, req)
+
+			if rr.Code != test.status {
+				t.Errorf("handler returned wrong status code: expected %v got %v", test.status, rr.Code)
+			}
+		})
+	}
+}
@@ -3,12 +3,19 @@ package rest
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"mime"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 
 	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
 	"github.com/rnov/Go-REST/pkg/logger"
+	"github.com/rnov/Go-REST/pkg/patch"
 	"github.com/rnov/Go-REST/pkg/recipe"
 	"github.com/rnov/Go-REST/pkg/service"
 )
@@ -17,6 +24,17 @@ const (
 	recipeID = "ID"
 )
 
+// query parameters accepted when listing recipes.
+const (
+	limitParam       = "limit"
+	cursorParam      = "cursor"
+	sortParam        = "sort"
+	vegetarianParam  = "vegetarian"
+	maxPrepTimeParam = "maxPrepTime"
+	difficultyParam  = "difficulty"
+	searchParam      = "q"
+)
+
 // interface, could get any controller that implements the interface (redis, mongo, psql ...)
 type RecipeHandler struct {
 	rcpSrv service.RecipeMng
@@ -40,16 +58,22 @@ func (rh *RecipeHandler) GetRecipeByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rcp, err := rh.rcpSrv.GetByID(ID)
+	rcp, err := rh.rcpSrv.GetByID(r.Context(), ID)
 	if err != nil {
-		errors.BuildResponse(w, r.Method, err)
+		buildResponse(w, r, rh.log, err)
+		return
+	}
+	w.Header().Set("ETag", etag(rcp))
+	// the client already holds the current representation of the recipe
+	if matchETag(r.Header.Get("If-None-Match"), rcp, true) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
 	// Marshal provided interface into JSON structure
 	recipeJSON, err := json.Marshal(rcp)
 	if err != nil {
-		rh.log.Errorf("system error: %s", err.Error())
+		requestLog(r, rh.log).Errorf("system error: %s", err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -60,26 +84,72 @@ func (rh *RecipeHandler) GetRecipeByID(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "%s", recipeJSON)
 }
 
+// GetAllRecipes - lists a page of recipes, whenever there are more recipes to list a link to the next page is provided
+// through the Link header.
 func (rh *RecipeHandler) GetAllRecipes(w http.ResponseWriter, r *http.Request) {
-	rcps, err := rh.rcpSrv.ListAll()
+	query, err := parseListQuery(r.URL.Query())
+	if err != nil {
+		buildResponse(w, r, rh.log, err)
+		return
+	}
+	page, err := rh.rcpSrv.List(r.Context(), query)
 	if err != nil {
-		rh.log.Errorf("system error: %s", err.Error())
-		errors.BuildResponse(w, r.Method, err)
+		buildResponse(w, r, rh.log, err)
+		return
+	}
+	if len(page.NextCursor) > 0 {
+		next := *r.URL
+		values := next.Query()
+		values.Set(cursorParam, page.NextCursor)
+		next.RawQuery = values.Encode()
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+	}
+	rcps := page.Recipes
+	if rcps == nil {
+		rcps = make([]*recipe.Recipe, 0)
 	}
 	var recipesJSON []byte
 	w.Header().Set("Content-Type", "application/json")
 	recipesJSON, jsonErr := json.Marshal(rcps)
 	if jsonErr != nil {
-		rh.log.Errorf("system error: %s", jsonErr.Error())
+		requestLog(r, rh.log).Errorf("system error: %s", jsonErr.Error())
 		return
 	}
 	if _, parseErr := w.Write(recipesJSON); parseErr != nil {
-		rh.log.Errorf("system error: %s", parseErr.Error())
+		requestLog(r, rh.log).Errorf("system error: %s", parseErr.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 }
 
+// SearchRecipes - full-text search of recipes, the matched recipes are listed from the most to the least relevant.
+func (rh *RecipeHandler) SearchRecipes(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	limit := 0
+	if v := values.Get(limitParam); len(v) > 0 {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil {
+			buildResponse(w, r, rh.log, errors.NewInputError("Invalid query parameters", map[string]string{errors.Limit: errors.Invalid}))
+			return
+		}
+	}
+	rcps, err := rh.rcpSrv.Search(r.Context(), values.Get(searchParam), limit)
+	if err != nil {
+		buildResponse(w, r, rh.log, err)
+		return
+	}
+
+	recipesJSON, err := json.Marshal(rcps)
+	if err != nil {
+		requestLog(r, rh.log).Errorf("system error: %s", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(recipesJSON)
+}
+
 func (rh *RecipeHandler) CreateRecipe(w http.ResponseWriter, r *http.Request) {
 	rcp := &recipe.Recipe{}
 	dec := json.NewDecoder(r.Body)
@@ -88,18 +158,20 @@ func (rh *RecipeHandler) CreateRecipe(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	if err := rh.rcpSrv.Create(rcp); err != nil {
-		errors.BuildResponse(w, r.Method, err)
+	if err := rh.rcpSrv.Create(r.Context(), rcp, principal(r)); err != nil {
+		buildResponse(w, r, rh.log, err)
 		return
 	}
 
 	body, jsonErr := json.Marshal(rcp)
 	if jsonErr != nil {
-		rh.log.Errorf("system error: %s", jsonErr.Error())
+		requestLog(r, rh.log).Errorf("system error: %s", jsonErr.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/recipes/"+url.PathEscape(rcp.ID))
+	w.Header().Set("ETag", etag(rcp))
 	w.WriteHeader(http.StatusCreated)
 	w.Write(body)
 }
@@ -119,21 +191,75 @@ func (rh *RecipeHandler) UpdateRecipe(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	if err := rh.rcpSrv.Update(ID, rcp); err != nil {
-		errors.BuildResponse(w, r.Method, err)
+	version, err := rh.ifMatchVersion(r, ID)
+	if err != nil {
+		buildResponse(w, r, rh.log, err)
+		return
+	}
+	if err := rh.rcpSrv.Update(r.Context(), ID, rcp, version, principal(r)); err != nil {
+		buildResponse(w, r, rh.log, err)
 		return
 	}
 
 	body, err := json.Marshal(rcp)
 	if err != nil {
-		rh.log.Errorf("system error: %s", err.Error())
+		requestLog(r, rh.log).Errorf("system error: %s", err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(rcp))
 	w.Write(body)
 }
 
+// PatchRecipe - partial update of a recipe, the patch document is either a JSON Merge Patch or a JSON Patch as told by
+// the Content-Type header.
+func (rh *RecipeHandler) PatchRecipe(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	ID := params[recipeID]
+	if len(ID) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != patch.MergePatchType && mediaType != patch.JSONPatchType) {
+		w.Header().Set("Accept-Patch", patch.MergePatchType+", "+patch.JSONPatchType)
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	p, err := patch.New(mediaType, body)
+	if err != nil {
+		buildResponse(w, r, rh.log, errors.NewInputError("Invalid patch", map[string]string{errors.Patch: err.Error()}))
+		return
+	}
+	version, err := rh.ifMatchVersion(r, ID)
+	if err != nil {
+		buildResponse(w, r, rh.log, err)
+		return
+	}
+	rcp, err := rh.rcpSrv.Patch(r.Context(), ID, p, version, principal(r))
+	if err != nil {
+		buildResponse(w, r, rh.log, err)
+		return
+	}
+
+	rcpJSON, err := json.Marshal(rcp)
+	if err != nil {
+		requestLog(r, rh.log).Errorf("system error: %s", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(rcp))
+	w.WriteHeader(http.StatusOK)
+	w.Write(rcpJSON)
+}
+
 func (rh *RecipeHandler) DeleteRecipe(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	ID := params[recipeID]
@@ -141,10 +267,151 @@ func (rh *RecipeHandler) DeleteRecipe(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	if err := rh.rcpSrv.Delete(ID); err != nil {
-		errors.BuildResponse(w, r.Method, err)
+	version, err := rh.ifMatchVersion(r, ID)
+	if err != nil {
+		buildResponse(w, r, rh.log, err)
+		return
+	}
+	if err := rh.rcpSrv.Delete(r.Context(), ID, version, principal(r)); err != nil {
+		buildResponse(w, r, rh.log, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// principal - the authenticated user the request is made on behalf of, nil unless the route requires authentication.
+func principal(r *http.Request) *identity.Principal {
+	p, _ := identity.FromContext(r.Context())
+	return p
+}
+
+// etag - strong entity tag of a recipe, e.g. "3-2-4.5". Its version identifies the recipe's fields but the rating summary
+// changes with every rate without the version being increased, hence the tag is made of the version followed by the
+// rating count and average.
+func etag(rcp *recipe.Recipe) string {
+	return `"` + strconv.FormatInt(rcp.Version, 10) + "-" + strconv.Itoa(rcp.RatingCount) + "-" +
+		strconv.FormatFloat(rcp.AverageRating, 'f', -1, 64) + `"`
+}
+
+// tagVersion - version of the recipe a strong entity tag (see etag) was issued for, false when it is not one.
+func tagVersion(tag string) (int64, bool) {
+	if len(tag) < 2 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+		return 0, false
+	}
+	tag = tag[1 : len(tag)-1]
+	if i := strings.IndexByte(tag, '-'); i >= 0 {
+		tag = tag[:i]
+	}
+	version, err := strconv.ParseInt(tag, 10, 64)
+	return version, err == nil && version > 0
+}
+
+// matchETag - whether a conditional header (If-None-Match) matches the current tag of the recipe. Weak comparison ignores
+// the weak indicator of the listed tags, as required by If-None-Match, whereas strong comparison never matches them.
+func matchETag(header string, rcp *recipe.Recipe, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == etag(rcp) {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchVersion - version the write is conditioned on by the If-Match header, 0 when it is unconditional. Only the
+// version of the listed tags is compared since writes leave the ratings as they are, a recipe rated in between is still
+// written. Whenever several tags are listed the one matching the stored recipe is taken, the write is still conditioned
+// on it in case the recipe is modified in between.
+func (rh *RecipeHandler) ifMatchVersion(r *http.Request, ID string) (int64, error) {
+	header := r.Header.Get("If-Match")
+	if len(header) == 0 {
+		return 0, nil
+	}
+	var versions []int64
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return 0, nil
+		}
+		if version, ok := tagVersion(tag); ok {
+			versions = append(versions, version)
+		}
+	}
+	switch len(versions) {
+	case 0:
+		return 0, errors.NewPreconditionErr()
+	case 1:
+		return versions[0], nil
+	}
+	rcp, err := rh.rcpSrv.GetByID(r.Context(), ID)
+	if err != nil {
+		return 0, err
+	}
+	for _, version := range versions {
+		if version == rcp.Version {
+			return version, nil
+		}
+	}
+	return 0, errors.NewPreconditionErr()
+}
+
+// parseListQuery - parses the listing query parameters, their ranges are validated by the service.
+func parseListQuery(values url.Values) (*recipe.Query, error) {
+	query := &recipe.Query{}
+	invalid := make(map[string]string)
+
+	if v := values.Get(limitParam); len(v) > 0 {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			invalid[errors.Limit] = errors.Invalid
+		}
+		query.Limit = limit
+	}
+	if v := values.Get(cursorParam); len(v) > 0 {
+		cursor, err := recipe.DecodeCursor(v)
+		if err != nil {
+			invalid[errors.Cursor] = errors.Invalid
+		}
+		query.Cursor = cursor
+	}
+	if v := values.Get(sortParam); len(v) > 0 {
+		query.Desc = strings.HasPrefix(v, "-")
+		query.Sort = strings.TrimPrefix(v, "-")
+	}
+	if v := values.Get(vegetarianParam); len(v) > 0 {
+		vegetarian, err := strconv.ParseBool(v)
+		if err != nil {
+			invalid[errors.Vegetarian] = errors.Invalid
+		}
+		query.Filter.Vegetarian = &vegetarian
+	}
+	if v := values.Get(maxPrepTimeParam); len(v) > 0 {
+		maxPrepTime, err := strconv.Atoi(v)
+		if err != nil {
+			invalid[errors.MaxPrepTime] = errors.Invalid
+		}
+		query.Filter.MaxPrepTime = maxPrepTime
+	}
+	if v := values.Get(difficultyParam); len(v) > 0 {
+		difficulty, err := strconv.Atoi(v)
+		if err != nil {
+			invalid[errors.Difficulty] = errors.Invalid
+		}
+		query.Filter.Difficulty = difficulty
+	}
+	if len(invalid) > 0 {
+		return nil, errors.NewInputError("Invalid query parameters", invalid)
+	}
+
+	return query, nil
+}
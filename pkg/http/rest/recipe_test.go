@@ -2,93 +2,189 @@ package rest
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 
 	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
 	"github.com/rnov/Go-REST/pkg/logger"
+	"github.com/rnov/Go-REST/pkg/patch"
 	r "github.com/rnov/Go-REST/pkg/recipe"
 )
 
 type RecipeServiceMock struct {
 	getByID func(recipeID string) (*r.Recipe, error)
-	listAll func() ([]*r.Recipe, error)
+	list    func(query *r.Query) (*r.Page, error)
+	search  func(text string, limit int) ([]*r.Recipe, error)
 	create  func(recipe *r.Recipe) error
-	update  func(ID string, recipe *r.Recipe) error
-	delete  func(recipeID string) error
+	batch   func(recipes []*r.Recipe) ([]error, error)
+	export  func(query *r.Query, fn func(recipe *r.Recipe) error) error
+	update  func(ID string, recipe *r.Recipe, version int64) error
+	patch   func(ID string, p patch.Patch, version int64) (*r.Recipe, error)
+	delete  func(recipeID string, version int64) error
 }
 
-func (rsm RecipeServiceMock) GetByID(recipeID string) (*r.Recipe, error) {
+func (rsm RecipeServiceMock) GetByID(ctx context.Context, recipeID string) (*r.Recipe, error) {
 	if rsm.getByID != nil {
 		return rsm.getByID(recipeID)
 	}
 	panic("Not implemented")
 }
 
-func (rsm RecipeServiceMock) ListAll() ([]*r.Recipe, error) {
-	if rsm.listAll != nil {
-		return rsm.listAll()
+func (rsm RecipeServiceMock) List(ctx context.Context, query *r.Query) (*r.Page, error) {
+	if rsm.list != nil {
+		return rsm.list(query)
 	}
 	panic("Not implemented")
 }
 
-func (rsm RecipeServiceMock) Create(recipe *r.Recipe) error {
+func (rsm RecipeServiceMock) Search(ctx context.Context, text string, limit int) ([]*r.Recipe, error) {
+	if rsm.search != nil {
+		return rsm.search(text, limit)
+	}
+	panic("Not implemented")
+}
+
+func (rsm RecipeServiceMock) Create(ctx context.Context, recipe *r.Recipe, user *identity.Principal) error {
 	if rsm.create != nil {
 		return rsm.create(recipe)
 	}
 	panic("Not implemented")
 }
 
-func (rsm RecipeServiceMock) Update(ID string, recipe *r.Recipe) error {
+func (rsm RecipeServiceMock) CreateBatch(ctx context.Context, recipes []*r.Recipe, user *identity.Principal) ([]error, error) {
+	if rsm.batch != nil {
+		return rsm.batch(recipes)
+	}
+	panic("Not implemented")
+}
+
+func (rsm RecipeServiceMock) Export(ctx context.Context, query *r.Query, fn func(recipe *r.Recipe) error) error {
+	if rsm.export != nil {
+		return rsm.export(query, fn)
+	}
+	panic("Not implemented")
+}
+
+func (rsm RecipeServiceMock) Update(ctx context.Context, ID string, recipe *r.Recipe, version int64, user *identity.Principal) error {
 	if rsm.update != nil {
-		return rsm.update(ID, recipe)
+		return rsm.update(ID, recipe, version)
 	}
 	panic("Not implemented")
 }
 
-func (rsm RecipeServiceMock) Delete(recipeID string) error {
+func (rsm RecipeServiceMock) Patch(ctx context.Context, ID string, p patch.Patch, version int64, user *identity.Principal) (*r.Recipe, error) {
+	if rsm.patch != nil {
+		return rsm.patch(ID, p, version)
+	}
+	panic("Not implemented")
+}
+
+func (rsm RecipeServiceMock) Delete(ctx context.Context, recipeID string, version int64, user *identity.Principal) error {
 	if rsm.delete != nil {
-		return rsm.delete(recipeID)
+		return rsm.delete(recipeID, version)
 	}
 	panic("Not implemented")
 }
 
 func TestRecipeHandler_GetRecipeByID(t *testing.T) {
+	stored := func(recipeID string) (*r.Recipe, error) {
+		return &r.Recipe{
+			ID:            "5f10223c",
+			Name:          "qwerty",
+			PrepTime:      20,
+			Difficulty:    3,
+			Vegetarian:    false,
+			Version:       2,
+			AverageRating: 4.5,
+			RatingCount:   2,
+		}, nil
+	}
 	tests := []struct {
 		name            string
 		url             string
+		ifNoneMatch     string
 		service         RecipeServiceMock
 		status          int
+		expectedETag    string
 		expectedPayload *r.Recipe
 	}{
 		{
-			name: "Successful request",
-			url:  "/recipes/5f10223c",
-			service: RecipeServiceMock{
-				getByID: func(recipeID string) (*r.Recipe, error) {
-					return &r.Recipe{
-						ID:         "5f10223c",
-						Name:       "qwerty",
-						PrepTime:   20,
-						Difficulty: 3,
-						Vegetarian: false,
-					}, nil
-				},
+			name:         "Successful request",
+			url:          "/recipes/5f10223c",
+			service:      RecipeServiceMock{getByID: stored},
+			status:       200,
+			expectedETag: `"2-2-4.5"`,
+			expectedPayload: &r.Recipe{
+				ID:            "5f10223c",
+				Name:          "qwerty",
+				PrepTime:      20,
+				Difficulty:    3,
+				Vegetarian:    false,
+				Version:       2,
+				AverageRating: 4.5,
+				RatingCount:   2,
 			},
-			status: 200,
+		},
+		{
+			name:         "Successful request - outdated If-None-Match",
+			url:          "/recipes/5f10223c",
+			ifNoneMatch:  `"1-2-4.5"`,
+			service:      RecipeServiceMock{getByID: stored},
+			status:       200,
+			expectedETag: `"2-2-4.5"`,
 			expectedPayload: &r.Recipe{
-				ID:         "5f10223c",
-				Name:       "qwerty",
-				PrepTime:   20,
-				Difficulty: 3,
-				Vegetarian: false,
+				ID:            "5f10223c",
+				Name:          "qwerty",
+				PrepTime:      20,
+				Difficulty:    3,
+				Vegetarian:    false,
+				Version:       2,
+				AverageRating: 4.5,
+				RatingCount:   2,
 			},
 		},
+		{
+			name:         "Successful request - rated since If-None-Match",
+			url:          "/recipes/5f10223c",
+			ifNoneMatch:  `"2-1-4"`,
+			service:      RecipeServiceMock{getByID: stored},
+			status:       200,
+			expectedETag: `"2-2-4.5"`,
+			expectedPayload: &r.Recipe{
+				ID:            "5f10223c",
+				Name:          "qwerty",
+				PrepTime:      20,
+				Difficulty:    3,
+				Vegetarian:    false,
+				Version:       2,
+				AverageRating: 4.5,
+				RatingCount:   2,
+			},
+		},
+		{
+			name:         "not modified - matching If-None-Match",
+			url:          "/recipes/5f10223c",
+			ifNoneMatch:  `"1-2-4.5", W/"2-2-4.5"`,
+			service:      RecipeServiceMock{getByID: stored},
+			status:       304,
+			expectedETag: `"2-2-4.5"`,
+		},
+		{
+			name:         "not modified - any version",
+			url:          "/recipes/5f10223c",
+			ifNoneMatch:  "*",
+			service:      RecipeServiceMock{getByID: stored},
+			status:       304,
+			expectedETag: `"2-2-4.5"`,
+		},
 		{
 			name: "error getting recipe ID - out of scope",
 			url:  "/recipes/0123456789xyz",
@@ -118,6 +214,9 @@ func TestRecipeHandler_GetRecipeByID(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
+			if len(test.ifNoneMatch) > 0 {
+				req.Header.Set("If-None-Match", test.ifNoneMatch)
+			}
 
 			rh := NewRecipeHandler(&test.service, l)
 
@@ -134,6 +233,12 @@ func TestRecipeHandler_GetRecipeByID(t *testing.T) {
 			if rr.Code != test.status {
 				t.Errorf("handler returned wrong status code: expected %v got %v", test.status, rr.Code)
 			}
+			if etag := rr.Header().Get("ETag"); etag != test.expectedETag {
+				t.Errorf("expected ETag: '%s' instead got: '%s'", test.expectedETag, etag)
+			}
+			if test.status == http.StatusNotModified && rr.Body.Len() > 0 {
+				t.Errorf("expected no body instead got: '%s'", rr.Body.String())
+			}
 
 			if test.expectedPayload != nil {
 				rcp := &r.Recipe{}
@@ -152,14 +257,15 @@ func TestRecipeHandler_GetAllRecipes(t *testing.T) {
 		url             string
 		service         RecipeServiceMock
 		status          int
+		expectedLink    string
 		expectedPayload []*r.Recipe
 	}{
 		{
 			name: "successful request - multiple results",
 			url:  "/recipes",
 			service: RecipeServiceMock{
-				listAll: func() ([]*r.Recipe, error) {
-					return []*r.Recipe{
+				list: func(query *r.Query) (*r.Page, error) {
+					return &r.Page{Recipes: []*r.Recipe{
 						{
 
 							ID:         "5f10223c",
@@ -175,7 +281,7 @@ func TestRecipeHandler_GetAllRecipes(t *testing.T) {
 							Difficulty: 5,
 							Vegetarian: false,
 						},
-					}, nil
+					}}, nil
 				},
 			},
 			status: 200,
@@ -201,8 +307,8 @@ func TestRecipeHandler_GetAllRecipes(t *testing.T) {
 			name: "successful request - empty result",
 			url:  "/recipes",
 			service: RecipeServiceMock{
-				listAll: func() ([]*r.Recipe, error) {
-					return []*r.Recipe{}, nil
+				list: func(query *r.Query) (*r.Page, error) {
+					return &r.Page{Recipes: []*r.Recipe{}}, nil
 				},
 			},
 			status:          200,
@@ -212,12 +318,36 @@ func TestRecipeHandler_GetAllRecipes(t *testing.T) {
 			name: "error - system failure",
 			url:  "/recipes",
 			service: RecipeServiceMock{
-				listAll: func() ([]*r.Recipe, error) {
+				list: func(query *r.Query) (*r.Page, error) {
 					return nil, errors.NewDBErr("system failure")
 				},
 			},
 			status: 500,
 		},
+		{
+			name: "successful request - query parameters and next page",
+			url:  "/recipes?limit=1&sort=-rating&vegetarian=true&maxPrepTime=30&difficulty=2",
+			service: RecipeServiceMock{
+				list: func(query *r.Query) (*r.Page, error) {
+					vegetarian := true
+					expected := &r.Query{Limit: 1, Sort: r.SortRating, Desc: true, Filter: r.Filter{Vegetarian: &vegetarian, MaxPrepTime: 30, Difficulty: 2}}
+					if !reflect.DeepEqual(query, expected) {
+						return nil, errors.NewInputError("unexpected query", nil)
+					}
+					return &r.Page{Recipes: []*r.Recipe{{ID: "5f10223c", Name: "qwerty", PrepTime: 20, Difficulty: 2, Vegetarian: true}}, NextCursor: "next"}, nil
+				},
+			},
+			status:       200,
+			expectedLink: `</recipes?cursor=next&difficulty=2&limit=1&maxPrepTime=30&sort=-rating&vegetarian=true>; rel="next"`,
+			expectedPayload: []*r.Recipe{
+				{ID: "5f10223c", Name: "qwerty", PrepTime: 20, Difficulty: 2, Vegetarian: true},
+			},
+		},
+		{
+			name:   "error - invalid query parameters",
+			url:    "/recipes?limit=ten&cursor=notACursor",
+			status: 400,
+		},
 	}
 
 	for _, test := range tests {
@@ -244,6 +374,10 @@ func TestRecipeHandler_GetAllRecipes(t *testing.T) {
 				t.Errorf("handler returned wrong status code: expected %v got %v", test.status, rr.Code)
 			}
 
+			if link := rr.Header().Get("Link"); link != test.expectedLink {
+				t.Errorf("expected link: '%s' instead got: '%s'", test.expectedLink, link)
+			}
+
 			if test.expectedPayload != nil {
 				rcps := make([]*r.Recipe, 0)
 				_ = json.Unmarshal(rr.Body.Bytes(), &rcps)
@@ -255,14 +389,109 @@ func TestRecipeHandler_GetAllRecipes(t *testing.T) {
 	}
 }
 
-func TestRecipeHandler_CreateRecipe(t *testing.T) {
+func TestRecipeHandler_SearchRecipes(t *testing.T) {
 	tests := []struct {
 		name            string
 		url             string
-		requestPayload  *r.Recipe
 		service         RecipeServiceMock
 		status          int
-		expectedPayload *r.Recipe
+		expectedPayload []*r.Recipe
+	}{
+		{
+			name: "successful request",
+			url:  "/recipes/search?q=chicken+curry&limit=5",
+			service: RecipeServiceMock{
+				search: func(text string, limit int) ([]*r.Recipe, error) {
+					if text != "chicken curry" || limit != 5 {
+						return nil, errors.NewInputError("unexpected search", nil)
+					}
+					return []*r.Recipe{{ID: "5f10223c", Name: "Chicken curry", PrepTime: 20, Difficulty: 2}}, nil
+				},
+			},
+			status: 200,
+			expectedPayload: []*r.Recipe{
+				{ID: "5f10223c", Name: "Chicken curry", PrepTime: 20, Difficulty: 2},
+			},
+		},
+		{
+			name: "successful request - no matches",
+			url:  "/recipes/search?q=pizza",
+			service: RecipeServiceMock{
+				search: func(text string, limit int) ([]*r.Recipe, error) {
+					return []*r.Recipe{}, nil
+				},
+			},
+			status:          200,
+			expectedPayload: []*r.Recipe{},
+		},
+		{
+			name: "error - missing text",
+			url:  "/recipes/search",
+			service: RecipeServiceMock{
+				search: func(text string, limit int) ([]*r.Recipe, error) {
+					return nil, errors.NewInputError("Invalid query parameters", map[string]string{errors.SearchText: errors.MissingText})
+				},
+			},
+			status: 400,
+		},
+		{
+			name:   "error - invalid limit",
+			url:    "/recipes/search?q=pizza&limit=ten",
+			status: 400,
+		},
+		{
+			name: "error - system failure",
+			url:  "/recipes/search?q=pizza",
+			service: RecipeServiceMock{
+				search: func(text string, limit int) ([]*r.Recipe, error) {
+					return nil, errors.NewDBErr("system failure")
+				},
+			},
+			status: 500,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := logger.NewLogger()
+			req, err := http.NewRequest("GET", test.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rh := NewRecipeHandler(&test.service, l)
+
+			rr := httptest.NewRecorder()
+			servicesRouter := mux.NewRouter()
+			servicesRouter.HandleFunc("/recipes/search", rh.SearchRecipes).Methods("GET")
+			servicesRouter.HandleFunc("/recipes/{ID}", rh.GetRecipeByID).Methods("GET")
+			servicesRouter.ServeHTTP(rr, req)
+
+			if rr.Code != test.status {
+				t.Errorf("handler returned wrong status code: expected %v got %v", test.status, rr.Code)
+			}
+			if test.expectedPayload != nil {
+				var rcps []*r.Recipe
+				if err := json.Unmarshal(rr.Body.Bytes(), &rcps); err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(rcps, test.expectedPayload) {
+					t.Errorf("handler returned unexpected body: expected %v got %v", test.expectedPayload, rcps)
+				}
+			}
+		})
+	}
+}
+
+func TestRecipeHandler_CreateRecipe(t *testing.T) {
+	tests := []struct {
+		name             string
+		url              string
+		requestPayload   *r.Recipe
+		service          RecipeServiceMock
+		status           int
+		expectedLocation string
+		expectedPayload  *r.Recipe
 	}{
 		{
 			name: "Successful request",
@@ -279,7 +508,8 @@ func TestRecipeHandler_CreateRecipe(t *testing.T) {
 					return nil
 				},
 			},
-			status: 201,
+			status:           201,
+			expectedLocation: "/recipes/5f10223c",
 			expectedPayload: &r.Recipe{
 				ID:         "5f10223c",
 				Name:       "qwerty",
@@ -288,6 +518,66 @@ func TestRecipeHandler_CreateRecipe(t *testing.T) {
 				Vegetarian: false,
 			},
 		},
+		{
+			name: "Successful request - details round trip",
+			url:  "/recipes",
+			requestPayload: &r.Recipe{
+				ID:          "5f10223c",
+				Name:        "qwerty",
+				PrepTime:    20,
+				Difficulty:  3,
+				Servings:    4,
+				Cuisine:     "spanish",
+				Tags:        []string{"quick"},
+				Ingredients: []r.Ingredient{{Name: "rice", Quantity: 400, Unit: "g"}, {Name: "egg", Quantity: 2}},
+				Steps:       []string{"boil the rice", "fry the eggs"},
+			},
+			service: RecipeServiceMock{
+				create: func(recipe *r.Recipe) error {
+					recipe.CreatedAt = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+					recipe.UpdatedAt = recipe.CreatedAt
+					return nil
+				},
+			},
+			status:           201,
+			expectedLocation: "/recipes/5f10223c",
+			expectedPayload: &r.Recipe{
+				ID:          "5f10223c",
+				Name:        "qwerty",
+				PrepTime:    20,
+				Difficulty:  3,
+				Servings:    4,
+				Cuisine:     "spanish",
+				Tags:        []string{"quick"},
+				Ingredients: []r.Ingredient{{Name: "rice", Quantity: 400, Unit: "g"}, {Name: "egg", Quantity: 2}},
+				Steps:       []string{"boil the rice", "fry the eggs"},
+				CreatedAt:   time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+				UpdatedAt:   time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+			},
+		},
+		{
+			name: "Successful request - generated ID",
+			url:  "/recipes",
+			requestPayload: &r.Recipe{
+				Name:       "qwerty",
+				PrepTime:   20,
+				Difficulty: 3,
+			},
+			service: RecipeServiceMock{
+				create: func(recipe *r.Recipe) error {
+					recipe.ID = "01EDGQ5K2XW4YCPMJBD3T9V7ZN"
+					return nil
+				},
+			},
+			status:           201,
+			expectedLocation: "/recipes/01EDGQ5K2XW4YCPMJBD3T9V7ZN",
+			expectedPayload: &r.Recipe{
+				ID:         "01EDGQ5K2XW4YCPMJBD3T9V7ZN",
+				Name:       "qwerty",
+				PrepTime:   20,
+				Difficulty: 3,
+			},
+		},
 		{
 			name: "error - invalid recipe params ",
 			url:  "/recipes",
@@ -347,6 +637,10 @@ func TestRecipeHandler_CreateRecipe(t *testing.T) {
 				t.Errorf("handler returned wrong status code: expected %v got %v", test.status, rr.Code)
 			}
 
+			if location := rr.Header().Get("Location"); location != test.expectedLocation {
+				t.Errorf("expected location: '%s' instead got: '%s'", test.expectedLocation, location)
+			}
+
 			if test.expectedPayload != nil {
 				rcp := &r.Recipe{}
 				_ = json.Unmarshal(rr.Body.Bytes(), rcp)
@@ -359,37 +653,114 @@ func TestRecipeHandler_CreateRecipe(t *testing.T) {
 }
 
 func TestRecipeHandler_UpdateRecipe(t *testing.T) {
+	// update - the stored recipe is at version 3
+	update := func(ID string, recipe *r.Recipe, version int64) error {
+		if version != 0 && version != 3 {
+			return errors.NewPreconditionErr()
+		}
+		recipe.Version = 4
+		return nil
+	}
+	getByID := func(recipeID string) (*r.Recipe, error) {
+		return &r.Recipe{ID: recipeID, Version: 3}, nil
+	}
+	payload := &r.Recipe{
+		ID:         "5f10223c",
+		Name:       "qwerty",
+		PrepTime:   20,
+		Difficulty: 3,
+		Vegetarian: false,
+	}
+	updated := &r.Recipe{
+		ID:         "5f10223c",
+		Name:       "qwerty",
+		PrepTime:   20,
+		Difficulty: 3,
+		Vegetarian: false,
+		Version:    4,
+	}
 	tests := []struct {
 		name            string
 		url             string
+		ifMatch         string
 		requestPayload  *r.Recipe
 		service         RecipeServiceMock
 		status          int
+		expectedETag    string
 		expectedPayload *r.Recipe
 	}{
 		{
-			name: "Successful request",
-			url:  "/recipes/5f10223c",
-			requestPayload: &r.Recipe{
-				ID:         "5f10223c",
-				Name:       "qwerty",
-				PrepTime:   20,
-				Difficulty: 3,
-				Vegetarian: false,
-			},
-			service: RecipeServiceMock{
-				update: func(ID string, recipe *r.Recipe) error {
-					return nil
-				},
-			},
-			status: 200,
-			expectedPayload: &r.Recipe{
-				ID:         "5f10223c",
-				Name:       "qwerty",
-				PrepTime:   20,
-				Difficulty: 3,
-				Vegetarian: false,
-			},
+			name:            "Successful request",
+			url:             "/recipes/5f10223c",
+			requestPayload:  payload,
+			service:         RecipeServiceMock{update: update},
+			status:          200,
+			expectedETag:    `"4-0-0"`,
+			expectedPayload: updated,
+		},
+		{
+			name:            "Successful request - matching If-Match",
+			url:             "/recipes/5f10223c",
+			ifMatch:         `"3"`,
+			requestPayload:  payload,
+			service:         RecipeServiceMock{update: update},
+			status:          200,
+			expectedETag:    `"4-0-0"`,
+			expectedPayload: updated,
+		},
+		{
+			name:            "Successful request - If-Match of a recipe rated since",
+			url:             "/recipes/5f10223c",
+			ifMatch:         `"3-1-5"`,
+			requestPayload:  payload,
+			service:         RecipeServiceMock{update: update},
+			status:          200,
+			expectedETag:    `"4-0-0"`,
+			expectedPayload: updated,
+		},
+		{
+			name:            "Successful request - If-Match any version",
+			url:             "/recipes/5f10223c",
+			ifMatch:         "*",
+			requestPayload:  payload,
+			service:         RecipeServiceMock{update: update},
+			status:          200,
+			expectedETag:    `"4-0-0"`,
+			expectedPayload: updated,
+		},
+		{
+			name:            "Successful request - If-Match listing the stored version",
+			url:             "/recipes/5f10223c",
+			ifMatch:         `"1", "3"`,
+			requestPayload:  payload,
+			service:         RecipeServiceMock{update: update, getByID: getByID},
+			status:          200,
+			expectedETag:    `"4-0-0"`,
+			expectedPayload: updated,
+		},
+		{
+			name:           "error - outdated If-Match",
+			url:            "/recipes/5f10223c",
+			ifMatch:        `"2"`,
+			requestPayload: payload,
+			service:        RecipeServiceMock{update: update},
+			status:         412,
+		},
+		{
+			name:           "error - If-Match not listing the stored version",
+			url:            "/recipes/5f10223c",
+			ifMatch:        `"1-0-0", "2-3-4"`,
+			requestPayload: payload,
+			service:        RecipeServiceMock{update: update, getByID: getByID},
+			status:         412,
+		},
+		{
+			name:           "error - weak If-Match never matches",
+			url:            "/recipes/5f10223c",
+			ifMatch:        `W/"3"`,
+			requestPayload: payload,
+			service:        RecipeServiceMock{update: update},
+			status:         412,
 		},
 		{
 			name: "error - invalid recipe params ",
@@ -402,7 +773,7 @@ func TestRecipeHandler_UpdateRecipe(t *testing.T) {
 				Vegetarian: false,
 			},
 			service: RecipeServiceMock{
-				update: func(ID string, recipe *r.Recipe) error {
+				update: func(ID string, recipe *r.Recipe, version int64) error {
 					return errors.NewInputError("Invalid input parameters", map[string]string{errors.Rate: errors.OutOfRange})
 				},
 			},
@@ -419,7 +790,7 @@ func TestRecipeHandler_UpdateRecipe(t *testing.T) {
 				Vegetarian: false,
 			},
 			service: RecipeServiceMock{
-				update: func(ID string, recipe *r.Recipe) error {
+				update: func(ID string, recipe *r.Recipe, version int64) error {
 					return errors.NewExistErr(false)
 				},
 			},
@@ -451,6 +822,9 @@ func TestRecipeHandler_UpdateRecipe(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
+			if len(test.ifMatch) > 0 {
+				req.Header.Set("If-Match", test.ifMatch)
+			}
 
 			rh := NewRecipeHandler(&test.service, l)
 
@@ -467,6 +841,9 @@ func TestRecipeHandler_UpdateRecipe(t *testing.T) {
 			if rr.Code != test.status {
 				t.Errorf("handler returned wrong status code: expected %v got %v", test.status, rr.Code)
 			}
+			if etag := rr.Header().Get("ETag"); etag != test.expectedETag {
+				t.Errorf("expected ETag: '%s' instead got: '%s'", test.expectedETag, etag)
+			}
 
 			if test.expectedPayload != nil {
 				rcp := &r.Recipe{}
@@ -479,10 +856,137 @@ func TestRecipeHandler_UpdateRecipe(t *testing.T) {
 	}
 }
 
+func TestRecipeHandler_PatchRecipe(t *testing.T) {
+	// patchService - applies the patch against a stored recipe at version 2
+	patchService := func(ID string, p patch.Patch, version int64) (*r.Recipe, error) {
+		if version != 0 && version != 2 {
+			return nil, errors.NewPreconditionErr()
+		}
+		doc, err := p.Apply([]byte(`{"ID":"5f10223c","name":"qwerty","prepTime":20,"difficulty":3,"version":2}`))
+		if err != nil {
+			return nil, errors.NewInputError("Invalid patch", map[string]string{errors.Patch: err.Error()})
+		}
+		rcp := &r.Recipe{}
+		if err := json.Unmarshal(doc, rcp); err != nil {
+			return nil, err
+		}
+		rcp.Version = 3
+		return rcp, nil
+	}
+	patched := &r.Recipe{ID: "5f10223c", Name: "zxcvb", PrepTime: 20, Difficulty: 3, Version: 3}
+	tests := []struct {
+		name            string
+		contentType     string
+		ifMatch         string
+		body            string
+		service         RecipeServiceMock
+		status          int
+		expectedETag    string
+		expectedPayload *r.Recipe
+	}{
+		{
+			name:            "Successful request - merge patch",
+			contentType:     "application/merge-patch+json",
+			body:            `{"name":"zxcvb"}`,
+			service:         RecipeServiceMock{patch: patchService},
+			status:          200,
+			expectedETag:    `"3-0-0"`,
+			expectedPayload: patched,
+		},
+		{
+			name:            "Successful request - JSON patch with charset and matching If-Match",
+			contentType:     "application/json-patch+json; charset=utf-8",
+			ifMatch:         `"2"`,
+			body:            `[{"op":"replace","path":"/name","value":"zxcvb"}]`,
+			service:         RecipeServiceMock{patch: patchService},
+			status:          200,
+			expectedETag:    `"3-0-0"`,
+			expectedPayload: patched,
+		},
+		{
+			name:        "error - outdated If-Match",
+			contentType: "application/merge-patch+json",
+			ifMatch:     `"1"`,
+			body:        `{"name":"zxcvb"}`,
+			service:     RecipeServiceMock{patch: patchService},
+			status:      412,
+		},
+		{
+			name:        "error - unsupported media type",
+			contentType: "application/json",
+			body:        `{"name":"zxcvb"}`,
+			status:      415,
+		},
+		{
+			name:        "error - malformed patch",
+			contentType: "application/json-patch+json",
+			body:        `{"op":"remove","path":"/name"}`,
+			status:      400,
+		},
+		{
+			name:        "error - patch can not be applied",
+			contentType: "application/json-patch+json",
+			body:        `[{"op":"remove","path":"/servings"}]`,
+			service:     RecipeServiceMock{patch: patchService},
+			status:      400,
+		},
+		{
+			name:        "error - recipe not found",
+			contentType: "application/merge-patch+json",
+			body:        `{"name":"zxcvb"}`,
+			service: RecipeServiceMock{
+				patch: func(ID string, p patch.Patch, version int64) (*r.Recipe, error) {
+					return nil, errors.NewExistErr(false)
+				},
+			},
+			status: 404,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := logger.NewLogger()
+			req, err := http.NewRequest("PATCH", "/recipes/5f10223c", bytes.NewBufferString(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", test.contentType)
+			if len(test.ifMatch) > 0 {
+				req.Header.Set("If-Match", test.ifMatch)
+			}
+
+			rh := NewRecipeHandler(&test.service, l)
+
+			rr := httptest.NewRecorder()
+			servicesRouter := mux.NewRouter()
+			servicesRouter.HandleFunc("/recipes/{ID}", rh.PatchRecipe).Methods("PATCH")
+			servicesRouter.ServeHTTP(rr, req)
+
+			if rr.Code != test.status {
+				t.Errorf("handler returned wrong status code: expected %v got %v", test.status, rr.Code)
+			}
+			if etag := rr.Header().Get("ETag"); etag != test.expectedETag {
+				t.Errorf("expected ETag: '%s' instead got: '%s'", test.expectedETag, etag)
+			}
+			if test.status == http.StatusUnsupportedMediaType && len(rr.Header().Get("Accept-Patch")) == 0 {
+				t.Errorf("expected Accept-Patch header to be set")
+			}
+			if test.expectedPayload != nil {
+				rcp := &r.Recipe{}
+				_ = json.Unmarshal(rr.Body.Bytes(), rcp)
+				if !reflect.DeepEqual(test.expectedPayload, rcp) {
+					t.Errorf("expected: '%v' instead got: '%v'", test.expectedPayload, rcp)
+				}
+			}
+		})
+	}
+}
+
 func TestRecipeHandler_DeleteRecipe(t *testing.T) {
 	tests := []struct {
 		name            string
 		url             string
+		ifMatch         string
 		service         RecipeServiceMock
 		status          int
 		expectedPayload *r.Recipe
@@ -491,7 +995,7 @@ func TestRecipeHandler_DeleteRecipe(t *testing.T) {
 			name: "Successful request",
 			url:  "/recipes/5f10223c",
 			service: RecipeServiceMock{
-				delete: func(recipeID string) error {
+				delete: func(recipeID string, version int64) error {
 					return nil
 				},
 			},
@@ -508,22 +1012,66 @@ func TestRecipeHandler_DeleteRecipe(t *testing.T) {
 			name: "error getting recipe ID - out of scope",
 			url:  "/recipes/0123456789xyz",
 			service: RecipeServiceMock{
-				delete: func(recipeID string) error {
+				delete: func(recipeID string, version int64) error {
 					return errors.NewInputError("Invalid ID format", nil)
 				},
 			},
 			status: 400,
 		},
+		{
+			name:    "Successful request - matching If-Match",
+			url:     "/recipes/5f10223c",
+			ifMatch: `"2"`,
+			service: RecipeServiceMock{
+				delete: func(recipeID string, version int64) error {
+					if version != 2 {
+						return errors.NewPreconditionErr()
+					}
+					return nil
+				},
+			},
+			status: 204,
+		},
+		{
+			name:    "error - outdated If-Match",
+			url:     "/recipes/5f10223c",
+			ifMatch: `"1"`,
+			service: RecipeServiceMock{
+				delete: func(recipeID string, version int64) error {
+					if version != 2 {
+						return errors.NewPreconditionErr()
+					}
+					return nil
+				},
+			},
+			status: 412,
+		},
+		{
+			name:    "error - malformed If-Match",
+			url:     "/recipes/5f10223c",
+			ifMatch: "2",
+			status:  412,
+		},
 		{
 			name: "error - recipe not found ",
 			url:  "/recipes/5f10223c",
 			service: RecipeServiceMock{
-				delete: func(recipeID string) error {
+				delete: func(recipeID string, version int64) error {
 					return errors.NewExistErr(false)
 				},
 			},
 			status: 404,
 		},
+		{
+			name: "error - recipe owned by another user",
+			url:  "/recipes/5f10223c",
+			service: RecipeServiceMock{
+				delete: func(recipeID string, version int64) error {
+					return errors.NewForbiddenErr()
+				},
+			},
+			status: 403,
+		},
 	}
 
 	for _, test := range tests {
@@ -533,6 +1081,9 @@ func TestRecipeHandler_DeleteRecipe(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
+			if len(test.ifMatch) > 0 {
+				req.Header.Set("If-Match", test.ifMatch)
+			}
 
 			rh := NewRecipeHandler(&test.service, l)
 
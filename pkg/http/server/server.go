@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/config"
+	"github.com/rnov/Go-REST/pkg/logger"
+)
+
+// defaults of the settings left to zero in config.Server.
+const (
+	defaultReadHeaderTimeout = 5 * time.Second
+	defaultReadTimeout       = 30 * time.Second
+	defaultWriteTimeout      = 60 * time.Second
+	defaultIdleTimeout       = 120 * time.Second
+	defaultMaxHeaderBytes    = 1 << 20
+	defaultShutdownTimeout   = 30 * time.Second
+)
+
+// Server - HTTP server that finishes the in-flight requests before shutting down.
+type Server struct {
+	srv             *http.Server
+	shutdownTimeout time.Duration
+}
+
+// New - server of the handler as configured by cfg, HTTPS is served whenever a TLS certificate is given.
+func New(cfg config.Server, h http.Handler, l logger.Loggers) (*Server, error) {
+	s := &Server{
+		srv: &http.Server{
+			Addr:              cfg.Address,
+			Handler:           h,
+			ReadHeaderTimeout: orDefault(cfg.ReadHeaderTimeout, defaultReadHeaderTimeout),
+			ReadTimeout:       orDefault(cfg.ReadTimeout, defaultReadTimeout),
+			WriteTimeout:      orDefault(cfg.WriteTimeout, defaultWriteTimeout),
+			IdleTimeout:       orDefault(cfg.IdleTimeout, defaultIdleTimeout),
+			MaxHeaderBytes:    defaultMaxHeaderBytes,
+		},
+		shutdownTimeout: orDefault(cfg.ShutdownTimeout, defaultShutdownTimeout),
+	}
+	if cfg.MaxHeaderBytes > 0 {
+		s.srv.MaxHeaderBytes = cfg.MaxHeaderBytes
+	}
+	if len(cfg.TLS.CertFile) > 0 {
+		tlsCfg, err := newTLSConfig(cfg.TLS, l)
+		if err != nil {
+			return nil, err
+		}
+		s.srv.TLSConfig = tlsCfg
+	}
+
+	return s, nil
+}
+
+// Addr - the address the server listens on.
+func (s *Server) Addr() string {
+	return s.srv.Addr
+}
+
+// Run - serves on the configured address until a signal is received from stop, then stops accepting connections and
+// waits for the in-flight requests to finish, up to the shutdown timeout. Returns nil once the server has shut down
+// gracefully.
+func (s *Server) Run(stop <-chan os.Signal) error {
+	ln, err := net.Listen("tcp", s.srv.Addr)
+	if err != nil {
+		return err
+	}
+	return s.serve(ln, stop)
+}
+
+func (s *Server) serve(ln net.Listener, stop <-chan os.Signal) error {
+	errs := make(chan error, 1)
+	go func() {
+		if s.srv.TLSConfig != nil {
+			// the certificates are provided by the TLS config
+			errs <- s.srv.ServeTLS(ln, "", "")
+			return
+		}
+		errs <- s.srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-stop:
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+
+	return s.srv.Shutdown(ctx)
+}
+
+func orDefault(d, def time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return def
+}
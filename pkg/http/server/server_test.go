@@ -0,0 +1,123 @@
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/config"
+	"github.com/rnov/Go-REST/pkg/logger"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.Server
+		expected *http.Server
+		shutdown time.Duration
+	}{
+		{
+			name: "defaults",
+			cfg:  config.Server{Address: ":8080"},
+			expected: &http.Server{
+				Addr:              ":8080",
+				ReadHeaderTimeout: 5 * time.Second,
+				ReadTimeout:       30 * time.Second,
+				WriteTimeout:      60 * time.Second,
+				IdleTimeout:       120 * time.Second,
+				MaxHeaderBytes:    1 << 20,
+			},
+			shutdown: 30 * time.Second,
+		},
+		{
+			name: "configured",
+			cfg: config.Server{
+				Address:           ":8443",
+				ReadHeaderTimeout: time.Second,
+				ReadTimeout:       2 * time.Second,
+				WriteTimeout:      3 * time.Second,
+				IdleTimeout:       4 * time.Second,
+				MaxHeaderBytes:    4096,
+				ShutdownTimeout:   5 * time.Second,
+			},
+			expected: &http.Server{
+				Addr:              ":8443",
+				ReadHeaderTimeout: time.Second,
+				ReadTimeout:       2 * time.Second,
+				WriteTimeout:      3 * time.Second,
+				IdleTimeout:       4 * time.Second,
+				MaxHeaderBytes:    4096,
+			},
+			shutdown: 5 * time.Second,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := New(test.cfg, http.NotFoundHandler(), logger.NewLogger())
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			got := s.srv
+			if got.Addr != test.expected.Addr || got.ReadHeaderTimeout != test.expected.ReadHeaderTimeout ||
+				got.ReadTimeout != test.expected.ReadTimeout || got.WriteTimeout != test.expected.WriteTimeout ||
+				got.IdleTimeout != test.expected.IdleTimeout || got.MaxHeaderBytes != test.expected.MaxHeaderBytes {
+				t.Errorf("expected: '%+v' instead got: '%+v'", test.expected, got)
+			}
+			if s.shutdownTimeout != test.shutdown {
+				t.Errorf("expected shutdown timeout: %s instead got: %s", test.shutdown, s.shutdownTimeout)
+			}
+		})
+	}
+}
+
+func TestServer_Run(t *testing.T) {
+	// the in-flight request is answered even though the server is told to stop meanwhile
+	started := make(chan struct{})
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+	s, err := New(config.Server{}, h, logger.NewLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan os.Signal, 1)
+	served := make(chan error, 1)
+	go func() {
+		served <- s.serve(ln, stop)
+	}()
+
+	responses := make(chan string, 1)
+	go func() {
+		res, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			responses <- err.Error()
+			return
+		}
+		defer res.Body.Close()
+		body, _ := ioutil.ReadAll(res.Body)
+		responses <- string(body)
+	}()
+	<-started
+	stop <- syscall.SIGTERM
+
+	if err := <-served; err != nil {
+		t.Errorf("expected graceful shutdown instead got: '%s'", err)
+	}
+	if body := <-responses; body != "done" {
+		t.Errorf("expected: 'done' instead got: '%s'", body)
+	}
+	if _, err := http.Get("http://" + ln.Addr().String()); err == nil {
+		t.Errorf("expected connections to be refused after shutdown")
+	}
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/config"
+	"github.com/rnov/Go-REST/pkg/logger"
+)
+
+// client certificates verification, see config.TLSConfig.
+const (
+	ClientAuthRequired = "required"
+	ClientAuthOptional = "optional"
+)
+
+// defaultReloadInterval - how often the TLS files are checked for changes unless configured.
+const defaultReloadInterval = 10 * time.Second
+
+// certReloader - keeps the server certificate and the client CAs loaded from their files, the files are checked for
+// changes at most once per interval whenever a connection is being established. Files that fail to load, e.g. a
+// certificate that has been replaced but not its key yet, are retried on the next check while the previous ones keep
+// being served.
+type certReloader struct {
+	certFile, keyFile, caFile string
+	interval                  time.Duration
+	log                       logger.Loggers
+	now                       func() time.Time
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+	checked   time.Time
+	// clientConfig - config of the handshakes verifying client certificates, see configFor.
+	clientConfig *tls.Config
+}
+
+// newTLSConfig - TLS config of the server as configured by cfg, the certificates are loaded right away.
+func newTLSConfig(cfg config.TLSConfig, l logger.Loggers) (*tls.Config, error) {
+	if len(cfg.KeyFile) == 0 {
+		return nil, fmt.Errorf("TLS key file is missing")
+	}
+	clientAuth := tls.NoClientCert
+	if len(cfg.ClientCAFile) > 0 {
+		switch strings.ToLower(cfg.ClientAuth) {
+		case "", ClientAuthRequired:
+			clientAuth = tls.RequireAndVerifyClientCert
+		case ClientAuthOptional:
+			clientAuth = tls.VerifyClientCertIfGiven
+		default:
+			return nil, fmt.Errorf("unsupported client authentication '%s'", cfg.ClientAuth)
+		}
+	}
+	cr := &certReloader{
+		certFile: cfg.CertFile,
+		keyFile:  cfg.KeyFile,
+		caFile:   cfg.ClientCAFile,
+		interval: orDefault(cfg.ReloadInterval, defaultReloadInterval),
+		log:      l,
+		now:      time.Now,
+	}
+	if err := cr.load(); err != nil {
+		return nil, err
+	}
+	cr.checked = cr.now()
+
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: clientAuth,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, _ := cr.current()
+			return cert, nil
+		},
+	}
+	if clientAuth != tls.NoClientCert {
+		// the client CAs are not looked up per handshake, the config is rebuilt instead
+		base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return cr.configFor(base), nil
+		}
+	}
+
+	return base, nil
+}
+
+// current - the certificate and client CAs to use, they are reloaded first whenever their files have changed.
+func (cr *certReloader) current() (*tls.Certificate, *x509.CertPool) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if now := cr.now(); now.Sub(cr.checked) >= cr.interval {
+		cr.checked = now
+		if cr.changed() {
+			if err := cr.load(); err != nil {
+				cr.log.Errorf("error reloading TLS certificates, the previous ones are kept: %s", err.Error())
+			} else {
+				cr.log.Info("TLS certificates reloaded")
+			}
+		}
+	}
+
+	return cr.cert, cr.clientCAs
+}
+
+// configFor - base along with the current client CAs, it is only cloned again once the client CAs have been reloaded.
+// The clone has no session ticket keys of its own, hence tickets keep being issued and resumed with the keys of base.
+func (cr *certReloader) configFor(base *tls.Config) *tls.Config {
+	_, clientCAs := cr.current()
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if cr.clientConfig == nil || cr.clientConfig.ClientCAs != clientCAs {
+		c := base.Clone()
+		c.ClientCAs = clientCAs
+		cr.clientConfig = c
+	}
+
+	return cr.clientConfig
+}
+
+// changed - whether any of the files has been modified since it was loaded, files that can not be checked are taken as
+// modified so that the error is reported by load.
+func (cr *certReloader) changed() bool {
+	for _, file := range cr.files() {
+		info, err := os.Stat(file)
+		if err != nil || !info.ModTime().Equal(cr.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// load - loads all the files, nothing is replaced unless all of them are valid.
+func (cr *certReloader) load() error {
+	modTimes := make(map[string]time.Time)
+	for _, file := range cr.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[file] = info.ModTime()
+	}
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return err
+	}
+	var clientCAs *x509.CertPool
+	if len(cr.caFile) > 0 {
+		pem, err := ioutil.ReadFile(cr.caFile)
+		if err != nil {
+			return err
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no CA certificate found in '%s'", cr.caFile)
+		}
+	}
+	cr.cert, cr.clientCAs, cr.modTimes = &cert, clientCAs, modTimes
+
+	return nil
+}
+
+func (cr *certReloader) files() []string {
+	if len(cr.caFile) > 0 {
+		return []string{cr.certFile, cr.keyFile, cr.caFile}
+	}
+	return []string{cr.certFile, cr.keyFile}
+}
@@ -0,0 +1,319 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/config"
+	"github.com/rnov/Go-REST/pkg/logger"
+)
+
+// testCA - self signed CA issuing the certificates of the tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+// issue - PEM encoded certificate and key of the subject, valid for the loopback address.
+func (ca *testCA) issue(t *testing.T, serial int64, subject pkix.Name, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func (ca *testCA) pem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
+// writeFile - writes the file with the given modification time, so that changes are told apart regardless of the
+// file system time resolution.
+func writeFile(t *testing.T, name string, data []byte, modTime time.Time) {
+	if err := ioutil.WriteFile(name, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(name, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServer_RunTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorest-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := newTestCA(t)
+	now := time.Now()
+	cfg := config.TLSConfig{
+		CertFile:     filepath.Join(dir, "server.pem"),
+		KeyFile:      filepath.Join(dir, "server-key.pem"),
+		ClientCAFile: filepath.Join(dir, "ca.pem"),
+	}
+	certPEM, keyPEM := ca.issue(t, 2, pkix.Name{CommonName: "gorest"}, x509.ExtKeyUsageServerAuth)
+	writeFile(t, cfg.CertFile, certPEM, now)
+	writeFile(t, cfg.KeyFile, keyPEM, now)
+	writeFile(t, cfg.ClientCAFile, ca.pem(), now)
+
+	// the handler answers with the subject of the client certificate
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.VerifiedChains[0][0].Subject.String()))
+	})
+	s, err := New(config.Server{TLS: cfg}, h, logger.NewLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan os.Signal, 1)
+	served := make(chan error, 1)
+	go func() {
+		served <- s.serve(ln, stop)
+	}()
+	defer func() {
+		stop <- syscall.SIGTERM
+		if err := <-served; err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	clientPEM, clientKeyPEM := ca.issue(t, 3, pkix.Name{CommonName: "ci", Organization: []string{"Acme"}},
+		x509.ExtKeyUsageClientAuth)
+	clientCert, err := tls.X509KeyPair(clientPEM, clientKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name         string
+		certs        []tls.Certificate
+		expectedBody string
+		expectedErr  bool
+	}{
+		{name: "client certificate", certs: []tls.Certificate{clientCert}, expectedBody: "CN=ci,O=Acme"},
+		{name: "error - client certificate required", expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &http.Client{Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: test.certs},
+			}}
+			res, err := client.Get("https://" + ln.Addr().String())
+			if (err != nil) != test.expectedErr {
+				t.Fatalf("expected error: %t instead got: '%v'", test.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			defer res.Body.Close()
+			body, _ := ioutil.ReadAll(res.Body)
+			if string(body) != test.expectedBody {
+				t.Errorf("expected: '%s' instead got: '%s'", test.expectedBody, body)
+			}
+		})
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	tests := []struct {
+		name               string
+		cfg                config.TLSConfig
+		expectedClientAuth tls.ClientAuthType
+		expectedErr        bool
+	}{
+		{name: "no client certificates", cfg: config.TLSConfig{}, expectedClientAuth: tls.NoClientCert},
+		{name: "required by default", cfg: config.TLSConfig{ClientCAFile: "ca.pem"}, expectedClientAuth: tls.RequireAndVerifyClientCert},
+		{name: "optional", cfg: config.TLSConfig{ClientCAFile: "ca.pem", ClientAuth: "optional"}, expectedClientAuth: tls.VerifyClientCertIfGiven},
+		{name: "error - unknown client authentication", cfg: config.TLSConfig{ClientCAFile: "ca.pem", ClientAuth: "request"}, expectedErr: true},
+		{name: "error - missing CA file", cfg: config.TLSConfig{ClientCAFile: "missing.pem"}, expectedErr: true},
+		{name: "error - missing key", cfg: config.TLSConfig{KeyFile: "-"}, expectedErr: true},
+	}
+
+	dir, err := ioutil.TempDir("", "gorest-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, 2, pkix.Name{CommonName: "gorest"}, x509.ExtKeyUsageServerAuth)
+	writeFile(t, filepath.Join(dir, "server.pem"), certPEM, time.Now())
+	writeFile(t, filepath.Join(dir, "server-key.pem"), keyPEM, time.Now())
+	writeFile(t, filepath.Join(dir, "ca.pem"), ca.pem(), time.Now())
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := test.cfg
+			cfg.CertFile = filepath.Join(dir, "server.pem")
+			if cfg.KeyFile == "-" {
+				cfg.KeyFile = ""
+			} else {
+				cfg.KeyFile = filepath.Join(dir, "server-key.pem")
+			}
+			if len(cfg.ClientCAFile) > 0 {
+				cfg.ClientCAFile = filepath.Join(dir, cfg.ClientCAFile)
+			}
+			tlsCfg, err := newTLSConfig(cfg, logger.NewLogger())
+			if (err != nil) != test.expectedErr {
+				t.Fatalf("expected error: %t instead got: '%v'", test.expectedErr, err)
+			}
+			if err == nil && tlsCfg.ClientAuth != test.expectedClientAuth {
+				t.Errorf("expected: %v instead got: %v", test.expectedClientAuth, tlsCfg.ClientAuth)
+			}
+		})
+	}
+}
+
+func TestCertReloader_Current(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorest-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := newTestCA(t)
+	modTime := time.Now().Add(-time.Hour)
+	cr := &certReloader{
+		certFile: filepath.Join(dir, "server.pem"),
+		keyFile:  filepath.Join(dir, "server-key.pem"),
+		interval: 10 * time.Second,
+		log:      logger.NewLogger(),
+	}
+	certPEM, keyPEM := ca.issue(t, 2, pkix.Name{CommonName: "gorest"}, x509.ExtKeyUsageServerAuth)
+	writeFile(t, cr.certFile, certPEM, modTime)
+	writeFile(t, cr.keyFile, keyPEM, modTime)
+	if err := cr.load(); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2020, 7, 16, 10, 0, 0, 0, time.UTC)
+	cr.checked = now
+	cr.now = func() time.Time { return now }
+	serial := func() int64 {
+		cert, _ := cr.current()
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf.SerialNumber.Int64()
+	}
+
+	// the renewed certificate is not loaded until the interval has elapsed
+	certPEM, keyPEM = ca.issue(t, 3, pkix.Name{CommonName: "gorest"}, x509.ExtKeyUsageServerAuth)
+	writeFile(t, cr.certFile, certPEM, modTime.Add(time.Minute))
+	if got := serial(); got != 2 {
+		t.Errorf("expected serial 2 before the interval elapsed instead got: %d", got)
+	}
+	// the certificate does not match the previous key, which is kept meanwhile
+	now = now.Add(10 * time.Second)
+	if got := serial(); got != 2 {
+		t.Errorf("expected serial 2 until the key is replaced instead got: %d", got)
+	}
+	writeFile(t, cr.keyFile, keyPEM, modTime.Add(time.Minute))
+	now = now.Add(10 * time.Second)
+	if got := serial(); got != 3 {
+		t.Errorf("expected serial 3 once reloaded instead got: %d", got)
+	}
+}
+
+func TestCertReloader_ConfigFor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorest-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := newTestCA(t)
+	modTime := time.Now().Add(-time.Hour)
+	cr := &certReloader{
+		certFile: filepath.Join(dir, "server.pem"),
+		keyFile:  filepath.Join(dir, "server-key.pem"),
+		caFile:   filepath.Join(dir, "ca.pem"),
+		interval: 10 * time.Second,
+		log:      logger.NewLogger(),
+	}
+	certPEM, keyPEM := ca.issue(t, 2, pkix.Name{CommonName: "gorest"}, x509.ExtKeyUsageServerAuth)
+	writeFile(t, cr.certFile, certPEM, modTime)
+	writeFile(t, cr.keyFile, keyPEM, modTime)
+	writeFile(t, cr.caFile, ca.pem(), modTime)
+	if err := cr.load(); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2020, 7, 16, 10, 0, 0, 0, time.UTC)
+	cr.checked = now
+	cr.now = func() time.Time { return now }
+	base := &tls.Config{MinVersion: tls.VersionTLS12, ClientAuth: tls.RequireAndVerifyClientCert}
+
+	// handshakes share the config until the client CAs are reloaded
+	first := cr.configFor(base)
+	if first == base || first.ClientCAs != cr.clientCAs {
+		t.Fatalf("expected a clone of base holding the client CAs")
+	}
+	if second := cr.configFor(base); second != first {
+		t.Errorf("expected the config to be cloned once")
+	}
+	writeFile(t, cr.caFile, newTestCA(t).pem(), modTime.Add(time.Minute))
+	now = now.Add(10 * time.Second)
+	reloaded := cr.configFor(base)
+	if reloaded == first || reloaded.ClientCAs != cr.clientCAs || reloaded.ClientCAs == first.ClientCAs {
+		t.Errorf("expected the config to be cloned again with the reloaded client CAs")
+	}
+}
@@ -0,0 +1,117 @@
+package id
+
+import (
+	"crypto/rand"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Len - length of the generated IDs.
+const Len = 26
+
+// encoding - Crockford's base32 alphabet, its characters are in ascending byte order so that encoded IDs sort the same
+// way their binary values do.
+const encoding = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// Generator - generates ULID like IDs: 48 bits of milliseconds since epoch followed by 80 random bits, encoded in 26
+// characters. IDs are sortable by creation time, IDs generated within the same millisecond increment the random bits of
+// the previous one so that they keep being ordered. It is safe for concurrent use.
+type Generator struct {
+	mu      sync.Mutex
+	entropy io.Reader
+	now     func() time.Time
+	lastMs  uint64
+	last    [10]byte
+}
+
+func NewGenerator() *Generator {
+	return &Generator{
+		entropy: rand.Reader,
+		now:     time.Now,
+	}
+}
+
+var defaultGenerator = NewGenerator()
+
+// New - generates an ID with the default generator.
+func New() (string, error) {
+	return defaultGenerator.New()
+}
+
+func (g *Generator) New() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := uint64(g.now().UnixNano() / int64(time.Millisecond))
+	if ms <= g.lastMs && increment(&g.last) {
+		// the clock did not move forward (or went backwards), keep the last timestamp so that IDs stay ordered
+		ms = g.lastMs
+	} else {
+		if _, err := io.ReadFull(g.entropy, g.last[:]); err != nil {
+			return "", err
+		}
+		// the random bits overflowed, move on to the next millisecond
+		if ms <= g.lastMs {
+			ms = g.lastMs + 1
+		}
+	}
+	g.lastMs = ms
+
+	var b [16]byte
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+	copy(b[6:], g.last[:])
+
+	return encode(b), nil
+}
+
+// increment - adds one to the random bits, returns false when they overflow.
+func increment(r *[10]byte) bool {
+	for i := len(r) - 1; i >= 0; i-- {
+		r[i]++
+		if r[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encode - encodes the 128 bits in groups of 5 bits, the first character only holds the 3 most significant bits.
+func encode(b [16]byte) string {
+	out := make([]byte, Len)
+	// bits are read from the least significant end
+	var acc uint32
+	var bits uint
+	pos := Len - 1
+	for i := len(b) - 1; i >= 0; i-- {
+		acc |= uint32(b[i]) << bits
+		bits += 8
+		for bits >= 5 {
+			out[pos] = encoding[acc&31]
+			acc >>= 5
+			bits -= 5
+			pos--
+		}
+	}
+	out[pos] = encoding[acc&31]
+
+	return string(out)
+}
+
+// Valid - whether s is an ID as generated by New, i.e. Len characters of the encoding alphabet the first of which only
+// holds 3 bits.
+func Valid(s string) bool {
+	if len(s) != Len || s[0] > '7' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(encoding, s[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
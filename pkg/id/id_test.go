@@ -0,0 +1,133 @@
+package id
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGenerator_New(t *testing.T) {
+	g := NewGenerator()
+	prev := ""
+	for i := 0; i < 1000; i++ {
+		ID, err := g.New()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(ID) != Len {
+			t.Fatalf("expected an ID of %d characters instead got: '%s'", Len, ID)
+		}
+		for _, c := range ID {
+			if !strings.ContainsRune(encoding, c) {
+				t.Fatalf("unexpected character '%c' in ID '%s'", c, ID)
+			}
+		}
+		if ID <= prev {
+			t.Fatalf("expected '%s' to be sorted after '%s'", ID, prev)
+		}
+		prev = ID
+	}
+}
+
+func TestGenerator_Timestamp(t *testing.T) {
+	g := NewGenerator()
+	g.now = func() time.Time {
+		return time.Unix(0, 0).Add(time.Millisecond)
+	}
+	g.entropy = bytes.NewReader(make([]byte, 10))
+	ID, err := g.New()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := "00000000010000000000000000"; ID != expected {
+		t.Errorf("expected: '%s' instead got: '%s'", expected, ID)
+	}
+
+	// same millisecond, the random bits are incremented
+	ID, _ = g.New()
+	if expected := "00000000010000000000000001"; ID != expected {
+		t.Errorf("expected: '%s' instead got: '%s'", expected, ID)
+	}
+
+	// the clock went backwards, IDs keep being ordered
+	g.now = func() time.Time {
+		return time.Unix(0, 0)
+	}
+	next, _ := g.New()
+	if next <= ID {
+		t.Errorf("expected '%s' to be sorted after '%s'", next, ID)
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("entropy issue")
+}
+
+func TestGenerator_EntropyError(t *testing.T) {
+	g := NewGenerator()
+	g.entropy = failingReader{}
+	if _, err := g.New(); err == nil {
+		t.Errorf("expected error instead got nil")
+	}
+}
+
+func TestGenerator_Concurrency(t *testing.T) {
+	g := NewGenerator()
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				ID, err := g.New()
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+					return
+				}
+				mu.Lock()
+				if seen[ID] {
+					t.Errorf("duplicated ID '%s'", ID)
+				}
+				seen[ID] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestValid(t *testing.T) {
+	generated, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		ID    string
+		valid bool
+	}{
+		{name: "generated ID", ID: generated, valid: true},
+		{name: "largest ID", ID: "7ZZZZZZZZZZZZZZZZZZZZZZZZZ", valid: true},
+		{name: "too short", ID: generated[1:]},
+		{name: "too long", ID: generated + "0"},
+		{name: "timestamp overflow", ID: "8ZZZZZZZZZZZZZZZZZZZZZZZZZ"},
+		{name: "lower case", ID: "01ec9v3p6y8b8xwj2q3kz4m5n6"},
+		{name: "excluded letter", ID: "01EC9V3P6Y8B8XWJ2Q3KZ4M5NU"},
+		{name: "dash", ID: "01EC9V3P-6Y8B8XWJ2Q3KZ4M5N"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if valid := Valid(test.ID); valid != test.valid {
+				t.Errorf("expected: '%t' instead got: '%t'", test.valid, valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package identity
+
+import "context"
+
+// Role - set of permissions granted to a user, each role includes the permissions of the previous one.
+type Role string
+
+const (
+	// Reader - authenticated user that can not modify recipes, it can rate them though. Reading recipes and rates needs
+	// no permission since those routes are public, being a reader means being allowed to rate.
+	Reader Role = "reader"
+	// Editor - can create recipes and modify the ones it owns.
+	Editor Role = "editor"
+	// Admin - can modify any recipe and manage the API.
+	Admin Role = "admin"
+)
+
+// DefaultRole - role of the users that have not been granted any, least privilege.
+const DefaultRole = Reader
+
+// Permission - an operation a route or a service method requires to be granted. There is none to read, recipes and
+// their rates can be read without authentication.
+type Permission string
+
+const (
+	// CreateRecipe - create new recipes, owned by the user creating them.
+	CreateRecipe Permission = "recipe:create"
+	// EditRecipe - update and delete the recipes owned by the user.
+	EditRecipe Permission = "recipe:edit"
+	// EditAnyRecipe - update and delete any recipe regardless of its owner.
+	EditAnyRecipe Permission = "recipe:edit:any"
+	// RateRecipe - rate recipes and retract the rate, one per user and recipe.
+	RateRecipe Permission = "recipe:rate"
+	// ManageAPIKeys - create, list, rotate and revoke API keys.
+	ManageAPIKeys Permission = "apikey:manage"
+)
+
+var rolePermissions = map[Role][]Permission{
+	Reader: {RateRecipe},
+	Editor: {RateRecipe, CreateRecipe, EditRecipe},
+	Admin:  {RateRecipe, CreateRecipe, EditRecipe, EditAnyRecipe, ManageAPIKeys},
+}
+
+// ValidRole - checks that the given role exists.
+func ValidRole(role Role) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// ParseRole - the role named by s, an empty name stands for DefaultRole.
+func ParseRole(s string) (Role, bool) {
+	if len(s) == 0 {
+		return DefaultRole, true
+	}
+	role := Role(s)
+	return role, ValidRole(role)
+}
+
+// Grants - whether the permission is included in the role.
+func (r Role) Grants(perm Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Principal - the authenticated user a request is made on behalf of. Scopes, when given, restrict the permissions
+// granted by the role to those listed, e.g. API keys limited to a few operations.
+type Principal struct {
+	Username string       `json:"username"`
+	Role     Role         `json:"role"`
+	Scopes   []Permission `json:"scopes,omitempty"`
+}
+
+// Can - whether the principal has been granted the permission through its role and, if any, its scopes.
+func (p *Principal) Can(perm Permission) bool {
+	if p == nil || !p.Role.Grants(perm) {
+		return false
+	}
+	if len(p.Scopes) == 0 {
+		return true
+	}
+	for _, scope := range p.Scopes {
+		if scope == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// CanEdit - whether the principal can modify a resource owned by owner, resources without owner can only be modified by
+// those allowed to modify any of them.
+func (p *Principal) CanEdit(owner string) bool {
+	if p.Can(EditAnyRecipe) {
+		return true
+	}
+	return p.Can(EditRecipe) && len(owner) > 0 && owner == p.Username
+}
+
+// Credentials - the stored secret a user authenticates with, PasswordHash is a salted hash encoding its own algorithm and
+// parameters.
+type Credentials struct {
+	Principal
+	PasswordHash string
+}
+
+type contextKey struct{}
+
+// NewContext - returns a copy of ctx carrying the principal.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext - the principal carried by ctx, if any.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(*Principal)
+	return p, ok && p != nil
+}
@@ -0,0 +1,74 @@
+package identity
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPrincipal_Can(t *testing.T) {
+	tests := []struct {
+		name     string
+		role     Role
+		scopes   []Permission
+		perm     Permission
+		expected bool
+	}{
+		{name: "reader can not create", role: Reader, perm: CreateRecipe},
+		{name: "reader can rate", role: Reader, perm: RateRecipe, expected: true},
+		{name: "editor can create", role: Editor, perm: CreateRecipe, expected: true},
+		{name: "editor can edit its own", role: Editor, perm: EditRecipe, expected: true},
+		{name: "editor can not edit any", role: Editor, perm: EditAnyRecipe},
+		{name: "admin can edit any", role: Admin, perm: EditAnyRecipe, expected: true},
+		{name: "unknown role", role: "root", perm: CreateRecipe},
+		{name: "admin can manage API keys", role: Admin, perm: ManageAPIKeys, expected: true},
+		{name: "editor can not manage API keys", role: Editor, perm: ManageAPIKeys},
+		{name: "scoped admin can create", role: Admin, scopes: []Permission{CreateRecipe}, perm: CreateRecipe, expected: true},
+		{name: "scoped admin can not edit", role: Admin, scopes: []Permission{CreateRecipe}, perm: EditRecipe},
+		{name: "scope not granted by the role", role: Reader, scopes: []Permission{CreateRecipe}, perm: CreateRecipe},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &Principal{Username: "chef", Role: test.role, Scopes: test.scopes}
+			if got := p.Can(test.perm); got != test.expected {
+				t.Errorf("expected: %t instead got: %t", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestPrincipal_CanEdit(t *testing.T) {
+	tests := []struct {
+		name     string
+		p        *Principal
+		owner    string
+		expected bool
+	}{
+		{name: "editor owner", p: &Principal{Username: "chef", Role: Editor}, owner: "chef", expected: true},
+		{name: "editor not owner", p: &Principal{Username: "chef", Role: Editor}, owner: "cook"},
+		{name: "editor without owner", p: &Principal{Role: Editor}},
+		{name: "reader owner", p: &Principal{Username: "chef", Role: Reader}, owner: "chef"},
+		{name: "admin not owner", p: &Principal{Username: "admin", Role: Admin}, owner: "chef", expected: true},
+		{name: "admin without owner", p: &Principal{Username: "admin", Role: Admin}, expected: true},
+		{name: "no principal", owner: "chef"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.p.CanEdit(test.owner); got != test.expected {
+				t.Errorf("expected: %t instead got: %t", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestContext(t *testing.T) {
+	if _, ok := FromContext(context.Background()); ok {
+		t.Errorf("expected no principal")
+	}
+	p := &Principal{Username: "chef", Role: Editor}
+	got, ok := FromContext(NewContext(context.Background(), p))
+	if !ok || got != p {
+		t.Errorf("expected: '%v' instead got: '%v'", p, got)
+	}
+}
@@ -0,0 +1,16 @@
+package logger
+
+import "context"
+
+type contextKey struct{}
+
+// NewContext - returns a copy of ctx carrying the logger, e.g. a logger carrying the request ID.
+func NewContext(ctx context.Context, l Loggers) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext - the logger carried by ctx, if any.
+func FromContext(ctx context.Context) (Loggers, bool) {
+	l, ok := ctx.Value(contextKey{}).(Loggers)
+	return l, ok && l != nil
+}
@@ -0,0 +1,277 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/config"
+)
+
+// Level - severity of the entries, entries less severe than the level of the logger are discarded.
+type Level int
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	NoticeLevel
+	WarningLevel
+	ErrorLevel
+	CriticalLevel
+)
+
+var levelNames = []string{"debug", "info", "notice", "warning", "error", "critical"}
+
+func (lv Level) String() string {
+	if lv < DebugLevel || lv > CriticalLevel {
+		return fmt.Sprintf("level(%d)", int(lv))
+	}
+	return levelNames[lv]
+}
+
+// ParseLevel - the level named by s, case insensitive. An empty name stands for InfoLevel.
+func ParseLevel(s string) (Level, error) {
+	if len(s) == 0 {
+		return InfoLevel, nil
+	}
+	for lv, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(lv), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level '%s'", s)
+}
+
+// outputs the entries can be written to, see config.LoggerConfig.
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+	File   = "file"
+)
+
+// Fields - key/value pairs attached to the entries, e.g. the request ID.
+type Fields map[string]interface{}
+
+// FieldLogger - logger that attaches fields to the entries it writes.
+type FieldLogger interface {
+	Loggers
+	// With - logger writing the given fields along with those of the logger, the logger itself is left unchanged.
+	With(fields Fields) FieldLogger
+}
+
+// With - l with the fields attached whenever it supports them, l as it is otherwise.
+func With(l Loggers, fields Fields) Loggers {
+	if fl, ok := l.(FieldLogger); ok {
+		return fl.With(fields)
+	}
+	return l
+}
+
+// reserved - keys of the entries that fields can not override.
+var reserved = map[string]bool{"time": true, "level": true, "logger": true, "msg": true}
+
+// JSONLogger - structured logger writing every entry as a single line JSON object, e.g.
+// {"level":"error","logger":"goREST","msg":"...","requestID":"...","time":"2020-07-16T10:00:00.000Z"}
+type JSONLogger struct {
+	name   string
+	level  Level
+	out    *output
+	fields Fields
+	now    func() time.Time
+	exit   func(code int)
+}
+
+// output - destination shared by a logger and those derived from it by With, entries are written one at a time.
+type output struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONLogger - logger writing to w the entries at least as severe as level.
+func NewJSONLogger(name string, w io.Writer, level Level) *JSONLogger {
+	return &JSONLogger{
+		name:  name,
+		level: level,
+		out:   &output{w: w},
+		now:   time.Now,
+		exit:  os.Exit,
+	}
+}
+
+// New - JSON logger configured by cfg, relative log files are placed under logsPath.
+func New(cfg config.LoggerConfig, logsPath string) (*JSONLogger, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	name := cfg.Name
+	if len(name) == 0 {
+		name = "goREST"
+	}
+	var w io.Writer
+	switch strings.ToLower(cfg.Output) {
+	case "", Stdout:
+		w = os.Stdout
+	case Stderr:
+		w = os.Stderr
+	case File:
+		if len(cfg.File) == 0 {
+			return nil, fmt.Errorf("log file is missing")
+		}
+		path := cfg.File
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(logsPath, path)
+		}
+		if w, err = newRotatingFile(path, int64(cfg.MaxSizeMB)<<20, cfg.MaxBackups); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported log output '%s'", cfg.Output)
+	}
+
+	return NewJSONLogger(name, w, level), nil
+}
+
+// With - see FieldLogger.
+func (l *JSONLogger) With(fields Fields) FieldLogger {
+	merged := make(Fields, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	child := *l
+	child.fields = merged
+	return &child
+}
+
+// Writer - writer logging each line written to it as an entry of the given level, e.g. to hand the logger over to
+// packages logging through the standard log package.
+func (l *JSONLogger) Writer(level Level) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		l.log(level, strings.TrimRight(string(p), "\n"))
+		return len(p), nil
+	})
+}
+
+// Close - closes the output, if it has to be closed at all.
+func (l *JSONLogger) Close() error {
+	if c, ok := l.out.w.(io.Closer); ok && l.out.w != os.Stdout && l.out.w != os.Stderr {
+		return c.Close()
+	}
+	return nil
+}
+
+func (l *JSONLogger) log(level Level, msg string) {
+	if level < l.level {
+		return
+	}
+	entry := make(map[string]interface{}, len(l.fields)+4)
+	for k, v := range l.fields {
+		if reserved[k] {
+			continue
+		}
+		// errors would be encoded as empty objects otherwise
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		entry[k] = v
+	}
+	entry["time"] = l.now().UTC().Format(time.RFC3339Nano)
+	entry["level"] = level.String()
+	entry["logger"] = l.name
+	entry["msg"] = msg
+	line, err := json.Marshal(entry)
+	if err != nil {
+		line, _ = json.Marshal(map[string]string{"time": entry["time"].(string), "level": level.String(),
+			"logger": l.name, "msg": msg, "logError": err.Error()})
+	}
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	l.out.w.Write(append(line, '\n'))
+}
+
+// Fatal - logs a critical entry, then exits.
+func (l *JSONLogger) Fatal(args ...interface{}) {
+	l.log(CriticalLevel, fmt.Sprint(args...))
+	l.exit(1)
+}
+
+func (l *JSONLogger) Fatalf(format string, args ...interface{}) {
+	l.log(CriticalLevel, fmt.Sprintf(format, args...))
+	l.exit(1)
+}
+
+// Panic - logs a critical entry, then panics.
+func (l *JSONLogger) Panic(args ...interface{}) {
+	msg := fmt.Sprint(args...)
+	l.log(CriticalLevel, msg)
+	panic(msg)
+}
+
+func (l *JSONLogger) Panicf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	l.log(CriticalLevel, msg)
+	panic(msg)
+}
+
+func (l *JSONLogger) Critical(args ...interface{}) {
+	l.log(CriticalLevel, fmt.Sprint(args...))
+}
+
+func (l *JSONLogger) Criticalf(format string, args ...interface{}) {
+	l.log(CriticalLevel, fmt.Sprintf(format, args...))
+}
+
+func (l *JSONLogger) Error(args ...interface{}) {
+	l.log(ErrorLevel, fmt.Sprint(args...))
+}
+
+func (l *JSONLogger) Errorf(format string, args ...interface{}) {
+	l.log(ErrorLevel, fmt.Sprintf(format, args...))
+}
+
+func (l *JSONLogger) Warning(args ...interface{}) {
+	l.log(WarningLevel, fmt.Sprint(args...))
+}
+
+func (l *JSONLogger) Warningf(format string, args ...interface{}) {
+	l.log(WarningLevel, fmt.Sprintf(format, args...))
+}
+
+func (l *JSONLogger) Notice(args ...interface{}) {
+	l.log(NoticeLevel, fmt.Sprint(args...))
+}
+
+func (l *JSONLogger) Noticef(format string, args ...interface{}) {
+	l.log(NoticeLevel, fmt.Sprintf(format, args...))
+}
+
+func (l *JSONLogger) Info(args ...interface{}) {
+	l.log(InfoLevel, fmt.Sprint(args...))
+}
+
+func (l *JSONLogger) Infof(format string, args ...interface{}) {
+	l.log(InfoLevel, fmt.Sprintf(format, args...))
+}
+
+func (l *JSONLogger) Debug(args ...interface{}) {
+	l.log(DebugLevel, fmt.Sprint(args...))
+}
+
+func (l *JSONLogger) Debugf(format string, args ...interface{}) {
+	l.log(DebugLevel, fmt.Sprintf(format, args...))
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
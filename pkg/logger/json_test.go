@@ -0,0 +1,199 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/config"
+)
+
+func newTestLogger(level Level) (*JSONLogger, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	l := NewJSONLogger("goREST", buf, level)
+	l.now = func() time.Time { return time.Date(2020, 7, 16, 10, 0, 0, 0, time.UTC) }
+	return l, buf
+}
+
+// entries - the JSON entries written to buf, one per line.
+func entries(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var res []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		entry := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid entry '%s': %s", line, err)
+		}
+		res = append(res, entry)
+	}
+	return res
+}
+
+func TestJSONLogger(t *testing.T) {
+	tests := []struct {
+		name     string
+		level    Level
+		log      func(l FieldLogger)
+		expected []map[string]interface{}
+	}{
+		{
+			name:  "entry",
+			level: InfoLevel,
+			log:   func(l FieldLogger) { l.Errorf("error reading recipe '%s'", "5f10223c") },
+			expected: []map[string]interface{}{
+				{"time": "2020-07-16T10:00:00Z", "level": "error", "logger": "goREST", "msg": "error reading recipe '5f10223c'"},
+			},
+		},
+		{
+			name:  "less severe entries are discarded",
+			level: WarningLevel,
+			log: func(l FieldLogger) {
+				l.Info("discarded")
+				l.Debugf("discarded %d", 1)
+				l.Warning("kept")
+			},
+			expected: []map[string]interface{}{
+				{"time": "2020-07-16T10:00:00Z", "level": "warning", "logger": "goREST", "msg": "kept"},
+			},
+		},
+		{
+			name:  "fields",
+			level: InfoLevel,
+			log: func(l FieldLogger) {
+				l.With(Fields{"requestID": "abc", "status": 200}).With(Fields{"error": errors.New("boom"), "msg": "ignored"}).Info("done")
+			},
+			expected: []map[string]interface{}{
+				{"time": "2020-07-16T10:00:00Z", "level": "info", "logger": "goREST", "msg": "done", "requestID": "abc",
+					"status": float64(200), "error": "boom"},
+			},
+		},
+		{
+			name:  "fields are not shared with the parent",
+			level: InfoLevel,
+			log: func(l FieldLogger) {
+				l.With(Fields{"requestID": "abc"})
+				l.Info("parent")
+			},
+			expected: []map[string]interface{}{
+				{"time": "2020-07-16T10:00:00Z", "level": "info", "logger": "goREST", "msg": "parent"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l, buf := newTestLogger(test.level)
+			test.log(l)
+			if got := entries(t, buf); !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("expected: '%v' instead got: '%v'", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestJSONLogger_Fatal(t *testing.T) {
+	l, buf := newTestLogger(InfoLevel)
+	code := -1
+	l.exit = func(c int) { code = c }
+	l.Fatalf("error %s", "starting")
+	if code != 1 {
+		t.Errorf("expected exit code 1 instead got: %d", code)
+	}
+	if got := entries(t, buf); len(got) != 1 || got[0]["level"] != "critical" || got[0]["msg"] != "error starting" {
+		t.Errorf("unexpected entries: '%v'", got)
+	}
+}
+
+func TestJSONLogger_Writer(t *testing.T) {
+	l, buf := newTestLogger(InfoLevel)
+	log.New(l.Writer(WarningLevel), "", 0).Printf("pool timeout")
+	if got := entries(t, buf); len(got) != 1 || got[0]["level"] != "warning" || got[0]["msg"] != "pool timeout" {
+		t.Errorf("unexpected entries: '%v'", got)
+	}
+}
+
+func TestWith(t *testing.T) {
+	l, buf := newTestLogger(InfoLevel)
+	With(l, Fields{"requestID": "abc"}).Info("done")
+	if got := entries(t, buf); len(got) != 1 || got[0]["requestID"] != "abc" {
+		t.Errorf("unexpected entries: '%v'", got)
+	}
+	// loggers without fields are given back as they are
+	plain := NewLogger()
+	if With(plain, Fields{"requestID": "abc"}) != Loggers(plain) {
+		t.Errorf("expected the logger to be left as it is")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name        string
+		level       string
+		expected    Level
+		expectedErr bool
+	}{
+		{name: "info by default", expected: InfoLevel},
+		{name: "case insensitive", level: "WARNING", expected: WarningLevel},
+		{name: "debug", level: "debug", expected: DebugLevel},
+		{name: "error - unknown level", level: "verbose", expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			level, err := ParseLevel(test.level)
+			if (err != nil) != test.expectedErr {
+				t.Fatalf("expected error: %t instead got: '%v'", test.expectedErr, err)
+			}
+			if err == nil && level != test.expected {
+				t.Errorf("expected: %s instead got: %s", test.expected, level)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorest-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tests := []struct {
+		name        string
+		cfg         config.LoggerConfig
+		expectedErr bool
+	}{
+		{name: "stdout by default"},
+		{name: "stderr", cfg: config.LoggerConfig{Output: "stderr", Level: "error"}},
+		{name: "file", cfg: config.LoggerConfig{Output: "file", File: "api.log"}},
+		{name: "error - file missing", cfg: config.LoggerConfig{Output: "file"}, expectedErr: true},
+		{name: "error - unknown output", cfg: config.LoggerConfig{Output: "syslog"}, expectedErr: true},
+		{name: "error - unknown level", cfg: config.LoggerConfig{Level: "verbose"}, expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l, err := New(test.cfg, dir)
+			if (err != nil) != test.expectedErr {
+				t.Fatalf("expected error: %t instead got: '%v'", test.expectedErr, err)
+			}
+			if err == nil {
+				if err := l.Close(); err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+			}
+		})
+	}
+	if _, err := os.Stat(filepath.Join(dir, "api.log")); err != nil {
+		t.Errorf("expected the log file to be created under the logs path: %s", err)
+	}
+}
@@ -0,0 +1,115 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// rotation defaults, see config.LoggerConfig.
+const (
+	defaultMaxSize    = 100 << 20
+	defaultMaxBackups = 3
+)
+
+// rotatingFile - appends to a file that is rotated once it would exceed maxSize, the previous files are kept as
+// <path>.1 (the most recent) up to <path>.<maxBackups>.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func newRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	if maxSize <= 0 {
+		maxSize = defaultMaxSize
+	}
+	if maxBackups <= 0 {
+		maxBackups = defaultMaxBackups
+	}
+	rf := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.file, rf.size = f, info.Size()
+	return nil
+}
+
+// Write - writes p at once, the file is rotated beforehand whenever p does not fit in it. Writes larger than maxSize
+// are written to a file of their own. p is still written whenever the rotation fails, the error is returned along with
+// the bytes written, and the file is reopened whenever a previous rotation left it closed.
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file == nil {
+		if err := rf.open(); err != nil {
+			return 0, err
+		}
+	}
+	var rotateErr error
+	if rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if rotateErr = rf.rotate(); rf.file == nil {
+			return 0, rotateErr
+		}
+	}
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+// rotate - shifts the backups, dropping the oldest one, and starts a new file. Whenever the backups can not be shifted
+// the current file is reopened, writes go on appending to it and the rotation is attempted again by the next write.
+func (rf *rotatingFile) rotate() (err error) {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+	rf.file = nil
+	defer func() {
+		if err != nil && rf.file == nil {
+			// left closed when reopening fails as well, Write attempts it again
+			rf.open()
+		}
+	}()
+	for i := rf.maxBackups - 1; i > 0; i-- {
+		from := fmt.Sprintf("%s.%d", rf.path, i)
+		if _, err := os.Stat(from); err == nil {
+			if err := os.Rename(from, fmt.Sprintf("%s.%d", rf.path, i+1)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.Rename(rf.path, rf.path+".1"); err != nil {
+		return err
+	}
+	return rf.open()
+}
+
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.file == nil {
+		return nil
+	}
+	return rf.file.Close()
+}
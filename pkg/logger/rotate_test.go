@@ -0,0 +1,116 @@
+package logger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotatingFile_Write(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorest-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "api.log")
+
+	rf, err := newRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	// each write but the first two fills the file on its own, the oldest one is dropped
+	for _, line := range []string{"first\n", "abc\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	}
+	for file, content := range expected {
+		got, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("expected '%s' to hold: '%s' instead got: '%s'", file, content, got)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected at most 2 backups")
+	}
+}
+
+func TestRotatingFile_Append(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorest-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "api.log")
+	if err := ioutil.WriteFile(path, []byte("previous\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the existing file counts towards the size
+	rf, err := newRotatingFile(path, 16, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	if _, err := rf.Write([]byte("current\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(path + ".1"); string(got) != "previous\n" {
+		t.Errorf("expected the previous file to be rotated instead got: '%s'", got)
+	}
+	if got, _ := ioutil.ReadFile(path); string(got) != "current\n" {
+		t.Errorf("expected: 'current' instead got: '%s'", got)
+	}
+}
+
+func TestRotatingFile_RotateFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorest-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "api.log")
+	// the file can not be renamed over a directory that is not empty
+	if err := os.MkdirAll(filepath.Join(path+".1", "taken"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	rf, err := newRotatingFile(path, 8, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	if _, err := rf.Write([]byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+	// appended to the current file as long as the rotation fails
+	for _, line := range []string{"abc\n", "def\n"} {
+		if n, err := rf.Write([]byte(line)); err == nil || n != len(line) {
+			t.Errorf("expected the line to be written despite the rotation failing instead got: %d, '%v'", n, err)
+		}
+	}
+	// writing goes on once the backup can be written
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rf.Write([]byte("second\n")); err != nil {
+		t.Fatalf("expected writing to go on instead got: '%s'", err)
+	}
+	if got, _ := ioutil.ReadFile(path + ".1"); string(got) != "first\nabc\ndef\n" {
+		t.Errorf("expected the file to be rotated instead got: '%s'", got)
+	}
+	if got, _ := ioutil.ReadFile(path); string(got) != "second\n" {
+		t.Errorf("expected: 'second' instead got: '%s'", got)
+	}
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rnov/Go-REST/pkg/auth"
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
+)
+
+// results of the authentication attempts.
+const (
+	authSuccess = "success"
+	authFailure = "failure"
+	authError   = "error"
+)
+
+// otherScheme - label of the schemes the API does not know about, which are named by the clients.
+const otherScheme = "other"
+
+// validator - decorates a validator recording the result of every authentication attempt.
+type validator struct {
+	next auth.Validator
+	m    *Metrics
+}
+
+// NewValidator - validator recording the attempts validated by v, e.g. *auth.Auth.
+func NewValidator(v auth.Validator, m *Metrics) auth.Validator {
+	return &validator{next: v, m: m}
+}
+
+// Validate - see auth.Validator. Attempts are failures when the credentials are not valid, i.e. *errors.FailedAuthErr,
+// and errors when they could not be validated at all.
+func (v *validator) Validate(ctx context.Context, scheme, credentials string) (*identity.Principal, error) {
+	principal, err := v.next.Validate(ctx, scheme, credentials)
+	result := authSuccess
+	if _, ok := err.(*errors.FailedAuthErr); ok {
+		result = authFailure
+	} else if err != nil {
+		result = authError
+	}
+	v.m.authAttempts.WithLabelValues(schemeLabel(scheme), result).Inc()
+	return principal, err
+}
+
+func schemeLabel(scheme string) string {
+	switch scheme = strings.ToLower(scheme); scheme {
+	case auth.Basic, auth.Bearer, auth.APIKey, auth.ClientCert:
+		return scheme
+	}
+	return otherScheme
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
+)
+
+type validatorMock struct {
+	validate func(scheme, credentials string) (*identity.Principal, error)
+}
+
+func (vm *validatorMock) Validate(ctx context.Context, scheme, credentials string) (*identity.Principal, error) {
+	if vm.validate != nil {
+		return vm.validate(scheme, credentials)
+	}
+	panic("Not implemented")
+}
+
+func TestValidator_Validate(t *testing.T) {
+	m := New()
+	v := NewValidator(&validatorMock{validate: func(scheme, credentials string) (*identity.Principal, error) {
+		switch credentials {
+		case "valid":
+			return &identity.Principal{Username: "chef", Role: identity.Editor}, nil
+		case "invalid":
+			return nil, errors.NewFailedAuthErr()
+		}
+		return nil, errors.NewDBErr("connection refused")
+	}}, m)
+
+	attempts := []struct {
+		scheme      string
+		credentials string
+	}{
+		{scheme: "Basic", credentials: "valid"},
+		{scheme: "basic", credentials: "invalid"},
+		{scheme: "apikey", credentials: "invalid"},
+		{scheme: "bearer", credentials: "unavailable"},
+		// schemes are named by the clients
+		{scheme: "Negotiate", credentials: "invalid"},
+	}
+	for _, attempt := range attempts {
+		principal, err := v.Validate(context.Background(), attempt.scheme, attempt.credentials)
+		if (principal != nil) != (attempt.credentials == "valid") || (err == nil) != (attempt.credentials == "valid") {
+			t.Errorf("unexpected outcome of '%s': '%v', '%v'", attempt.credentials, principal, err)
+		}
+	}
+
+	assertSamples(t, scrape(t, m), []string{
+		`gorest_auth_attempts_total{result="success",scheme="basic"} 1`,
+		`gorest_auth_attempts_total{result="failure",scheme="basic"} 1`,
+		`gorest_auth_attempts_total{result="failure",scheme="apikey"} 1`,
+		`gorest_auth_attempts_total{result="error",scheme="bearer"} 1`,
+		`gorest_auth_attempts_total{result="failure",scheme="other"} 1`,
+	})
+}
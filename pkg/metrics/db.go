@@ -0,0 +1,180 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/apikey"
+	"github.com/rnov/Go-REST/pkg/db"
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
+	"github.com/rnov/Go-REST/pkg/rate"
+	rcp "github.com/rnov/Go-REST/pkg/recipe"
+)
+
+// dbClient - decorates a DB client recording the latency of every call and the DB errors it fails with.
+type dbClient struct {
+	next db.Client
+	m    *Metrics
+}
+
+// NewDBClient - DB client recording the calls made to c, whatever its backend.
+func NewDBClient(c db.Client, m *Metrics) db.Client {
+	return &dbClient{next: c, m: m}
+}
+
+// observe - records a call of method started at start, only *errors.DBErr counts as an error, the rest of them are
+// outcomes of the call, e.g. a recipe that does not exist. Calls interrupted since the request has been canceled by the
+// client do not count either.
+func (c *dbClient) observe(method string, start time.Time, err error) {
+	c.m.dbDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if dbErr, ok := err.(*errors.DBErr); ok && !dbErr.Canceled() {
+		c.m.dbErrors.WithLabelValues(method).Inc()
+	}
+}
+
+func (c *dbClient) GetRecipeByID(ctx context.Context, recipeID string) (*rcp.Recipe, error) {
+	start := time.Now()
+	recipe, err := c.next.GetRecipeByID(ctx, recipeID)
+	c.observe("GetRecipeByID", start, err)
+	return recipe, err
+}
+
+func (c *dbClient) GetRecipes(ctx context.Context, query *rcp.Query) (*rcp.Page, error) {
+	start := time.Now()
+	page, err := c.next.GetRecipes(ctx, query)
+	c.observe("GetRecipes", start, err)
+	return page, err
+}
+
+func (c *dbClient) CreateRecipe(ctx context.Context, recipe *rcp.Recipe) error {
+	start := time.Now()
+	err := c.next.CreateRecipe(ctx, recipe)
+	c.observe("CreateRecipe", start, err)
+	return err
+}
+
+// CreateRecipes - recorded as a single call, which counts as a DB error if any recipe failed due to one.
+func (c *dbClient) CreateRecipes(ctx context.Context, recipes []*rcp.Recipe) []error {
+	start := time.Now()
+	errs := c.next.CreateRecipes(ctx, recipes)
+	var failed error
+	for _, err := range errs {
+		if _, ok := err.(*errors.DBErr); ok {
+			failed = err
+			break
+		}
+	}
+	c.observe("CreateRecipes", start, failed)
+	return errs
+}
+
+func (c *dbClient) UpdateRecipe(ctx context.Context, recipe *rcp.Recipe, version int64) error {
+	start := time.Now()
+	err := c.next.UpdateRecipe(ctx, recipe, version)
+	c.observe("UpdateRecipe", start, err)
+	return err
+}
+
+func (c *dbClient) PatchRecipe(ctx context.Context, recipe *rcp.Recipe, fields []string, version int64) error {
+	start := time.Now()
+	err := c.next.PatchRecipe(ctx, recipe, fields, version)
+	c.observe("PatchRecipe", start, err)
+	return err
+}
+
+func (c *dbClient) DeleteRecipe(ctx context.Context, recipeID string, version int64) error {
+	start := time.Now()
+	err := c.next.DeleteRecipe(ctx, recipeID, version)
+	c.observe("DeleteRecipe", start, err)
+	return err
+}
+
+func (c *dbClient) RateRecipe(ctx context.Context, recipeID string, rate *rate.Rate) error {
+	start := time.Now()
+	err := c.next.RateRecipe(ctx, recipeID, rate)
+	c.observe("RateRecipe", start, err)
+	return err
+}
+
+func (c *dbClient) DeleteRate(ctx context.Context, recipeID, rater string) error {
+	start := time.Now()
+	err := c.next.DeleteRate(ctx, recipeID, rater)
+	c.observe("DeleteRate", start, err)
+	return err
+}
+
+func (c *dbClient) GetRates(ctx context.Context, recipeID string) ([]*rate.Rate, error) {
+	start := time.Now()
+	rates, err := c.next.GetRates(ctx, recipeID)
+	c.observe("GetRates", start, err)
+	return rates, err
+}
+
+func (c *dbClient) GetRateSummary(ctx context.Context, recipeID string) (*rate.Summary, error) {
+	start := time.Now()
+	summary, err := c.next.GetRateSummary(ctx, recipeID)
+	c.observe("GetRateSummary", start, err)
+	return summary, err
+}
+
+func (c *dbClient) CheckAuth(ctx context.Context, auth string) (*identity.Principal, error) {
+	start := time.Now()
+	principal, err := c.next.CheckAuth(ctx, auth)
+	c.observe("CheckAuth", start, err)
+	return principal, err
+}
+
+func (c *dbClient) GetCredentials(ctx context.Context, username string) (*identity.Credentials, error) {
+	start := time.Now()
+	credentials, err := c.next.GetCredentials(ctx, username)
+	c.observe("GetCredentials", start, err)
+	return credentials, err
+}
+
+func (c *dbClient) SetPassword(ctx context.Context, username, passwordHash string) error {
+	start := time.Now()
+	err := c.next.SetPassword(ctx, username, passwordHash)
+	c.observe("SetPassword", start, err)
+	return err
+}
+
+func (c *dbClient) CreateAPIKey(ctx context.Context, key *apikey.Key) error {
+	start := time.Now()
+	err := c.next.CreateAPIKey(ctx, key)
+	c.observe("CreateAPIKey", start, err)
+	return err
+}
+
+func (c *dbClient) GetAPIKey(ctx context.Context, ID string) (*apikey.Key, error) {
+	start := time.Now()
+	key, err := c.next.GetAPIKey(ctx, ID)
+	c.observe("GetAPIKey", start, err)
+	return key, err
+}
+
+func (c *dbClient) GetAPIKeys(ctx context.Context) ([]*apikey.Key, error) {
+	start := time.Now()
+	keys, err := c.next.GetAPIKeys(ctx)
+	c.observe("GetAPIKeys", start, err)
+	return keys, err
+}
+
+func (c *dbClient) RotateAPIKey(ctx context.Context, ID, oldHash, newHash string) error {
+	start := time.Now()
+	err := c.next.RotateAPIKey(ctx, ID, oldHash, newHash)
+	c.observe("RotateAPIKey", start, err)
+	return err
+}
+
+func (c *dbClient) DeleteAPIKey(ctx context.Context, ID string) error {
+	start := time.Now()
+	err := c.next.DeleteAPIKey(ctx, ID)
+	c.observe("DeleteAPIKey", start, err)
+	return err
+}
+
+// Close - not recorded, it is not a call made on behalf of a request.
+func (c *dbClient) Close() error {
+	return c.next.Close()
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/rnov/Go-REST/pkg/db"
+	"github.com/rnov/Go-REST/pkg/db/memory"
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/rate"
+)
+
+// failingDB - in-memory DB whose rates can not be read.
+type failingDB struct {
+	db.Client
+}
+
+func (f *failingDB) GetRates(ctx context.Context, recipeID string) ([]*rate.Rate, error) {
+	return nil, errors.NewDBErr("connection refused")
+}
+
+func TestDBClient(t *testing.T) {
+	m := New()
+	c := NewDBClient(&failingDB{Client: memory.NewStore()}, m)
+
+	if _, err := c.GetRecipeByID(context.Background(), "5f10223c"); err == nil {
+		t.Errorf("expected the recipe not to exist")
+	}
+	if _, err := c.GetAPIKeys(context.Background()); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if _, err := c.GetRates(context.Background(), "5f10223c"); err == nil {
+		t.Errorf("expected a DB error")
+	}
+
+	// recipes that do not exist are not DB errors
+	assertSamples(t, scrape(t, m), []string{
+		`gorest_db_call_duration_seconds_count{method="GetRecipeByID"} 1`,
+		`gorest_db_call_duration_seconds_count{method="GetAPIKeys"} 1`,
+		`gorest_db_call_duration_seconds_count{method="GetRates"} 1`,
+		`gorest_db_errors_total{method="GetRates"} 1`,
+	})
+	if exposed := scrape(t, m); strings.Contains(exposed, `gorest_db_errors_total{method="GetRecipeByID"}`) {
+		t.Errorf("unexpected DB error of GetRecipeByID: '%s'", exposed)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
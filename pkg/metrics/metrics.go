@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/rnov/Go-REST/pkg/config"
+	"github.com/rnov/Go-REST/pkg/http/server"
+	"github.com/rnov/Go-REST/pkg/logger"
+)
+
+const namespace = "gorest"
+
+// defaults of the settings left empty in config.MetricsConfig.
+const (
+	defaultAddress = ":9090"
+	defaultPath    = "/metrics"
+)
+
+// Metrics - Prometheus collectors of the API, registered on a registry of their own along with the Go runtime and
+// process collectors.
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	dbDuration      *prometheus.HistogramVec
+	dbErrors        *prometheus.CounterVec
+	authAttempts    *prometheus.CounterVec
+}
+
+// New - registers the collectors, metrics are exposed by Handler.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests served by method, route template and status code.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to serve the HTTP requests by method, route template and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		dbDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "db_call_duration_seconds",
+			Help:      "Time taken by the DB calls by DB client method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		dbErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "db_errors_total",
+			Help:      "DB calls failed due to a DB error by DB client method.",
+		}, []string{"method"}),
+		authAttempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "auth_attempts_total",
+			Help:      "Authentication attempts by scheme and result: success, failure or error.",
+		}, []string{"scheme", "result"}),
+	}
+	m.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.dbDuration,
+		m.dbErrors,
+		m.authAttempts,
+	)
+	return m
+}
+
+// Handler - exposes the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest - records a request served, route is the path template of the matched route rather than the request
+// path, which would give a time series per recipe otherwise.
+func (m *Metrics) ObserveRequest(method, route string, status int, d time.Duration) {
+	code := strconv.Itoa(status)
+	m.requests.WithLabelValues(method, route, code).Inc()
+	m.requestDuration.WithLabelValues(method, route, code).Observe(d.Seconds())
+}
+
+// NewServer - server exposing the metrics as configured by cfg, apart from the API so that they are not exposed along
+// with it.
+func NewServer(cfg config.MetricsConfig, m *Metrics, l logger.Loggers) (*server.Server, error) {
+	address, path := cfg.Address, cfg.Path
+	if len(address) == 0 {
+		address = defaultAddress
+	}
+	if len(path) == 0 {
+		path = defaultPath
+	}
+	mux := http.NewServeMux()
+	mux.Handle(path, m.Handler())
+	return server.New(config.Server{Address: address}, mux, l)
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/config"
+	"github.com/rnov/Go-REST/pkg/logger"
+)
+
+// scrape - the metrics as exposed to Prometheus.
+func scrape(t *testing.T, m *Metrics) string {
+	rr := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Handler().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status code: %d instead got: %d", http.StatusOK, rr.Code)
+	}
+	body, err := ioutil.ReadAll(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+// assertSamples - every sample is expected to be exposed as it is, e.g. `gorest_db_errors_total{method="GetRates"} 1`.
+func assertSamples(t *testing.T, exposed string, samples []string) {
+	t.Helper()
+	for _, sample := range samples {
+		if !strings.Contains(exposed, sample+"\n") {
+			t.Errorf("expected sample: '%s' instead got: '%s'", sample, exposed)
+		}
+	}
+}
+
+func TestMetrics_ObserveRequest(t *testing.T) {
+	m := New()
+	m.ObserveRequest("GET", "/recipes/{ID}", http.StatusOK, 20*time.Millisecond)
+	m.ObserveRequest("GET", "/recipes/{ID}", http.StatusOK, 200*time.Millisecond)
+	m.ObserveRequest("GET", "/recipes/{ID}", http.StatusNotFound, time.Millisecond)
+
+	exposed := scrape(t, m)
+	assertSamples(t, exposed, []string{
+		`gorest_http_requests_total{method="GET",route="/recipes/{ID}",status="200"} 2`,
+		`gorest_http_requests_total{method="GET",route="/recipes/{ID}",status="404"} 1`,
+		`gorest_http_request_duration_seconds_bucket{method="GET",route="/recipes/{ID}",status="200",le="0.025"} 1`,
+		`gorest_http_request_duration_seconds_count{method="GET",route="/recipes/{ID}",status="200"} 2`,
+	})
+	// runtime stats are exposed along with the API ones
+	assertSamples(t, exposed, []string{"# TYPE go_goroutines gauge"})
+}
+
+func TestNewServer(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.MetricsConfig
+		expected string
+	}{
+		{name: "default address", expected: ":9090"},
+		{name: "configured address", cfg: config.MetricsConfig{Address: "127.0.0.1:9102", Path: "/internal/metrics"},
+			expected: "127.0.0.1:9102"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv, err := NewServer(test.cfg, New(), logger.NewLogger())
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if srv.Addr() != test.expected {
+				t.Errorf("expected address: '%s' instead got: '%s'", test.expected, srv.Addr())
+			}
+		})
+	}
+}
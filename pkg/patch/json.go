@@ -0,0 +1,299 @@
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// JSON Patch operations.
+const (
+	opAdd     = "add"
+	opRemove  = "remove"
+	opReplace = "replace"
+	opMove    = "move"
+	opCopy    = "copy"
+	opTest    = "test"
+)
+
+// Operation - a single JSON Patch operation, paths are JSON Pointers (RFC 6901).
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// JSONPatch - JSON Patch (RFC 6902), a sequence of operations applied in order, the whole patch fails whenever any of
+// them does.
+type JSONPatch struct {
+	ops []operation
+}
+
+// operation - an already validated and parsed Operation.
+type operation struct {
+	op    string
+	path  []string
+	from  []string
+	value interface{}
+}
+
+func NewJSONPatch(body []byte) (*JSONPatch, error) {
+	var ops []Operation
+	if err := json.Unmarshal(body, &ops); err != nil {
+		return nil, fmt.Errorf("malformed JSON patch: %s", err.Error())
+	}
+	jp := &JSONPatch{ops: make([]operation, 0, len(ops))}
+	for i, op := range ops {
+		parsed, err := parseOperation(op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %s", i, err.Error())
+		}
+		jp.ops = append(jp.ops, parsed)
+	}
+	return jp, nil
+}
+
+func parseOperation(op Operation) (operation, error) {
+	parsed := operation{op: op.Op}
+	var err error
+	if parsed.path, err = parsePointer(op.Path); err != nil {
+		return parsed, err
+	}
+	switch op.Op {
+	case opAdd, opReplace, opTest:
+		if len(op.Value) == 0 {
+			return parsed, fmt.Errorf("missing value")
+		}
+		if parsed.value, err = decode(op.Value); err != nil {
+			return parsed, fmt.Errorf("malformed value: %s", err.Error())
+		}
+	case opMove, opCopy:
+		if parsed.from, err = parsePointer(op.From); err != nil {
+			return parsed, err
+		}
+		// an object can not be moved into one of its children
+		if op.Op == opMove && len(parsed.from) < len(parsed.path) && strings.HasPrefix(op.Path, op.From+"/") {
+			return parsed, fmt.Errorf("%s can not be moved into one of its children", op.From)
+		}
+	case opRemove:
+	default:
+		return parsed, fmt.Errorf("unsupported operation: '%s'", op.Op)
+	}
+	return parsed, nil
+}
+
+// parsePointer - splits a JSON Pointer into its unescaped reference tokens, the empty pointer refers to the whole
+// document.
+func parsePointer(pointer string) ([]string, error) {
+	if len(pointer) == 0 {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid path: '%s'", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func (jp *JSONPatch) Apply(doc []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	for i, op := range jp.ops {
+		if target, err = op.apply(target); err != nil {
+			return nil, fmt.Errorf("operation %d: %s", i, err.Error())
+		}
+	}
+	return json.Marshal(target)
+}
+
+func (op operation) apply(doc interface{}) (interface{}, error) {
+	switch op.op {
+	case opAdd:
+		// values are copied since the same patch may be applied more than once
+		return add(doc, op.path, clone(op.value))
+	case opRemove:
+		doc, _, err := remove(doc, op.path)
+		return doc, err
+	case opReplace:
+		if len(op.path) == 0 {
+			return clone(op.value), nil
+		}
+		doc, _, err := remove(doc, op.path)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, clone(op.value))
+	case opMove:
+		doc, value, err := remove(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, value)
+	case opCopy:
+		value, err := get(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, clone(value))
+	case opTest:
+		value, err := get(doc, op.path)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(value, op.value) {
+			return nil, fmt.Errorf("test failed, value at '/%s' does not match", strings.Join(op.path, "/"))
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unsupported operation: '%s'", op.op)
+}
+
+func get(node interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			child, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("member '%s' not found", token)
+			}
+			node = child
+		case []interface{}:
+			i, err := index(token, len(n)-1)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("'%s' can not be referenced in a scalar value", token)
+		}
+	}
+	return node, nil
+}
+
+// add - adds the value at the path, object members are replaced whereas array elements are inserted. The possibly new
+// node is returned since arrays are reallocated.
+func add(node interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token := path[0]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if len(path) == 1 {
+			n[token] = value
+			return n, nil
+		}
+		child, ok := n[token]
+		if !ok {
+			return nil, fmt.Errorf("member '%s' not found", token)
+		}
+		child, err := add(child, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		n[token] = child
+		return n, nil
+	case []interface{}:
+		if len(path) == 1 {
+			i := len(n)
+			if token != "-" {
+				var err error
+				if i, err = index(token, len(n)); err != nil {
+					return nil, err
+				}
+			}
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = value
+			return n, nil
+		}
+		i, err := index(token, len(n)-1)
+		if err != nil {
+			return nil, err
+		}
+		if n[i], err = add(n[i], path[1:], value); err != nil {
+			return nil, err
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("'%s' can not be added to a scalar value", token)
+}
+
+// remove - removes the value at the path, which must exist, returns the possibly new node along with the removed value.
+func remove(node interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("the whole document can not be removed")
+	}
+	token := path[0]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("member '%s' not found", token)
+		}
+		if len(path) == 1 {
+			delete(n, token)
+			return n, child, nil
+		}
+		child, removed, err := remove(child, path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		n[token] = child
+		return n, removed, nil
+	case []interface{}:
+		i, err := index(token, len(n)-1)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(path) == 1 {
+			removed := n[i]
+			return append(n[:i], n[i+1:]...), removed, nil
+		}
+		child, removed, err := remove(n[i], path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		n[i] = child
+		return n, removed, nil
+	}
+	return nil, nil, fmt.Errorf("'%s' can not be removed from a scalar value", token)
+}
+
+// index - parses an array index, which must be within [0, max]. Leading zeros are not allowed.
+func index(token string, max int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index: '%s'", token)
+	}
+	if i > max {
+		return 0, fmt.Errorf("array index out of bounds: '%s'", token)
+	}
+	return i, nil
+}
+
+// clone - deep copy of a decoded JSON value.
+func clone(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			c[key] = clone(child)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, child := range v {
+			c[i] = clone(child)
+		}
+		return c
+	}
+	return value
+}
@@ -0,0 +1,124 @@
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Media types of the supported patch documents.
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+// Patch - a set of changes to apply to a JSON document, the document is never modified, a patched copy is returned
+// instead.
+type Patch interface {
+	Apply(doc []byte) ([]byte, error)
+}
+
+// New - parses the patch document of the given media type.
+func New(mediaType string, body []byte) (Patch, error) {
+	switch mediaType {
+	case MergePatchType:
+		return NewMergePatch(body)
+	case JSONPatchType:
+		return NewJSONPatch(body)
+	}
+	return nil, fmt.Errorf("unsupported patch media type: %s", mediaType)
+}
+
+// MergePatch - JSON Merge Patch (RFC 7386), the patch mirrors the document: members set to null are removed, objects are
+// merged recursively and any other value replaces the target one.
+type MergePatch struct {
+	patch interface{}
+}
+
+func NewMergePatch(body []byte) (*MergePatch, error) {
+	patch, err := decode(body)
+	if err != nil {
+		return nil, fmt.Errorf("malformed merge patch: %s", err.Error())
+	}
+	return &MergePatch{patch: patch}, nil
+}
+
+func (mp *MergePatch) Apply(doc []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(merge(target, mp.patch))
+}
+
+func merge(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+			continue
+		}
+		t[key] = merge(t[key], value)
+	}
+	return t
+}
+
+// decode - numbers are kept as json.Number, that way they are written back exactly as they were read.
+func decode(b []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected data after the JSON value")
+	}
+	return v, nil
+}
+
+// equal - JSON values equality, numbers are compared by their value regardless of their representation.
+func equal(a, b interface{}) bool {
+	switch x := a.(type) {
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		fx, errX := x.Float64()
+		fy, errY := y.Float64()
+		return errX == nil && errY == nil && fx == fy
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for key, value := range x {
+			other, ok := y[key]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,247 @@
+package patch
+
+import (
+	"testing"
+)
+
+// assertJSON - compares JSON documents regardless of their formatting and members order.
+func assertJSON(t *testing.T, expected string, got []byte) {
+	t.Helper()
+	e, err := decode([]byte(expected))
+	if err != nil {
+		t.Fatalf("malformed expected document: %s", err)
+	}
+	g, err := decode(got)
+	if err != nil {
+		t.Fatalf("malformed document: %s", err)
+	}
+	if !equal(e, g) {
+		t.Errorf("expected: '%s' instead got: '%s'", expected, got)
+	}
+}
+
+func TestMergePatch_Apply(t *testing.T) {
+	// test cases from RFC 7386 appendix A
+	tests := []struct {
+		name     string
+		doc      string
+		patch    string
+		expected string
+	}{
+		{name: "replace member", doc: `{"a":"b"}`, patch: `{"a":"c"}`, expected: `{"a":"c"}`},
+		{name: "add member", doc: `{"a":"b"}`, patch: `{"b":"c"}`, expected: `{"a":"b","b":"c"}`},
+		{name: "remove member", doc: `{"a":"b"}`, patch: `{"a":null}`, expected: `{}`},
+		{name: "remove one of the members", doc: `{"a":"b","b":"c"}`, patch: `{"a":null}`, expected: `{"b":"c"}`},
+		{name: "replace array", doc: `{"a":["b"]}`, patch: `{"a":"c"}`, expected: `{"a":"c"}`},
+		{name: "replace by array", doc: `{"a":"c"}`, patch: `{"a":["b"]}`, expected: `{"a":["b"]}`},
+		{name: "nested objects", doc: `{"a":{"b":"c"}}`, patch: `{"a":{"b":"d","c":null}}`, expected: `{"a":{"b":"d"}}`},
+		{name: "arrays are not merged", doc: `{"a":[{"b":"c"}]}`, patch: `{"a":[1]}`, expected: `{"a":[1]}`},
+		{name: "non object patch", doc: `{"a":"foo"}`, patch: `["c"]`, expected: `["c"]`},
+		{name: "null patch", doc: `{"a":"foo"}`, patch: `null`, expected: `null`},
+		{name: "object into scalar", doc: `{"e":null}`, patch: `{"a":1}`, expected: `{"e":null,"a":1}`},
+		{name: "nested null members are dropped", doc: `[1,2]`, patch: `{"a":{"bb":{"ccc":null}}}`, expected: `{"a":{"bb":{}}}`},
+		{name: "numbers are kept", doc: `{"a":1.50}`, patch: `{"b":12345678901234567890}`, expected: `{"a":1.5,"b":12345678901234567890}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mp, err := NewMergePatch([]byte(test.patch))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			got, err := mp.Apply([]byte(test.doc))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			assertJSON(t, test.expected, got)
+		})
+	}
+}
+
+func TestJSONPatch_Apply(t *testing.T) {
+	// most test cases come from RFC 6902 appendix A
+	tests := []struct {
+		name        string
+		doc         string
+		patch       string
+		expected    string
+		expectedErr string
+	}{
+		{
+			name:     "add object member",
+			doc:      `{"foo":"bar"}`,
+			patch:    `[{"op":"add","path":"/baz","value":"qux"}]`,
+			expected: `{"baz":"qux","foo":"bar"}`,
+		},
+		{
+			name:     "add array element",
+			doc:      `{"foo":["bar","baz"]}`,
+			patch:    `[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			expected: `{"foo":["bar","qux","baz"]}`,
+		},
+		{
+			name:     "add to the end of the array",
+			doc:      `{"foo":["bar"]}`,
+			patch:    `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`,
+			expected: `{"foo":["bar",["abc","def"]]}`,
+		},
+		{
+			name:     "remove object member",
+			doc:      `{"baz":"qux","foo":"bar"}`,
+			patch:    `[{"op":"remove","path":"/baz"}]`,
+			expected: `{"foo":"bar"}`,
+		},
+		{
+			name:     "remove array element",
+			doc:      `{"foo":["bar","qux","baz"]}`,
+			patch:    `[{"op":"remove","path":"/foo/1"}]`,
+			expected: `{"foo":["bar","baz"]}`,
+		},
+		{
+			name:     "replace value",
+			doc:      `{"baz":"qux","foo":"bar"}`,
+			patch:    `[{"op":"replace","path":"/baz","value":"boo"}]`,
+			expected: `{"baz":"boo","foo":"bar"}`,
+		},
+		{
+			name:     "move value",
+			doc:      `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			patch:    `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			expected: `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{
+			name:     "move array element",
+			doc:      `{"foo":["all","grass","cows","eat"]}`,
+			patch:    `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+			expected: `{"foo":["all","cows","eat","grass"]}`,
+		},
+		{
+			name:     "copy value",
+			doc:      `{"foo":{"bar":[1]}}`,
+			patch:    `[{"op":"copy","from":"/foo","path":"/baz"},{"op":"add","path":"/baz/bar/-","value":2}]`,
+			expected: `{"foo":{"bar":[1]},"baz":{"bar":[1,2]}}`,
+		},
+		{
+			name:     "test value",
+			doc:      `{"baz":"qux","foo":["a",2,"c"]}`,
+			patch:    `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2.0}]`,
+			expected: `{"baz":"qux","foo":["a",2,"c"]}`,
+		},
+		{
+			name:     "escaped pointer",
+			doc:      `{"/":9,"~1":10}`,
+			patch:    `[{"op":"test","path":"/~01","value":10},{"op":"remove","path":"/~1"}]`,
+			expected: `{"~1":10}`,
+		},
+		{
+			name:     "replace the whole document",
+			doc:      `{"foo":"bar"}`,
+			patch:    `[{"op":"replace","path":"","value":{"baz":"qux"}}]`,
+			expected: `{"baz":"qux"}`,
+		},
+		{
+			name:     "add null value",
+			doc:      `{"foo":"bar"}`,
+			patch:    `[{"op":"add","path":"/baz","value":null}]`,
+			expected: `{"foo":"bar","baz":null}`,
+		},
+		{
+			name:        "error - test failed",
+			doc:         `{"baz":"qux"}`,
+			patch:       `[{"op":"test","path":"/baz","value":"bar"}]`,
+			expectedErr: "operation 0: test failed, value at '/baz' does not match",
+		},
+		{
+			name:        "error - add to a nonexistent target",
+			doc:         `{"foo":"bar"}`,
+			patch:       `[{"op":"add","path":"/baz/bat","value":"qux"}]`,
+			expectedErr: "operation 0: member 'baz' not found",
+		},
+		{
+			name:        "error - remove a nonexistent member",
+			doc:         `{"foo":"bar"}`,
+			patch:       `[{"op":"replace","path":"/baz","value":"qux"}]`,
+			expectedErr: "operation 0: member 'baz' not found",
+		},
+		{
+			name:        "error - array index out of bounds",
+			doc:         `{"foo":["bar","baz"]}`,
+			patch:       `[{"op":"add","path":"/foo/3","value":"qux"}]`,
+			expectedErr: "operation 0: array index out of bounds: '3'",
+		},
+		{
+			name:        "error - invalid array index",
+			doc:         `{"foo":["bar","baz"]}`,
+			patch:       `[{"op":"remove","path":"/foo/01"}]`,
+			expectedErr: "operation 0: invalid array index: '01'",
+		},
+		{
+			name:        "error - the patch is atomic",
+			doc:         `{"foo":"bar"}`,
+			patch:       `[{"op":"add","path":"/baz","value":"qux"},{"op":"remove","path":"/nope"}]`,
+			expectedErr: "operation 1: member 'nope' not found",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jp, err := NewJSONPatch([]byte(test.patch))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			got, err := jp.Apply([]byte(test.doc))
+			if err != nil {
+				if err.Error() != test.expectedErr {
+					t.Errorf("expected: '%s' instead got: '%s'", test.expectedErr, err)
+				}
+				return
+			}
+			if len(test.expectedErr) > 0 {
+				t.Fatalf("expected: '%s' instead got nil", test.expectedErr)
+			}
+			assertJSON(t, test.expected, got)
+		})
+	}
+}
+
+func TestNewJSONPatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		patch       string
+		expectedErr string
+	}{
+		{name: "valid patch", patch: `[{"op":"remove","path":"/a"},{"op":"copy","from":"/b","path":"/c"}]`},
+		{name: "malformed patch", patch: `{"op":"remove"}`, expectedErr: "malformed JSON patch: json: cannot unmarshal object into Go value of type []patch.Operation"},
+		{name: "unsupported operation", patch: `[{"op":"delete","path":"/a"}]`, expectedErr: "operation 0: unsupported operation: 'delete'"},
+		{name: "missing value", patch: `[{"op":"add","path":"/a"}]`, expectedErr: "operation 0: missing value"},
+		{name: "invalid path", patch: `[{"op":"remove","path":"a"}]`, expectedErr: "operation 0: invalid path: 'a'"},
+		{name: "move into a child", patch: `[{"op":"move","from":"/a","path":"/a/b"}]`, expectedErr: "operation 0: /a can not be moved into one of its children"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewJSONPatch([]byte(test.patch))
+			if err != nil && err.Error() != test.expectedErr {
+				t.Errorf("expected: '%s' instead got: '%s'", test.expectedErr, err)
+			}
+			if err == nil && len(test.expectedErr) > 0 {
+				t.Errorf("expected: '%s' instead got nil", test.expectedErr)
+			}
+		})
+	}
+}
+
+func TestPatch_ReusedPatch(t *testing.T) {
+	// applying a patch must neither modify it nor share its values with the patched documents
+	jp, err := NewJSONPatch([]byte(`[{"op":"add","path":"/a","value":{"b":[1]}},{"op":"add","path":"/a/b/-","value":2}]`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		got, err := jp.Apply([]byte(`{}`))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		assertJSON(t, `{"a":{"b":[1,2]}}`, got)
+	}
+}
@@ -1,5 +1,35 @@
 package rate
 
+import (
+	"math"
+	"time"
+)
+
+// Rate - a single rating of a recipe, Rater and CreatedAt are set by the API regardless of the values sent by the client.
+// Rater is the user that rated the recipe, rates given before rating required authentication may hold the rater address.
+// Raters are kept to tell apart the rates of each user, they are neither published nor accepted from the client.
 type Rate struct {
-	Note int `json:"note"`
+	Note      int       `json:"note"`
+	Rater     string    `json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Summary - aggregated score of all the rates of a recipe.
+type Summary struct {
+	Average float64 `json:"averageRating"`
+	Count   int     `json:"ratingCount"`
+	Rates   []*Rate `json:"ratings,omitempty"`
+}
+
+// NewSummary - builds the aggregated score from the sum of all the notes and the number of rates, every DB client relays
+// on it so that averages are computed (and rounded) the same way regardless of the backend.
+func NewSummary(sum, count int) *Summary {
+	summary := &Summary{
+		Count: count,
+	}
+	if count > 0 {
+		summary.Average = math.Round(float64(sum)/float64(count)*100) / 100
+	}
+
+	return summary
 }
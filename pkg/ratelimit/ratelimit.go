@@ -0,0 +1,154 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/config"
+)
+
+// stores the limits state can be kept in, see config.RateLimitConfig.
+const (
+	Memory = "memory"
+	Redis  = "redis"
+)
+
+// Authentication - route the requests to protected routes are limited by before being authenticated, limited by
+// config.RateLimitConfig.Authentication rather than the default limit.
+const Authentication = "authentication"
+
+// Limit - token bucket holding up to Burst tokens, refilled at Rate tokens per second. Every request takes a token out
+// of the bucket, requests are rejected while it is empty.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// refill - time it takes to refill the given amount of tokens, to the millisecond.
+func (l Limit) refill(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / l.Rate * float64(time.Second)).Round(time.Millisecond)
+}
+
+// Result - outcome of taking a token out of a bucket. Reset is the time until the bucket is full again and RetryAfter,
+// only set when the request is not allowed, the time until a token is available.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// newResult - the result of a bucket left with the given tokens.
+func newResult(limit Limit, tokens float64, allowed bool) *Result {
+	res := &Result{
+		Allowed:   allowed,
+		Limit:     limit.Burst,
+		Remaining: int(tokens),
+		Reset:     limit.refill(float64(limit.Burst) - tokens),
+	}
+	if !allowed {
+		// rounding must not tell the client to retry right away
+		if res.RetryAfter = limit.refill(1 - tokens); res.RetryAfter < time.Millisecond {
+			res.RetryAfter = time.Millisecond
+		}
+	}
+	return res
+}
+
+// Store - keeps the state of the buckets.
+type Store interface {
+	// Take - takes a token out of the bucket identified by key, buckets are created full the first time.
+	Take(key string, limit Limit, now time.Time) (*Result, error)
+}
+
+// Allower - decides whether the requests are allowed.
+type Allower interface {
+	// Allow - takes a token out of the bucket of the client for the route, the result is nil whenever the route is not
+	// limited.
+	Allow(route, client string) (*Result, error)
+}
+
+// Limiter - limits the requests of each client per route, every client has its own bucket per route.
+type Limiter struct {
+	store  Store
+	def    *Limit
+	routes map[string]*Limit
+	now    func() time.Time
+}
+
+// NewLimiter - limiter configured by cfg, the limits state is kept in the configured store.
+func NewLimiter(cfg config.RateLimitConfig) (*Limiter, error) {
+	var store Store
+	switch strings.ToLower(cfg.Store) {
+	case "", Memory:
+		store = NewMemoryStore()
+	case Redis:
+		store = NewRedisStore(newRedisClient(cfg.Redis))
+	default:
+		return nil, fmt.Errorf("unsupported rate limit store '%s'", cfg.Store)
+	}
+
+	return newLimiter(cfg, store)
+}
+
+func newLimiter(cfg config.RateLimitConfig, store Store) (*Limiter, error) {
+	def, err := parseLimit(cfg.Default)
+	if err != nil {
+		return nil, fmt.Errorf("invalid default rate limit: %s", err.Error())
+	}
+	l := &Limiter{
+		store:  store,
+		def:    def,
+		routes: make(map[string]*Limit, len(cfg.Routes)),
+		now:    time.Now,
+	}
+	for route, limit := range cfg.Routes {
+		if l.routes[route], err = parseLimit(limit); err != nil {
+			return nil, fmt.Errorf("invalid rate limit of route '%s': %s", route, err.Error())
+		}
+	}
+	// kept even when nil, so that the default limit does not apply
+	if l.routes[Authentication], err = parseLimit(cfg.Authentication); err != nil {
+		return nil, fmt.Errorf("invalid authentication rate limit: %s", err.Error())
+	}
+
+	return l, nil
+}
+
+// parseLimit - the limit given by cfg, nil when there is none.
+func parseLimit(cfg config.LimitConfig) (*Limit, error) {
+	if cfg.Requests < 0 || cfg.Per < 0 || cfg.Burst < 0 {
+		return nil, fmt.Errorf("requests, per and burst can not be negative")
+	}
+	if cfg.Requests == 0 {
+		return nil, nil
+	}
+	per := cfg.Per
+	if per == 0 {
+		per = time.Second
+	}
+	burst := cfg.Burst
+	if burst == 0 {
+		burst = cfg.Requests
+	}
+
+	return &Limit{Rate: float64(cfg.Requests) / per.Seconds(), Burst: burst}, nil
+}
+
+// Allow - routes listed in the config are limited by their own limit, the rest by the default one.
+func (l *Limiter) Allow(route, client string) (*Result, error) {
+	limit, ok := l.routes[route]
+	if !ok {
+		limit = l.def
+	}
+	if limit == nil {
+		return nil, nil
+	}
+
+	return l.store.Take(route+"|"+client, *limit, l.now())
+}
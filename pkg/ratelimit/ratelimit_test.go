@@ -0,0 +1,176 @@
+package ratelimit
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/config"
+)
+
+func TestNewLimiter(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         config.RateLimitConfig
+		expectedErr bool
+	}{
+		{name: "no limits"},
+		{
+			name: "default and route limits",
+			cfg: config.RateLimitConfig{
+				Default: config.LimitConfig{Requests: 100, Per: time.Minute},
+				Routes:  map[string]config.LimitConfig{"POST /recipes/{ID}/rate": {Requests: 5, Burst: 10}},
+			},
+		},
+		{name: "redis store", cfg: config.RateLimitConfig{Store: "redis"}},
+		{name: "unknown store", cfg: config.RateLimitConfig{Store: "memcached"}, expectedErr: true},
+		{name: "negative default", cfg: config.RateLimitConfig{Default: config.LimitConfig{Requests: -1}}, expectedErr: true},
+		{
+			name:        "negative authentication limit",
+			cfg:         config.RateLimitConfig{Authentication: config.LimitConfig{Per: -time.Second}},
+			expectedErr: true,
+		},
+		{
+			name:        "negative route burst",
+			cfg:         config.RateLimitConfig{Routes: map[string]config.LimitConfig{"GET /recipes": {Requests: 1, Burst: -1}}},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewLimiter(test.cfg); (err != nil) != test.expectedErr {
+				t.Errorf("expected error: %t instead got: '%v'", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.LimitConfig
+		expected *Limit
+	}{
+		{name: "no limit"},
+		{name: "per second by default", cfg: config.LimitConfig{Requests: 10}, expected: &Limit{Rate: 10, Burst: 10}},
+		{name: "per minute", cfg: config.LimitConfig{Requests: 30, Per: time.Minute}, expected: &Limit{Rate: 0.5, Burst: 30}},
+		{name: "burst", cfg: config.LimitConfig{Requests: 1, Burst: 5}, expected: &Limit{Rate: 1, Burst: 5}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limit, err := parseLimit(test.cfg)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(limit, test.expected) {
+				t.Errorf("expected: '%v' instead got: '%v'", test.expected, limit)
+			}
+		})
+	}
+}
+
+func TestLimiter_Allow(t *testing.T) {
+	cfg := config.RateLimitConfig{
+		Default: config.LimitConfig{Requests: 2, Per: time.Minute},
+		Routes: map[string]config.LimitConfig{
+			"POST /recipes/{ID}/rate": {Requests: 1, Per: time.Minute},
+			"GET /recipes":            {},
+		},
+	}
+	l, err := newLimiter(cfg, NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2020, 7, 16, 10, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	steps := []struct {
+		name     string
+		route    string
+		client   string
+		elapsed  time.Duration
+		expected *Result
+	}{
+		{name: "unlimited route", route: "GET /recipes", client: "ip:192.0.2.1"},
+		{name: "authentication not limited by default", route: Authentication, client: "ip:192.0.2.1"},
+		{
+			name:     "default limit",
+			route:    "GET /recipes/{ID}",
+			client:   "ip:192.0.2.1",
+			expected: &Result{Allowed: true, Limit: 2, Remaining: 1, Reset: 30 * time.Second},
+		},
+		{
+			name:     "default limit - last token",
+			route:    "GET /recipes/{ID}",
+			client:   "ip:192.0.2.1",
+			expected: &Result{Allowed: true, Limit: 2, Remaining: 0, Reset: time.Minute},
+		},
+		{
+			name:     "default limit - exhausted",
+			route:    "GET /recipes/{ID}",
+			client:   "ip:192.0.2.1",
+			elapsed:  10 * time.Second,
+			expected: &Result{Limit: 2, Remaining: 0, Reset: 50 * time.Second, RetryAfter: 20 * time.Second},
+		},
+		{
+			name:     "another client has its own bucket",
+			route:    "GET /recipes/{ID}",
+			client:   "user:chef",
+			expected: &Result{Allowed: true, Limit: 2, Remaining: 1, Reset: 30 * time.Second},
+		},
+		{
+			name:     "route limit",
+			route:    "POST /recipes/{ID}/rate",
+			client:   "user:chef",
+			expected: &Result{Allowed: true, Limit: 1, Remaining: 0, Reset: time.Minute},
+		},
+		{
+			name:     "route limit - exhausted",
+			route:    "POST /recipes/{ID}/rate",
+			client:   "user:chef",
+			expected: &Result{Limit: 1, Remaining: 0, Reset: time.Minute, RetryAfter: time.Minute},
+		},
+		{
+			name:     "default limit - refilled",
+			route:    "GET /recipes/{ID}",
+			client:   "ip:192.0.2.1",
+			elapsed:  20 * time.Second,
+			expected: &Result{Allowed: true, Limit: 2, Remaining: 0, Reset: time.Minute},
+		},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.elapsed)
+		res, err := l.Allow(step.route, step.client)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", step.name, err)
+		}
+		if !reflect.DeepEqual(res, step.expected) {
+			t.Errorf("%s: expected: '%+v' instead got: '%+v'", step.name, step.expected, res)
+		}
+	}
+}
+
+func TestMemoryStore_Sweep(t *testing.T) {
+	s := NewMemoryStore()
+	limit := Limit{Rate: 1, Burst: 5}
+	now := time.Date(2020, 7, 16, 10, 0, 0, 0, time.UTC)
+	if _, err := s.Take("GET /recipes|ip:192.0.2.1", limit, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Take("GET /recipes|ip:192.0.2.2", limit, now.Add(sweepInterval-time.Second/2)); err != nil {
+		t.Fatal(err)
+	}
+	// the first bucket has been refilled by now whereas the second one is still being refilled
+	if _, err := s.Take("GET /recipes|ip:192.0.2.3", limit, now.Add(sweepInterval)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.buckets["GET /recipes|ip:192.0.2.1"]; ok {
+		t.Errorf("expected full bucket to be dropped")
+	}
+	if len(s.buckets) != 2 {
+		t.Errorf("expected 2 buckets instead got: %d", len(s.buckets))
+	}
+}
@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/rnov/Go-REST/pkg/config"
+)
+
+// keyPrefix - prefix of the hashes holding the buckets.
+const keyPrefix = "RATELIMIT_"
+
+// takeScript - refills the bucket and takes a token out of it atomically, the bucket expires once it is full again
+// since a full bucket is the same as a missing one. ARGV holds the rate (tokens per second), the burst and the current
+// time in milliseconds, returns whether the token has been taken along with the tokens left (as a string, numbers are
+// truncated to integers otherwise).
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(bucket[1])
+local last = tonumber(bucket[2])
+if tokens == nil or last == nil then
+	tokens = burst
+	last = now
+end
+if now > last then
+	tokens = math.min(burst, tokens + (now - last) / 1000 * rate)
+	last = now
+end
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'last', tostring(last))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate * 1000) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// scripter - to be able to mock redis without running any instance, satisfied by *redis.Client.
+type scripter interface {
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd
+	EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) *redis.Cmd
+	ScriptExists(ctx context.Context, hashes ...string) *redis.BoolSliceCmd
+	ScriptLoad(ctx context.Context, script string) *redis.StringCmd
+}
+
+// RedisStore - keeps the buckets in redis, the limits are shared by all the replicas using the same instance. The
+// buckets are refilled according to the clock of the replicas, which are expected to be in sync.
+type RedisStore struct {
+	client scripter
+}
+
+// NewRedisStore - store backed by the given client.
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func newRedisClient(cfg config.DBConfig) *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr: fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		DB:   cfg.DB,
+	})
+}
+
+// Take - runs takeScript against the bucket hash of the key, the round trip is bounded by the client timeouts.
+func (s *RedisStore) Take(key string, limit Limit, now time.Time) (*Result, error) {
+	nowMs := now.UnixNano() / int64(time.Millisecond)
+	reply, err := takeScript.Run(context.Background(), s.client, []string{keyPrefix + key}, limit.Rate, limit.Burst, nowMs).Result()
+	if err != nil {
+		return nil, err
+	}
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return nil, fmt.Errorf("unexpected rate limit reply '%v'", reply)
+	}
+	allowed, ok := values[0].(int64)
+	if !ok {
+		return nil, fmt.Errorf("unexpected rate limit reply '%v'", reply)
+	}
+	left, ok := values[1].(string)
+	if !ok {
+		return nil, fmt.Errorf("unexpected rate limit reply '%v'", reply)
+	}
+	tokens, err := strconv.ParseFloat(left, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected rate limit reply '%v'", reply)
+	}
+
+	return newResult(limit, tokens, allowed == 1), nil
+}
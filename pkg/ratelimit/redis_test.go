@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// scripterMock - replies to the script run by EvalSha, the script is never loaded.
+type scripterMock struct {
+	evalSha func(keys []string, args ...interface{}) (interface{}, error)
+}
+
+func (sm *scripterMock) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	panic("Not implemented")
+}
+
+func (sm *scripterMock) EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) *redis.Cmd {
+	if sm.evalSha != nil {
+		return redis.NewCmdResult(sm.evalSha(keys, args...))
+	}
+	panic("Not implemented")
+}
+
+func (sm *scripterMock) ScriptExists(ctx context.Context, hashes ...string) *redis.BoolSliceCmd {
+	panic("Not implemented")
+}
+
+func (sm *scripterMock) ScriptLoad(ctx context.Context, script string) *redis.StringCmd {
+	panic("Not implemented")
+}
+
+func TestRedisStore_Take(t *testing.T) {
+	limit := Limit{Rate: 0.5, Burst: 2}
+	now := time.Date(2020, 7, 16, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		client      scripterMock
+		expected    *Result
+		expectedErr bool
+	}{
+		{
+			name: "allowed",
+			client: scripterMock{
+				evalSha: func(keys []string, args ...interface{}) (interface{}, error) {
+					if !reflect.DeepEqual(keys, []string{"RATELIMIT_GET /recipes|ip:192.0.2.1"}) {
+						return nil, errors.New("unexpected keys")
+					}
+					if !reflect.DeepEqual(args, []interface{}{0.5, 2, int64(1594893600000)}) {
+						return nil, errors.New("unexpected args")
+					}
+					return []interface{}{int64(1), "1"}, nil
+				},
+			},
+			expected: &Result{Allowed: true, Limit: 2, Remaining: 1, Reset: 2 * time.Second},
+		},
+		{
+			name: "not allowed",
+			client: scripterMock{
+				evalSha: func(keys []string, args ...interface{}) (interface{}, error) {
+					return []interface{}{int64(0), "0.5"}, nil
+				},
+			},
+			expected: &Result{Limit: 2, Remaining: 0, Reset: 3 * time.Second, RetryAfter: time.Second},
+		},
+		{
+			name: "error redis",
+			client: scripterMock{
+				evalSha: func(keys []string, args ...interface{}) (interface{}, error) {
+					return nil, errors.New("connection refused")
+				},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "error unexpected reply",
+			client: scripterMock{
+				evalSha: func(keys []string, args ...interface{}) (interface{}, error) {
+					return []interface{}{int64(1), int64(1)}, nil
+				},
+			},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &RedisStore{client: &test.client}
+			res, err := s.Take("GET /recipes|ip:192.0.2.1", limit, now)
+			if (err != nil) != test.expectedErr {
+				t.Fatalf("expected error: %t instead got: '%v'", test.expectedErr, err)
+			}
+			if !reflect.DeepEqual(res, test.expected) {
+				t.Errorf("expected: '%+v' instead got: '%+v'", test.expected, res)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package recipe
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sort fields supported when listing recipes, prefixing them with "-" sorts in descending order.
+const (
+	SortName       = "name"
+	SortPrepTime   = "prepTime"
+	SortDifficulty = "difficulty"
+	SortRating     = "rating"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// Filter - criteria a recipe must satisfy to be listed, zero values mean no filtering.
+type Filter struct {
+	Vegetarian  *bool
+	MaxPrepTime int
+	Difficulty  int
+}
+
+// Query - defines which recipes and in which order are listed, it is pushed down to the DB clients.
+type Query struct {
+	Limit  int
+	Sort   string
+	Desc   bool
+	Cursor *Cursor
+	Filter Filter
+}
+
+// Page - a chunk of listed recipes, NextCursor is empty when there are no more recipes to list.
+type Page struct {
+	Recipes    []*Recipe
+	NextCursor string
+}
+
+// Cursor - position of the last listed recipe, the next page starts right after it. Key holds the value of the sort
+// field whereas the ID breaks ties between recipes with the same value.
+type Cursor struct {
+	Key string `json:"k"`
+	ID  string `json:"id"`
+}
+
+// EncodeCursor - opaque representation of a cursor, clients must not rely on its content.
+func EncodeCursor(c *Cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cursor{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// ValidSort - checks that the given field can be used to sort recipes.
+func ValidSort(field string) bool {
+	switch field {
+	case SortName, SortPrepTime, SortDifficulty, SortRating:
+		return true
+	}
+	return false
+}
+
+// ValidCursor - checks that the cursor key can be compared with the query's sort field.
+func (q *Query) ValidCursor() bool {
+	if q.Cursor == nil {
+		return true
+	}
+	switch q.Sort {
+	case SortPrepTime, SortDifficulty:
+		_, err := strconv.Atoi(q.Cursor.Key)
+		return err == nil
+	case SortRating:
+		_, err := strconv.ParseFloat(q.Cursor.Key, 64)
+		return err == nil
+	}
+	return true
+}
+
+// Matches - whether a recipe satisfies the query's filter.
+func (q *Query) Matches(rcp *Recipe) bool {
+	if q.Filter.Vegetarian != nil && rcp.Vegetarian != *q.Filter.Vegetarian {
+		return false
+	}
+	if q.Filter.MaxPrepTime > 0 && rcp.PrepTime > q.Filter.MaxPrepTime {
+		return false
+	}
+	if q.Filter.Difficulty > 0 && rcp.Difficulty != q.Filter.Difficulty {
+		return false
+	}
+	return true
+}
+
+// CursorOf - cursor pointing to the given recipe for the query's sort.
+func (q *Query) CursorOf(rcp *Recipe) *Cursor {
+	c := &Cursor{ID: rcp.ID}
+	switch q.Sort {
+	case SortName:
+		c.Key = strings.ToLower(rcp.Name)
+	case SortPrepTime:
+		c.Key = strconv.Itoa(rcp.PrepTime)
+	case SortDifficulty:
+		c.Key = strconv.Itoa(rcp.Difficulty)
+	case SortRating:
+		c.Key = strconv.FormatFloat(rcp.AverageRating, 'f', -1, 64)
+	}
+
+	return c
+}
+
+// Less - whether a is listed before b, recipes are ordered by the sort field and then by ID.
+func (q *Query) Less(a, b *Recipe) bool {
+	return q.before(q.CursorOf(a), q.CursorOf(b))
+}
+
+// After - whether a recipe is listed after the given cursor.
+func (q *Query) After(rcp *Recipe, c *Cursor) bool {
+	return q.before(c, q.CursorOf(rcp))
+}
+
+func (q *Query) before(a, b *Cursor) bool {
+	cmp := q.compareKeys(a.Key, b.Key)
+	if cmp == 0 {
+		cmp = strings.Compare(a.ID, b.ID)
+	}
+	if q.Desc {
+		return cmp > 0
+	}
+	return cmp < 0
+}
+
+func (q *Query) compareKeys(a, b string) int {
+	if q.Sort == SortName || len(q.Sort) == 0 {
+		return strings.Compare(a, b)
+	}
+	fa, _ := strconv.ParseFloat(a, 64)
+	fb, _ := strconv.ParseFloat(b, 64)
+	switch {
+	case fa < fb:
+		return -1
+	case fa > fb:
+		return 1
+	}
+	return 0
+}
+
+// Apply - filters, sorts and paginates the given recipes, meant for DB clients that cannot do it natively.
+func (q *Query) Apply(rcps []*Recipe) *Page {
+	matched := make([]*Recipe, 0, len(rcps))
+	for _, rcp := range rcps {
+		if !q.Matches(rcp) {
+			continue
+		}
+		if q.Cursor != nil && !q.After(rcp, q.Cursor) {
+			continue
+		}
+		matched = append(matched, rcp)
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return q.Less(matched[i], matched[j])
+	})
+
+	return q.NewPage(matched)
+}
+
+// NewPage - builds a page out of sorted recipes that follow the cursor, at most limit + 1 are needed to know whether
+// there is a next page.
+func (q *Query) NewPage(sorted []*Recipe) *Page {
+	page := &Page{Recipes: sorted}
+	if q.Limit > 0 && len(sorted) > q.Limit {
+		page.Recipes = sorted[:q.Limit]
+		page.NextCursor = EncodeCursor(q.CursorOf(page.Recipes[q.Limit-1]))
+	}
+
+	return page
+}
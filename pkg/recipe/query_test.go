@@ -0,0 +1,72 @@
+package recipe
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQuery_Apply(t *testing.T) {
+	vegetarian := true
+	recipes := []*Recipe{
+		{ID: "d", Name: "Dal", PrepTime: 40, Difficulty: 2, Vegetarian: true, AverageRating: 4.5},
+		{ID: "a", Name: "apple pie", PrepTime: 60, Difficulty: 3, Vegetarian: true, AverageRating: 3},
+		{ID: "c", Name: "Chili", PrepTime: 40, Difficulty: 1, Vegetarian: false, AverageRating: 4.5},
+		{ID: "b", Name: "burger", PrepTime: 15, Difficulty: 1, Vegetarian: false},
+	}
+	tests := []struct {
+		name        string
+		query       *Query
+		expectedIDs [][]string
+	}{
+		{
+			name:        "default order by ID",
+			query:       &Query{Limit: 3},
+			expectedIDs: [][]string{{"a", "b", "c"}, {"d"}},
+		},
+		{
+			name:        "sort by name - case insensitive",
+			query:       &Query{Limit: 2, Sort: SortName},
+			expectedIDs: [][]string{{"a", "b"}, {"c", "d"}},
+		},
+		{
+			name:        "sort by prep time - ties broken by ID",
+			query:       &Query{Limit: 2, Sort: SortPrepTime},
+			expectedIDs: [][]string{{"b", "c"}, {"d", "a"}},
+		},
+		{
+			name:        "sort by rating descending",
+			query:       &Query{Limit: 1, Sort: SortRating, Desc: true},
+			expectedIDs: [][]string{{"d"}, {"c"}, {"a"}, {"b"}},
+		},
+		{
+			name:        "filtered",
+			query:       &Query{Limit: 10, Sort: SortDifficulty, Filter: Filter{Vegetarian: &vegetarian, MaxPrepTime: 50}},
+			expectedIDs: [][]string{{"d"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var pages [][]string
+			for {
+				page := test.query.Apply(recipes)
+				IDs := make([]string, 0, len(page.Recipes))
+				for _, rcp := range page.Recipes {
+					IDs = append(IDs, rcp.ID)
+				}
+				pages = append(pages, IDs)
+				if len(page.NextCursor) == 0 {
+					break
+				}
+				cursor, err := DecodeCursor(page.NextCursor)
+				if err != nil {
+					t.Fatalf("unexpected error decoding cursor: '%s'", err)
+				}
+				test.query.Cursor = cursor
+			}
+			if !reflect.DeepEqual(pages, test.expectedIDs) {
+				t.Errorf("expected: '%v' instead got: '%v'", test.expectedIDs, pages)
+			}
+		})
+	}
+}
@@ -1,9 +1,109 @@
 package recipe
 
+import (
+	"reflect"
+	"time"
+)
+
 type Recipe struct {
 	ID         string `json:"ID"`
 	Name       string `json:"name"`
 	PrepTime   int    `json:"prepTime"`
 	Difficulty int    `json:"difficulty"`
 	Vegetarian bool   `json:"vegetarian"`
+	Servings   int    `json:"servings,omitempty"`
+	Cuisine    string `json:"cuisine,omitempty"`
+	// Tags - free labels of the recipe, e.g. "quick" or "spicy".
+	Tags        []string     `json:"tags,omitempty"`
+	Ingredients []Ingredient `json:"ingredients,omitempty"`
+	// Steps - preparation steps, in the order they have to be followed.
+	Steps []string `json:"steps,omitempty"`
+	// AverageRating and RatingCount are read only, they are computed from the recipe's rates.
+	AverageRating float64 `json:"averageRating"`
+	RatingCount   int     `json:"ratingCount"`
+	// CreatedAt and UpdatedAt are read only, they are set by the API regardless of the values sent by the client.
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Version is read only, it is set by the DB and increased on every update. It is exposed within the recipe's ETag.
+	Version int64 `json:"version"`
+	// Owner is read only, it is the user that created the recipe. Recipes created before ownership was recorded have none.
+	Owner string `json:"owner,omitempty"`
+}
+
+// Ingredient - an ingredient of a recipe, the quantity is expressed in the given unit (e.g. grams, cups) or as a number
+// of pieces when the unit is empty.
+type Ingredient struct {
+	Name     string  `json:"name"`
+	Quantity float64 `json:"quantity,omitempty"`
+	Unit     string  `json:"unit,omitempty"`
+}
+
+// Writable fields of a recipe, named after their JSON counterpart, partial updates are expressed in terms of them.
+const (
+	FieldName        = "name"
+	FieldPrepTime    = "prepTime"
+	FieldDifficulty  = "difficulty"
+	FieldVegetarian  = "vegetarian"
+	FieldServings    = "servings"
+	FieldCuisine     = "cuisine"
+	FieldTags        = "tags"
+	FieldIngredients = "ingredients"
+	FieldSteps       = "steps"
+)
+
+// field - a writable field along with a pointer to its value in a recipe.
+type field struct {
+	name  string
+	value interface{}
+}
+
+func writableFields(rcp *Recipe) []field {
+	return []field{
+		{name: FieldName, value: &rcp.Name},
+		{name: FieldPrepTime, value: &rcp.PrepTime},
+		{name: FieldDifficulty, value: &rcp.Difficulty},
+		{name: FieldVegetarian, value: &rcp.Vegetarian},
+		{name: FieldServings, value: &rcp.Servings},
+		{name: FieldCuisine, value: &rcp.Cuisine},
+		{name: FieldTags, value: &rcp.Tags},
+		{name: FieldIngredients, value: &rcp.Ingredients},
+		{name: FieldSteps, value: &rcp.Steps},
+	}
+}
+
+// ChangedFields - writable fields whose value differs between both recipes, empty and nil lists are considered equal.
+func ChangedFields(old, new *Recipe) []string {
+	var changed []string
+	oldValues, newValues := writableFields(old), writableFields(new)
+	for i, f := range oldValues {
+		o, n := reflect.ValueOf(f.value).Elem(), reflect.ValueOf(newValues[i].value).Elem()
+		if o.Kind() == reflect.Slice && o.Len() == 0 && n.Len() == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(o.Interface(), n.Interface()) {
+			changed = append(changed, f.name)
+		}
+	}
+	return changed
+}
+
+// CopyFields - copies the value of the given writable fields from src into dst, lists are copied as well so that they
+// are not shared. Unknown fields are ignored.
+func CopyFields(dst, src *Recipe, fields []string) {
+	dstValues, srcValues := writableFields(dst), writableFields(src)
+	for _, field := range fields {
+		for i, f := range dstValues {
+			if f.name != field {
+				continue
+			}
+			s := reflect.ValueOf(srcValues[i].value).Elem()
+			d := reflect.ValueOf(f.value).Elem()
+			if s.Kind() == reflect.Slice && !s.IsNil() {
+				c := reflect.MakeSlice(s.Type(), s.Len(), s.Len())
+				reflect.Copy(c, s)
+				s = c
+			}
+			d.Set(s)
+		}
+	}
 }
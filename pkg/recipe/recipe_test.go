@@ -0,0 +1,50 @@
+package recipe
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChangedFields(t *testing.T) {
+	old := &Recipe{ID: "1", Name: "Paella", PrepTime: 60, Difficulty: 2, Tags: []string{}, Steps: []string{"cook"}}
+	tests := []struct {
+		name     string
+		new      *Recipe
+		expected []string
+	}{
+		{
+			name: "no changes - read only fields and empty lists are ignored",
+			new:  &Recipe{ID: "2", Name: "Paella", PrepTime: 60, Difficulty: 2, Steps: []string{"cook"}, Version: 3},
+		},
+		{
+			name:     "changed fields",
+			new:      &Recipe{Name: "Paella", PrepTime: 45, Difficulty: 2, Vegetarian: true, Tags: []string{"rice"}},
+			expected: []string{FieldPrepTime, FieldVegetarian, FieldTags, FieldSteps},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changed := ChangedFields(old, test.new)
+			if !reflect.DeepEqual(changed, test.expected) {
+				t.Errorf("expected: '%v' instead got: '%v'", test.expected, changed)
+			}
+		})
+	}
+}
+
+func TestCopyFields(t *testing.T) {
+	dst := &Recipe{ID: "1", Name: "Paella", PrepTime: 60, Difficulty: 2, Tags: []string{"rice"}, Version: 2}
+	src := &Recipe{ID: "2", Name: "Gazpacho", PrepTime: 15, Difficulty: 1, Steps: []string{"blend"}, Version: 5}
+
+	CopyFields(dst, src, []string{FieldName, FieldTags, FieldSteps, "unknown"})
+	expected := &Recipe{ID: "1", Name: "Gazpacho", PrepTime: 60, Difficulty: 2, Steps: []string{"blend"}, Version: 2}
+	if !reflect.DeepEqual(dst, expected) {
+		t.Errorf("expected: '%v' instead got: '%v'", expected, dst)
+	}
+	// lists are not shared
+	src.Steps[0] = "modified"
+	if dst.Steps[0] != "blend" {
+		t.Errorf("expected copied steps not to be modified instead got: '%v'", dst.Steps)
+	}
+}
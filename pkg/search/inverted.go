@@ -0,0 +1,140 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rnov/Go-REST/pkg/recipe"
+)
+
+// exactBoost - a term matching exactly a query term weights more than one that is only prefixed by it.
+const exactBoost = 2
+
+// InvertedIndex - in-process inverted index, every term points to the recipes containing it along with the weighted
+// frequency of the term within each recipe. Terms are also kept sorted so that prefix matches are a range lookup.
+type InvertedIndex struct {
+	mu       sync.RWMutex
+	postings map[string]map[string]float64
+	terms    []string
+	docs     map[string][]string
+}
+
+func NewInvertedIndex() *InvertedIndex {
+	return &InvertedIndex{
+		postings: make(map[string]map[string]float64),
+		docs:     make(map[string][]string),
+	}
+}
+
+func (ii *InvertedIndex) Index(rcp *recipe.Recipe) {
+	freqs := make(map[string]float64)
+	for _, f := range fields(rcp) {
+		for _, term := range Tokenize(f.text) {
+			freqs[term] += f.weight
+		}
+	}
+
+	ii.mu.Lock()
+	defer ii.mu.Unlock()
+	ii.remove(rcp.ID)
+	terms := make([]string, 0, len(freqs))
+	for term, freq := range freqs {
+		posting, ok := ii.postings[term]
+		if !ok {
+			posting = make(map[string]float64)
+			ii.postings[term] = posting
+			ii.insertTerm(term)
+		}
+		posting[rcp.ID] = freq
+		terms = append(terms, term)
+	}
+	if len(terms) > 0 {
+		ii.docs[rcp.ID] = terms
+	}
+}
+
+func (ii *InvertedIndex) Remove(recipeID string) {
+	ii.mu.Lock()
+	defer ii.mu.Unlock()
+	ii.remove(recipeID)
+}
+
+func (ii *InvertedIndex) Search(text string, limit int) []string {
+	queryTerms := Tokenize(text)
+	if len(queryTerms) == 0 {
+		return []string{}
+	}
+
+	ii.mu.RLock()
+	var scores map[string]float64
+	for _, queryTerm := range queryTerms {
+		termScores := make(map[string]float64)
+		for i := sort.SearchStrings(ii.terms, queryTerm); i < len(ii.terms) && strings.HasPrefix(ii.terms[i], queryTerm); i++ {
+			boost := 1.0
+			if ii.terms[i] == queryTerm {
+				boost = exactBoost
+			}
+			for ID, freq := range ii.postings[ii.terms[i]] {
+				termScores[ID] += freq * boost
+			}
+		}
+		// every query term must be matched
+		if scores == nil {
+			scores = termScores
+			continue
+		}
+		for ID, score := range scores {
+			if termScore, ok := termScores[ID]; ok {
+				scores[ID] = score + termScore
+			} else {
+				delete(scores, ID)
+			}
+		}
+	}
+	ii.mu.RUnlock()
+
+	IDs := make([]string, 0, len(scores))
+	for ID := range scores {
+		IDs = append(IDs, ID)
+	}
+	sort.Slice(IDs, func(i, j int) bool {
+		if scores[IDs[i]] != scores[IDs[j]] {
+			return scores[IDs[i]] > scores[IDs[j]]
+		}
+		return IDs[i] < IDs[j]
+	})
+	if limit > 0 && len(IDs) > limit {
+		IDs = IDs[:limit]
+	}
+
+	return IDs
+}
+
+// remove - removes the recipe from the postings of its terms, terms left without recipes are dropped. The caller must
+// hold the write lock.
+func (ii *InvertedIndex) remove(recipeID string) {
+	for _, term := range ii.docs[recipeID] {
+		posting := ii.postings[term]
+		delete(posting, recipeID)
+		if len(posting) == 0 {
+			delete(ii.postings, term)
+			ii.deleteTerm(term)
+		}
+	}
+	delete(ii.docs, recipeID)
+}
+
+func (ii *InvertedIndex) insertTerm(term string) {
+	i := sort.SearchStrings(ii.terms, term)
+	ii.terms = append(ii.terms, "")
+	copy(ii.terms[i+1:], ii.terms[i:])
+	ii.terms[i] = term
+}
+
+func (ii *InvertedIndex) deleteTerm(term string) {
+	i := sort.SearchStrings(ii.terms, term)
+	if i < len(ii.terms) && ii.terms[i] == term {
+		ii.terms = append(ii.terms[:i], ii.terms[i+1:]...)
+	}
+}
@@ -0,0 +1,167 @@
+package search
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/rnov/Go-REST/pkg/recipe"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected []string
+	}{
+		{name: "empty", text: "", expected: []string{}},
+		{name: "separators only", text: " ,-!", expected: []string{}},
+		{name: "mixed case and punctuation", text: "Chicken, Tikka-Masala!", expected: []string{"chicken", "tikka", "masala"}},
+		{name: "digits and accents", text: "Crème brûlée x2", expected: []string{"crème", "brûlée", "x2"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			terms := Tokenize(test.text)
+			if len(terms) == 0 && len(test.expected) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(terms, test.expected) {
+				t.Errorf("expected: '%v' instead got: '%v'", test.expected, terms)
+			}
+		})
+	}
+}
+
+func newTestIndex() *InvertedIndex {
+	index := NewInvertedIndex()
+	for _, rcp := range []*recipe.Recipe{
+		{ID: "1", Name: "Chicken curry"},
+		{ID: "2", Name: "Chicken chicken soup"},
+		{ID: "3", Name: "Chickpea curry"},
+		{ID: "4", Name: "Tomato soup"},
+		{ID: "5", Name: "Chick"},
+	} {
+		index.Index(rcp)
+	}
+	return index
+}
+
+func TestInvertedIndex_Search(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		limit    int
+		expected []string
+	}{
+		{
+			name:     "exact term, ranked by frequency",
+			text:     "chicken",
+			expected: []string{"2", "1"},
+		},
+		{
+			name:     "prefix matching, exact matches first",
+			text:     "chick",
+			expected: []string{"2", "5", "1", "3"},
+		},
+		{
+			name:     "all terms must match",
+			text:     "chick curry",
+			expected: []string{"1", "3"},
+		},
+		{
+			name:     "case insensitive",
+			text:     "SOUP",
+			expected: []string{"2", "4"},
+		},
+		{
+			name:     "limit",
+			text:     "chick",
+			limit:    2,
+			expected: []string{"2", "5"},
+		},
+		{
+			name:     "no matches",
+			text:     "pizza",
+			expected: []string{},
+		},
+		{
+			name:     "no terms",
+			text:     "  ",
+			expected: []string{},
+		},
+	}
+
+	index := newTestIndex()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			IDs := index.Search(test.text, test.limit)
+			if !reflect.DeepEqual(IDs, test.expected) {
+				t.Errorf("expected: '%v' instead got: '%v'", test.expected, IDs)
+			}
+		})
+	}
+}
+
+func TestInvertedIndex_SearchDetails(t *testing.T) {
+	index := newTestIndex()
+	index.Index(&recipe.Recipe{
+		ID:          "6",
+		Name:        "Vindaloo",
+		Cuisine:     "Indian",
+		Tags:        []string{"spicy"},
+		Ingredients: []recipe.Ingredient{{Name: "chicken thighs"}, {Name: "chilli"}},
+	})
+
+	// name matches rank above ingredient ones
+	if IDs := index.Search("chicken", 0); !reflect.DeepEqual(IDs, []string{"2", "1", "6"}) {
+		t.Errorf("expected: '%v' instead got: '%v'", []string{"2", "1", "6"}, IDs)
+	}
+	if IDs := index.Search("spicy indian", 0); !reflect.DeepEqual(IDs, []string{"6"}) {
+		t.Errorf("expected: '%v' instead got: '%v'", []string{"6"}, IDs)
+	}
+}
+
+func TestInvertedIndex_IndexAndRemove(t *testing.T) {
+	index := newTestIndex()
+
+	// re-indexing replaces the previous version of the recipe
+	index.Index(&recipe.Recipe{ID: "1", Name: "Beef stew"})
+	if IDs := index.Search("curry", 0); !reflect.DeepEqual(IDs, []string{"3"}) {
+		t.Errorf("expected: '%v' instead got: '%v'", []string{"3"}, IDs)
+	}
+	if IDs := index.Search("beef", 0); !reflect.DeepEqual(IDs, []string{"1"}) {
+		t.Errorf("expected: '%v' instead got: '%v'", []string{"1"}, IDs)
+	}
+
+	index.Remove("1")
+	index.Remove("3")
+	index.Remove("unknown")
+	if IDs := index.Search("beef", 0); len(IDs) != 0 {
+		t.Errorf("expected no matches instead got: '%v'", IDs)
+	}
+	for _, term := range index.terms {
+		if term == "beef" || term == "stew" || term == "curry" || term == "chickpea" {
+			t.Errorf("expected term '%s' to be dropped", term)
+		}
+	}
+}
+
+func TestInvertedIndex_Concurrency(t *testing.T) {
+	index := NewInvertedIndex()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			ID := string(rune('a' + i%26))
+			index.Index(&recipe.Recipe{ID: ID, Name: "Concurrent recipe"})
+			index.Remove(ID)
+		}(i)
+		go func() {
+			defer wg.Done()
+			index.Search("recipe", 10)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,48 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/rnov/Go-REST/pkg/recipe"
+)
+
+// Index - full-text index of recipes, implementations must be safe for concurrent use. It is kept updated by the recipe
+// service, therefore it can be swapped (e.g. by an external search engine) without changes in the rest of the API.
+type Index interface {
+	// Index - adds the recipe to the index, any previously indexed version of the same recipe is replaced.
+	Index(rcp *recipe.Recipe)
+	// Remove - removes the recipe from the index, removing a recipe that is not indexed is a no-op.
+	Remove(recipeID string)
+	// Search - IDs of the recipes matching all the terms of the text, ranked from the most to the least relevant. A limit
+	// equal or lower than 0 means no limit.
+	Search(text string, limit int) []string
+}
+
+// field - searchable text of a recipe along with its weight when ranking.
+type field struct {
+	text   string
+	weight float64
+}
+
+// fields - searchable fields of a recipe, new text fields of the recipe only need to be listed here to be searchable.
+func fields(rcp *recipe.Recipe) []field {
+	fs := []field{
+		{text: rcp.Name, weight: 1},
+		{text: rcp.Cuisine, weight: 0.5},
+	}
+	for _, tag := range rcp.Tags {
+		fs = append(fs, field{text: tag, weight: 0.5})
+	}
+	for _, ingredient := range rcp.Ingredients {
+		fs = append(fs, field{text: ingredient.Name, weight: 0.5})
+	}
+	return fs
+}
+
+// Tokenize - splits the text into lower case terms, anything other than letters and digits is a separator.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
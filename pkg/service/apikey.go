@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/apikey"
+	"github.com/rnov/Go-REST/pkg/db"
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/id"
+	"github.com/rnov/Go-REST/pkg/identity"
+	"github.com/rnov/Go-REST/pkg/tracing"
+)
+
+const maxKeyNameLen = 100
+
+// APIKeyMng - API keys business logic, every method works on behalf of the request of ctx.
+type APIKeyMng interface {
+	// Create - generates the key on behalf of the user, its secret is set into the given key.
+	Create(ctx context.Context, key *apikey.Key, user *identity.Principal) error
+	List(ctx context.Context) ([]*apikey.Key, error)
+	// Rotate - generates a new secret for the key, the previous one is no longer accepted. The key is returned along with
+	// its new secret.
+	Rotate(ctx context.Context, ID string) (*apikey.Key, error)
+	// Revoke - deletes the key, it is no longer accepted.
+	Revoke(ctx context.Context, ID string) error
+}
+
+type APIKey struct {
+	keyDB db.APIKey
+	newID func() (string, error)
+	now   func() time.Time
+}
+
+func NewAPIKey(keyDB db.APIKey) *APIKey {
+	keySrv := &APIKey{
+		keyDB: keyDB,
+		newID: id.New,
+		now:   time.Now,
+	}
+	return keySrv
+}
+
+// Create - keys are granted the default role unless told otherwise, scopes must be permissions of the role.
+func (k *APIKey) Create(ctx context.Context, key *apikey.Key, user *identity.Principal) (err error) {
+	ctx, span := tracing.Start(ctx, "service.APIKey.Create")
+	defer func() { tracing.End(span, err) }()
+	now := k.now().UTC()
+	if len(key.Role) == 0 {
+		key.Role = identity.DefaultRole
+	}
+	if v := validateAPIKey(key, now); len(v) > 0 {
+		return errors.NewInputError("Invalid input parameters", v)
+	}
+	ID, err := k.newID()
+	if err != nil {
+		return errors.NewDBErr(err.Error())
+	}
+	key.ID = ID
+	key.CreatedBy = user.Username
+	key.CreatedAt = now
+	if err := key.Generate(); err != nil {
+		return errors.NewDBErr(err.Error())
+	}
+
+	return k.keyDB.CreateAPIKey(ctx, key)
+}
+
+func (k *APIKey) List(ctx context.Context) (_ []*apikey.Key, err error) {
+	ctx, span := tracing.Start(ctx, "service.APIKey.List")
+	defer func() { tracing.End(span, err) }()
+	return k.keyDB.GetAPIKeys(ctx)
+}
+
+// Rotate - the hash is swapped for the new one as long as the key has not been rotated since it was read, of concurrent
+// rotations of the same key only one succeeds, the others fail with *errors.PreconditionErr.
+func (k *APIKey) Rotate(ctx context.Context, ID string) (_ *apikey.Key, err error) {
+	ctx, span := tracing.Start(ctx, "service.APIKey.Rotate")
+	defer func() { tracing.End(span, err) }()
+	if !validateKeyID(ID) {
+		return nil, errors.NewInputError("Invalid ID format", nil)
+	}
+	key, err := k.keyDB.GetAPIKey(ctx, ID)
+	if err != nil {
+		return nil, err
+	}
+	oldHash := key.Hash
+	if err := key.Generate(); err != nil {
+		return nil, errors.NewDBErr(err.Error())
+	}
+	if err := k.keyDB.RotateAPIKey(ctx, ID, oldHash, key.Hash); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (k *APIKey) Revoke(ctx context.Context, ID string) (err error) {
+	ctx, span := tracing.Start(ctx, "service.APIKey.Revoke")
+	defer func() { tracing.End(span, err) }()
+	if !validateKeyID(ID) {
+		return errors.NewInputError("Invalid ID format", nil)
+	}
+	return k.keyDB.DeleteAPIKey(ctx, ID)
+}
+
+// validateKeyID - key IDs are always generated by id.New.
+func validateKeyID(ID string) bool {
+	return id.Valid(ID)
+}
+
+// validateAPIKey validates the fields of a key given by the client.
+func validateAPIKey(key *apikey.Key, now time.Time) map[string]string {
+	valid := make(map[string]string)
+
+	if v := validateText(key.Name, maxKeyNameLen); len(v) > 0 {
+		valid[errors.Name] = v
+	}
+	if !identity.ValidRole(key.Role) {
+		valid[errors.Role] = errors.Invalid
+	}
+	for _, scope := range key.Scopes {
+		if !key.Role.Grants(scope) {
+			valid[errors.Scopes] = errors.Invalid
+		}
+	}
+	if key.ExpiresAt != nil && !key.ExpiresAt.After(now) {
+		valid[errors.ExpiresAt] = errors.OutOfRange
+	}
+	return valid
+}
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rnov/Go-REST/pkg/apikey"
+	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
+)
+
+type apiKeyDBMock struct {
+	createAPIKey func(key *apikey.Key) error
+	getAPIKey    func(ID string) (*apikey.Key, error)
+	getAPIKeys   func() ([]*apikey.Key, error)
+	rotateAPIKey func(ID, oldHash, newHash string) error
+	deleteAPIKey func(ID string) error
+}
+
+func (am *apiKeyDBMock) CreateAPIKey(ctx context.Context, key *apikey.Key) error {
+	if am.createAPIKey != nil {
+		return am.createAPIKey(key)
+	}
+	panic("Not implemented")
+}
+
+func (am *apiKeyDBMock) GetAPIKey(ctx context.Context, ID string) (*apikey.Key, error) {
+	if am.getAPIKey != nil {
+		return am.getAPIKey(ID)
+	}
+	panic("Not implemented")
+}
+
+func (am *apiKeyDBMock) GetAPIKeys(ctx context.Context) ([]*apikey.Key, error) {
+	if am.getAPIKeys != nil {
+		return am.getAPIKeys()
+	}
+	panic("Not implemented")
+}
+
+func (am *apiKeyDBMock) RotateAPIKey(ctx context.Context, ID, oldHash, newHash string) error {
+	if am.rotateAPIKey != nil {
+		return am.rotateAPIKey(ID, oldHash, newHash)
+	}
+	panic("Not implemented")
+}
+
+func (am *apiKeyDBMock) DeleteAPIKey(ctx context.Context, ID string) error {
+	if am.deleteAPIKey != nil {
+		return am.deleteAPIKey(ID)
+	}
+	panic("Not implemented")
+}
+
+func TestService_CreateAPIKey(t *testing.T) {
+	now := time.Date(2020, 7, 1, 10, 0, 0, 0, time.UTC)
+	tomorrow, yesterday := now.Add(24*time.Hour), now.Add(-24*time.Hour)
+	tests := []struct {
+		name        string
+		keyDB       apiKeyDBMock
+		key         apikey.Key
+		expectedKey *apikey.Key
+		expectedErr error
+	}{
+		{
+			name: "successful create",
+			keyDB: apiKeyDBMock{
+				createAPIKey: func(key *apikey.Key) error {
+					if len(key.Hash) == 0 || key.Hash != apikey.Hash(key.Secret) {
+						return errors.NewDBErr("unexpected hash")
+					}
+					return nil
+				},
+			},
+			key: apikey.Key{Name: "ci", Role: identity.Editor, Scopes: []identity.Permission{identity.CreateRecipe},
+				ExpiresAt: &tomorrow},
+			expectedKey: &apikey.Key{ID: "01EC9V3P6Y8B8XWJ2Q3KZ4M5N6", Name: "ci", Role: identity.Editor,
+				Scopes: []identity.Permission{identity.CreateRecipe}, CreatedBy: "admin", CreatedAt: now, ExpiresAt: &tomorrow},
+		},
+		{
+			name: "successful create - default role",
+			keyDB: apiKeyDBMock{
+				createAPIKey: func(key *apikey.Key) error {
+					return nil
+				},
+			},
+			key: apikey.Key{Name: "ci"},
+			expectedKey: &apikey.Key{ID: "01EC9V3P6Y8B8XWJ2Q3KZ4M5N6", Name: "ci", Role: identity.DefaultRole,
+				CreatedBy: "admin", CreatedAt: now},
+		},
+		{
+			name: "error - invalid input",
+			key:  apikey.Key{Role: "root", ExpiresAt: &yesterday},
+			expectedErr: errors.NewInputError("Invalid input parameters", map[string]string{errors.Name: errors.Empty,
+				errors.Role: errors.Invalid, errors.ExpiresAt: errors.OutOfRange}),
+		},
+		{
+			name: "error - scope not granted by the role",
+			key:  apikey.Key{Name: "ci", Role: identity.Editor, Scopes: []identity.Permission{identity.ManageAPIKeys}},
+			expectedErr: errors.NewInputError("Invalid input parameters",
+				map[string]string{errors.Scopes: errors.Invalid}),
+		},
+		{
+			name: "error - DB",
+			keyDB: apiKeyDBMock{
+				createAPIKey: func(key *apikey.Key) error {
+					return errors.NewDBErr("DB issue")
+				},
+			},
+			key:         apikey.Key{Name: "ci"},
+			expectedErr: errors.NewDBErr("DB issue"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := NewAPIKey(&test.keyDB)
+			srv.newID = func() (string, error) { return "01EC9V3P6Y8B8XWJ2Q3KZ4M5N6", nil }
+			srv.now = func() time.Time { return now }
+			key := test.key
+			err := srv.Create(context.Background(), &key, admin)
+			if err != nil && (test.expectedErr == nil || err.Error() != test.expectedErr.Error()) {
+				t.Errorf("expected: '%v' instead got: '%s'", test.expectedErr, err)
+			}
+			if err == nil && test.expectedErr != nil {
+				t.Errorf("expected: '%s' instead got nil", test.expectedErr)
+			}
+			if test.expectedKey == nil {
+				return
+			}
+			if !strings.HasPrefix(key.Secret, key.ID+".") {
+				t.Errorf("unexpected secret '%s'", key.Secret)
+			}
+			key.Secret, key.Hash = "", ""
+			if !reflect.DeepEqual(&key, test.expectedKey) {
+				t.Errorf("expected: '%v' instead got: '%v'", test.expectedKey, &key)
+			}
+		})
+	}
+}
+
+func TestService_RotateAPIKey(t *testing.T) {
+	stored := &apikey.Key{ID: "01EC9V3P6Y8B8XWJ2Q3KZ4M5N6", Name: "ci", Role: identity.Editor, Hash: "hash"}
+	tests := []struct {
+		name        string
+		ID          string
+		keyDB       apiKeyDBMock
+		expectedErr error
+	}{
+		{
+			name: "successful rotate",
+			ID:   stored.ID,
+			keyDB: apiKeyDBMock{
+				getAPIKey: func(ID string) (*apikey.Key, error) {
+					key := *stored
+					return &key, nil
+				},
+				rotateAPIKey: func(ID, oldHash, newHash string) error {
+					if oldHash != stored.Hash || newHash == stored.Hash {
+						return errors.NewDBErr("hash not rotated")
+					}
+					return nil
+				},
+			},
+		},
+		{
+			name: "error - key does not exist",
+			ID:   stored.ID,
+			keyDB: apiKeyDBMock{
+				getAPIKey: func(ID string) (*apikey.Key, error) {
+					return nil, errors.NewExistErr(false)
+				},
+			},
+			expectedErr: errors.NewExistErr(false),
+		},
+		{
+			name: "error - key deleted in between",
+			ID:   stored.ID,
+			keyDB: apiKeyDBMock{
+				getAPIKey: func(ID string) (*apikey.Key, error) {
+					key := *stored
+					return &key, nil
+				},
+				rotateAPIKey: func(ID, oldHash, newHash string) error {
+					return errors.NewExistErr(false)
+				},
+			},
+			expectedErr: errors.NewExistErr(false),
+		},
+		{
+			name: "error - key rotated in between",
+			ID:   stored.ID,
+			keyDB: apiKeyDBMock{
+				getAPIKey: func(ID string) (*apikey.Key, error) {
+					key := *stored
+					return &key, nil
+				},
+				rotateAPIKey: func(ID, oldHash, newHash string) error {
+					return errors.NewPreconditionErr()
+				},
+			},
+			expectedErr: errors.NewPreconditionErr(),
+		},
+		{
+			name:        "error - invalid ID",
+			ID:          "01EC9V3P-6Y8B",
+			expectedErr: errors.NewInputError("Invalid ID format", nil),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, err := NewAPIKey(&test.keyDB).Rotate(context.Background(), test.ID)
+			if err != nil && (test.expectedErr == nil || err.Error() != test.expectedErr.Error()) {
+				t.Errorf("expected: '%v' instead got: '%s'", test.expectedErr, err)
+			}
+			if err == nil && test.expectedErr != nil {
+				t.Errorf("expected: '%s' instead got nil", test.expectedErr)
+			}
+			if err == nil && (key.Name != stored.Name || !key.Matches(key.Secret) || key.Hash == stored.Hash) {
+				t.Errorf("unexpected rotated key: '%v'", key)
+			}
+		})
+	}
+}
+
+func TestService_RevokeAPIKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		ID          string
+		keyDB       apiKeyDBMock
+		expectedErr error
+	}{
+		{
+			name: "successful revoke",
+			ID:   "01EC9V3P6Y8B8XWJ2Q3KZ4M5N6",
+			keyDB: apiKeyDBMock{
+				deleteAPIKey: func(ID string) error {
+					return nil
+				},
+			},
+		},
+		{
+			name: "error - key does not exist",
+			ID:   "01EC9V3P6Y8B8XWJ2Q3KZ4M5N6",
+			keyDB: apiKeyDBMock{
+				deleteAPIKey: func(ID string) error {
+					return errors.NewExistErr(false)
+				},
+			},
+			expectedErr: errors.NewExistErr(false),
+		},
+		{
+			name:        "error - invalid ID",
+			ID:          "01EC9V3P-6Y8B",
+			expectedErr: errors.NewInputError("Invalid ID format", nil),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := NewAPIKey(&test.keyDB).Revoke(context.Background(), test.ID)
+			if err != nil && (test.expectedErr == nil || err.Error() != test.expectedErr.Error()) {
+				t.Errorf("expected: '%v' instead got: '%s'", test.expectedErr, err)
+			}
+			if err == nil && test.expectedErr != nil {
+				t.Errorf("expected: '%s' instead got nil", test.expectedErr)
+			}
+		})
+	}
+}
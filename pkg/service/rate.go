@@ -1,13 +1,24 @@
 package service
 
 import (
+	"context"
+	"time"
+
 	"github.com/rnov/Go-REST/pkg/db"
 	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/id"
+	"github.com/rnov/Go-REST/pkg/identity"
 	r "github.com/rnov/Go-REST/pkg/rate"
+	"github.com/rnov/Go-REST/pkg/tracing"
 )
 
+// Rater - rates business logic, every method works on behalf of the request of ctx.
 type Rater interface {
-	Rate(ID string, rate *r.Rate) error
+	// Rate - rates the recipe on behalf of the user, its previous rate of the recipe is replaced.
+	Rate(ctx context.Context, ID string, rate *r.Rate, user *identity.Principal) error
+	GetRates(ctx context.Context, ID string) (*r.Summary, error)
+	// DeleteRate - retracts the rate of the recipe given by the user.
+	DeleteRate(ctx context.Context, ID string, user *identity.Principal) error
 }
 
 type Rate struct {
@@ -21,21 +32,56 @@ func NewRate(rateDB db.Rate) *Rate {
 	return rateSrv
 }
 
-func (r *Rate) Rate(ID string, rate *r.Rate) error {
+func (r *Rate) Rate(ctx context.Context, ID string, rate *r.Rate, user *identity.Principal) (err error) {
+	ctx, span := tracing.Start(ctx, "service.Rate.Rate")
+	defer func() { tracing.End(span, err) }()
 	if v := validateRateDataRange(ID, rate); len(v) > 0 {
 		return errors.NewInputError("Invalid input parameters", v)
 	}
-	if err := r.rateDB.RateRecipe(ID, rate); err != nil {
+	rate.Rater = user.Username
+	rate.CreatedAt = time.Now().UTC()
+	if err := r.rateDB.RateRecipe(ctx, ID, rate); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// GetRates - returns the aggregated score of a recipe along with all its rates.
+func (r *Rate) GetRates(ctx context.Context, ID string) (_ *r.Summary, err error) {
+	ctx, span := tracing.Start(ctx, "service.Rate.GetRates")
+	defer func() { tracing.End(span, err) }()
+	if !validateRcpID(ID) {
+		return nil, errors.NewInputError("Invalid ID format", nil)
+	}
+	summary, err := r.rateDB.GetRateSummary(ctx, ID)
+	if err != nil {
+		return nil, err
+	}
+	rates, err := r.rateDB.GetRates(ctx, ID)
+	if err != nil {
+		return nil, err
+	}
+	summary.Rates = rates
+
+	return summary, nil
+}
+
+// DeleteRate - retracts the rate of the user, *errors.ExistErr when the user has not rated the recipe.
+func (r *Rate) DeleteRate(ctx context.Context, ID string, user *identity.Principal) (err error) {
+	ctx, span := tracing.Start(ctx, "service.Rate.DeleteRate")
+	defer func() { tracing.End(span, err) }()
+	if !validateRcpID(ID) {
+		return errors.NewInputError("Invalid ID format", nil)
+	}
+
+	return r.rateDB.DeleteRate(ctx, ID, user.Username)
+}
+
 func validateRateDataRange(ID string, rate *r.Rate) map[string]string {
 	valid := make(map[string]string)
 
-	if len(ID) > 12 {
+	if len(ID) > id.Len {
 		valid[errors.RateID] = errors.TooLong
 	}
 	if rate.Note < 1 || rate.Note > 5 {
@@ -1,24 +1,51 @@
 package service
 
 import (
+	"context"
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
 	"github.com/rnov/Go-REST/pkg/rate"
 )
 
 type rateDBMock struct {
-	rateRecipe func(recipeId string, rate *rate.Rate) error
+	rateRecipe     func(recipeId string, rate *rate.Rate) error
+	deleteRate     func(recipeId, rater string) error
+	getRates       func(recipeId string) ([]*rate.Rate, error)
+	getRateSummary func(recipeId string) (*rate.Summary, error)
 }
 
-func (rm *rateDBMock) RateRecipe(recipeID string, rate *rate.Rate) error {
+func (rm *rateDBMock) RateRecipe(ctx context.Context, recipeID string, rate *rate.Rate) error {
 	if rm.rateRecipe != nil {
 		return rm.rateRecipe(recipeID, rate)
 	}
 	panic("Not implemented")
 }
 
+func (rm *rateDBMock) DeleteRate(ctx context.Context, recipeID, rater string) error {
+	if rm.deleteRate != nil {
+		return rm.deleteRate(recipeID, rater)
+	}
+	panic("Not implemented")
+}
+
+func (rm *rateDBMock) GetRates(ctx context.Context, recipeID string) ([]*rate.Rate, error) {
+	if rm.getRates != nil {
+		return rm.getRates(recipeID)
+	}
+	panic("Not implemented")
+}
+
+func (rm *rateDBMock) GetRateSummary(ctx context.Context, recipeID string) (*rate.Summary, error) {
+	if rm.getRateSummary != nil {
+		return rm.getRateSummary(recipeID)
+	}
+	panic("Not implemented")
+}
+
 func TestService_Rate(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -31,6 +58,9 @@ func TestService_Rate(t *testing.T) {
 			name: "successful rate",
 			rateDB: rateDBMock{
 				rateRecipe: func(recipeId string, rate *rate.Rate) error {
+					if rate.Rater != "chef" {
+						return errors.NewDBErr("unexpected rater " + rate.Rater)
+					}
 					return nil
 				},
 			},
@@ -44,7 +74,7 @@ func TestService_Rate(t *testing.T) {
 			inputRate: rate.Rate{
 				Note: 5,
 			},
-			inputID:     "12sw2329cwme9",
+			inputID:     "12sw2329cwme912sw2329cwme91",
 			expectedErr: errors.NewInputError("Invalid input parameters", nil),
 		},
 		{
@@ -71,9 +101,116 @@ func TestService_Rate(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			rateSvr := NewRate(&test.rateDB)
-			if err := rateSvr.Rate(test.inputID, &test.inputRate); err != nil && !strings.Contains(err.Error(), test.expectedErr.Error()) {
+			user := &identity.Principal{Username: "chef", Role: identity.Reader}
+			err := rateSvr.Rate(context.Background(), test.inputID, &test.inputRate, user)
+			if err != nil && (test.expectedErr == nil || !strings.Contains(err.Error(), test.expectedErr.Error())) {
 				t.Errorf("expected: '%s' instead got: '%s'", test.expectedErr, err)
 			}
 		})
 	}
 }
+
+func TestService_GetRates(t *testing.T) {
+	tests := []struct {
+		name            string
+		rateDB          rateDBMock
+		inputID         string
+		expectedSummary *rate.Summary
+		expectedErr     error
+	}{
+		{
+			name: "successful retrieval",
+			rateDB: rateDBMock{
+				getRateSummary: func(recipeId string) (*rate.Summary, error) {
+					return rate.NewSummary(9, 2), nil
+				},
+				getRates: func(recipeId string) ([]*rate.Rate, error) {
+					return []*rate.Rate{{Note: 5}, {Note: 4}}, nil
+				},
+			},
+			inputID: "654321",
+			expectedSummary: &rate.Summary{
+				Average: 4.5,
+				Count:   2,
+				Rates:   []*rate.Rate{{Note: 5}, {Note: 4}},
+			},
+		},
+		{
+			name:        "error recipe ID does not match regex",
+			inputID:     "0987654321-qwerty",
+			expectedErr: errors.NewInputError("Invalid ID format", nil),
+		},
+		{
+			name: "error recipe not found",
+			rateDB: rateDBMock{
+				getRateSummary: func(recipeId string) (*rate.Summary, error) {
+					return nil, errors.NewExistErr(false)
+				},
+			},
+			inputID:     "654321",
+			expectedErr: errors.NewExistErr(false),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rateSvr := NewRate(&test.rateDB)
+			summary, err := rateSvr.GetRates(context.Background(), test.inputID)
+			if err != nil && err.Error() != test.expectedErr.Error() {
+				t.Errorf("expected: '%s' instead got: '%s'", test.expectedErr, err)
+			}
+			if summary != nil {
+				if !reflect.DeepEqual(summary, test.expectedSummary) {
+					t.Errorf("expected: '%v' instead got: '%v'", test.expectedSummary, summary)
+				}
+			}
+		})
+	}
+}
+
+func TestService_DeleteRate(t *testing.T) {
+	tests := []struct {
+		name        string
+		rateDB      rateDBMock
+		inputID     string
+		expectedErr error
+	}{
+		{
+			name: "successful delete",
+			rateDB: rateDBMock{
+				deleteRate: func(recipeId, rater string) error {
+					if rater != "chef" {
+						return errors.NewDBErr("unexpected rater " + rater)
+					}
+					return nil
+				},
+			},
+			inputID: "654321",
+		},
+		{
+			name:        "error recipe ID does not match regex",
+			inputID:     "0987654321-qwerty",
+			expectedErr: errors.NewInputError("Invalid ID format", nil),
+		},
+		{
+			name: "error rate not found",
+			rateDB: rateDBMock{
+				deleteRate: func(recipeId, rater string) error {
+					return errors.NewExistErr(false)
+				},
+			},
+			inputID:     "654321",
+			expectedErr: errors.NewExistErr(false),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rateSvr := NewRate(&test.rateDB)
+			err := rateSvr.DeleteRate(context.Background(), test.inputID, &identity.Principal{Username: "chef", Role: identity.Reader})
+			if (err == nil) != (test.expectedErr == nil) || (err != nil && err.Error() != test.expectedErr.Error()) {
+				t.Errorf("expected: '%v' instead got: '%v'", test.expectedErr, err)
+			}
+		})
+	}
+}
@@ -1,39 +1,74 @@
 package service
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
 	"regexp"
+	"strings"
+	"time"
 
 	"github.com/rnov/Go-REST/pkg/db"
 	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/id"
+	"github.com/rnov/Go-REST/pkg/identity"
+	"github.com/rnov/Go-REST/pkg/patch"
 	r "github.com/rnov/Go-REST/pkg/recipe"
+	"github.com/rnov/Go-REST/pkg/search"
+	"github.com/rnov/Go-REST/pkg/tracing"
 )
 
+// RecipeMng - recipes business logic, every method works on behalf of the request of ctx.
 type RecipeMng interface {
-	GetByID(recipeID string) (*r.Recipe, error)
-	ListAll() ([]*r.Recipe, error)
-	Create(recipe *r.Recipe) error
-	Update(ID string, recipe *r.Recipe) error
-	Delete(recipeID string) error
+	GetByID(ctx context.Context, recipeID string) (*r.Recipe, error)
+	List(ctx context.Context, query *r.Query) (*r.Page, error)
+	Search(ctx context.Context, text string, limit int) ([]*r.Recipe, error)
+	// Create - stores a new recipe owned by the user.
+	Create(ctx context.Context, recipe *r.Recipe, user *identity.Principal) error
+	// CreateBatch - creates each recipe as Create does, the outcome of each of them is returned in the same order.
+	CreateBatch(ctx context.Context, recipes []*r.Recipe, user *identity.Principal) ([]error, error)
+	// Export - calls fn for each of the recipes matching the query, in its order, until fn returns an error.
+	Export(ctx context.Context, query *r.Query, fn func(recipe *r.Recipe) error) error
+	// Update - replaces the recipe, a version greater than 0 conditions the update to the recipe being stored at it. The
+	// user must be allowed to edit the stored recipe.
+	Update(ctx context.Context, ID string, recipe *r.Recipe, version int64, user *identity.Principal) error
+	// Patch - applies the patch to the stored recipe and returns the outcome, version and user are checked as in Update.
+	Patch(ctx context.Context, ID string, p patch.Patch, version int64, user *identity.Principal) (*r.Recipe, error)
+	// Delete - deletes the recipe, version and user are checked as in Update.
+	Delete(ctx context.Context, recipeID string, version int64, user *identity.Principal) error
 }
 
 type Recipe struct {
 	rcpDB db.Recipe
+	index search.Index
+	newID func() (string, error)
 	//logger log.Loggers
 	// add more func fields
 }
 
-func NewRecipe(rcpDB db.Recipe) *Recipe {
+func NewRecipe(rcpDB db.Recipe, index search.Index) *Recipe {
 	recipeSrv := &Recipe{
 		rcpDB: rcpDB,
+		index: index,
+		newID: id.New,
 	}
 	return recipeSrv
 }
 
-func (r *Recipe) GetByID(ID string) (*r.Recipe, error) {
+// BuildIndex - indexes all the stored recipes, meant to be run on startup before serving any request.
+func (r *Recipe) BuildIndex() error {
+	return buildIndex(context.Background(), r.rcpDB, r.index)
+}
+
+func (r *Recipe) GetByID(ctx context.Context, ID string) (_ *r.Recipe, err error) {
+	ctx, span := tracing.Start(ctx, "service.Recipe.GetByID")
+	defer func() { tracing.End(span, err) }()
 	if !validateRcpID(ID) {
 		return nil, errors.NewInputError("Invalid ID format", nil)
 	}
-	rcp, err := r.rcpDB.GetRecipeByID(ID)
+	rcp, err := r.rcpDB.GetRecipeByID(ctx, ID)
 	if err != nil {
 		return nil, err
 	}
@@ -41,27 +76,102 @@ func (r *Recipe) GetByID(ID string) (*r.Recipe, error) {
 	return rcp, nil
 }
 
-func (r *Recipe) ListAll() ([]*r.Recipe, error) {
-	recipes, err := r.rcpDB.GetAllRecipes()
+// List - lists a page of recipes, filtering, sorting and pagination are delegated to the DB.
+func (r *Recipe) List(ctx context.Context, query *r.Query) (_ *r.Page, err error) {
+	ctx, span := tracing.Start(ctx, "service.Recipe.List")
+	defer func() { tracing.End(span, err) }()
+	if v := validateQuery(query); len(v) > 0 {
+		return nil, errors.NewInputError("Invalid query parameters", v)
+	}
+	setQueryDefaults(query)
+	page, err := r.rcpDB.GetRecipes(ctx, query)
 	if err != nil {
 		return nil, err
 	}
 
-	return recipes, nil
+	return page, nil
+}
+
+// Search - full-text search of recipes, recipes are returned from the most to the least relevant.
+func (r *Recipe) Search(ctx context.Context, text string, limit int) (_ []*r.Recipe, err error) {
+	ctx, span := tracing.Start(ctx, "service.Recipe.Search")
+	defer func() { tracing.End(span, err) }()
+	if v := validateSearch(text, limit); len(v) > 0 {
+		return nil, errors.NewInputError("Invalid query parameters", v)
+	}
+	return searchRecipes(ctx, r.rcpDB, r.index, text, limit)
+}
+
+// Create - stores a new recipe, an ID is generated unless one is provided (e.g. when importing recipes).
+func (r *Recipe) Create(ctx context.Context, recipe *r.Recipe, user *identity.Principal) (err error) {
+	ctx, span := tracing.Start(ctx, "service.Recipe.Create")
+	defer func() { tracing.End(span, err) }()
+	if err := r.prepare(recipe, user); err != nil {
+		return err
+	}
+	if err := r.rcpDB.CreateRecipe(ctx, recipe); err != nil {
+		return err
+	}
+	r.index.Index(recipe)
+
+	return nil
 }
 
-func (r *Recipe) Create(recipe *r.Recipe) error {
+// maxBatchSize - recipes that can be created by a single batch.
+const maxBatchSize = 1000
+
+// CreateBatch - recipes are validated one by one, the valid ones are created at once. A failing recipe does not prevent
+// the rest from being created, its error is returned at its position instead.
+func (r *Recipe) CreateBatch(ctx context.Context, recipes []*r.Recipe,
+	user *identity.Principal) (_ []error, err error) {
+	ctx, span := tracing.Start(ctx, "service.Recipe.CreateBatch")
+	defer func() { tracing.End(span, err) }()
+	if len(recipes) == 0 || len(recipes) > maxBatchSize {
+		return nil, errors.NewInputError("Invalid batch", map[string]string{errors.Batch: errors.OutOfRange})
+	}
+	return createBatch(ctx, r.rcpDB, r.index, r.prepare, recipes, user), nil
+}
+
+// Export - the query is validated as in List, its limit is ignored since all the matching recipes are walked.
+func (r *Recipe) Export(ctx context.Context, query *r.Query, fn func(recipe *r.Recipe) error) (err error) {
+	ctx, span := tracing.Start(ctx, "service.Recipe.Export")
+	defer func() { tracing.End(span, err) }()
+	if v := validateQuery(query); len(v) > 0 {
+		return errors.NewInputError("Invalid query parameters", v)
+	}
+	return walkRecipes(ctx, r.rcpDB, query, fn)
+}
+
+// prepare - validates a new recipe and fills the fields set on creation, the ID among them unless one is provided. The
+// recipe is owned by the user creating it regardless of the owner sent by the client.
+func (r *Recipe) prepare(recipe *r.Recipe, user *identity.Principal) error {
+	if len(recipe.ID) > 0 && !validateRcpID(recipe.ID) {
+		return errors.NewInputError("Invalid ID format", nil)
+	}
 	if v := validateRecipe(recipe); len(v) > 0 {
 		return errors.NewInputError("Invalid input parameters", v)
 	}
-	if err := r.rcpDB.CreateRecipe(recipe); err != nil {
-		return err
+	if len(recipe.ID) == 0 {
+		ID, err := r.newID()
+		if err != nil {
+			return errors.NewDBErr(fmt.Sprintf("error generating recipe ID: %s", err.Error()))
+		}
+		recipe.ID = ID
+	}
+	recipe.CreatedAt = time.Now().UTC()
+	recipe.UpdatedAt = recipe.CreatedAt
+	recipe.Owner = ""
+	if user != nil {
+		recipe.Owner = user.Username
 	}
 
 	return nil
 }
 
-func (r *Recipe) Update(ID string, recipe *r.Recipe) error {
+func (r *Recipe) Update(ctx context.Context, ID string, recipe *r.Recipe, version int64,
+	user *identity.Principal) (err error) {
+	ctx, span := tracing.Start(ctx, "service.Recipe.Update")
+	defer func() { tracing.End(span, err) }()
 	if !validateRcpID(ID) {
 		return errors.NewInputError("Invalid ID format", nil)
 	}
@@ -72,24 +182,140 @@ func (r *Recipe) Update(ID string, recipe *r.Recipe) error {
 	if v := validateRecipe(recipe); len(v) > 0 {
 		return errors.NewInputError("Invalid input parameters", v)
 	}
-	err := r.rcpDB.UpdateRecipe(recipe)
+	if err := r.authorize(ctx, ID, user); err != nil {
+		return err
+	}
+	// the creation timestamp, the owner and the version are kept by the DB
+	recipe.UpdatedAt = time.Now().UTC()
+	err = r.rcpDB.UpdateRecipe(ctx, recipe, version)
 	if err != nil {
 		return err
 	}
+	r.index.Index(recipe)
 
 	return nil
 }
 
-func (r *Recipe) Delete(recipeID string) error {
+// maxPatchAttempts - times a patch is applied while the recipe keeps being modified in between it is read and written.
+const maxPatchAttempts = 3
+
+// Patch - the patch is applied against the stored recipe, the outcome is validated as any other recipe and only the
+// changed fields are written. The write is conditioned on the version that has been read, unless the client conditioned
+// the patch to a version it is retried whenever the recipe is modified in between.
+func (r *Recipe) Patch(ctx context.Context, ID string, p patch.Patch, version int64,
+	user *identity.Principal) (_ *r.Recipe, err error) {
+	ctx, span := tracing.Start(ctx, "service.Recipe.Patch")
+	defer func() { tracing.End(span, err) }()
+	if !validateRcpID(ID) {
+		return nil, errors.NewInputError("Invalid ID format", nil)
+	}
+	for attempt := 1; ; attempt++ {
+		stored, err := r.rcpDB.GetRecipeByID(ctx, ID)
+		if err != nil {
+			return nil, err
+		}
+		if !user.CanEdit(stored.Owner) {
+			return nil, errors.NewForbiddenErr()
+		}
+		if version > 0 && stored.Version != version {
+			return nil, errors.NewPreconditionErr()
+		}
+		patched, fields, err := applyPatch(stored, p)
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) == 0 {
+			return stored, nil
+		}
+		patched.UpdatedAt = time.Now().UTC()
+		err = r.rcpDB.PatchRecipe(ctx, patched, fields, stored.Version)
+		if _, ok := err.(*errors.PreconditionErr); ok && version == 0 && attempt < maxPatchAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		r.index.Index(patched)
+
+		return patched, nil
+	}
+}
+
+func (r *Recipe) Delete(ctx context.Context, recipeID string, version int64, user *identity.Principal) (err error) {
+	ctx, span := tracing.Start(ctx, "service.Recipe.Delete")
+	defer func() { tracing.End(span, err) }()
 	if !validateRcpID(recipeID) {
 		return errors.NewInputError("Invalid ID format", nil)
 	}
-	if err := r.rcpDB.DeleteRecipe(recipeID); err != nil {
+	if err := r.authorize(ctx, recipeID, user); err != nil {
+		return err
+	}
+	if err := r.rcpDB.DeleteRecipe(ctx, recipeID, version); err != nil {
 		return err
 	}
+	r.index.Remove(recipeID)
 	return nil
 }
 
+// authorize - checks that the user can edit the stored recipe, those allowed to edit any recipe are not checked against
+// its owner. Owners are never modified so the check holds until the recipe is written.
+func (r *Recipe) authorize(ctx context.Context, ID string, user *identity.Principal) error {
+	if user.Can(identity.EditAnyRecipe) {
+		return nil
+	}
+	stored, err := r.rcpDB.GetRecipeByID(ctx, ID)
+	if err != nil {
+		return err
+	}
+	if !user.CanEdit(stored.Owner) {
+		return errors.NewForbiddenErr()
+	}
+	return nil
+}
+
+// applyPatch - applies the patch to the JSON representation of the recipe, read only fields are kept whereas the ID can
+// not be patched. Returns the validated outcome along with the fields that have changed.
+func applyPatch(stored *r.Recipe, p patch.Patch) (*r.Recipe, []string, error) {
+	doc, err := json.Marshal(stored)
+	if err != nil {
+		return nil, nil, errors.NewDBErr(fmt.Sprintf("error marshalling recipe: %s", err.Error()))
+	}
+	doc, err = p.Apply(doc)
+	if err != nil {
+		return nil, nil, errors.NewInputError("Invalid patch", map[string]string{errors.Patch: err.Error()})
+	}
+	patched := &r.Recipe{}
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(patched); err != nil {
+		return nil, nil, errors.NewInputError("Invalid patch", map[string]string{errors.Patch: err.Error()})
+	}
+	if patched.ID != stored.ID {
+		return nil, nil, errors.NewInputError("ID can not be patched", nil)
+	}
+	patched.AverageRating, patched.RatingCount = stored.AverageRating, stored.RatingCount
+	patched.CreatedAt, patched.UpdatedAt, patched.Version = stored.CreatedAt, stored.UpdatedAt, stored.Version
+	patched.Owner = stored.Owner
+	if v := validateRecipe(patched); len(v) > 0 {
+		return nil, nil, errors.NewInputError("Invalid input parameters", v)
+	}
+
+	return patched, r.ChangedFields(stored, patched), nil
+}
+
+// recipe fields limits.
+const (
+	maxServings      = 100
+	maxCuisineLen    = 50
+	maxTags          = 20
+	maxTagLen        = 30
+	maxIngredients   = 100
+	maxIngredientLen = 100
+	maxUnitLen       = 20
+	maxSteps         = 100
+	maxStepLen       = 1000
+)
+
 // validateRecipe validates that all the recipe's fields values are within their defined range.
 func validateRecipe(recipe *r.Recipe) map[string]string {
 	valid := make(map[string]string)
@@ -106,11 +332,190 @@ func validateRecipe(recipe *r.Recipe) map[string]string {
 	if recipe.PrepTime <= 1 || recipe.PrepTime > 1000 {
 		valid[errors.Preptime] = errors.OutOfRange
 	}
+	if recipe.Servings < 0 || recipe.Servings > maxServings {
+		valid[errors.Servings] = errors.OutOfRange
+	}
+	if len(recipe.Cuisine) > maxCuisineLen {
+		valid[errors.Cuisine] = errors.TooLong
+	}
+	if len(recipe.Tags) > maxTags {
+		valid[errors.Tags] = errors.TooMany
+	}
+	for i, tag := range recipe.Tags {
+		if v := validateText(tag, maxTagLen); len(v) > 0 {
+			valid[fmt.Sprintf("%s[%d]", errors.Tags, i)] = v
+		}
+	}
+	if len(recipe.Ingredients) > maxIngredients {
+		valid[errors.Ingredients] = errors.TooMany
+	}
+	for i, ingredient := range recipe.Ingredients {
+		param := fmt.Sprintf("%s[%d]", errors.Ingredients, i)
+		if v := validateText(ingredient.Name, maxIngredientLen); len(v) > 0 {
+			valid[param+"."+errors.Name] = v
+		}
+		if ingredient.Quantity < 0 || math.IsInf(ingredient.Quantity, 0) || math.IsNaN(ingredient.Quantity) {
+			valid[param+".quantity"] = errors.OutOfRange
+		}
+		if len(ingredient.Unit) > maxUnitLen {
+			valid[param+".unit"] = errors.TooLong
+		}
+	}
+	if len(recipe.Steps) > maxSteps {
+		valid[errors.Steps] = errors.TooMany
+	}
+	for i, step := range recipe.Steps {
+		if v := validateText(step, maxStepLen); len(v) > 0 {
+			valid[fmt.Sprintf("%s[%d]", errors.Steps, i)] = v
+		}
+	}
 	return valid
 }
 
-// validateRcpID - validates that a incoming recipe ID has the proper format, alphanumeric up to 12 digits.
+// validateText validates that a text is neither blank nor longer than max, returns the reason when it is not valid.
+func validateText(text string, max int) string {
+	if len(strings.TrimSpace(text)) == 0 {
+		return errors.Empty
+	}
+	if len(text) > max {
+		return errors.TooLong
+	}
+	return ""
+}
+
+// validateQuery validates that the listing parameters are within their defined range.
+func validateQuery(query *r.Query) map[string]string {
+	valid := make(map[string]string)
+
+	if query.Limit < 0 || query.Limit > r.MaxLimit {
+		valid[errors.Limit] = errors.OutOfRange
+	}
+	if len(query.Sort) > 0 && !r.ValidSort(query.Sort) {
+		valid[errors.Sort] = errors.Invalid
+	}
+	if !query.ValidCursor() {
+		valid[errors.Cursor] = errors.Invalid
+	}
+	if query.Filter.Difficulty < 0 || query.Filter.Difficulty > 3 {
+		valid[errors.Difficulty] = errors.OutOfRange
+	}
+	if query.Filter.MaxPrepTime < 0 {
+		valid[errors.MaxPrepTime] = errors.OutOfRange
+	}
+	return valid
+}
+
+// validateSearch validates the full-text search parameters.
+func validateSearch(text string, limit int) map[string]string {
+	valid := make(map[string]string)
+
+	if len(search.Tokenize(text)) == 0 {
+		valid[errors.SearchText] = errors.MissingText
+	}
+	if len(text) > 100 {
+		valid[errors.SearchText] = errors.TooLong
+	}
+	if limit < 0 || limit > r.MaxLimit {
+		valid[errors.Limit] = errors.OutOfRange
+	}
+	return valid
+}
+
+// buildIndex - walks all the recipes adding them to the index.
+func buildIndex(ctx context.Context, rcpDB db.Recipe, index search.Index) error {
+	return walkRecipes(ctx, rcpDB, &r.Query{}, func(rcp *r.Recipe) error {
+		index.Index(rcp)
+		return nil
+	})
+}
+
+// walkRecipes - walks all the pages of recipes matching the query, starting after its cursor if any, calling fn for
+// each recipe until it returns an error.
+func walkRecipes(ctx context.Context, rcpDB db.Recipe, query *r.Query, fn func(rcp *r.Recipe) error) error {
+	query.Limit = r.MaxLimit
+	for {
+		page, err := rcpDB.GetRecipes(ctx, query)
+		if err != nil {
+			return err
+		}
+		for _, rcp := range page.Recipes {
+			if err := fn(rcp); err != nil {
+				return err
+			}
+		}
+		if len(page.NextCursor) == 0 {
+			return nil
+		}
+		cursor, err := r.DecodeCursor(page.NextCursor)
+		if err != nil {
+			return err
+		}
+		query.Cursor = cursor
+	}
+}
+
+// createBatch - prepares each recipe, those prepared successfully are created at once and indexed. Errors are returned at
+// the position of the failing recipes.
+func createBatch(ctx context.Context, rcpDB db.Recipe, index search.Index,
+	prepare func(rcp *r.Recipe, user *identity.Principal) error, rcps []*r.Recipe,
+	user *identity.Principal) []error {
+	errs := make([]error, len(rcps))
+	valid := make([]*r.Recipe, 0, len(rcps))
+	positions := make([]int, 0, len(rcps))
+	for i, rcp := range rcps {
+		if err := prepare(rcp, user); err != nil {
+			errs[i] = err
+			continue
+		}
+		valid = append(valid, rcp)
+		positions = append(positions, i)
+	}
+	if len(valid) == 0 {
+		return errs
+	}
+	for i, err := range rcpDB.CreateRecipes(ctx, valid) {
+		errs[positions[i]] = err
+		if err == nil {
+			index.Index(valid[i])
+		}
+	}
+
+	return errs
+}
+
+// searchRecipes - retrieves the recipes matched by the index keeping their rank, recipes that are still indexed but no
+// longer stored are skipped.
+func searchRecipes(ctx context.Context, rcpDB db.Recipe, index search.Index, text string,
+	limit int) ([]*r.Recipe, error) {
+	if limit == 0 {
+		limit = r.DefaultLimit
+	}
+	IDs := index.Search(text, limit)
+	rcps := make([]*r.Recipe, 0, len(IDs))
+	for _, ID := range IDs {
+		rcp, err := rcpDB.GetRecipeByID(ctx, ID)
+		if err != nil {
+			if _, ok := err.(*errors.ExistErr); ok {
+				continue
+			}
+			return nil, err
+		}
+		rcps = append(rcps, rcp)
+	}
+
+	return rcps, nil
+}
+
+// setQueryDefaults sets the default value of the listing parameters that have not been provided.
+func setQueryDefaults(query *r.Query) {
+	if query.Limit == 0 {
+		query.Limit = r.DefaultLimit
+	}
+}
+
+// validateRcpID - validates that a incoming recipe ID has the proper format, alphanumeric up to the length of the
+// generated IDs.
 func validateRcpID(ID string) bool {
-	regex, _ := regexp.Compile("^[a-zA-Z0-9]{1,12}$")
+	regex, _ := regexp.Compile(fmt.Sprintf("^[a-zA-Z0-9]{1,%d}$", id.Len))
 	return regex.MatchString(ID)
 }
@@ -1,52 +1,79 @@
 package service
 
 import (
+	"context"
+	e "errors"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/rnov/Go-REST/pkg/errors"
+	"github.com/rnov/Go-REST/pkg/identity"
+	"github.com/rnov/Go-REST/pkg/patch"
 	"github.com/rnov/Go-REST/pkg/recipe"
+	"github.com/rnov/Go-REST/pkg/search"
+)
+
+var (
+	admin  = &identity.Principal{Username: "admin", Role: identity.Admin}
+	editor = &identity.Principal{Username: "chef", Role: identity.Editor}
 )
 
 type recipeDBMock struct {
 	getRecipeByID func(recipeId string) (*recipe.Recipe, error)
-	getAllRecipes func() ([]*recipe.Recipe, error)
+	getRecipes    func(query *recipe.Query) (*recipe.Page, error)
 	createRecipe  func(recipe *recipe.Recipe) error
-	updateRecipe  func(recipe *recipe.Recipe) error
-	deleteRecipe  func(recipeId string) error
+	createRecipes func(recipes []*recipe.Recipe) []error
+	updateRecipe  func(recipe *recipe.Recipe, version int64) error
+	patchRecipe   func(recipe *recipe.Recipe, fields []string, version int64) error
+	deleteRecipe  func(recipeId string, version int64) error
 }
 
-func (rm *recipeDBMock) GetRecipeByID(recipeID string) (*recipe.Recipe, error) {
+func (rm *recipeDBMock) GetRecipeByID(ctx context.Context, recipeID string) (*recipe.Recipe, error) {
 	if rm.getRecipeByID != nil {
 		return rm.getRecipeByID(recipeID)
 	}
 	panic("Not implemented")
 }
 
-func (rm *recipeDBMock) GetAllRecipes() ([]*recipe.Recipe, error) {
-	if rm.getAllRecipes != nil {
-		return rm.getAllRecipes()
+func (rm *recipeDBMock) GetRecipes(ctx context.Context, query *recipe.Query) (*recipe.Page, error) {
+	if rm.getRecipes != nil {
+		return rm.getRecipes(query)
 	}
 	panic("Not implemented")
 }
 
-func (rm *recipeDBMock) CreateRecipe(recipe *recipe.Recipe) error {
+func (rm *recipeDBMock) CreateRecipe(ctx context.Context, recipe *recipe.Recipe) error {
 	if rm.createRecipe != nil {
 		return rm.createRecipe(recipe)
 	}
 	panic("Not implemented")
 }
 
-func (rm *recipeDBMock) UpdateRecipe(recipe *recipe.Recipe) error {
+func (rm *recipeDBMock) CreateRecipes(ctx context.Context, recipes []*recipe.Recipe) []error {
+	if rm.createRecipes != nil {
+		return rm.createRecipes(recipes)
+	}
+	panic("Not implemented")
+}
+
+func (rm *recipeDBMock) UpdateRecipe(ctx context.Context, recipe *recipe.Recipe, version int64) error {
 	if rm.updateRecipe != nil {
-		return rm.updateRecipe(recipe)
+		return rm.updateRecipe(recipe, version)
 	}
 	panic("Not implemented")
 }
 
-func (rm *recipeDBMock) DeleteRecipe(recipeID string) error {
+func (rm *recipeDBMock) PatchRecipe(ctx context.Context, recipe *recipe.Recipe, fields []string, version int64) error {
+	if rm.patchRecipe != nil {
+		return rm.patchRecipe(recipe, fields, version)
+	}
+	panic("Not implemented")
+}
+
+func (rm *recipeDBMock) DeleteRecipe(ctx context.Context, recipeID string, version int64) error {
 	if rm.deleteRecipe != nil {
-		return rm.deleteRecipe(recipeID)
+		return rm.deleteRecipe(recipeID, version)
 	}
 	panic("Not implemented")
 }
@@ -95,7 +122,7 @@ func TestRcp_GetByID(t *testing.T) {
 		},
 		{
 			name:        "error recipe ID does not match regex",
-			inputRcpID:  "0987654321qwerty",
+			inputRcpID:  "0987654321-qwerty",
 			expectedRcp: nil,
 			expectedErr: errors.NewInputError("Invalid ID format", nil),
 		},
@@ -114,8 +141,8 @@ func TestRcp_GetByID(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			rcpSvr := NewRecipe(&test.rcpDB)
-			rcp, err := rcpSvr.GetByID(test.inputRcpID)
+			rcpSvr := NewRecipe(&test.rcpDB, search.NewInvertedIndex())
+			rcp, err := rcpSvr.GetByID(context.Background(), test.inputRcpID)
 			if err != nil && err.Error() != test.expectedErr.Error() {
 				t.Errorf("expected: '%s' instead got: '%s'", test.expectedErr, err)
 			}
@@ -128,18 +155,20 @@ func TestRcp_GetByID(t *testing.T) {
 	}
 }
 
-func TestRcp_ListAll(t *testing.T) {
+func TestRcp_List(t *testing.T) {
 	tests := []struct {
-		name         string
-		rcpDB        recipeDBMock
-		expectedRcps []*recipe.Recipe
-		expectedErr  error
+		name          string
+		rcpDB         recipeDBMock
+		inputQuery    *recipe.Query
+		expectedLimit int
+		expectedRcps  []*recipe.Recipe
+		expectedErr   error
 	}{
 		{
 			name: "successful retrieval",
 			rcpDB: recipeDBMock{
-				getAllRecipes: func() ([]*recipe.Recipe, error) {
-					return []*recipe.Recipe{
+				getRecipes: func(query *recipe.Query) (*recipe.Page, error) {
+					return &recipe.Page{Recipes: []*recipe.Recipe{
 						{
 							ID:         "654321",
 							Name:       "qwerty",
@@ -153,9 +182,11 @@ func TestRcp_ListAll(t *testing.T) {
 							Difficulty: 3,
 							Vegetarian: false,
 						},
-					}, nil
+					}}, nil
 				},
 			},
+			inputQuery:    &recipe.Query{},
+			expectedLimit: recipe.DefaultLimit,
 			expectedRcps: []*recipe.Recipe{
 				{
 					ID:         "654321",
@@ -176,19 +207,32 @@ func TestRcp_ListAll(t *testing.T) {
 		{
 			name: "Empty result - no recipes in DB",
 			rcpDB: recipeDBMock{
-				getAllRecipes: func() ([]*recipe.Recipe, error) {
-					return nil, nil
+				getRecipes: func(query *recipe.Query) (*recipe.Page, error) {
+					return &recipe.Page{}, nil
 				},
 			},
-			expectedRcps: nil,
+			inputQuery:    &recipe.Query{Limit: 5, Sort: recipe.SortRating},
+			expectedLimit: 5,
+			expectedRcps:  nil,
+		},
+		{
+			name:        "error query validation - limit out of range",
+			inputQuery:  &recipe.Query{Limit: recipe.MaxLimit + 1},
+			expectedErr: errors.NewInputError("Invalid query parameters", nil),
+		},
+		{
+			name:        "error query validation - unsupported sort",
+			inputQuery:  &recipe.Query{Sort: "unsupported"},
+			expectedErr: errors.NewInputError("Invalid query parameters", nil),
 		},
 		{
 			name: "error DB issue",
 			rcpDB: recipeDBMock{
-				getAllRecipes: func() ([]*recipe.Recipe, error) {
+				getRecipes: func(query *recipe.Query) (*recipe.Page, error) {
 					return nil, errors.NewDBErr("error parsing recipe from DB")
 				},
 			},
+			inputQuery:   &recipe.Query{},
 			expectedRcps: nil,
 			expectedErr:  errors.NewDBErr("error parsing recipe from DB"),
 		},
@@ -196,14 +240,17 @@ func TestRcp_ListAll(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			rcpSvr := NewRecipe(&test.rcpDB)
-			rcps, err := rcpSvr.ListAll()
+			rcpSvr := NewRecipe(&test.rcpDB, search.NewInvertedIndex())
+			page, err := rcpSvr.List(context.Background(), test.inputQuery)
 			if err != nil && err.Error() != test.expectedErr.Error() {
 				t.Errorf("expected: '%s' instead got: '%s'", test.expectedErr, err)
 			}
-			if rcps != nil {
-				if !reflect.DeepEqual(rcps, test.expectedRcps) {
-					t.Errorf("expected: '%v' instead got: '%v'", test.expectedRcps, rcps)
+			if page != nil {
+				if !reflect.DeepEqual(page.Recipes, test.expectedRcps) {
+					t.Errorf("expected: '%v' instead got: '%v'", test.expectedRcps, page.Recipes)
+				}
+				if test.inputQuery.Limit != test.expectedLimit {
+					t.Errorf("expected limit: '%d' instead got: '%d'", test.expectedLimit, test.inputQuery.Limit)
 				}
 			}
 		})
@@ -232,6 +279,46 @@ func TestRcp_Create(t *testing.T) {
 				Vegetarian: false,
 			},
 		},
+		{
+			name: "successful create - details and timestamps",
+			rcpDB: recipeDBMock{
+				createRecipe: func(rcp *recipe.Recipe) error {
+					if rcp.CreatedAt.IsZero() || !rcp.CreatedAt.Equal(rcp.UpdatedAt) {
+						return errors.NewDBErr("unexpected timestamps")
+					}
+					return nil
+				},
+			},
+			inputRcp: &recipe.Recipe{
+				ID:          "654321",
+				Name:        "qwerty",
+				PrepTime:    20,
+				Difficulty:  3,
+				Servings:    4,
+				Cuisine:     "spanish",
+				Tags:        []string{"quick"},
+				Ingredients: []recipe.Ingredient{{Name: "rice", Quantity: 400, Unit: "g"}},
+				Steps:       []string{"boil the rice"},
+			},
+		},
+		{
+			name: "successful create - owned by the user",
+			rcpDB: recipeDBMock{
+				createRecipe: func(rcp *recipe.Recipe) error {
+					if rcp.Owner != "chef" {
+						return errors.NewDBErr("unexpected owner")
+					}
+					return nil
+				},
+			},
+			inputRcp: &recipe.Recipe{
+				ID:         "654321",
+				Name:       "qwerty",
+				PrepTime:   20,
+				Difficulty: 3,
+				Owner:      "admin",
+			},
+		},
 		{
 			name: "error input validation - Difficulty out of range",
 			inputRcp: &recipe.Recipe{
@@ -263,8 +350,8 @@ func TestRcp_Create(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			rcpSvr := NewRecipe(&test.rcpDB)
-			err := rcpSvr.Create(test.inputRcp)
+			rcpSvr := NewRecipe(&test.rcpDB, search.NewInvertedIndex())
+			err := rcpSvr.Create(context.Background(), test.inputRcp, editor)
 			if err != nil && err.Error() != test.expectedErr.Error() {
 				t.Errorf("expected: '%s' instead got: '%s'", test.expectedErr, err)
 			}
@@ -272,10 +359,288 @@ func TestRcp_Create(t *testing.T) {
 	}
 }
 
+func TestRcp_CreateID(t *testing.T) {
+	tests := []struct {
+		name        string
+		inputID     string
+		newID       func() (string, error)
+		expectedID  string
+		expectedErr error
+	}{
+		{
+			name:       "generated ID",
+			newID:      func() (string, error) { return "01EDGQ5K2XW4YCPMJBD3T9V7ZN", nil },
+			expectedID: "01EDGQ5K2XW4YCPMJBD3T9V7ZN",
+		},
+		{
+			name:       "client supplied ID",
+			inputID:    "654321",
+			newID:      func() (string, error) { return "", e.New("unexpected call") },
+			expectedID: "654321",
+		},
+		{
+			name:        "error input validation - invalid client supplied ID",
+			inputID:     "6543-21",
+			expectedErr: errors.NewInputError("Invalid ID format", nil),
+		},
+		{
+			name:        "error generating ID",
+			newID:       func() (string, error) { return "", e.New("entropy issue") },
+			expectedErr: errors.NewDBErr("error generating recipe ID: entropy issue"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rcpDB := &recipeDBMock{
+				createRecipe: func(recipe *recipe.Recipe) error {
+					return nil
+				},
+			}
+			rcpSvr := NewRecipe(rcpDB, search.NewInvertedIndex())
+			rcpSvr.newID = test.newID
+			rcp := &recipe.Recipe{ID: test.inputID, Name: "qwerty", PrepTime: 20, Difficulty: 3}
+			err := rcpSvr.Create(context.Background(), rcp, editor)
+			if err != nil && (test.expectedErr == nil || err.Error() != test.expectedErr.Error()) {
+				t.Errorf("expected: '%v' instead got: '%s'", test.expectedErr, err)
+			}
+			if err == nil && rcp.ID != test.expectedID {
+				t.Errorf("expected: '%s' instead got: '%s'", test.expectedID, rcp.ID)
+			}
+		})
+	}
+}
+
+func TestRcp_CreateBatch(t *testing.T) {
+	valid := func(ID string) *recipe.Recipe {
+		return &recipe.Recipe{ID: ID, Name: "qwerty " + ID, PrepTime: 20, Difficulty: 3}
+	}
+	tests := []struct {
+		name         string
+		rcpDB        recipeDBMock
+		inputRcps    []*recipe.Recipe
+		expectedErrs []error
+		expectedErr  error
+	}{
+		{
+			name: "successful create - invalid recipes are not created",
+			rcpDB: recipeDBMock{
+				createRecipes: func(rcps []*recipe.Recipe) []error {
+					if len(rcps) != 2 || rcps[0].ID != "111111" || rcps[1].ID != "333333" {
+						return []error{errors.NewDBErr("unexpected recipes"), errors.NewDBErr("unexpected recipes")}
+					}
+					if rcps[1].CreatedAt.IsZero() || rcps[1].Owner != "chef" {
+						return []error{errors.NewDBErr("unexpected recipes"), errors.NewDBErr("unexpected recipes")}
+					}
+					return []error{nil, errors.NewExistErr(true)}
+				},
+			},
+			inputRcps:    []*recipe.Recipe{valid("111111"), {ID: "222222", Name: "qwerty", PrepTime: 20}, valid("333333"), valid("44-44")},
+			expectedErrs: []error{nil, errors.NewInputError("Invalid input parameters", nil), errors.NewExistErr(true), errors.NewInputError("Invalid ID format", nil)},
+		},
+		{
+			name:         "successful create - no valid recipes",
+			inputRcps:    []*recipe.Recipe{{ID: "222222"}},
+			expectedErrs: []error{errors.NewInputError("Invalid input parameters", nil)},
+		},
+		{
+			name:        "error input validation - empty batch",
+			expectedErr: errors.NewInputError("Invalid batch", nil),
+		},
+		{
+			name:        "error input validation - too many recipes",
+			inputRcps:   make([]*recipe.Recipe, maxBatchSize+1),
+			expectedErr: errors.NewInputError("Invalid batch", nil),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			index := search.NewInvertedIndex()
+			rcpSvr := NewRecipe(&test.rcpDB, index)
+			errs, err := rcpSvr.CreateBatch(context.Background(), test.inputRcps, editor)
+			if err != nil && (test.expectedErr == nil || err.Error() != test.expectedErr.Error()) {
+				t.Fatalf("expected: '%v' instead got: '%s'", test.expectedErr, err)
+			}
+			if err == nil && test.expectedErr != nil {
+				t.Fatalf("expected: '%s' instead got nil", test.expectedErr)
+			}
+			if len(errs) != len(test.expectedErrs) {
+				t.Fatalf("expected: %d results instead got: %d", len(test.expectedErrs), len(errs))
+			}
+			for i, err := range errs {
+				if (err == nil) != (test.expectedErrs[i] == nil) || (err != nil && err.Error() != test.expectedErrs[i].Error()) {
+					t.Errorf("recipe %d expected: '%v' instead got: '%v'", i, test.expectedErrs[i], err)
+				}
+			}
+			// only the created recipes are indexed
+			for i, err := range errs {
+				indexed := len(index.Search(test.inputRcps[i].ID, 0)) > 0
+				if indexed != (err == nil) {
+					t.Errorf("recipe %d expected indexed: %t", i, err == nil)
+				}
+			}
+		})
+	}
+}
+
+func TestRcp_Export(t *testing.T) {
+	all := []*recipe.Recipe{
+		{ID: "1", Name: "Chicken curry", Difficulty: 2},
+		{ID: "2", Name: "Chicken soup", Difficulty: 1},
+		{ID: "3", Name: "Tomato soup", Difficulty: 1},
+		{ID: "4", Name: "Fish soup", Difficulty: 1},
+	}
+	var limit int
+	rcpDB := &recipeDBMock{
+		getRecipes: func(query *recipe.Query) (*recipe.Page, error) {
+			if limit == 0 {
+				limit = query.Limit
+			}
+			// two recipes per page
+			query.Limit = 2
+			return query.Apply(all), nil
+		},
+	}
+	rcpSvr := NewRecipe(rcpDB, search.NewInvertedIndex())
+
+	var IDs []string
+	err := rcpSvr.Export(context.Background(), &recipe.Query{Limit: 1, Filter: recipe.Filter{Difficulty: 1}}, func(rcp *recipe.Recipe) error {
+		IDs = append(IDs, rcp.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(IDs, []string{"2", "3", "4"}) {
+		t.Errorf("expected: '%v' instead got: '%v'", []string{"2", "3", "4"}, IDs)
+	}
+	if limit != recipe.MaxLimit {
+		t.Errorf("expected limit: %d instead got: %d", recipe.MaxLimit, limit)
+	}
+
+	stop := e.New("stop")
+	err = rcpSvr.Export(context.Background(), &recipe.Query{}, func(rcp *recipe.Recipe) error {
+		return stop
+	})
+	if err != stop {
+		t.Errorf("expected: '%v' instead got: '%v'", stop, err)
+	}
+
+	err = rcpSvr.Export(context.Background(), &recipe.Query{Sort: "unknown"}, func(rcp *recipe.Recipe) error {
+		return nil
+	})
+	if _, ok := err.(*errors.InputErr); !ok {
+		t.Errorf("expected input error instead got: '%v'", err)
+	}
+}
+
+func TestValidateRecipe(t *testing.T) {
+	valid := func() *recipe.Recipe {
+		return &recipe.Recipe{
+			ID:          "654321",
+			Name:        "qwerty",
+			PrepTime:    20,
+			Difficulty:  3,
+			Servings:    4,
+			Cuisine:     "spanish",
+			Tags:        []string{"quick"},
+			Ingredients: []recipe.Ingredient{{Name: "rice", Quantity: 400, Unit: "g"}, {Name: "salt"}},
+			Steps:       []string{"boil the rice"},
+		}
+	}
+	tests := []struct {
+		name     string
+		modify   func(rcp *recipe.Recipe)
+		expected map[string]string
+	}{
+		{
+			name:     "valid recipe",
+			modify:   func(rcp *recipe.Recipe) {},
+			expected: map[string]string{},
+		},
+		{
+			name: "valid recipe - no details",
+			modify: func(rcp *recipe.Recipe) {
+				rcp.Servings, rcp.Cuisine, rcp.Tags, rcp.Ingredients, rcp.Steps = 0, "", nil, nil, nil
+			},
+			expected: map[string]string{},
+		},
+		{
+			name: "servings out of range and cuisine too long",
+			modify: func(rcp *recipe.Recipe) {
+				rcp.Servings = -1
+				rcp.Cuisine = strings.Repeat("a", 51)
+			},
+			expected: map[string]string{errors.Servings: errors.OutOfRange, errors.Cuisine: errors.TooLong},
+		},
+		{
+			name: "invalid tags",
+			modify: func(rcp *recipe.Recipe) {
+				rcp.Tags = []string{"quick", " ", strings.Repeat("a", 31)}
+			},
+			expected: map[string]string{"tags[1]": errors.Empty, "tags[2]": errors.TooLong},
+		},
+		{
+			name: "too many tags",
+			modify: func(rcp *recipe.Recipe) {
+				rcp.Tags = make([]string, 21)
+				for i := range rcp.Tags {
+					rcp.Tags[i] = "tag"
+				}
+			},
+			expected: map[string]string{errors.Tags: errors.TooMany},
+		},
+		{
+			name: "invalid ingredients",
+			modify: func(rcp *recipe.Recipe) {
+				rcp.Ingredients = []recipe.Ingredient{{Name: ""}, {Name: "rice", Quantity: -1, Unit: strings.Repeat("g", 21)}}
+			},
+			expected: map[string]string{
+				"ingredients[0].name":     errors.Empty,
+				"ingredients[1].quantity": errors.OutOfRange,
+				"ingredients[1].unit":     errors.TooLong,
+			},
+		},
+		{
+			name: "invalid steps",
+			modify: func(rcp *recipe.Recipe) {
+				rcp.Steps = []string{"", strings.Repeat("a", 1001)}
+			},
+			expected: map[string]string{"steps[0]": errors.Empty, "steps[1]": errors.TooLong},
+		},
+		{
+			name: "too many steps",
+			modify: func(rcp *recipe.Recipe) {
+				rcp.Steps = make([]string, 101)
+				for i := range rcp.Steps {
+					rcp.Steps[i] = "step"
+				}
+			},
+			expected: map[string]string{errors.Steps: errors.TooMany},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rcp := valid()
+			test.modify(rcp)
+			if v := validateRecipe(rcp); !reflect.DeepEqual(v, test.expected) {
+				t.Errorf("expected: '%v' instead got: '%v'", test.expected, v)
+			}
+		})
+	}
+}
+
 func TestRcp_Update(t *testing.T) {
+	owned := func(recipeID string) (*recipe.Recipe, error) {
+		return &recipe.Recipe{ID: recipeID, Name: "qwerty", PrepTime: 20, Difficulty: 3, Owner: "chef"}, nil
+	}
 	tests := []struct {
 		name        string
 		ID          string
+		version     int64
+		user        *identity.Principal
 		rcpDB       recipeDBMock
 		inputRcp    *recipe.Recipe
 		expectedErr error
@@ -284,7 +649,7 @@ func TestRcp_Update(t *testing.T) {
 			name: "successful update",
 			ID:   "654321",
 			rcpDB: recipeDBMock{
-				updateRecipe: func(recipe *recipe.Recipe) error {
+				updateRecipe: func(recipe *recipe.Recipe, version int64) error {
 					return nil
 				},
 			},
@@ -325,7 +690,7 @@ func TestRcp_Update(t *testing.T) {
 			name: "error DB issue - recipe does not exist",
 			ID:   "654321",
 			rcpDB: recipeDBMock{
-				updateRecipe: func(recipe *recipe.Recipe) error {
+				updateRecipe: func(recipe *recipe.Recipe, version int64) error {
 					return errors.NewExistErr(false)
 				},
 			},
@@ -338,15 +703,281 @@ func TestRcp_Update(t *testing.T) {
 			},
 			expectedErr: errors.NewExistErr(false),
 		},
+		{
+			name:    "error DB issue - recipe modified since the given version",
+			ID:      "654321",
+			version: 3,
+			rcpDB: recipeDBMock{
+				updateRecipe: func(recipe *recipe.Recipe, version int64) error {
+					if version != 3 {
+						return errors.NewDBErr("unexpected version")
+					}
+					return errors.NewPreconditionErr()
+				},
+			},
+			inputRcp: &recipe.Recipe{
+				ID:         "654321",
+				Name:       "qwerty",
+				PrepTime:   20,
+				Difficulty: 3,
+				Vegetarian: false,
+			},
+			expectedErr: errors.NewPreconditionErr(),
+		},
+		{
+			name: "successful update - editor owning the recipe",
+			ID:   "654321",
+			user: editor,
+			rcpDB: recipeDBMock{
+				getRecipeByID: owned,
+				updateRecipe: func(recipe *recipe.Recipe, version int64) error {
+					return nil
+				},
+			},
+			inputRcp: &recipe.Recipe{ID: "654321", Name: "qwerty", PrepTime: 20, Difficulty: 3},
+		},
+		{
+			name:        "error forbidden - editor not owning the recipe",
+			ID:          "654321",
+			user:        &identity.Principal{Username: "cook", Role: identity.Editor},
+			rcpDB:       recipeDBMock{getRecipeByID: owned},
+			inputRcp:    &recipe.Recipe{ID: "654321", Name: "qwerty", PrepTime: 20, Difficulty: 3},
+			expectedErr: errors.NewForbiddenErr(),
+		},
+		{
+			name:        "error forbidden - reader",
+			ID:          "654321",
+			user:        &identity.Principal{Username: "chef", Role: identity.Reader},
+			rcpDB:       recipeDBMock{getRecipeByID: owned},
+			inputRcp:    &recipe.Recipe{ID: "654321", Name: "qwerty", PrepTime: 20, Difficulty: 3},
+			expectedErr: errors.NewForbiddenErr(),
+		},
+		{
+			name: "error DB issue - retrieving the stored recipe",
+			ID:   "654321",
+			user: editor,
+			rcpDB: recipeDBMock{
+				getRecipeByID: func(recipeID string) (*recipe.Recipe, error) {
+					return nil, errors.NewExistErr(false)
+				},
+			},
+			inputRcp:    &recipe.Recipe{ID: "654321", Name: "qwerty", PrepTime: 20, Difficulty: 3},
+			expectedErr: errors.NewExistErr(false),
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			rcpSvr := NewRecipe(&test.rcpDB)
-			err := rcpSvr.Update(test.ID, test.inputRcp)
+			user := test.user
+			if user == nil {
+				user = admin
+			}
+			rcpSvr := NewRecipe(&test.rcpDB, search.NewInvertedIndex())
+			err := rcpSvr.Update(context.Background(), test.ID, test.inputRcp, test.version, user)
 			if err != nil && err.Error() != test.expectedErr.Error() {
 				t.Errorf("expected: '%s' instead got: '%s'", test.expectedErr, err)
 			}
+			if err == nil && test.expectedErr != nil {
+				t.Errorf("expected: '%s' instead got nil", test.expectedErr)
+			}
+		})
+	}
+}
+
+func TestRcp_Patch(t *testing.T) {
+	stored := func(recipeID string) (*recipe.Recipe, error) {
+		return &recipe.Recipe{ID: "654321", Name: "Chicken curry", PrepTime: 30, Difficulty: 2, Tags: []string{"spicy"},
+			AverageRating: 4, RatingCount: 1, Version: 2}, nil
+	}
+	// patchRecipe - the stored recipe is at version 2
+	patchRecipe := func(rcp *recipe.Recipe, fields []string, version int64) error {
+		if version != 2 {
+			return errors.NewPreconditionErr()
+		}
+		rcp.Version = 3
+		return nil
+	}
+	mergePatch := func(body string) patch.Patch {
+		p, err := patch.NewMergePatch([]byte(body))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return p
+	}
+	jsonPatch := func(body string) patch.Patch {
+		p, err := patch.NewJSONPatch([]byte(body))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return p
+	}
+	tests := []struct {
+		name           string
+		rcpDB          recipeDBMock
+		patch          patch.Patch
+		version        int64
+		user           *identity.Principal
+		expectedFields []string
+		expectedRcp    *recipe.Recipe
+		expectedErr    error
+	}{
+		{
+			name:           "successful merge patch",
+			rcpDB:          recipeDBMock{getRecipeByID: stored, patchRecipe: patchRecipe},
+			patch:          mergePatch(`{"name":"Beef stew","tags":null,"servings":4}`),
+			expectedFields: []string{recipe.FieldName, recipe.FieldServings, recipe.FieldTags},
+			expectedRcp: &recipe.Recipe{ID: "654321", Name: "Beef stew", PrepTime: 30, Difficulty: 2, Servings: 4,
+				AverageRating: 4, RatingCount: 1, Version: 3},
+		},
+		{
+			name:           "successful JSON patch - matching version",
+			rcpDB:          recipeDBMock{getRecipeByID: stored, patchRecipe: patchRecipe},
+			patch:          jsonPatch(`[{"op":"test","path":"/tags/0","value":"spicy"},{"op":"add","path":"/tags/-","value":"indian"}]`),
+			version:        2,
+			expectedFields: []string{recipe.FieldTags},
+			expectedRcp: &recipe.Recipe{ID: "654321", Name: "Chicken curry", PrepTime: 30, Difficulty: 2,
+				Tags: []string{"spicy", "indian"}, AverageRating: 4, RatingCount: 1, Version: 3},
+		},
+		{
+			name:  "successful patch - read only fields are kept, nothing to write",
+			rcpDB: recipeDBMock{getRecipeByID: stored},
+			patch: mergePatch(`{"averageRating":1,"version":9}`),
+			expectedRcp: &recipe.Recipe{ID: "654321", Name: "Chicken curry", PrepTime: 30, Difficulty: 2,
+				Tags: []string{"spicy"}, AverageRating: 4, RatingCount: 1, Version: 2},
+		},
+		{
+			name: "successful patch - retried while the recipe is modified in between",
+			rcpDB: func() recipeDBMock {
+				attempts := 0
+				return recipeDBMock{
+					getRecipeByID: stored,
+					patchRecipe: func(rcp *recipe.Recipe, fields []string, version int64) error {
+						if attempts++; attempts < maxPatchAttempts {
+							return errors.NewPreconditionErr()
+						}
+						return patchRecipe(rcp, fields, version)
+					},
+				}
+			}(),
+			patch:          mergePatch(`{"prepTime":45}`),
+			expectedFields: []string{recipe.FieldPrepTime},
+			expectedRcp: &recipe.Recipe{ID: "654321", Name: "Chicken curry", PrepTime: 45, Difficulty: 2,
+				Tags: []string{"spicy"}, AverageRating: 4, RatingCount: 1, Version: 3},
+		},
+		{
+			name: "error - recipe keeps being modified",
+			rcpDB: recipeDBMock{
+				getRecipeByID: stored,
+				patchRecipe: func(rcp *recipe.Recipe, fields []string, version int64) error {
+					return errors.NewPreconditionErr()
+				},
+			},
+			patch:       mergePatch(`{"prepTime":45}`),
+			expectedErr: errors.NewPreconditionErr(),
+		},
+		{
+			name: "successful patch - editor owning the recipe",
+			rcpDB: recipeDBMock{
+				getRecipeByID: func(recipeID string) (*recipe.Recipe, error) {
+					rcp, err := stored(recipeID)
+					rcp.Owner = "chef"
+					return rcp, err
+				},
+				patchRecipe: patchRecipe,
+			},
+			patch:          mergePatch(`{"prepTime":45,"owner":"admin"}`),
+			user:           editor,
+			expectedFields: []string{recipe.FieldPrepTime},
+			expectedRcp: &recipe.Recipe{ID: "654321", Name: "Chicken curry", PrepTime: 45, Difficulty: 2,
+				Tags: []string{"spicy"}, AverageRating: 4, RatingCount: 1, Version: 3, Owner: "chef"},
+		},
+		{
+			name:        "error - editor not owning the recipe",
+			rcpDB:       recipeDBMock{getRecipeByID: stored},
+			patch:       mergePatch(`{"prepTime":45}`),
+			user:        editor,
+			expectedErr: errors.NewForbiddenErr(),
+		},
+		{
+			name:        "error - version mismatch",
+			rcpDB:       recipeDBMock{getRecipeByID: stored},
+			patch:       mergePatch(`{"prepTime":45}`),
+			version:     1,
+			expectedErr: errors.NewPreconditionErr(),
+		},
+		{
+			name:        "error - ID can not be patched",
+			rcpDB:       recipeDBMock{getRecipeByID: stored},
+			patch:       mergePatch(`{"ID":"123456"}`),
+			expectedErr: errors.NewInputError("ID can not be patched", nil),
+		},
+		{
+			name:        "error - invalid outcome",
+			rcpDB:       recipeDBMock{getRecipeByID: stored},
+			patch:       mergePatch(`{"difficulty":10}`),
+			expectedErr: errors.NewInputError("Invalid input parameters", nil),
+		},
+		{
+			name:        "error - unknown field",
+			rcpDB:       recipeDBMock{getRecipeByID: stored},
+			patch:       mergePatch(`{"color":"red"}`),
+			expectedErr: errors.NewInputError("Invalid patch", nil),
+		},
+		{
+			name:        "error - failed JSON patch test",
+			rcpDB:       recipeDBMock{getRecipeByID: stored},
+			patch:       jsonPatch(`[{"op":"test","path":"/name","value":"Beef stew"}]`),
+			expectedErr: errors.NewInputError("Invalid patch", nil),
+		},
+		{
+			name: "error - recipe does not exist",
+			rcpDB: recipeDBMock{
+				getRecipeByID: func(recipeID string) (*recipe.Recipe, error) {
+					return nil, errors.NewExistErr(false)
+				},
+			},
+			patch:       mergePatch(`{"prepTime":45}`),
+			expectedErr: errors.NewExistErr(false),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var fields []string
+			if test.rcpDB.patchRecipe != nil {
+				patchRecipe := test.rcpDB.patchRecipe
+				test.rcpDB.patchRecipe = func(rcp *recipe.Recipe, f []string, version int64) error {
+					fields = f
+					return patchRecipe(rcp, f, version)
+				}
+			}
+			index := search.NewInvertedIndex()
+			rcpSvr := NewRecipe(&test.rcpDB, index)
+			user := test.user
+			if user == nil {
+				user = admin
+			}
+			rcp, err := rcpSvr.Patch(context.Background(), "654321", test.patch, test.version, user)
+			if err != nil && err.Error() != test.expectedErr.Error() {
+				t.Errorf("expected: '%s' instead got: '%s'", test.expectedErr, err)
+			}
+			if err == nil && test.expectedErr != nil {
+				t.Errorf("expected: '%s' instead got nil", test.expectedErr)
+			}
+			if err != nil {
+				return
+			}
+			rcp.UpdatedAt = test.expectedRcp.UpdatedAt
+			if !reflect.DeepEqual(rcp, test.expectedRcp) {
+				t.Errorf("expected: '%v' instead got: '%v'", test.expectedRcp, rcp)
+			}
+			if !reflect.DeepEqual(fields, test.expectedFields) {
+				t.Errorf("expected: '%v' written fields instead got: '%v'", test.expectedFields, fields)
+			}
+			// the index follows the written recipe
+			if len(fields) > 0 && !reflect.DeepEqual(index.Search(rcp.Name, 0), []string{rcp.ID}) {
+				t.Errorf("expected patched recipe to be indexed")
+			}
 		})
 	}
 }
@@ -356,12 +987,14 @@ func TestRcp_Delete(t *testing.T) {
 		name        string
 		rcpDB       recipeDBMock
 		inputRcpID  string
+		version     int64
+		user        *identity.Principal
 		expectedErr error
 	}{
 		{
 			name: "successful delete",
 			rcpDB: recipeDBMock{
-				deleteRecipe: func(recipeId string) error {
+				deleteRecipe: func(recipeId string, version int64) error {
 					return nil
 				},
 			},
@@ -371,22 +1004,233 @@ func TestRcp_Delete(t *testing.T) {
 		{
 			name: "error DB issue - DB connection error ",
 			rcpDB: recipeDBMock{
-				deleteRecipe: func(recipeId string) error {
+				deleteRecipe: func(recipeId string, version int64) error {
 					return errors.NewDBErr("error DB connection")
 				},
 			},
 			inputRcpID:  "654321",
 			expectedErr: errors.NewDBErr("error DB connection"),
 		},
+		{
+			name: "error DB issue - recipe modified since the given version",
+			rcpDB: recipeDBMock{
+				deleteRecipe: func(recipeId string, version int64) error {
+					if version != 2 {
+						return errors.NewDBErr("unexpected version")
+					}
+					return errors.NewPreconditionErr()
+				},
+			},
+			inputRcpID:  "654321",
+			version:     2,
+			expectedErr: errors.NewPreconditionErr(),
+		},
+		{
+			name: "successful delete - editor owning the recipe",
+			rcpDB: recipeDBMock{
+				getRecipeByID: func(recipeID string) (*recipe.Recipe, error) {
+					return &recipe.Recipe{ID: recipeID, Owner: "chef"}, nil
+				},
+				deleteRecipe: func(recipeId string, version int64) error {
+					return nil
+				},
+			},
+			inputRcpID: "654321",
+			user:       editor,
+		},
+		{
+			name: "error forbidden - recipe without owner",
+			rcpDB: recipeDBMock{
+				getRecipeByID: func(recipeID string) (*recipe.Recipe, error) {
+					return &recipe.Recipe{ID: recipeID}, nil
+				},
+			},
+			inputRcpID:  "654321",
+			user:        editor,
+			expectedErr: errors.NewForbiddenErr(),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			user := test.user
+			if user == nil {
+				user = admin
+			}
+			rcpSvr := NewRecipe(&test.rcpDB, search.NewInvertedIndex())
+			err := rcpSvr.Delete(context.Background(), test.inputRcpID, test.version, user)
+			if err != nil && err.Error() != test.expectedErr.Error() {
+				t.Errorf("expected: '%s' instead got: '%s'", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestRcp_Search(t *testing.T) {
+	stored := map[string]*recipe.Recipe{
+		"1": {ID: "1", Name: "Chicken curry", PrepTime: 30, Difficulty: 2},
+		"2": {ID: "2", Name: "Chicken chicken soup", PrepTime: 20, Difficulty: 1},
+		"3": {ID: "3", Name: "Tomato soup", PrepTime: 15, Difficulty: 1},
+	}
+	getRecipeByID := func(recipeId string) (*recipe.Recipe, error) {
+		if rcp, ok := stored[recipeId]; ok {
+			return rcp, nil
+		}
+		return nil, errors.NewExistErr(false)
+	}
+	tests := []struct {
+		name         string
+		rcpDB        recipeDBMock
+		indexed      []*recipe.Recipe
+		text         string
+		limit        int
+		expectedRcps []*recipe.Recipe
+		expectedErr  error
+	}{
+		{
+			name:         "successful search - ranked results",
+			rcpDB:        recipeDBMock{getRecipeByID: getRecipeByID},
+			indexed:      []*recipe.Recipe{stored["1"], stored["2"], stored["3"]},
+			text:         "chick",
+			expectedRcps: []*recipe.Recipe{stored["2"], stored["1"]},
+		},
+		{
+			name:         "successful search - limited",
+			rcpDB:        recipeDBMock{getRecipeByID: getRecipeByID},
+			indexed:      []*recipe.Recipe{stored["1"], stored["2"], stored["3"]},
+			text:         "soup",
+			limit:        1,
+			expectedRcps: []*recipe.Recipe{stored["2"]},
+		},
+		{
+			name:         "successful search - indexed recipe no longer stored",
+			rcpDB:        recipeDBMock{getRecipeByID: getRecipeByID},
+			indexed:      []*recipe.Recipe{stored["3"], {ID: "4", Name: "Onion soup"}},
+			text:         "soup",
+			expectedRcps: []*recipe.Recipe{stored["3"]},
+		},
+		{
+			name:         "successful search - no matches",
+			rcpDB:        recipeDBMock{},
+			indexed:      []*recipe.Recipe{stored["1"]},
+			text:         "pizza",
+			expectedRcps: []*recipe.Recipe{},
+		},
+		{
+			name:        "error input - missing text",
+			rcpDB:       recipeDBMock{},
+			text:        " - ",
+			expectedErr: errors.NewInputError("Invalid query parameters", map[string]string{errors.SearchText: errors.MissingText}),
+		},
+		{
+			name:        "error input - limit out of range",
+			rcpDB:       recipeDBMock{},
+			text:        "soup",
+			limit:       recipe.MaxLimit + 1,
+			expectedErr: errors.NewInputError("Invalid query parameters", map[string]string{errors.Limit: errors.OutOfRange}),
+		},
+		{
+			name: "error DB issue - DB connection error",
+			rcpDB: recipeDBMock{
+				getRecipeByID: func(recipeId string) (*recipe.Recipe, error) {
+					return nil, errors.NewDBErr("error DB connection")
+				},
+			},
+			indexed:     []*recipe.Recipe{stored["3"]},
+			text:        "soup",
+			expectedErr: errors.NewDBErr("error DB connection"),
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			rcpSvr := NewRecipe(&test.rcpDB)
-			err := rcpSvr.Delete(test.inputRcpID)
+			index := search.NewInvertedIndex()
+			for _, rcp := range test.indexed {
+				index.Index(rcp)
+			}
+			rcpSvr := NewRecipe(&test.rcpDB, index)
+			rcps, err := rcpSvr.Search(context.Background(), test.text, test.limit)
 			if err != nil && err.Error() != test.expectedErr.Error() {
 				t.Errorf("expected: '%s' instead got: '%s'", test.expectedErr, err)
 			}
+			if err == nil && !reflect.DeepEqual(rcps, test.expectedRcps) {
+				t.Errorf("expected: '%v' instead got: '%v'", test.expectedRcps, rcps)
+			}
 		})
 	}
 }
+
+func TestRcp_SearchIndexUpdates(t *testing.T) {
+	rcpDB := &recipeDBMock{
+		createRecipe: func(recipe *recipe.Recipe) error {
+			return nil
+		},
+		updateRecipe: func(recipe *recipe.Recipe, version int64) error {
+			return nil
+		},
+		deleteRecipe: func(recipeId string, version int64) error {
+			return nil
+		},
+	}
+	index := search.NewInvertedIndex()
+	rcpSvr := NewRecipe(rcpDB, index)
+
+	if err := rcpSvr.Create(context.Background(), &recipe.Recipe{ID: "1", Name: "Chicken curry", PrepTime: 30, Difficulty: 2}, admin); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if IDs := index.Search("curry", 0); !reflect.DeepEqual(IDs, []string{"1"}) {
+		t.Errorf("expected created recipe to be indexed instead got: '%v'", IDs)
+	}
+	if err := rcpSvr.Update(context.Background(), "1", &recipe.Recipe{ID: "1", Name: "Beef stew", PrepTime: 30, Difficulty: 2}, 0, admin); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if IDs := index.Search("curry", 0); len(IDs) != 0 {
+		t.Errorf("expected updated recipe to be re-indexed instead got: '%v'", IDs)
+	}
+	if err := rcpSvr.Delete(context.Background(), "1", 0, admin); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if IDs := index.Search("beef", 0); len(IDs) != 0 {
+		t.Errorf("expected deleted recipe to be removed instead got: '%v'", IDs)
+	}
+
+	// failed writes leave the index untouched
+	rcpDB.createRecipe = func(recipe *recipe.Recipe) error {
+		return errors.NewDBErr("error DB connection")
+	}
+	if err := rcpSvr.Create(context.Background(), &recipe.Recipe{ID: "2", Name: "Tomato soup", PrepTime: 15, Difficulty: 1}, admin); err == nil {
+		t.Fatalf("expected error instead got nil")
+	}
+	if IDs := index.Search("soup", 0); len(IDs) != 0 {
+		t.Errorf("expected recipe not to be indexed instead got: '%v'", IDs)
+	}
+}
+
+func TestRcp_BuildIndex(t *testing.T) {
+	all := []*recipe.Recipe{
+		{ID: "1", Name: "Chicken curry"},
+		{ID: "2", Name: "Chicken soup"},
+		{ID: "3", Name: "Tomato soup"},
+	}
+	rcpDB := &recipeDBMock{
+		getRecipes: func(query *recipe.Query) (*recipe.Page, error) {
+			// two recipes per page
+			query.Limit = 2
+			return query.Apply(all), nil
+		},
+	}
+	index := search.NewInvertedIndex()
+	if err := NewRecipe(rcpDB, index).BuildIndex(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if IDs := index.Search("soup", 0); !reflect.DeepEqual(IDs, []string{"2", "3"}) {
+		t.Errorf("expected: '%v' instead got: '%v'", []string{"2", "3"}, IDs)
+	}
+
+	rcpDB.getRecipes = func(query *recipe.Query) (*recipe.Page, error) {
+		return nil, errors.NewDBErr("error DB connection")
+	}
+	if err := NewRecipe(rcpDB, search.NewInvertedIndex()).BuildIndex(); err == nil {
+		t.Errorf("expected error instead got nil")
+	}
+}
@@ -0,0 +1,140 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlphttp"
+	"go.opentelemetry.io/otel/exporters/stdout"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/rnov/Go-REST/pkg/config"
+	"github.com/rnov/Go-REST/pkg/errors"
+)
+
+// exporters the spans can be sent to, see config.TracingConfig.
+const (
+	None   = "none"
+	Stdout = "stdout"
+	OTLP   = "otlp"
+)
+
+// defaults of the settings left empty in config.TracingConfig.
+const (
+	defaultEndpoint    = "localhost:4318"
+	defaultServiceName = "gorest"
+)
+
+// instrumentation - name the spans of the API are reported under.
+const instrumentation = "github.com/rnov/Go-REST"
+
+// Provider - exports the spans started by Start, until shut down.
+type Provider struct {
+	tp *sdktrace.TracerProvider
+}
+
+// NewProvider - sets up the exporter configured by cfg as the one of the spans started from then on. Trace context is
+// propagated as given by W3C Trace Context (traceparent and tracestate headers) whatever the exporter.
+func NewProvider(cfg config.TracingConfig) (*Provider, error) {
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return nil, fmt.Errorf("sample ratio must be between 0 and 1, instead got %v", cfg.SampleRatio)
+	}
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch strings.ToLower(cfg.Exporter) {
+	case "", None:
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+		return &Provider{}, nil
+	case Stdout:
+		exporter, err = stdout.NewExporter(stdout.WithWriter(os.Stdout), stdout.WithoutMetricExport())
+	case OTLP:
+		endpoint := cfg.Endpoint
+		if len(endpoint) == 0 {
+			endpoint = defaultEndpoint
+		}
+		opts := []otlphttp.Option{otlphttp.WithEndpoint(endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlphttp.WithInsecure())
+		}
+		exporter, err = otlp.NewExporter(context.Background(), otlphttp.NewDriver(opts...))
+	default:
+		return nil, fmt.Errorf("unsupported tracing exporter '%s'", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p := newProvider(cfg, exporter)
+	otel.SetTracerProvider(p.tp)
+	return p, nil
+}
+
+// newProvider - provider of the spans exported in batches by exporter.
+func newProvider(cfg config.TracingConfig, exporter sdktrace.SpanExporter) *Provider {
+	ratio := cfg.SampleRatio
+	if ratio == 0 {
+		ratio = 1
+	}
+	name := cfg.ServiceName
+	if len(name) == 0 {
+		name = defaultServiceName
+	}
+	return &Provider{tp: sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.ServiceNameKey.String(name))),
+	)}
+}
+
+// Shutdown - exports the spans not exported yet, until ctx is done.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	if p.tp == nil {
+		return nil
+	}
+	return p.tp.Shutdown(ctx)
+}
+
+// Start - starts a span named name, as a child of the span of ctx if any, which is passed on through the returned
+// context. The span has to be ended by End.
+func Start(ctx context.Context, name string, opts ...trace.SpanOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentation).Start(ctx, name, opts...)
+}
+
+// Extract - ctx along with the trace context propagated by the client in the headers of the request, if any, spans
+// started from it continue the trace of the client.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// TraceID - ID of the trace the span of ctx belongs to, empty when there is none or it is not recorded.
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+// End - ends the span, which is flagged as failed whenever err is a system error, i.e. one that would be logged (see
+// errors.StatusCode). Expected outcomes, e.g. a recipe that does not exist, are not.
+func End(span trace.Span, err error) {
+	if err != nil {
+		if _, toLog := errors.StatusCode("", err); toLog {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+	span.End()
+}
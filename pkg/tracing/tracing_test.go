@@ -0,0 +1,147 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/rnov/Go-REST/pkg/config"
+	"github.com/rnov/Go-REST/pkg/errors"
+)
+
+// record - spans started from then on are exported as soon as they end.
+func record(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() { tp.Shutdown(context.Background()) })
+	return exporter
+}
+
+func TestNewProvider(t *testing.T) {
+	tests := map[string]struct {
+		cfg         config.TracingConfig
+		expectedErr bool
+	}{
+		"disabled by default": {
+			cfg: config.TracingConfig{},
+		},
+		"none": {
+			cfg: config.TracingConfig{Exporter: "none"},
+		},
+		"stdout": {
+			cfg: config.TracingConfig{Exporter: "stdout", SampleRatio: 0.5},
+		},
+		"otlp": {
+			cfg: config.TracingConfig{Exporter: "OTLP", Endpoint: "collector:4318", Insecure: true, ServiceName: "api"},
+		},
+		"unknown exporter": {
+			cfg:         config.TracingConfig{Exporter: "zipkin"},
+			expectedErr: true,
+		},
+		"sample ratio above 1": {
+			cfg:         config.TracingConfig{Exporter: "stdout", SampleRatio: 1.5},
+			expectedErr: true,
+		},
+		"negative sample ratio": {
+			cfg:         config.TracingConfig{SampleRatio: -0.1},
+			expectedErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := NewProvider(test.cfg)
+			if test.expectedErr {
+				if err == nil {
+					t.Errorf("expected error, instead got provider: '%v'", p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: '%s'", err.Error())
+			}
+			if err := p.Shutdown(context.Background()); err != nil {
+				t.Errorf("unexpected error shutting down: '%s'", err.Error())
+			}
+		})
+	}
+}
+
+func TestEnd(t *testing.T) {
+	tests := map[string]struct {
+		err            error
+		expectedStatus codes.Code
+		expectedEvents int
+	}{
+		"success": {
+			expectedStatus: codes.Unset,
+		},
+		"system error": {
+			err:            errors.NewDBErr("connection refused"),
+			expectedStatus: codes.Error,
+			expectedEvents: 1,
+		},
+		"expected outcome": {
+			err:            errors.NewExistErr(false),
+			expectedStatus: codes.Unset,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			exporter := record(t)
+			_, span := Start(context.Background(), "service.Recipe.GetByID")
+			End(span, test.err)
+
+			spans := exporter.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("expected a single span, instead got: '%d'", len(spans))
+			}
+			if spans[0].StatusCode != test.expectedStatus {
+				t.Errorf("expected status: '%v' instead got: '%v'", test.expectedStatus, spans[0].StatusCode)
+			}
+			if len(spans[0].MessageEvents) != test.expectedEvents {
+				t.Errorf("expected %d events, instead got: '%v'", test.expectedEvents, spans[0].MessageEvents)
+			}
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	// the propagator is set up regardless of the exporter
+	if _, err := NewProvider(config.TracingConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	exporter := record(t)
+
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, parent := Start(Extract(context.Background(), header), "GET /recipes")
+	if traceID := TraceID(ctx); traceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected the trace of the client, instead got: '%s'", traceID)
+	}
+	_, child := Start(ctx, "service.Recipe.List")
+	End(child, nil)
+	End(parent, nil)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, instead got: '%d'", len(spans))
+	}
+	if spans[0].Parent.SpanID() != spans[1].SpanContext.SpanID() {
+		t.Errorf("expected '%s' to be the child of '%s'", spans[0].Name, spans[1].Name)
+	}
+	if spans[1].Parent.SpanID().String() != "00f067aa0ba902b7" || !spans[1].Parent.IsRemote() {
+		t.Errorf("expected the span of the client to be the parent, instead got: '%v'", spans[1].Parent)
+	}
+
+	if traceID := TraceID(context.Background()); len(traceID) > 0 {
+		t.Errorf("expected no trace, instead got: '%s'", traceID)
+	}
+}
@@ -1 +1,3 @@
-cat source.txt | redis-cli -p 6379
\ No newline at end of file
+cat source.txt | redis-cli -p 6379
+# recipes written straight into redis are not indexed, the indexes are rebuilt on the next start once IDX_RECIPE_ID is gone
+redis-cli -p 6379 DEL IDX_RECIPE_ID
\ No newline at end of file
@@ -1,51 +1,44 @@
 package main
 
 import (
-	"crypto/sha256"
-	b64 "encoding/base64"
+	"bufio"
+	"flag"
 	"fmt"
-)
+	"os"
+	"strings"
 
-type basicAuth struct {
-	user string
-	pwd  string
-	ba64 string
-	hash string
-}
+	"github.com/rnov/Go-REST/pkg/auth"
+)
 
-// script that generates Basic Auth and prints the its values
+// script that hashes a user's password read from the standard input and prints the commands storing it, e.g.
+// echo -n 'A&BEtr*!n^51' | go run ./tools/authgenerator -user admin
 func main() {
-	baList := []basicAuth{
-		{
-			user: "username",
-			pwd:  "password",
-		},
-		{
-			user: "admin",
-			pwd:  "A&BEtr*!n^51",
-		},
-		{
-			user: "chef-1",
-			pwd:  "I49Zq!0Pqc",
-		},
+	user := flag.String("user", "", "username the password belongs to")
+	algorithm := flag.String("algorithm", auth.Argon2id, "password hashing algorithm, argon2id or bcrypt")
+	flag.Parse()
+	if len(*user) == 0 {
+		fmt.Fprintln(os.Stderr, "the -user flag is required")
+		os.Exit(2)
 	}
 
-	for i, ba := range baList {
-		aux := ba.user + ":" + ba.pwd
-		ba64 := b64.StdEncoding.EncodeToString([]byte(aux))
-		hash := hash(ba64)
-		baList[i].ba64 = ba64
-		baList[i].hash = hash
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && len(password) == 0 {
+		fmt.Fprintf(os.Stderr, "error reading the password: %s\n", err)
+		os.Exit(1)
 	}
-
-	for _, ba := range baList {
-		fmt.Println("username: " + ba.user + " password: " + ba.pwd + " base64: " + ba.ba64 + " hash: " + ba.hash)
+	password = strings.TrimRight(password, "\r\n")
+	if len(password) == 0 {
+		fmt.Fprintln(os.Stderr, "the password can not be empty")
+		os.Exit(2)
 	}
-}
-
-func hash(ba string) string {
-	h := sha256.New()
-	h.Write([]byte(ba))
 
-	return fmt.Sprintf("%x", h.Sum(nil))
+	hash, err := auth.HashPassword(password, *algorithm)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error hashing the password: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("hash: " + hash)
+	fmt.Printf("redis: HSET USER_%s password '%s'\n", *user, hash)
+	fmt.Printf("postgres: INSERT INTO users (username, password_hash) VALUES ('%s', '%s') ON CONFLICT (username) "+
+		"DO UPDATE SET password_hash = EXCLUDED.password_hash;\n", strings.ReplaceAll(*user, "'", "''"), hash)
 }